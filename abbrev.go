@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// abbreviations returns the short names which the name could abbreviate,
+// best first. A name abbreviates a short name if it starts with the same
+// character, and its other characters all appear in the short name in
+// order, so "sc" abbreviates "staticcheck". The prefix given by the list is
+// left off, unless the name has one itself.
+func abbreviations(links map[string]Link, name string) []string {
+	type match struct {
+		short string
+		score int
+	}
+	var matches []match
+	for short := range links {
+		full := short
+		if i := strings.LastIndexByte(short, '/'); i >= 0 && !strings.Contains(name, "/") {
+			short = short[i+1:]
+		}
+		if name == "" || short == "" || name[0] != short[0] {
+			continue
+		}
+		if score, ok := fuzzyScore(name, short); ok {
+			matches = append(matches, match{full, score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].short < matches[j].short
+	})
+	shorts := make([]string, len(matches))
+	for i, m := range matches {
+		shorts[i] = m.short
+	}
+	return shorts
+}
+
+// answeredAbbreviations remembers which link was chosen for each ambiguous
+// abbreviation, so that nobody is asked twice.
+var answeredAbbreviations = make(map[string]Link)
+
+// expandAbbreviation returns the link the name abbreviates, if --fuzzy is
+// set. Where the name could abbreviate several, which was meant is asked
+// for if there is a terminal to ask at; otherwise it is left ambiguous, so
+// that scripts never depend on the answer.
+func expandAbbreviation(links map[string]Link, name string) (Link, bool) {
+	if !*flagFuzzy {
+		return Link{}, false
+	}
+	if link, ok := answeredAbbreviations[name]; ok {
+		return link, true
+	}
+	shorts := abbreviations(links, name)
+	switch {
+	case len(shorts) == 1:
+		return links[shorts[0]], true
+	case len(shorts) == 0 || !isTerminal(os.Stdin) || !isTerminal(os.Stderr):
+		return Link{}, false
+	}
+
+	w := tabwriter.NewWriter(os.Stderr, 1, 4, 2, ' ', 0)
+	for i, short := range shorts {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", i+1, short, links[short].Pkg)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "%s could be any of these, which? [1-%d, or enter for none]: ", name, len(shorts))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return Link{}, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil || n < 1 || n > len(shorts) {
+		return Link{}, false
+	}
+	answeredAbbreviations[name] = links[shorts[n-1]]
+	return links[shorts[n-1]], true
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// validateAlias validates the target of an alias: a short name, which may
+// have a prefix such as "go/", and optionally a version. The first element of
+// a module path must contain a dot, so the target of an alias must not, so
+// that a module path is never taken for one.
+func validateAlias(target string) bool {
+	short, version, hasVersion := strings.Cut(target, "@")
+	if hasVersion && version == "" || strings.Contains(short, ".") {
+		return false
+	}
+	for _, elem := range strings.Split(short, "/") {
+		if !validateShort(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveAliases resolves each link which is an alias of another, following
+// aliases of aliases, so that every link has a package. An alias takes its
+// package from the link it is an alias of, at its own version if it has
+// one, and layers itself over that link: its default arguments and
+// environment variables come after that link's, and anything else it does
+// not set itself is that link's.
+//
+// The short name an alias is of is looked for with the prefix of the
+// alias's list first, so that links in a list can be aliases of each other,
+// and then without it, so that "golangci-lint" in team.list can be an alias
+// of the embedded "golangci-lint", layering the team's conventions over it.
+//
+// Aliases are resolved once every source has been loaded, and versions
+// overridden, so that an alias in one list can build on a link in another,
+// and follows it wherever it is pinned.
+func resolveAliases(links map[string]Link) error {
+	shorts := make([]string, 0, len(links))
+	for short, link := range links {
+		if link.Alias != "" {
+			shorts = append(shorts, short)
+		}
+	}
+	sort.Strings(shorts)
+	resolved := make(map[string]Link)
+	for _, short := range shorts {
+		link, err := resolveAlias(links, resolved, short, nil)
+		if err != nil {
+			return err
+		}
+		links[short] = link
+	}
+	return nil
+}
+
+// relativeShort returns the short name of the link which the link refers to
+// by name, such as the link it is an alias of: the name with the prefix of
+// the link's list, if there is such a link other than this one, or else the
+// name as it is.
+func relativeShort(links map[string]Link, link Link, name string) string {
+	if prefix, _ := listPrefix(link.ListFile()); prefix != "" && prefix+name != link.Short {
+		if _, ok := links[prefix+name]; ok {
+			return prefix + name
+		}
+	}
+	return name
+}
+
+// resolveAlias resolves the alias of the short name, remembering each alias
+// it resolves along the way. chain are the aliases which led to this one, so
+// that an alias which would lead back to itself is caught.
+func resolveAlias(links, resolved map[string]Link, short string, chain []string) (Link, error) {
+	link := links[short]
+	if link.Alias == "" {
+		return link, nil
+	}
+	if done, ok := resolved[short]; ok {
+		return done, nil
+	}
+	for _, s := range chain {
+		if s == short {
+			return Link{}, fmt.Errorf("link %s in %s: alias cycle: %s -> %s", short, link.Origin(), strings.Join(chain, " -> "), short)
+		}
+	}
+	targetShort, version, _ := strings.Cut(link.Alias, "@")
+	targetShort = relativeShort(links, link, targetShort)
+	if _, ok := links[targetShort]; !ok {
+		return Link{}, fmt.Errorf("link %s in %s: alias of unknown short name: %s", short, link.Origin(), targetShort)
+	}
+	target, err := resolveAlias(links, resolved, targetShort, append(chain[:len(chain):len(chain)], short))
+	if err != nil {
+		return Link{}, err
+	}
+
+	pkgPath, targetVersion, _ := strings.Cut(target.Pkg, "@")
+	if version == "" {
+		version = targetVersion
+	}
+	link.Pkg = pkgPath + "@" + version
+	if link.Desc == "" {
+		link.Desc = target.Desc
+	}
+	if len(link.Tags) == 0 {
+		link.Tags = target.Tags
+	}
+	if link.Post == "" {
+		link.Post = target.Post
+	}
+	link.Args = append(target.Args[:len(target.Args):len(target.Args)], link.Args...)
+	link.Env = append(target.Env[:len(target.Env):len(target.Env)], link.Env...)
+	link.BuildEnv = append(target.BuildEnv[:len(target.BuildEnv):len(target.BuildEnv)], link.BuildEnv...)
+	link.BuildTags = append(target.BuildTags[:len(target.BuildTags):len(target.BuildTags)], link.BuildTags...)
+	if link.Ldflags == "" {
+		link.Ldflags = target.Ldflags
+	}
+	if len(link.GOOS) == 0 {
+		link.GOOS = target.GOOS
+	}
+	if len(link.GOARCH) == 0 {
+		link.GOARCH = target.GOARCH
+	}
+	resolved[short] = link
+	return link, nil
+}
+
+// userListsDir returns the directory of the user's own lists, within va's
+// configuration directory.
+func userListsDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lists"), nil
+}
+
+// userListFile returns the list file, relative to the user's lists
+// directory, which a link of the short name is kept in by va alias, along
+// with its short name within the file: "team/lint" is "lint" in team.list,
+// and "lint" is in _.list, whose links have no prefix.
+func userListFile(short string) (file, name string) {
+	prefix, name := "_", short
+	if i := strings.LastIndexByte(short, '/'); i >= 0 {
+		prefix, name = short[:i], short[i+1:]
+	}
+	return prefix + ".list", name
+}
+
+// UserList is one of the user's own list files, as va alias edits it, line
+// by line, so that everything but the lines it changes is kept as it was.
+type UserList struct {
+	Dir    string // The lists directory, such as the user's.
+	File   string // Path of the list file within Dir, with slashes.
+	Source string // Name of the source Dir is, such as "user".
+	Lines  []string
+}
+
+// readUserList reads the user's list file, which need not exist yet.
+func readUserList(file string) (*UserList, error) {
+	dir, err := userListsDir()
+	if err != nil {
+		return nil, err
+	}
+	return readListLines(dir, file, "user")
+}
+
+// readListLines reads the list file within the lists directory of the
+// source, which need not exist yet, as readUserList does the user's.
+func readListLines(dir, file, source string) (*UserList, error) {
+	list := &UserList{Dir: dir, File: file, Source: source}
+	b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list.Lines = strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	return list, nil
+}
+
+// Find returns the index of the line which defines the link of the short
+// name, without the list's prefix, or -1 if none does.
+func (l *UserList) Find(name string) int {
+	for i, line := range l.Lines {
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "@include ") {
+			continue
+		}
+		if parsed, err := parseListLine(line); err == nil && parsed.Short == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Check checks the list as va checks every list when it starts, and that
+// each alias in it is of a link which exists, given the other links.
+func (l *UserList) Check(links map[string]Link) error {
+	prefix, _ := listPrefix(l.File)
+	fileLinks, err := readListFrom(os.DirFS(l.Dir), strings.NewReader(strings.Join(l.Lines, "\n")), l.File, prefix, nil)
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]Link, len(links)+len(fileLinks))
+	for short, link := range links {
+		merged[short] = link
+	}
+	for _, link := range fileLinks {
+		link.Source = l.Source
+		merged[link.Short] = link
+	}
+	return resolveAliases(merged)
+}
+
+// Write writes the list back, once it has been checked.
+func (l *UserList) Write() error {
+	name := filepath.Join(l.Dir, filepath.FromSlash(l.File))
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	var b []byte
+	if len(l.Lines) > 0 {
+		b = []byte(strings.Join(l.Lines, "\n") + "\n")
+	}
+	return writeFileAtomic(name, b)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadArgsFile reads arguments for a tool from a file, one argument per line.
+// Leading and trailing whitespace is ignored, as are blank lines and lines
+// starting with "#". To keep such whitespace, or to start an argument with
+// "#", the whole line may be quoted as described by nextField.
+func ReadArgsFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var args []string
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, `"`), strings.HasPrefix(line, "'"):
+			arg, rest, err := nextField(line)
+			if err == nil && rest != "" {
+				err = fmt.Errorf("unexpected text after quoted argument: %s", rest)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, lineNum, err)
+			}
+			args = append(args, arg)
+		default:
+			args = append(args, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeArgsFile writes the lines to an arguments file, returning its name.
+func writeArgsFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "args")
+	if err := os.WriteFile(name, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestReadArgsFile(t *testing.T) {
+	for _, tt := range []struct {
+		lines   []string
+		want    []string
+		wantErr string
+	}{
+		{lines: nil, want: nil},
+		{
+			lines: []string{"-v", "", "   ", "# a comment", "  # an indented comment", "./..."},
+			want:  []string{"-v", "./..."},
+		},
+		{
+			lines: []string{"  -run  ", "\tTest Foo\t", "a # not a comment"},
+			want:  []string{"-run", "Test Foo", "a # not a comment"},
+		},
+		{
+			lines: []string{`"  spaced  "`, `'#not a comment'`, `"say \"hi\""`, `'it'\''s'`, `""`},
+			want:  []string{"  spaced  ", "#not a comment", `say "hi"`, "it's", ""},
+		},
+		{
+			lines:   []string{`"a" b`},
+			wantErr: "args:1: unexpected text after quoted argument: b",
+		},
+		{
+			lines:   []string{"ok", `"unterminated`},
+			wantErr: "args:2: unterminated quote",
+		},
+	} {
+		name := writeArgsFile(t, tt.lines...)
+		got, err := ReadArgsFile(name)
+		if tt.wantErr != "" {
+			if err == nil || !strings.HasSuffix(err.Error(), tt.wantErr) {
+				t.Errorf("ReadArgsFile(%q) error = %v, want %q", tt.lines, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadArgsFile(%q): %v", tt.lines, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReadArgsFile(%q) = %q, want %q", tt.lines, got, tt.want)
+		}
+	}
+}
+
+func TestArgsFileOrder(t *testing.T) {
+	defer func(name string) { *flagArgsFile = name }(*flagArgsFile)
+	*flagArgsFile = writeArgsFile(t, "-from-file", "file arg")
+	link := Link{Args: []string{"-default"}}
+
+	// The link's default arguments come first, then those in the file,
+	// then those given inline.
+	args, err := withArgsFile([]string{"-inline", "inline arg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-default", "-from-file", "file arg", "-inline", "inline arg"}
+	if got := defaultArgs(link, args); !reflect.DeepEqual(got, want) {
+		t.Errorf("arguments = %q, want %q", got, want)
+	}
+
+	*flagArgsFile = ""
+	if args, err := withArgsFile([]string{"-inline"}); err != nil || !reflect.DeepEqual(args, []string{"-inline"}) {
+		t.Errorf("without an arguments file, arguments = %q, %v, want only those inline", args, err)
+	}
+
+	*flagArgsFile = filepath.Join(t.TempDir(), "missing")
+	if _, err := withArgsFile(nil); err == nil {
+		t.Error("a missing arguments file was not an error")
+	}
+}
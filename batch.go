@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Invocation is a tool to run, and its arguments, as read from a batch.
+type Invocation struct {
+	Line int // Line of the batch the invocation is on.
+	Link Link
+	Tool string // Package path and version of the tool.
+	Args []string
+}
+
+// readBatch reads a batch of invocations, one to a line: a link or package
+// path, with any version, followed by the arguments for the tool, quoted as
+// a shell would quote them. Blank lines, and those starting with "#", are
+// skipped.
+func readBatch(links map[string]Link, r io.Reader) ([]Invocation, error) {
+	var batch []Invocation
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20) // Arguments can make for long lines.
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields, err := splitFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		tool := followDeprecation(links, fields[0])
+		warnUnsupported(links, tool)
+		mod, link, _ := expandLink(links, tool)
+		if err := checkTool(links, mod); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		batch = append(batch, Invocation{Line: n, Link: link, Tool: mod, Args: fields[1:]})
+	}
+	return batch, scanner.Err()
+}
+
+// RunBatch runs the batch of invocations, as many at once as jobs allows,
+// returning the exit code of each. An invocation whose tool cannot be
+// prepared has an exit code of -1.
+func RunBatch(cacheDir string, batch []Invocation, wrap []string, jobs int) []int {
+	exitCodes := make([]int, len(batch))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, inv := range batch {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, inv Invocation) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			start := time.Now()
+			ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+			ctx, rec := withBuildRecord(ctx)
+			run := RunRecord{Short: inv.Link.Short, Tool: inv.Tool, Args: inv.Args, ExitCode: -1}
+			tool, temp, err := prepareTool(ctx, cacheDir, inv.Tool, linkBuildOptions(inv.Link))
+			cancel()
+			run.Start = time.Now()
+			run.Prepare, run.Built = run.Start.Sub(start), rec.Download > 0 || rec.Build > 0
+			if err != nil {
+				logWarnf("exec: line %d: %s: %v", inv.Line, inv.Tool, err)
+				exitCodes[i] = -1
+				recordRun(cacheDir, run)
+				return
+			}
+			exitCodes[i] = runTool(inv.Link, wrap, tool, inv.Args, temp)
+			run.ExitCode, run.Duration = exitCodes[i], time.Since(run.Start)
+			recordRun(cacheDir, run)
+		}(i, inv)
+	}
+	wg.Wait()
+	return exitCodes
+}
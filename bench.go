@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// benchPhases are the phases of running a tool which are timed by Bench, in
+// the order they happen.
+var benchPhases = []string{"resolve", "download", "build", "exec", "total"}
+
+// Bench runs the tool n times, as va would, timing each phase of doing so,
+// and returns the timings of each phase. The output of the tool is
+// discarded. If cold is set, the tool is removed from the cache before each
+// run, so that every run has to build it, albeit from the go build cache.
+// The resolve phase includes everything other than downloading, building,
+// and running the tool, such as checking for retractions. A run in which
+// the tool fails is warned of, and left out of the timings, as how quickly
+// a tool fails says little of how quickly it runs; only if every run fails
+// is it an error.
+func Bench(cacheDir, mod string, args []string, n int, cold bool) (map[string][]time.Duration, error) {
+	timings := make(map[string][]time.Duration)
+	var failed error
+	first := 1
+	if cold {
+		// Run once more than asked, without timing it, so that there
+		// is something to remove before the first timed run.
+		first = 0
+	}
+	for i := first; i <= n; i++ {
+		ctx, rec := withBuildRecord(rootCtx)
+		start := time.Now()
+		tool, temp, err := prepareTool(ctx, cacheDir, mod, buildOptions())
+		if err != nil {
+			return nil, err
+		}
+		prepared := time.Since(start)
+
+		execStart := time.Now()
+		cmd := toolCommand(nil, tool, args)
+		cmd.Stdout, cmd.Stderr = io.Discard, io.Discard
+		logCommand(cmd)
+		runErr := cmd.Run()
+		execTime := time.Since(execStart)
+
+		switch {
+		case i == 0:
+		case runErr != nil:
+			failed = runErr
+			logWarnf("bench: run %d of %d, which is left out: %v", i, n, runErr)
+		default:
+			timings["resolve"] = append(timings["resolve"], prepared-rec.Download-rec.Build)
+			timings["download"] = append(timings["download"], rec.Download)
+			timings["build"] = append(timings["build"], rec.Build)
+			timings["exec"] = append(timings["exec"], execTime)
+			timings["total"] = append(timings["total"], time.Since(start))
+		}
+
+		switch {
+		case temp:
+			removeTemp(tool)
+		case cold:
+			if err := os.RemoveAll(filepath.Dir(tool)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(timings["total"]) == 0 {
+		return nil, fmt.Errorf("every run of the tool failed: %w", failed)
+	}
+	return timings, nil
+}
+
+// printBench prints the percentiles of the timings of each phase.
+func printBench(out io.Writer, timings map[string][]time.Duration) error {
+	w := tabwriter.NewWriter(out, 1, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "PHASE\tP50\tP95\tMIN\tMAX\t\n")
+	for _, phase := range benchPhases {
+		d := timings[phase]
+		if len(d) == 0 {
+			continue
+		}
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+		fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\t\n", phase,
+			roundDuration(percentile(d, 0.5)), roundDuration(percentile(d, 0.95)),
+			roundDuration(d[0]), roundDuration(d[len(d)-1]))
+	}
+	return w.Flush()
+}
+
+// percentile returns the qth percentile of the sorted durations, using the
+// nearest rank.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// roundDuration rounds the duration to a precision suitable for people to
+// read, keeping three significant figures or so.
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
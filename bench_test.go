@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// flakyTool fails every other run, counting its runs in the file given.
+const flakyTool = `package main
+
+import (
+	"os"
+	"strconv"
+)
+
+func main() {
+	b, _ := os.ReadFile(os.Args[1])
+	n, _ := strconv.Atoi(string(b))
+	os.WriteFile(os.Args[1], []byte(strconv.Itoa(n+1)), 0o644)
+	if n%2 == 1 {
+		os.Exit(1)
+	}
+}
+`
+
+func TestBenchLeavesOutFailedRuns(t *testing.T) {
+	useTestProxy(t, testModule{
+		Path:    "example.com/flaky",
+		Version: "v1.0.0",
+		GoMod:   "module example.com/flaky\n\ngo 1.18\n",
+		Files:   map[string]string{"main.go": flakyTool},
+	})
+	cacheDir := t.TempDir()
+	t.Setenv("VA_CACHE_DIR", cacheDir)
+	t.Setenv("VA_STATE_DIR", t.TempDir())
+	count := filepath.Join(t.TempDir(), "count")
+
+	timings, err := Bench(cacheDir, "example.com/flaky@v1.0.0", []string{count}, 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, phase := range benchPhases {
+		if got := len(timings[phase]); got != 2 {
+			t.Errorf("%s has %d timings, want 2 of the 4 runs", phase, got)
+		}
+	}
+
+	// The next run fails, so every run does when only one is asked for.
+	if err := os.WriteFile(count, []byte("1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Bench(cacheDir, "example.com/flaky@v1.0.0", []string{count}, 1, false); err == nil || !strings.HasPrefix(err.Error(), "every run of the tool failed") {
+		t.Errorf("Bench of a failing tool = %v, want every run failed", err)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+// binDir is the directory within the cache directory holding built tools.
+// Each tool is in a directory named for the hash of its ToolKey, alongside
+// a metadata file describing it.
+const binDir = "bin"
+
+// lockDir is the directory within the cache directory holding the locks
+// taken while building tools, which are named for the hash of the ToolKey.
+const lockDir = "locks"
+
+// binMetaFile is the file alongside each cached tool describing it.
+const binMetaFile = "meta.json"
+
+// ToolKey identifies a built tool. Tools with the same key are expected to
+// be identical, so a tool only needs to be built once per key.
+type ToolKey struct {
+	Path    string // Module path.
+	Version string // Module version, which must not be a query like "latest".
+	Tail    string // Path of the tool within the module.
+	Env     GoEnv
+	Build   BuildOptions
+}
+
+// NewToolKey returns the key for the tool in the module, built in the
+// environment with the options.
+func NewToolKey(m Module, env GoEnv, opts BuildOptions) ToolKey {
+	return ToolKey{
+		Path:    m.Path,
+		Version: m.Version,
+		Tail:    m.Tail,
+		Env:     env,
+		Build:   opts,
+	}
+}
+
+// Binary returns the name of the tool's binary, as binaryName names it.
+func (k ToolKey) Binary() string {
+	return binaryName(path.Join(k.Path, k.Tail))
+}
+
+// binaryName returns the name of the binary of the tool of the package path,
+// which is the name go install gives it: the last element of the path, unless
+// that is a major version, such as "v2", when it is the one before. The tool
+// is kept in the cache, and installed, under this name.
+func binaryName(pkgPath string) string {
+	dir, name := path.Split(pkgPath)
+	if _, major, ok := module.SplitPathVersion("/" + name); ok && major != "" && dir != "" {
+		name = path.Base(dir)
+	}
+	return name
+}
+
+// CachePath returns where the tool is kept in the cache directory, once it
+// has been built.
+func (k ToolKey) CachePath(cacheDir string) string {
+	return filepath.Join(cacheDir, binDir, k.Hash(), k.Binary())
+}
+
+// Hash returns a hash of the key, suitable for use as a filename.
+func (k ToolKey) Hash() string {
+	b, _ := json.Marshal(k)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// ToolMeta describes a tool in the cache.
+type ToolMeta struct {
+	Key    ToolKey
+	Built  time.Time
+	SHA256 string // Hash of the binary, which names it in objectsDir.
+}
+
+// FindCachedTool returns the path to the tool in the cache for the package
+// path and version, if it has been built before. This never runs the go
+// command, so that running a tool which has already been built is as quick
+// as possible: the version must not be a query like "latest", and the module
+// containing the tool must already be in the module cache.
+func FindCachedTool(ctx context.Context, cacheDir, mod string, opts BuildOptions) (string, bool) {
+	pkgPath, version, ok := strings.Cut(mod, "@")
+	if !ok || isQuery(version) {
+		return "", false
+	}
+	modCache, err := GoModCache(ctx)
+	if err != nil {
+		return "", false
+	}
+	m, ok := findDownloaded(modCache, pkgPath, version)
+	if !ok {
+		return "", false
+	}
+	env, err := ReadGoEnv(ctx)
+	if err != nil {
+		return "", false
+	}
+	key := NewToolKey(m, env, opts)
+	tool := key.CachePath(cacheDir)
+	entryDir := filepath.Dir(tool)
+	if _, err := os.Stat(tool); err != nil {
+		return "", false
+	}
+	if err := touchEntry(entryDir); err != nil {
+		return "", false
+	}
+	return tool, true
+}
+
+// CachedTool returns the path of the tool in the cache, building it if it is
+// not already there. Building happens in a temporary location within the
+// cache, so that a failed or concurrent build never leaves a partial binary
+// where a complete one is expected.
+//
+// If a remote cache is given, a tool missing from the cache is fetched from
+// there instead of being built if possible, and tools that are built are
+// shared with it.
+func CachedTool(ctx context.Context, cacheDir string, remote RemoteCache, m Module, key ToolKey) (string, error) {
+	tool := key.CachePath(cacheDir)
+	entryDir := filepath.Dir(tool)
+	if _, err := os.Stat(tool); err == nil {
+		return tool, touchEntry(entryDir)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	// Only build each tool once at a time, so that running the same tool
+	// from two places at once waits for the first build and then uses it,
+	// rather than building it twice.
+	if err := os.MkdirAll(filepath.Join(cacheDir, lockDir), 0o755); err != nil {
+		return "", err
+	}
+	lockFile, err := lock(ctx, filepath.Join(cacheDir, lockDir, key.Hash()), func() {
+		logInfof("waiting for another build of %s@%s", m.ToolPath(), m.Version)
+	})
+	if err != nil {
+		return "", err
+	}
+	defer unlock(lockFile)
+	if _, err := os.Stat(tool); err == nil {
+		return tool, touchEntry(entryDir)
+	}
+
+	if err := os.MkdirAll(filepath.Join(cacheDir, binDir), 0o755); err != nil {
+		return "", err
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Join(cacheDir, binDir), "tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpTool := filepath.Join(tmpDir, filepath.Base(tool))
+	fetched := false
+	if remote != nil {
+		err := fetchRemote(ctx, remote, key.Hash(), tmpTool)
+		switch {
+		case err == nil:
+			fetched = true
+		case !errors.Is(err, errNotCached):
+			logWarnf("remote cache: %v", err)
+		}
+	}
+	if !fetched {
+		if err := Build(ctx, m.ToolDir(), tmpTool, key.Build); err != nil {
+			return "", err
+		}
+		if remote != nil {
+			if err := pushRemote(ctx, remote, key.Hash(), tmpTool); err != nil {
+				logWarnf("remote cache: %v", err)
+			}
+		}
+	}
+	sum, err := storeObject(cacheDir, tmpTool)
+	if err != nil {
+		return "", err
+	}
+	meta, err := json.MarshalIndent(ToolMeta{Key: key, Built: time.Now(), SHA256: sum}, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, binMetaFile), meta, 0o644); err != nil {
+		return "", err
+	}
+
+	// Move the complete entry into place. If another build beat us to it,
+	// theirs is just as good as ours.
+	if err := os.Rename(tmpDir, entryDir); err != nil {
+		if _, statErr := os.Stat(tool); statErr != nil {
+			return "", err
+		}
+	}
+	return tool, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestBinaryName(t *testing.T) {
+	for _, tt := range []struct {
+		pkgPath string
+		want    string
+	}{
+		{"example.com/hello", "hello"},
+		{"golang.org/x/tools/cmd/stringer", "stringer"},
+		{"github.com/mikefarah/yq/v4", "yq"},
+		{"github.com/a/b/v2/cmd/c", "c"},
+		{"v2", "v2"},
+		{"example.com/v2", "example.com"},
+		{"gopkg.in/yaml.v3", "yaml.v3"},
+	} {
+		if got := binaryName(tt.pkgPath); got != tt.want {
+			t.Errorf("binaryName(%q) = %q, want %q", tt.pkgPath, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// buildsFile is the file within the cache directory recording how each build
+// of a tool went, one JSON record per line.
+const buildsFile = "builds.jsonl"
+
+// maxBuildRecords is how many builds are remembered.
+const maxBuildRecords = 1000
+
+// BuildRecord describes how the build of a tool went, so that slow builds
+// can be put down to the network, compiling, or linking.
+type BuildRecord struct {
+	Tool    string    // Package path of the tool.
+	Version string    // Version of the module containing the tool.
+	Time    time.Time // When the build finished.
+
+	Download time.Duration // Resolving and downloading the module.
+	Build    time.Duration // Running the go command to build the tool.
+	Compile  time.Duration // Compiling packages, within the build.
+	Link     time.Duration // Linking the binary, within the build.
+	Packages int           // Packages needed to build the tool.
+	Cached   int           // Packages found in the go build cache.
+}
+
+// buildRecordKey is the context key for the BuildRecord being filled in.
+type buildRecordKey struct{}
+
+// withBuildRecord returns a context in which Download and Build fill in the
+// record returned, as they go.
+func withBuildRecord(ctx context.Context) (context.Context, *BuildRecord) {
+	rec := &BuildRecord{}
+	return context.WithValue(ctx, buildRecordKey{}, rec), rec
+}
+
+// buildRecordFrom returns the record being filled in within the context, or
+// nil if there is none.
+func buildRecordFrom(ctx context.Context) *BuildRecord {
+	rec, _ := ctx.Value(buildRecordKey{}).(*BuildRecord)
+	return rec
+}
+
+// action is the part of an action in the go command's action graph, as
+// written by "go build -debug-actiongraph", which is needed to work out
+// where the time went.
+type action struct {
+	Mode      string
+	Package   string
+	Cmd       []string
+	TimeStart time.Time
+	TimeDone  time.Time
+}
+
+// readActionGraph fills in the record from the action graph. The graph is
+// an internal debugging aid of the go command, so anything unexpected is
+// simply ignored.
+func readActionGraph(name string, rec *BuildRecord) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return
+	}
+	var actions []action
+	if err := json.Unmarshal(b, &actions); err != nil {
+		return
+	}
+	var start, done time.Time
+	for _, a := range actions {
+		switch a.Mode {
+		case "build":
+			rec.Packages++
+			if len(a.Cmd) == 0 {
+				rec.Cached++
+				continue
+			}
+			if start.IsZero() || a.TimeStart.Before(start) {
+				start = a.TimeStart
+			}
+			if a.TimeDone.After(done) {
+				done = a.TimeDone
+			}
+		case "link":
+			if len(a.Cmd) > 0 {
+				rec.Link = a.TimeDone.Sub(a.TimeStart)
+			}
+		}
+	}
+	rec.Compile = done.Sub(start)
+}
+
+// recordBuild adds the record to those kept in the cache directory, keeping
+// only the most recent maxBuildRecords.
+func recordBuild(cacheDir string, rec BuildRecord) error {
+	if err := os.MkdirAll(filepath.Join(cacheDir, lockDir), 0o755); err != nil {
+		return err
+	}
+	lockFile, err := lock(context.Background(), filepath.Join(cacheDir, lockDir, buildsFile), nil)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	recs, err := readBuildRecords(cacheDir)
+	if err != nil {
+		// Start again, rather than forever failing to record anything.
+		recs = nil
+	}
+	recs = append(recs, rec)
+	if len(recs) > maxBuildRecords {
+		recs = recs[len(recs)-maxBuildRecords:]
+	}
+	var b []byte
+	for _, r := range recs {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, line...), '\n')
+	}
+	return writeFileAtomic(filepath.Join(cacheDir, buildsFile), b)
+}
+
+// readBuildRecords reads the records of builds, oldest first.
+func readBuildRecords(cacheDir string) ([]BuildRecord, error) {
+	f, err := os.Open(filepath.Join(cacheDir, buildsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recs []BuildRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec BuildRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, scanner.Err()
+}
@@ -0,0 +1,709 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// The files within a bundle. The module files are laid out as a module proxy
+// would serve them, so that the go command can download from the bundle.
+const (
+	bundleManifestFile = "manifest.json"
+	bundleSumsFile     = "go.sum"
+	bundleDownloadDir  = "download"
+)
+
+// BundleManifest describes the tools in a bundle.
+type BundleManifest struct {
+	Created time.Time
+	Tools   []BundleTool
+}
+
+// BundleTool is a tool in a bundle.
+type BundleTool struct {
+	Query   string // Package path and version as asked for, e.g. "example.com/a/cmd/b@latest".
+	Path    string // Module path, e.g. "example.com/a".
+	Version string // Version the query resolved to, e.g. "v1.2.3".
+	Tail    string // Path of the tool within the module, e.g. "cmd/b".
+	Binary  string `json:",omitempty"` // Hash of the ToolKey of the binary, if one is included.
+}
+
+// ToolPath returns the package path of the tool.
+func (t BundleTool) ToolPath() string {
+	return path.Join(t.Path, t.Tail)
+}
+
+// CreateBundle writes a bundle of the tools to the file, containing the
+// source of every module needed to build them along with their checksums,
+// and optionally the binaries built for the current go toolchain, so that
+// the tools can be run on machines which cannot reach a module proxy.
+func CreateBundle(ctx context.Context, cacheDir string, mods []string, output string, opts BuildOptions, binaries bool) (err error) {
+	modCache, err := GoModCache(ctx)
+	if err != nil {
+		return err
+	}
+	w, err := createBundleFile(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(output)
+		}
+	}()
+
+	b := &bundleWriter{tw: tar.NewWriter(w), modCache: modCache, sums: make(map[string]string), added: make(map[string]bool)}
+	manifest := BundleManifest{Created: time.Now().UTC()}
+	for _, mod := range mods {
+		var m Module
+		if binaries {
+			m, err = Prefetch(ctx, cacheDir, mod, opts)
+		} else {
+			m, err = Download(ctx, mod)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", mod, err)
+		}
+		if err := b.addModules(ctx, m); err != nil {
+			return fmt.Errorf("%s: %w", mod, err)
+		}
+		tool := BundleTool{Query: mod, Path: m.Path, Version: m.Version, Tail: m.Tail}
+		if binaries {
+			if tool.Binary, err = b.addBinary(ctx, cacheDir, m, opts); err != nil {
+				return fmt.Errorf("%s: %w", mod, err)
+			}
+		}
+		manifest.Tools = append(manifest.Tools, tool)
+	}
+
+	lines := make([]string, 0, len(b.sums))
+	for key, sum := range b.sums {
+		lines = append(lines, key+" "+sum+"\n")
+	}
+	sort.Strings(lines)
+	if err := b.addBytes(bundleSumsFile, []byte(strings.Join(lines, "")), 0o644); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := b.addBytes(bundleManifestFile, data, 0o644); err != nil {
+		return err
+	}
+	return b.tw.Close()
+}
+
+// bundleWriter writes the files of a bundle, once each.
+type bundleWriter struct {
+	tw       *tar.Writer
+	modCache string
+	sums     map[string]string // Checksums, keyed as in go.sum.
+	added    map[string]bool   // Names of the files written.
+}
+
+// addModules adds the module, and every module needed to build it, to the
+// bundle. The zip of every module in the build list is added, along with
+// the go.mod of every module version the go command reads to work out the
+// build list.
+func (b *bundleWriter) addModules(ctx context.Context, m Module) error {
+	if err := b.addModule(m.Path, m.Version, true); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(m.Dir, "go.mod")); err != nil {
+		// Modules which predate modules have no dependencies the go
+		// command knows of.
+		return nil
+	}
+
+	cmd := goCommand(ctx, "mod", "download", "-json", "all")
+	cmd.Dir = m.Dir
+	logCommand(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("mod-download: %s", downloadErrorText(out))
+	}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var dep struct {
+			Path, Version, Error string
+		}
+		if err := dec.Decode(&dep); err != nil {
+			return fmt.Errorf("json: %w", err)
+		}
+		if dep.Error != "" {
+			return fmt.Errorf("mod-download: %s@%s: %s", dep.Path, dep.Version, dep.Error)
+		}
+		if err := b.addModule(dep.Path, dep.Version, true); err != nil {
+			return err
+		}
+	}
+
+	cmd = goCommand(ctx, "mod", "graph")
+	cmd.Dir = m.Dir
+	logCommand(cmd)
+	out, err = cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("mod-graph: %s", bytes.TrimSpace(exitErr.Stderr))
+		}
+		return fmt.Errorf("mod-graph: %w", err)
+	}
+	for _, node := range strings.Fields(string(out)) {
+		modPath, version, ok := strings.Cut(node, "@")
+		if !ok || modPath == "go" || modPath == "toolchain" {
+			continue
+		}
+		if err := b.addModule(modPath, version, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addModule adds the files of the module version from the module cache to
+// the bundle, with the zip of its source only if withZip is set.
+func (b *bundleWriter) addModule(modPath, version string, withZip bool) error {
+	src, name, err := downloadFiles(b.modCache, modPath, version)
+	if err != nil {
+		return err
+	}
+	key := modPath + " " + version
+	if _, ok := b.sums[key+"/go.mod"]; !ok {
+		sum, err := hashGoMod(src + ".mod")
+		if errors.Is(err, fs.ErrNotExist) && !withZip {
+			// The module graph lists versions whose go.mod files
+			// the go command never needed to read, thanks to
+			// module graph pruning.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b.sums[key+"/go.mod"] = sum
+		if err := b.addFile(name+".mod", src+".mod", 0o644); err != nil {
+			return err
+		}
+		if _, err := os.Stat(src + ".info"); err == nil {
+			if err := b.addFile(name+".info", src+".info", 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	if _, ok := b.sums[key]; ok || !withZip {
+		return nil
+	}
+	sum, err := os.ReadFile(src + ".ziphash")
+	if err != nil {
+		return fmt.Errorf("%s@%s: %w", modPath, version, err)
+	}
+	b.sums[key] = strings.TrimSpace(string(sum))
+	return b.addFile(name+".zip", src+".zip", 0o644)
+}
+
+// addBinary adds the cached binary of the tool to the bundle, returning the
+// hash of its key.
+func (b *bundleWriter) addBinary(ctx context.Context, cacheDir string, m Module, opts BuildOptions) (string, error) {
+	tool, ok := FindCachedTool(ctx, cacheDir, m.ToolPath()+"@"+m.Version, opts)
+	if !ok {
+		return "", fmt.Errorf("%s@%s is not in the cache", m.ToolPath(), m.Version)
+	}
+	entryDir := filepath.Dir(tool)
+	hash := filepath.Base(entryDir)
+	name := path.Join(binDir, hash)
+	if err := b.addFile(path.Join(name, binMetaFile), filepath.Join(entryDir, binMetaFile), 0o644); err != nil {
+		return "", err
+	}
+	return hash, b.addFile(path.Join(name, filepath.Base(tool)), tool, 0o755)
+}
+
+// addFile adds the file to the bundle under the name.
+func (b *bundleWriter) addFile(name, src string, mode int64) error {
+	if b.added[name] {
+		return nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	b.added[name] = true
+	hdr := &tar.Header{Name: name, Mode: mode, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(b.tw, f)
+	return err
+}
+
+// addBytes adds a file with the contents to the bundle under the name.
+func (b *bundleWriter) addBytes(name string, data []byte, mode int64) error {
+	b.added[name] = true
+	hdr := &tar.Header{Name: name, Mode: mode, Size: int64(len(data)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(data)
+	return err
+}
+
+// downloadFiles returns where the files of the module version are in the
+// module cache, and what they are named in a bundle, both without the
+// extension of each file.
+func downloadFiles(modCache, modPath, version string) (src, name string, err error) {
+	encPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return "", "", err
+	}
+	encVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", "", err
+	}
+	name = path.Join(encPath, "@v", encVersion)
+	src = filepath.Join(modCache, "cache", "download", filepath.FromSlash(name))
+	return src, path.Join(bundleDownloadDir, name), nil
+}
+
+// hashGoMod returns the checksum of the go.mod file, as in go.sum.
+func hashGoMod(name string) (string, error) {
+	return dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return os.Open(name)
+	})
+}
+
+// createBundleFile creates the bundle file, compressed according to its
+// extension. zstd compression needs the zstd command.
+func createBundleFile(name string) (io.WriteCloser, error) {
+	var compress func(f *os.File) (io.WriteCloser, error)
+	switch {
+	case strings.HasSuffix(name, ".tar.zst") || strings.HasSuffix(name, ".tzst"):
+		compress = func(f *os.File) (io.WriteCloser, error) {
+			cmd := exec.Command("zstd", "-q", "-c")
+			cmd.Stdout = f
+			cmd.Stderr = os.Stderr
+			return startFilter(cmd)
+		}
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		compress = func(f *os.File) (io.WriteCloser, error) {
+			return gzip.NewWriter(f), nil
+		}
+	case strings.HasSuffix(name, ".tar"):
+		compress = func(f *os.File) (io.WriteCloser, error) {
+			return nopWriteCloser{f}, nil
+		}
+	default:
+		return nil, fmt.Errorf("%s: bundles must be named .tar.zst, .tar.gz, or .tar", name)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	w, err := compress(f)
+	if err != nil {
+		f.Close()
+		os.Remove(name)
+		return nil, err
+	}
+	return &bundleFile{WriteCloser: w, f: f}, nil
+}
+
+// bundleFile is a bundle being written through a compressor.
+type bundleFile struct {
+	io.WriteCloser
+	f *os.File
+}
+
+// Close closes the compressor, then the file.
+func (b *bundleFile) Close() error {
+	err := b.WriteCloser.Close()
+	if closeErr := b.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// nopWriteCloser is a writer whose Close does nothing, as the file it writes
+// to is closed separately.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// filter is a command which data is written through, such as a compressor.
+type filter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+// startFilter starts the command, returning a writer to its standard input.
+func startFilter(cmd *exec.Cmd) (*filter, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	logCommand(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &filter{WriteCloser: stdin, cmd: cmd}, nil
+}
+
+// Close closes the standard input of the command, and waits for it to exit.
+func (f *filter) Close() error {
+	err := f.WriteCloser.Close()
+	if waitErr := f.cmd.Wait(); err == nil && waitErr != nil {
+		err = fmt.Errorf("%s: %w", f.cmd.Path, waitErr)
+	}
+	return err
+}
+
+// openBundleFile opens the bundle file, decompressing it according to what
+// it starts with.
+func openBundleFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return readCloser{zr, f}, nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		cmd := exec.Command("zstd", "-q", "-d", "-c")
+		cmd.Stdin = r
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		logCommand(cmd)
+		if err := cmd.Start(); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return readCloser{stdout, closerFunc(func() error {
+			err := cmd.Wait()
+			f.Close()
+			return err
+		})}, nil
+	default:
+		return readCloser{r, f}, nil
+	}
+}
+
+// readCloser reads from a reader, and closes something else when closed.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// closerFunc is a function which can be used as an io.Closer.
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// extractBundle extracts the regular files in the bundle into the directory,
+// refusing any whose names would escape it.
+func extractBundle(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("bad file name in bundle: %q", hdr.Name)
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(hdr.Mode)&0o755|0o600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+}
+
+// ImportBundle imports the tools in the bundle file, checking the module
+// files within it against its checksums and adding them to the module cache,
+// so that the tools can be built and run without going online. Binaries in
+// the bundle are added to the cache if they were built for the current go
+// toolchain; otherwise, the tools will be built when first run.
+func ImportBundle(ctx context.Context, cacheDir, name string) ([]BundleTool, error) {
+	r, err := openBundleFile(name)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "va-bundle-")
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	err = extractBundle(r, dir)
+	if closeErr := r.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	var manifest BundleManifest
+	data, err := os.ReadFile(filepath.Join(dir, bundleManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a bundle: %w", name, err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: json: %w", name, err)
+	}
+	zips, err := verifyBundle(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	modCache, err := GoModCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := importModules(ctx, dir, modCache, zips); err != nil {
+		return nil, err
+	}
+	for _, tool := range manifest.Tools {
+		if err := recordResolution(cacheDir, tool.Query, tool.Version); err != nil {
+			return nil, fmt.Errorf("cache: %w", err)
+		}
+		if tool.Binary != "" {
+			if err := importBinary(ctx, dir, cacheDir, modCache, tool); err != nil {
+				return nil, fmt.Errorf("%s: %w", tool.Query, err)
+			}
+		}
+	}
+	return manifest.Tools, nil
+}
+
+// verifyBundle checks every module file in the extracted bundle against the
+// checksums in the bundle, returning the module versions whose zips are in
+// the bundle.
+func verifyBundle(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, bundleSumsFile))
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if f := strings.Fields(line); len(f) == 3 {
+			sums[f[0]+" "+f[1]] = f[2]
+		}
+	}
+
+	var zips []string
+	root := filepath.Join(dir, bundleDownloadDir)
+	err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		encPath, file, ok := strings.Cut(filepath.ToSlash(rel), "/@v/")
+		if !ok {
+			return fmt.Errorf("unexpected file in bundle: %s", rel)
+		}
+		ext := path.Ext(file)
+		modPath, err := module.UnescapePath(encPath)
+		if err != nil {
+			return err
+		}
+		version, err := module.UnescapeVersion(strings.TrimSuffix(file, ext))
+		if err != nil {
+			return err
+		}
+
+		var key, sum string
+		switch ext {
+		case ".info":
+			return nil
+		case ".mod":
+			key = modPath + " " + version + "/go.mod"
+			sum, err = hashGoMod(name)
+		case ".zip":
+			key = modPath + " " + version
+			sum, err = dirhash.HashZip(name, dirhash.Hash1)
+			zips = append(zips, modPath+"@"+version)
+		default:
+			return fmt.Errorf("unexpected file in bundle: %s", rel)
+		}
+		if err != nil {
+			return err
+		}
+		switch want, ok := sums[key]; {
+		case !ok:
+			return fmt.Errorf("no checksum for %s", key)
+		case sum != want:
+			return fmt.Errorf("checksum mismatch for %s: bundle has %s, expected %s", key, sum, want)
+		}
+		return nil
+	})
+	return zips, err
+}
+
+// importModules adds the module files in the extracted bundle to the module
+// cache. The go command downloads the zips from the bundle as if it were a
+// module proxy, which unpacks them too. The go.mod files of modules whose
+// source is not needed are copied into place, as the go command has no way
+// of downloading only them.
+//
+// The checksum database is not consulted, as it may well not be reachable,
+// and the files have already been checked against the checksums recorded
+// when the bundle was created.
+func importModules(ctx context.Context, dir, modCache string, zips []string) error {
+	root := filepath.Join(dir, bundleDownloadDir)
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(name) == ".zip" {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(modCache, "cache", "download", rel)
+		if _, err := os.Stat(dst); err == nil {
+			return nil
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		return writeFileAtomic(dst, data)
+	})
+	if err != nil || len(zips) == 0 {
+		return err
+	}
+
+	proxyURL := "file://" + filepath.ToSlash(root)
+	if !strings.HasPrefix(proxyURL, "file:///") {
+		proxyURL = "file:///" + strings.TrimPrefix(proxyURL, "file://")
+	}
+	cmd := goCommand(withProxySource(ctx, proxyURL), append([]string{"mod", "download", "-json"}, zips...)...)
+	cmd.Env = append(cmd.Env, "GOSUMDB=off")
+	cmd.Dir = dir
+	logCommand(cmd)
+	if out, err := cmd.Output(); err != nil {
+		return fmt.Errorf("mod-download: %s", downloadErrorText(out))
+	}
+	return nil
+}
+
+// importBinary adds the binary of the tool in the extracted bundle to the
+// cache, if it was built for the current go toolchain.
+func importBinary(ctx context.Context, dir, cacheDir, modCache string, tool BundleTool) error {
+	entryDir := filepath.Join(dir, binDir, tool.Binary)
+	data, err := os.ReadFile(filepath.Join(entryDir, binMetaFile))
+	if err != nil {
+		return err
+	}
+	var meta ToolMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return fmt.Errorf("json: %w", err)
+	}
+	if meta.Key.Hash() != tool.Binary {
+		return fmt.Errorf("binary does not match its description")
+	}
+	env, err := ReadGoEnv(ctx)
+	if err != nil {
+		return err
+	}
+	if meta.Key.Env != env {
+		logInfof("bundle: %s@%s was built for %s/%s with %s, so it will be built when first run", tool.ToolPath(), tool.Version, meta.Key.Env.GOOS, meta.Key.Env.GOARCH, meta.Key.Env.GOVERSION)
+		return nil
+	}
+	m, ok := findDownloaded(modCache, tool.ToolPath(), tool.Version)
+	if !ok || m.Path != tool.Path {
+		return fmt.Errorf("%s@%s is not in the module cache", tool.Path, tool.Version)
+	}
+	bin := filepath.Join(entryDir, meta.Key.Binary())
+	sum, err := hashFile(bin)
+	if err != nil {
+		return err
+	}
+	if sum != meta.SHA256 {
+		return fmt.Errorf("checksum mismatch for binary: bundle has %s, expected %s", sum, meta.SHA256)
+	}
+	_, err = CachedTool(ctx, cacheDir, bundleBinaries{tool.Binary: bin}, m, meta.Key)
+	return err
+}
+
+// bundleBinaries is the binaries in an extracted bundle, keyed by the hash
+// of their ToolKey, which CachedTool fetches from as if it were a remote
+// cache.
+type bundleBinaries map[string]string
+
+func (b bundleBinaries) Get(ctx context.Context, hash string) (io.ReadCloser, string, error) {
+	name, ok := b[hash]
+	if !ok {
+		return nil, "", errNotCached
+	}
+	// importBinary has checked the binary against the bundle already.
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, "", nil
+}
+
+func (b bundleBinaries) Put(ctx context.Context, hash string, r io.Reader, size int64, sum string) error {
+	return errors.New("bundles are read-only")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// cacheVersion is the version of the layout of the cache directory. It must
+// be incremented whenever the layout changes incompatibly, so that a cache
+// written by another version of va is cleared rather than misread.
+const cacheVersion = 2
+
+// cacheVersionFile is the file within the cache directory holding the
+// version of the layout of the cache.
+const cacheVersionFile = "version"
+
+// CacheDir returns the directory va caches things in, which is $VA_CACHE_DIR
+// if set, or "va" within the user's cache directory otherwise.
+func CacheDir() (dir string, custom bool, err error) {
+	if dir := os.Getenv("VA_CACHE_DIR"); dir != "" {
+		return dir, true, nil
+	}
+	dir, err = os.UserCacheDir()
+	if err != nil {
+		return "", false, err
+	}
+	return filepath.Join(dir, "va"), false, nil
+}
+
+// stateDir returns the directory va keeps what it must not lose in, unlike
+// what it caches, which may be purged at any time: $VA_STATE_DIR if set, or
+// else "va" within $XDG_STATE_HOME, or ~/.local/state on Unix systems, or
+// va's configuration directory on those with no such place.
+func stateDir() (string, error) {
+	if dir := os.Getenv("VA_STATE_DIR"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, "va"), nil
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		return configDir()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "va"), nil
+}
+
+// OpenCache returns the cache directory, creating it if needed. If the cache
+// was written by a different version of va, it is cleared before use.
+func OpenCache() (string, error) {
+	dir, custom, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	version, err := readCacheVersion(dir)
+	if err != nil {
+		return "", err
+	}
+	switch cacheMigration(version, len(entries) == 0, custom) {
+	case cacheUse:
+		return dir, nil
+	case cacheRefuse:
+		return "", fmt.Errorf("%s is not empty and is not a va cache, refusing to use it", dir)
+	case cacheClear:
+		if len(entries) > 0 {
+			logInfof("cache at %s is from another version of va, clearing it", dir)
+		}
+		for _, entry := range entries {
+			if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// The cache is now empty, so mark it with the current version.
+	v := []byte(strconv.Itoa(cacheVersion) + "\n")
+	if err := os.WriteFile(filepath.Join(dir, cacheVersionFile), v, 0o644); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// readCacheVersion returns the version of the layout of the cache, or zero
+// if the cache has no version file.
+func readCacheVersion(dir string) (int, error) {
+	b, err := os.ReadFile(filepath.Join(dir, cacheVersionFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("bad cache version: %w", err)
+	}
+	return version, nil
+}
+
+// cacheAction is what to do with a cache directory before using it.
+type cacheAction int
+
+const (
+	cacheUse    cacheAction = iota // Use the cache as it is.
+	cacheClear                     // Clear the cache, then use it.
+	cacheRefuse                    // Do not touch the directory at all.
+)
+
+// cacheMigration decides what to do with a cache directory, given the
+// version found in it (zero if there was none), whether it is empty, and
+// whether it was chosen by the user rather than being the default location.
+//
+// There are no migrations between versions yet, so any cache from another
+// version is cleared. A directory without a version that is not empty may
+// not belong to va at all, so it is only cleared if it is in the default
+// location; a user-chosen directory could hold anything.
+func cacheMigration(version int, empty, custom bool) cacheAction {
+	switch {
+	case version == cacheVersion:
+		return cacheUse
+	case empty:
+		return cacheClear
+	case version == 0 && custom:
+		return cacheRefuse
+	default:
+		return cacheClear
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCacheMigration(t *testing.T) {
+	for _, tt := range []struct {
+		version       int
+		empty, custom bool
+		want          cacheAction
+	}{
+		{cacheVersion, false, false, cacheUse},
+		{cacheVersion, false, true, cacheUse},
+		{0, true, false, cacheClear},
+		{0, true, true, cacheClear},
+		{0, false, false, cacheClear},
+		{0, false, true, cacheRefuse},
+		{cacheVersion - 1, false, false, cacheClear},
+		{cacheVersion - 1, false, true, cacheClear},
+		{cacheVersion + 1, false, false, cacheClear},
+		{cacheVersion + 1, false, true, cacheClear},
+	} {
+		if got := cacheMigration(tt.version, tt.empty, tt.custom); got != tt.want {
+			t.Errorf("cacheMigration(%d, empty %v, custom %v) = %v, want %v", tt.version, tt.empty, tt.custom, got, tt.want)
+		}
+	}
+}
+
+func TestOpenCache(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		version string // Contents of the version file, if there is one.
+		kept    bool   // Whether what was in the cache is kept.
+		refused bool
+	}{
+		{name: "no version file", refused: true},
+		{name: "older version", version: strconv.Itoa(cacheVersion-1) + "\n"},
+		{name: "newer version", version: strconv.Itoa(cacheVersion+1) + "\n"},
+		{name: "current version", version: strconv.Itoa(cacheVersion) + "\n", kept: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("VA_CACHE_DIR", dir)
+			entry := filepath.Join(dir, binDir)
+			if err := os.Mkdir(entry, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if tt.version != "" {
+				if err := os.WriteFile(filepath.Join(dir, cacheVersionFile), []byte(tt.version), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := OpenCache()
+			if tt.refused {
+				if err == nil {
+					t.Fatalf("OpenCache() = %s, want it to refuse a directory which is not a va cache", got)
+				}
+				if _, err := os.Stat(entry); err != nil {
+					t.Errorf("the directory was touched: %v", err)
+				}
+				return
+			}
+			if err != nil || got != dir {
+				t.Fatalf("OpenCache() = %s, %v, want %s", got, err, dir)
+			}
+			if _, err := os.Stat(entry); (err == nil) != tt.kept {
+				t.Errorf("%s kept = %v, want %v", binDir, err == nil, tt.kept)
+			}
+			if version, err := readCacheVersion(dir); err != nil || version != cacheVersion {
+				t.Errorf("cache version = %d, %v, want %d", version, err, cacheVersion)
+			}
+		})
+	}
+
+	// An empty directory is made a cache, whether or not it was chosen.
+	dir := filepath.Join(t.TempDir(), "cache")
+	t.Setenv("VA_CACHE_DIR", dir)
+	if _, err := OpenCache(); err != nil {
+		t.Fatalf("OpenCache() of a new directory: %v", err)
+	}
+	if version, err := readCacheVersion(dir); err != nil || version != cacheVersion {
+		t.Errorf("cache version = %d, %v, want %d", version, err, cacheVersion)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+var flagColor = flag.String("color", "auto", "when to color output: \"auto\" (only to a terminal, and not if $NO_COLOR is set), \"always\", or \"never\"")
+
+// color is the SGR parameter of an ANSI escape sequence which colors text.
+type color string
+
+const (
+	colorBold   color = "1"
+	colorDim    color = "2"
+	colorRed    color = "31"
+	colorGreen  color = "32"
+	colorYellow color = "33"
+	colorCyan   color = "36"
+)
+
+// checkColor checks the --color flag is one va knows.
+func checkColor() error {
+	switch *flagColor {
+	case "auto", "always", "never":
+		return nil
+	}
+	return fmt.Errorf("unknown color mode: %s", *flagColor)
+}
+
+// useColor reports whether output to w should be colored. Unless told
+// otherwise, it is only colored for terminals which understand colors, and
+// never if $NO_COLOR is set, as https://no-color.org asks.
+func useColor(w io.Writer) bool {
+	switch *flagColor {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f)
+}
+
+// paint colors s, if on is set.
+func paint(on bool, c color, s string) string {
+	if !on || s == "" {
+		return s
+	}
+	return "\x1b[" + string(c) + "m" + s + "\x1b[0m"
+}
@@ -0,0 +1,2794 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// command is a subcommand of va.
+type command struct {
+	run     func(links map[string]Link, args []string) error
+	summary string // What the command does, in a line.
+}
+
+// commands are the subcommands of va, which are looked up by the first
+// argument given to va.
+var commands = map[string]command{
+	"alias":        {cmdAlias, "add, change, or remove links in your own lists"},
+	"bench":        {cmdBench, "time each phase of running a tool"},
+	"bundle":       {cmdBundle, "move tools onto machines which cannot go online"},
+	"cache":        {cmdCache, "inspect and manage the cache of built tools"},
+	"cache-server": {cmdCacheServer, "serve a cache of built tools to other machines"},
+	"clean":        {cmdClean, "remove files left behind by va"},
+	"completion":   {cmdCompletion, "print a script for a shell to complete the arguments of va"},
+	"daemon":       {cmdDaemon, "keep tools built in the background"},
+	"doctor":       {cmdDoctor, "check everything va needs is working"},
+	"exec":         {cmdExec, "run a batch of tools, read from stdin"},
+	"export":       {cmdExport, "print shell aliases, Make variables, or Task tasks which run links"},
+	"gc":           {cmdGC, "evict tools from the cache"},
+	"hook":         {cmdHook, "print a hook which has the shell run links for commands not found"},
+	"import":       {cmdImport, "make links of the tools managed by bingo, tools.go, or .tool-versions"},
+	"history":      {cmdHistory, "list the tools run recently"},
+	"info":         {cmdInfo, "describe a tool and the module it is in"},
+	"install":      {cmdInstall, "install tools into GOBIN, by name and by name and version"},
+	"lists":        {cmdLists, "subscribe to lists of short names, fetched over HTTPS or from git"},
+	"list":         {cmdList, "list the registered short names"},
+	"outdated":     {cmdOutdated, "list links pinned to a version which have newer versions"},
+	"pick":         {cmdPick, "pick a tool from a list, then run it"},
+	"prefetch":     {cmdPrefetch, "download and build tools without running them"},
+	"resolve":      {cmdResolve, "show what a tool resolves to, without running it"},
+	"rerun":        {cmdRerun, "run a tool again, exactly as it was run before"},
+	"run":          {cmdRun, "run a tool, or several in turn (the default)"},
+	"search":       {cmdSearch, "search for tools, and run one"},
+	"self-update":  {cmdSelfUpdate, "update va itself to its newest version"},
+	"shim":         {cmdShim, "write scripts onto the PATH which run links through va"},
+	"sources":      {cmdSources, "list the lists of short names, and where they come from"},
+	"stats":        {cmdStats, "show statistics about tools and builds"},
+	"trust":        {cmdTrust, "list, add, or forget the tools trusted to run"},
+	"uninstall":    {cmdUninstall, "remove tools installed by va install"},
+	"verify":       {cmdVerify, "check cached tools have not been modified"},
+	"version":      {cmdVersion, "show the version of va, and of the lists of links built into it"},
+	"versions":     {cmdVersions, "list the versions of a tool"},
+	"which":        {cmdResolve, "the same as resolve"},
+}
+
+// The help, completion, lint-lists, and verify-lists commands refer to the commands, so
+// they are added once they exist. Commands without a summary are hidden from
+// the usage.
+func init() {
+	commands["help"] = command{cmdHelp, "show how to use va, or a command"}
+	commands["lint-lists"] = command{cmdLintLists, "check the lists of short names for problems"}
+	commands["verify-lists"] = command{cmdVerifyLists, "build the tool of every link in the lists, to check they still build"}
+	commands["__complete"] = command{cmdComplete, ""}
+	commands["__not-found"] = command{cmdNotFound, ""}
+}
+
+// cmdHelp shows how to use va, or how to use the command given.
+func cmdHelp(links map[string]Link, args []string) error {
+	switch len(args) {
+	case 0:
+		flag.CommandLine.SetOutput(os.Stdout)
+		flag.Usage()
+		return nil
+	case 1:
+		cmd, ok := commands[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown command: %s", args[0])
+		}
+		if err := cmd.run(links, []string{"-h"}); err != nil && !errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return nil
+	default:
+		return errors.New("usage: va help [command]")
+	}
+}
+
+// newFlagSet returns the flag set for the arguments of the command, which
+// describes the command when asked for help with -h or "va help".
+func newFlagSet(name, usage, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: va %s\n\n", usage)
+		if description != "" {
+			fmt.Fprintf(fs.Output(), "%s\n\n", description)
+		}
+		fs.PrintDefaults()
+	}
+	lastFlagSet = fs
+	return fs
+}
+
+// exitError is returned by a command which should exit with the exit code,
+// without printing anything further, such as when a tool it ran failed.
+type exitError int
+
+func (e exitError) Error() string {
+	return "exit status " + strconv.Itoa(int(e))
+}
+
+// cmdDoctor checks everything va needs is working, and says how to fix
+// anything which is not.
+func cmdDoctor(links map[string]Link, args []string) error {
+	fs := newFlagSet("doctor", "doctor",
+		"Checks the go command, the module and va caches, the temporary directory, the module\n"+
+			"proxies, the checksum database, and credentials for private modules.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	failed := false
+	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	for _, result := range Doctor(rootCtx) {
+		fmt.Fprintf(w, "%s\t%s:\t%s\n", result.Status, result.Name, result.Detail)
+		if result.Status != checkOK && result.Fix != "" {
+			fmt.Fprintf(w, "\t\tfix: %s\n", result.Fix)
+		}
+		failed = failed || result.Status == checkFail
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed {
+		return exitError(1)
+	}
+	return nil
+}
+
+// cmdHistory lists the tools run recently, numbered from the most recent
+// for va rerun.
+func cmdHistory(links map[string]Link, args []string) error {
+	fs := newFlagSet("history", "history [flags]", "")
+	limit := fs.Int("n", 20, "number of most recent runs to list (0 is all)")
+	asJSON := fs.Bool("json", false, "print the runs as JSON, one per line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	recs, err := readHistory(cacheDir)
+	if err != nil {
+		return err
+	}
+	first := 0
+	if *limit > 0 && len(recs) > *limit {
+		first = len(recs) - *limit
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, rec := range recs[first:] {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "N\tWHEN\tEXIT\tTOOK\tCOMMAND")
+	for i := first; i < len(recs); i++ {
+		rec := recs[i]
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", len(recs)-i, rec.Start.Local().Format("2006-01-02 15:04:05"),
+			rec.ExitCode, rec.Duration.Round(time.Millisecond), joinFields(append([]string{rerunArg(links, rec)}, rec.Args...)))
+	}
+	return w.Flush()
+}
+
+// cmdRerun runs a tool again, at the same version, with the same arguments,
+// and in the same directory, as it was run before.
+func cmdRerun(links map[string]Link, args []string) error {
+	fs := newFlagSet("rerun", "rerun [n]",
+		"Runs the nth most recent tool again, as listed by \"va history\", or the most recent if\n"+
+			"not given.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	n := 1
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		var err error
+		if n, err = strconv.Atoi(fs.Arg(0)); err != nil || n < 1 {
+			return fmt.Errorf("not a run number: %s", fs.Arg(0))
+		}
+	default:
+		return fmt.Errorf("unexpected arguments: %v", fs.Args()[1:])
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	recs, err := readHistory(cacheDir)
+	if err != nil {
+		return err
+	}
+	if n > len(recs) {
+		return fmt.Errorf("only %d runs are in the history", len(recs))
+	}
+	rec := recs[len(recs)-n]
+	if wd, _ := os.Getwd(); rec.Dir != "" && rec.Dir != wd {
+		if err := os.Chdir(rec.Dir); err != nil {
+			return err
+		}
+	}
+	toolArgs := append([]string{rerunArg(links, rec)}, rec.Args...)
+	logInfof("rerunning %s in %s", joinFields(toolArgs), rec.Dir)
+	return runSingle(links, toolArgs)
+}
+
+// rerunArg returns what to give va to run the tool again at the same
+// version: the short name of its link, so that the link's hooks run too,
+// if it still exists, or else its package path.
+func rerunArg(links map[string]Link, rec RunRecord) string {
+	if _, ok := links[rec.Short]; ok && rec.Short != "" {
+		_, version, _ := strings.Cut(rec.Tool, "@")
+		return rec.Short + "@" + version
+	}
+	return rec.Tool
+}
+
+// cmdInfo describes a tool, and the module it is in.
+func cmdInfo(links map[string]Link, args []string) error {
+	fs := newFlagSet("info", "info [flags] <path|short>[@version]", "")
+	asJSON := fs.Bool("json", false, "print the description as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one tool must be given")
+	}
+	mod, link, _ := expandLink(links, fs.Arg(0))
+	if err := checkTool(links, mod); err != nil {
+		return err
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		logWarnf("cache: %v", err)
+	} else {
+		UseGoEnvCache(cacheDir)
+	}
+	ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+	defer cancel()
+	info, err := Info(ctx, cacheDir, link, mod)
+	if err != nil {
+		return err
+	}
+	return writeInfo(os.Stdout, info, *asJSON)
+}
+
+// writeInfo writes the description of the tool, one field to a line, or as
+// JSON.
+func writeInfo(out io.Writer, info ToolInfo, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "\t")
+		return enc.Encode(info)
+	}
+	unknown := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+		return s
+	}
+	w := tabwriter.NewWriter(out, 1, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Tool:\t%s\n", info.Tool)
+	fmt.Fprintf(w, "Module:\t%s\n", info.Module)
+	fmt.Fprintf(w, "Pinned:\t%s\n", info.Pinned)
+	fmt.Fprintf(w, "Version:\t%s\n", info.Version)
+	fmt.Fprintf(w, "Latest:\t%s\n", unknown(info.Latest))
+	fmt.Fprintf(w, "Description:\t%s\n", info.Desc)
+	fmt.Fprintf(w, "License:\t%s\n", unknown(info.License))
+	fmt.Fprintf(w, "Repository:\t%s\n", unknown(info.Repository))
+	if info.Binary != "" {
+		fmt.Fprintf(w, "Binary:\t%s\n", info.Binary)
+		fmt.Fprintf(w, "Size:\t%s\n", formatSize(info.Size))
+	} else {
+		fmt.Fprint(w, "Binary:\tnot built\n")
+	}
+	return w.Flush()
+}
+
+// cmdResolve shows what a tool resolves to: the module and version, the
+// directory of the package, and the cached binary if it has been built.
+// Nothing is downloaded, built, or run.
+func cmdResolve(links map[string]Link, args []string) error {
+	fs := newFlagSet("resolve", "resolve [flags] <path|short>[@version]",
+		"Prints the module and version the tool resolves to, the directory of its package, and its\n"+
+			"cached binary, if it has been built, one to a line.")
+	asJSON := fs.Bool("json", false, "print the resolution as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one tool must be given")
+	}
+	mod, _, _ := expandLink(links, fs.Arg(0))
+	if err := checkTool(links, mod); err != nil {
+		return err
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		logWarnf("cache: %v", err)
+	} else {
+		UseGoEnvCache(cacheDir)
+	}
+	ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+	defer cancel()
+	m, downloaded, err := locateTool(ctx, cacheDir, mod)
+	if err != nil {
+		return err
+	}
+	var binary string
+	if cacheDir != "" && downloaded {
+		binary, _ = FindCachedTool(ctx, cacheDir, m.ToolPath()+"@"+m.Version, buildOptions())
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(struct {
+			Tool       string
+			Module     string
+			Version    string
+			Dir        string
+			Downloaded bool
+			Binary     string `json:",omitempty"`
+		}{m.ToolPath(), m.Path, m.Version, m.ToolDir(), downloaded, binary})
+	}
+	fmt.Printf("%s@%s\n%s\n", m.Path, m.Version, m.ToolDir())
+	if binary != "" {
+		fmt.Println(binary)
+	}
+	if !downloaded {
+		logInfof("%s@%s has not been downloaded", m.Path, m.Version)
+	}
+	return nil
+}
+
+// cmdList lists the registered links, or those matching the patterns.
+func cmdList(links map[string]Link, args []string) error {
+	fs := newFlagSet("list", "list [flags] [pattern...]",
+		"Lists the links whose short name, package, or description contains any of the patterns.")
+	synopsis := fs.Bool("synopsis", false, "describe links without a description using their package documentation (slow, but cached)")
+	regex := fs.Bool("regex", false, "treat the patterns as regular expressions")
+	tags := fs.String("tag", "", "only list links with all of the comma-separated tags")
+	asJSON := fs.Bool("json", false, "print the links as JSON")
+	asTSV := fs.Bool("tsv", false, "print the links as tab-separated short names, packages, and descriptions")
+	sortBy := fs.String("sort", "frecency", "order of the links: \"frecency\", most used recently first, or \"name\"")
+	installed := fs.Bool("installed", false, "list the tools installed by va install instead")
+	listTags := fs.Bool("tags", false, "list the tags of the links, and how many links have each, instead of the links")
+	origin := fs.Bool("origin", false, "show where each link is defined, and the definitions it overrides")
+	all := fs.Bool("all", false, "also list the links restricted to other operating systems or architectures")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *asJSON && *asTSV {
+		return errors.New("--json and --tsv cannot be used together")
+	}
+	if *installed {
+		return listInstalled(fs.Args(), *asJSON)
+	}
+
+	if !*all {
+		links = supportedLinks(links)
+	}
+	links, err := filterLinks(links, fs.Args(), *regex, *tags)
+	if err != nil {
+		return err
+	}
+	if *listTags {
+		return printTags(os.Stdout, links, *asJSON)
+	}
+	if *synopsis {
+		links = withSynopses(context.Background(), links)
+	}
+	var sorted []Link
+	switch *sortBy {
+	case "frecency":
+		sorted = linksByFrecency(links)
+	case "name":
+		sorted = sortedLinks(links, nil)
+	default:
+		return fmt.Errorf("unknown sort order: %s", *sortBy)
+	}
+	switch {
+	case *asJSON:
+		return printLinksJSON(os.Stdout, sorted)
+	case *asTSV:
+		return printLinksTSV(os.Stdout, sorted)
+	default:
+		return printLinks(os.Stdout, sorted, *origin)
+	}
+}
+
+// filterLinks returns the links matching any of the patterns, if any are
+// given, which also have all of the comma-separated tags. Patterns match
+// the short name, package, or description of a link, case insensitively,
+// either as substrings or as regular expressions.
+func filterLinks(links map[string]Link, patterns []string, regex bool, tags string) (map[string]Link, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		if !regex {
+			pattern = regexp.QuoteMeta(pattern)
+		}
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	var wantTags []string
+	if tags != "" {
+		wantTags = strings.Split(tags, ",")
+	}
+
+	filtered := make(map[string]Link)
+	for short, link := range links {
+		matched := len(res) == 0
+		for _, re := range res {
+			if re.MatchString(link.Short) || re.MatchString(link.Pkg) || re.MatchString(link.Desc) {
+				matched = true
+				break
+			}
+		}
+		for _, tag := range wantTags {
+			matched = matched && link.HasTag(tag)
+		}
+		if matched {
+			filtered[short] = link
+		}
+	}
+	return filtered, nil
+}
+
+// TagCount is a tag, and how many links have it.
+type TagCount struct {
+	Tag   string
+	Links int
+}
+
+// printTags prints each tag of the links, and how many of them have it,
+// most common first.
+func printTags(out io.Writer, links map[string]Link, asJSON bool) error {
+	counts := make(map[string]int)
+	for _, link := range links {
+		for _, tag := range link.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]TagCount, 0, len(counts))
+	for tag, n := range counts {
+		tags = append(tags, TagCount{tag, n})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Links != tags[j].Links {
+			return tags[i].Links > tags[j].Links
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "\t")
+		return enc.Encode(tags)
+	}
+	color := useColor(out)
+	w := tabwriter.NewWriter(out, 1, 4, 2, ' ', 0)
+	for _, tag := range tags {
+		fmt.Fprintf(w, "%s\t%d\n", paint(color, colorYellow, tag.Tag), tag.Links)
+	}
+	return w.Flush()
+}
+
+// printLinksJSON prints the links as a JSON array, in order.
+func printLinksJSON(out io.Writer, links []Link) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "\t")
+	return enc.Encode(links)
+}
+
+// printLinksTSV prints the short name, package, and description of each of
+// the links on a line, separated by tabs, sorted by short name.
+func printLinksTSV(out io.Writer, links []Link) error {
+	w := bufio.NewWriter(out)
+	for _, link := range links {
+		desc := strings.NewReplacer("\t", " ", "\n", " ").Replace(link.Desc)
+		fmt.Fprintf(w, "%s\t%s\t%s\n", link.Short, link.Pkg, desc)
+	}
+	return w.Flush()
+}
+
+// cmdSearch searches for tools, then offers to run one of them.
+func cmdSearch(links map[string]Link, args []string) error {
+	fs := newFlagSet("search", "search [flags] <query> [-- args...]",
+		"Searches the registered links, and optionally pkg.go.dev, for tools matching the query.\n"+
+			"In a terminal, offers to run one of them straight away, with the arguments after \"--\".")
+	remote := fs.Bool("remote", false, "also search pkg.go.dev")
+	limit := fs.Int("n", 10, "maximum number of results from each place searched")
+	run := fs.Bool("run", false, "run the best match without asking")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	words, toolArgs := fs.Args(), []string(nil)
+	for i, arg := range words {
+		if arg == "--" {
+			words, toolArgs = words[:i], words[i+1:]
+			break
+		}
+	}
+	query := strings.Join(words, " ")
+	if query == "" || *limit < 1 {
+		fs.Usage()
+		return errors.New("nothing to search for")
+	}
+	if *remote && offline {
+		return fmt.Errorf("--remote: %w", errOffline)
+	}
+
+	results := searchLinks(links, query)
+	if len(results) > *limit {
+		results = results[:*limit]
+	}
+	if *remote {
+		found, err := searchPkgGoDev(rootCtx, query, *limit)
+		if err != nil {
+			logWarnf("search: %v", err)
+		}
+		results = append(results, found...)
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("nothing found for %q", query)
+	}
+	if *run {
+		return runSingle(links, append([]string{results[0].Arg}, toolArgs...))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	for i, result := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, result.Name, result.Pkg, truncate(result.Desc, 60))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Run which? [1-%d, or enter for none]: ", len(results))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return nil
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(results) {
+		return fmt.Errorf("no such result: %s", answer)
+	}
+	return runSingle(links, append([]string{results[n-1].Arg}, toolArgs...))
+}
+
+// cmdPick has a link picked at the terminal, then a version and arguments
+// typed for it, and runs it.
+func cmdPick(links map[string]Link, args []string) error {
+	fs := newFlagSet("pick", "pick",
+		"Lists the links at the terminal to be filtered and one picked, then asks for the version\n"+
+			"and arguments to run it with.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+		return errors.New("a terminal is needed to pick from")
+	}
+	short, err := pickLink(links, os.Stdin, os.Stderr)
+	if err != nil || short == "" {
+		return err
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	link := links[short]
+	_, version, _ := strings.Cut(link.Pkg, "@")
+	for {
+		fmt.Fprintf(os.Stderr, "Version of %s [enter for %s, or ? to list]: ", short, version)
+		answer, err := readLine(in)
+		if err != nil {
+			return err
+		}
+		if answer != "?" {
+			if answer != "" {
+				version = answer
+			}
+			break
+		}
+		cacheDir, err := OpenCache()
+		if err != nil {
+			logWarnf("cache: %v", err)
+		} else {
+			UseGoEnvCache(cacheDir)
+		}
+		ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+		_, versions, err := ToolVersions(ctx, cacheDir, link.Pkg, false, false)
+		cancel()
+		if err != nil {
+			logWarnf("versions: %v", err)
+			continue
+		}
+		for _, v := range versions {
+			fmt.Fprintf(os.Stderr, "  %s\n", v.Version)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Arguments for %s: ", short)
+	answer, err := readLine(in)
+	if err != nil {
+		return err
+	}
+	toolArgs, err := splitFields(answer)
+	if err != nil {
+		return err
+	}
+	return runSingle(links, append([]string{short + "@" + version}, toolArgs...))
+}
+
+// cmdSources lists each prefix, the source which contributes it, and the
+// number of links within it.
+func cmdSources(links map[string]Link, args []string) error {
+	fs := newFlagSet("sources", "sources", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	// Group the links by the list file they came from.
+	counts := make(map[string]int)
+	files := make(map[string]Link)
+	for _, link := range links {
+		counts[link.Origin()]++
+		files[link.Origin()] = link
+	}
+	origins := make([]string, 0, len(counts))
+	for origin := range counts {
+		origins = append(origins, origin)
+	}
+	sort.Strings(origins)
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	fmt.Fprint(w, "PREFIX\tSOURCE\tLINKS\n")
+	for _, origin := range origins {
+		prefix, _ := listPrefix(files[origin].ListFile())
+		if prefix == "" {
+			prefix = "(none)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\n", prefix, origin, counts[origin])
+	}
+	return w.Flush()
+}
+
+// cmdLintLists checks every list of short names for problems, reporting all
+// of them, where they are, rather than only the first as loading them does.
+func cmdLintLists(links map[string]Link, args []string) error {
+	fs := newFlagSet("lint-lists", "lint-lists [flags] [dir|file...]",
+		"Checks the list files of every source of links, or only those given, for lines which\n"+
+			"cannot be read, bad short names and module paths, short names defined twice, and\n"+
+			"aliases and replacements of short names which do not exist. With --online, the module\n"+
+			"of each link is looked up at its version, and checked for having been retracted.\n"+
+			"Exits with 1 if there are any problems other than warnings.")
+	online := fs.Bool("online", false, "check each module can be found at its version, and has not been retracted")
+	strict := fs.Bool("strict", false, "exit with 1 if there are any warnings, too")
+	asJSON := fs.Bool("json", false, "print the problems as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	sources := linkSources()
+	if fs.NArg() > 0 {
+		var err error
+		if sources, err = lintSources(fs.Args()); err != nil {
+			return err
+		}
+	}
+
+	lint := LintLists(sources)
+	if *online {
+		if offline {
+			return fmt.Errorf("--online: %w", errOffline)
+		}
+		ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+		defer cancel()
+		LintOnline(ctx, &lint)
+		sortProblems(sources, lint.Problems)
+	}
+
+	errs, warnings := 0, 0
+	for _, p := range lint.Problems {
+		if p.Warning {
+			warnings++
+		} else {
+			errs++
+		}
+	}
+	if *asJSON {
+		problems := lint.Problems
+		if problems == nil {
+			problems = []ListProblem{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(problems); err != nil {
+			return err
+		}
+	} else {
+		color := useColor(os.Stdout)
+		for _, p := range lint.Problems {
+			kind := paint(color, colorRed, "error")
+			if p.Warning {
+				kind = paint(color, colorYellow, "warning")
+			}
+			fmt.Printf("%s: %s: %s\n", p.Location(), kind, p.Problem)
+		}
+		logInfof("%d list files: %d errors, %d warnings", lint.Files, errs, warnings)
+	}
+	if errs > 0 || *strict && warnings > 0 {
+		return exitError(1)
+	}
+	return nil
+}
+
+// cmdVerifyLists builds the tool of every link in the lists given, or in
+// every list, reporting those which no longer build.
+func cmdVerifyLists(links map[string]Link, args []string) error {
+	fs := newFlagSet("verify-lists", "verify-lists [flags] [dir|file...]",
+		"Resolves, downloads, and builds the tool of every link in the list files given, or in\n"+
+			"every list if none are, reporting those which no longer build at their versions. Tools\n"+
+			"already cached for the go toolchain are not built again, and links for other systems\n"+
+			"are skipped. Exits with 1 if any do not build, or if the lists have problems which\n"+
+			"\"va lint-lists\" would report as errors.")
+	jobs := fs.Int("j", 1, "number of tools to build at once")
+	since := fs.String("since", "", "only build links whose definitions have changed since the git `ref`, such as \"origin/main\"")
+	asJSON := fs.Bool("json", false, "print the outcome for each link as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *jobs < 1 {
+		return errors.New("-j must be at least 1")
+	}
+	sources := linkSources()
+	verified := make(map[string]bool)
+	if fs.NArg() > 0 {
+		given, err := lintSources(fs.Args())
+		if err != nil {
+			return err
+		}
+		for _, src := range given {
+			verified[src.Name] = true
+		}
+		sources = append(sources, given...)
+	}
+
+	lint := LintLists(sources)
+	failed := 0
+	for _, p := range lint.Problems {
+		if !p.Warning && (len(verified) == 0 || verified[p.Source]) {
+			logErrorf("%s: %s", p.Location(), p.Problem)
+			failed++
+		}
+	}
+	toVerify := verifiableLinks(&lint, verified)
+	if *since != "" {
+		var err error
+		if toVerify, err = changedLinks(rootCtx, &lint, toVerify, *since); err != nil {
+			return err
+		}
+	}
+	if len(toVerify) == 0 {
+		logInfof("no links to build")
+	}
+
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	UseGoEnvCache(cacheDir)
+	results := VerifyLinks(cacheDir, toVerify, *jobs)
+	skipped := 0
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			failed++
+		case r.Skipped != "":
+			skipped++
+		}
+	}
+
+	if *asJSON {
+		if results == nil {
+			results = []ListVerification{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		color := useColor(os.Stdout)
+		w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+		for _, r := range results {
+			status, detail := paint(color, colorGreen, "ok"), r.Pkg
+			if pkgPath, version, _ := strings.Cut(r.Pkg, "@"); r.Version != "" && r.Version != version {
+				detail = pkgPath + "@" + r.Version + " (" + version + ")"
+			}
+			took := r.Took.Round(time.Millisecond).String()
+			switch {
+			case r.Error != "":
+				status, detail = paint(color, colorRed, "FAIL"), r.Location
+			case r.Skipped != "":
+				status, took = paint(color, colorYellow, "skip"), r.Skipped
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", status, r.Short, detail, took)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		for _, r := range results {
+			if r.Error != "" {
+				fmt.Printf("\n%s: %s (%s):\n%s\n", r.Location, r.Short, r.Pkg, r.Error)
+			}
+		}
+		if skipped > 0 {
+			logInfof("skipped %d links for other systems than %s/%s", skipped, runtime.GOOS, runtime.GOARCH)
+		}
+	}
+	if failed > 0 {
+		return exitError(1)
+	}
+	return nil
+}
+
+// cmdRun runs a tool, as va does when not given a command. Several tools
+// may be given before "--", in which case they are all built at once, then
+// each is run in turn with the same arguments, stopping at the first which
+// fails.
+func cmdRun(links map[string]Link, args []string) error {
+	fs := newFlagSet("run", "run <path|short>[@version] [args...]\n"+
+		"       va run <path|short>[@version]... -- [args...]",
+		"Runs the tool with the arguments, as va does when not given a command. Given several\n"+
+			"tools before \"--\", builds them all, then runs each in turn with the arguments after\n"+
+			"it, stopping at the first which fails.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	tools, toolArgs := args, []string(nil)
+	for i, arg := range args {
+		if arg == "--" {
+			tools, toolArgs = args[:i], args[i+1:]
+			break
+		}
+	}
+	if len(tools) == 0 {
+		fs.Usage()
+		return errors.New("no tools to run")
+	}
+	switch {
+	case len(tools) == len(args):
+		// Without "--", the arguments after the tool are its own.
+		return runSingle(links, args)
+	case len(tools) == 1:
+		return runSingle(links, append(tools, toolArgs...))
+	}
+	if *flagShowBuildCmd {
+		return errors.New("--show-build-cmd only works with a single tool")
+	}
+	if info, err := os.Stat(*flagOutput); *flagOutput != "" && (err != nil || !info.IsDir()) {
+		return errors.New("--output must be a directory when running several tools")
+	}
+	if *flagArgsFile != "" {
+		fileArgs, err := ReadArgsFile(*flagArgsFile)
+		if err != nil {
+			return fmt.Errorf("args-file: %w", err)
+		}
+		toolArgs = append(fileArgs, toolArgs...)
+	}
+	wrap, err := splitFields(*flagWrap)
+	if err != nil {
+		return fmt.Errorf("wrap: %w", err)
+	}
+	mods := make([]string, len(tools))
+	toolLinks := make([]Link, len(tools))
+	for i, arg := range tools {
+		tools[i] = followDeprecation(links, arg)
+		warnUnsupported(links, tools[i])
+		mods[i], toolLinks[i], _ = expandLink(links, tools[i])
+		if err := checkTool(links, mods[i]); err != nil {
+			return err
+		}
+	}
+	if *flagExplain || *flagDryRun {
+		for i, arg := range tools {
+			if i > 0 {
+				fmt.Println()
+			}
+			err := dryRun(rootCtx, os.Stdout, links, arg, wrap, toolArgs)
+			if *flagExplain {
+				err = explain(rootCtx, os.Stdout, links, arg)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := sweepTemps(); err != nil {
+		logWarnf("clean: %v", err)
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		logWarnf("cache: %v", err)
+	} else {
+		UseGoEnvCache(cacheDir)
+	}
+	for i, mod := range mods {
+		if err := checkTrust(cacheDir, toolLinks[i], mod); err != nil {
+			return err
+		}
+	}
+
+	// Build every tool before running any of them, so that a tool which
+	// fails to build is found before the others have done anything.
+	type prepared struct {
+		tool string
+		temp bool
+		err  error
+		rec  *BuildRecord
+	}
+	built := make([]prepared, len(mods))
+	buildCtx, cancel := withTimeout(rootCtx, *flagTimeout)
+	var wg sync.WaitGroup
+	for i := range mods {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := &built[i]
+			ctx, rec := withBuildRecord(buildCtx)
+			p.tool, p.temp, p.err = prepareTool(ctx, cacheDir, mods[i], linkBuildOptions(toolLinks[i]))
+			p.rec = rec
+		}(i)
+	}
+	wg.Wait()
+	cancel()
+	defer func() {
+		for _, p := range built {
+			if p.temp {
+				removeTemp(p.tool)
+			}
+		}
+	}()
+	prepare := time.Since(started)
+	runs := make([]RunRecord, len(mods))
+	failed := 0
+	for i, p := range built {
+		runs[i] = RunRecord{
+			Short:    toolLinks[i].Short,
+			Tool:     mods[i],
+			Args:     toolArgs,
+			ExitCode: -1,
+			Prepare:  prepare,
+			Built:    p.rec.Download > 0 || p.rec.Build > 0,
+		}
+		if p.err != nil {
+			logWarnf("run: %s: %v", mods[i], p.err)
+			runs[i].Start = time.Now()
+			recordRun(cacheDir, runs[i])
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tools failed to build", failed, len(mods))
+	}
+	for i, p := range built {
+		if err := keepTool(p.tool, mods[i]); err != nil {
+			return fmt.Errorf("output: %w", err)
+		}
+	}
+
+	for i, p := range built {
+		runs[i].Start = time.Now()
+		exitCode := runTool(toolLinks[i], wrap, p.tool, toolArgs, p.temp)
+		built[i].temp = false // runTool has removed it.
+		runs[i].ExitCode, runs[i].Duration = exitCode, time.Since(runs[i].Start)
+		recordRun(cacheDir, runs[i])
+		if exitCode != 0 {
+			return exitError(exitCode)
+		}
+	}
+	if cacheDir != "" {
+		if err := autoGC(cacheDir, ""); err != nil {
+			logWarnf("cache gc: %v", err)
+		}
+	}
+	return nil
+}
+
+// cmdBench measures how long each phase of running a tool takes, so that
+// changes to how quickly va starts can be measured.
+func cmdBench(links map[string]Link, args []string) error {
+	fs := newFlagSet("bench", "bench [flags] <path|short>[@version] [args...]", "")
+	n := fs.Int("n", 10, "number of times to run the tool")
+	cold := fs.Bool("cold", false, "remove the tool from the cache after each run, so that each run builds it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || *n < 1 {
+		fs.Usage()
+		return errors.New("nothing to benchmark")
+	}
+	mods, err := expandMods(links, fs.Args()[:1])
+	if err != nil {
+		return err
+	}
+
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	UseGoEnvCache(cacheDir)
+	_, link, _ := expandLink(links, fs.Arg(0))
+	if err := checkTrust(cacheDir, link, mods[0]); err != nil {
+		return err
+	}
+	timings, err := Bench(cacheDir, mods[0], fs.Args()[1:], *n, *cold)
+	if err != nil {
+		return err
+	}
+	return printBench(os.Stdout, timings)
+}
+
+// bundleCommands are the subcommands of the bundle command.
+var bundleCommands = map[string]func(cacheDir string, links map[string]Link, args []string) error{
+	"create": cmdBundleCreate,
+	"import": cmdBundleImport,
+}
+
+// cmdBundle moves tools onto machines which cannot reach a module proxy,
+// such as those on air-gapped networks.
+func cmdBundle(links map[string]Link, args []string) error {
+	fs := newFlagSet("bundle", "bundle create [flags] <path|short>[@version]...\n"+
+		"       va bundle import <file>", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing subcommand: create or import")
+	}
+	sub, ok := bundleCommands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown subcommand: %s", fs.Arg(0))
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	UseGoEnvCache(cacheDir)
+	return sub(cacheDir, links, fs.Args()[1:])
+}
+
+// cmdBundleCreate writes a bundle of tools, to be imported elsewhere.
+func cmdBundleCreate(cacheDir string, links map[string]Link, args []string) error {
+	fs := flag.NewFlagSet("bundle create", flag.ContinueOnError)
+	output := fs.String("o", "va-bundle.tar.gz", "file to write the bundle to, compressed according to its extension: .tar.zst, .tar.gz, or .tar")
+	binaries := fs.Bool("binaries", false, "include the binaries built for the current go toolchain, so that they need not be built again")
+	static := fs.Bool("static", *flagStatic, "build statically linked binaries, as with va --static")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: va bundle create [flags] <path|short>[@version]...\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no tools to bundle")
+	}
+	mods, err := expandMods(links, fs.Args())
+	if err != nil {
+		return err
+	}
+	opts := buildOptions()
+	opts.Static = *static
+	if err := CreateBundle(rootCtx, cacheDir, mods, *output, opts, *binaries); err != nil {
+		return err
+	}
+	logInfof("bundled %d tools into %s", len(mods), *output)
+	return nil
+}
+
+// cmdBundleImport imports a bundle of tools, so that they can be run
+// without going online.
+func cmdBundleImport(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: va bundle import <file>")
+	}
+	tools, err := ImportBundle(rootCtx, cacheDir, args[0])
+	if err != nil {
+		return err
+	}
+	for _, tool := range tools {
+		fmt.Printf("%s@%s\n", tool.ToolPath(), tool.Version)
+	}
+	return nil
+}
+
+// cmdDaemon keeps tools downloaded and built in the background, so that
+// running them is always quick.
+func cmdDaemon(links map[string]Link, args []string) error {
+	fs := newFlagSet("daemon", "daemon [flags] [<path|short>[@version]...]",
+		"Keeps the tools given, and every tool in the cache, built for the current go toolchain.")
+	interval := fs.Duration("interval", time.Hour, "how often to resolve version queries such as \"latest\" again")
+	once := fs.Bool("once", false, "warm the tools once and exit, rather than running forever")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	mods, err := expandMods(links, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	UseGoEnvCache(cacheDir)
+	return Daemon(context.Background(), cacheDir, mods, *interval, *once)
+}
+
+// cmdPrefetch downloads and builds tools without running them, so that they
+// are ready to run later, such as when building a container image.
+func cmdPrefetch(links map[string]Link, args []string) error {
+	fs := newFlagSet("prefetch", "prefetch [flags] [<path|short>[@version]...]", "")
+	file := fs.String("file", "", "file of tools to prefetch, one per line, in addition to any given as arguments")
+	static := fs.Bool("static", *flagStatic, "build statically linked binaries, as with va --static")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tools := fs.Args()
+	if *file != "" {
+		fileTools, err := ReadArgsFile(*file)
+		if err != nil {
+			return err
+		}
+		tools = append(fileTools, tools...)
+	}
+	if len(tools) == 0 {
+		return errors.New("no tools to prefetch")
+	}
+	mods, err := expandMods(links, tools)
+	if err != nil {
+		return err
+	}
+
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	UseGoEnvCache(cacheDir)
+	failed := 0
+	for i, mod := range mods {
+		_, link, _ := expandLink(links, tools[i])
+		opts := linkBuildOptions(link)
+		opts.Static = *static
+		m, err := Prefetch(rootCtx, cacheDir, mod, opts)
+		if err != nil {
+			logWarnf("prefetch: %s: %v", mod, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s@%s\n", m.ToolPath(), m.Version)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tools failed", failed, len(mods))
+	}
+	return nil
+}
+
+// expandMods expands the shortened links in the arguments, checking that
+// each is a valid package path and version.
+func expandMods(links map[string]Link, args []string) ([]string, error) {
+	mods := make([]string, 0, len(args))
+	for _, arg := range args {
+		mod, _, _ := expandLink(links, arg)
+		if err := checkTool(links, mod); err != nil {
+			return nil, err
+		}
+		mods = append(mods, mod)
+	}
+	return mods, nil
+}
+
+// cmdClean removes files left behind by va.
+func cmdClean(links map[string]Link, args []string) error {
+	fs := newFlagSet("clean", "clean [flags]", "")
+	orphans := fs.Bool("orphans", false, "remove temporary binaries left behind by runs of va which were killed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if !*orphans {
+		return errors.New("nothing to clean, try --orphans")
+	}
+	removed, err := sweepTemps()
+	for _, name := range removed {
+		fmt.Println(name)
+	}
+	logInfof("removed %d orphaned files", len(removed))
+	return err
+}
+
+// cmdGC evicts tools from the cache.
+func cmdGC(links map[string]Link, args []string) error {
+	policy, err := defaultGCPolicy()
+	if err != nil {
+		return err
+	}
+	fs := newFlagSet("gc", "gc [flags]", "")
+	maxSize := fs.String("max-size", strconv.FormatInt(policy.MaxSize, 10), "evict least recently used tools until the cache is no bigger than this, e.g. 512M (0 is unlimited)")
+	maxAge := fs.String("max-age", policy.MaxAge.String(), "evict tools not used for this long, e.g. 30d (0 is unlimited)")
+	dryRun := fs.Bool("dry-run", false, "only list the tools that would be evicted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if policy.MaxSize, err = parseSize(*maxSize); err != nil {
+		return err
+	}
+	if policy.MaxAge, err = parseAge(*maxAge); err != nil {
+		return err
+	}
+
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	evicted, err := GC(cacheDir, policy, "", *dryRun)
+	var freed int64
+	for _, entry := range evicted {
+		fmt.Printf("%s@%s\t%s\n", entry.ToolPath(), entry.Meta.Key.Version, formatSize(entry.Size))
+		freed += entry.Size
+	}
+	logInfof("evicted %d tools, freeing %s", len(evicted), formatSize(freed))
+	return err
+}
+
+// cacheCommands are the subcommands of the cache command.
+var cacheCommands = map[string]func(cacheDir string, links map[string]Link, args []string) error{
+	"info":  cmdCacheInfo,
+	"ls":    cmdCacheLs,
+	"purge": cmdCachePurge,
+	"rm":    cmdCacheRm,
+}
+
+// cmdCache inspects and manages the cache of built tools.
+func cmdCache(links map[string]Link, args []string) error {
+	fs := newFlagSet("cache", "cache ls\n"+
+		"       va cache info <path|short>[@version]\n"+
+		"       va cache rm <path|short>[@version]...\n"+
+		"       va cache purge", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing subcommand: ls, info, rm, or purge")
+	}
+	sub, ok := cacheCommands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown subcommand: %s", fs.Arg(0))
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	return sub(cacheDir, links, fs.Args()[1:])
+}
+
+// cmdCacheLs lists the tools in the cache, most recently used first.
+func cmdCacheLs(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	entries, err := cacheEntries(cacheDir)
+	if err != nil {
+		return err
+	}
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	fmt.Fprint(w, "TOOL\tVERSION\tSIZE\tLAST USED\n")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.ToolPath(), entry.Meta.Key.Version, formatSize(entry.Size), entry.Used.Format("2006-01-02 15:04"))
+		total += entry.Size
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	logInfof("%d tools, using %s in %s", len(entries), formatSize(total), cacheDir)
+	return nil
+}
+
+// cmdCacheInfo describes the cached builds of a tool.
+func cmdCacheInfo(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: va cache info <path|short>[@version]")
+	}
+	entries, err := matchingEntries(cacheDir, links, args[0])
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		if i > 0 {
+			fmt.Println()
+		}
+		key := entry.Meta.Key
+		w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Tool:\t%s\n", entry.ToolPath())
+		fmt.Fprintf(w, "Module:\t%s@%s\n", key.Path, key.Version)
+		fmt.Fprintf(w, "Platform:\t%s/%s\n", key.Env.GOOS, key.Env.GOARCH)
+		fmt.Fprintf(w, "Go:\t%s\n", key.Env.GOVERSION)
+		fmt.Fprintf(w, "Static:\t%t\n", key.Build.Static)
+		if len(key.Build.Env) > 0 {
+			fmt.Fprintf(w, "Build env:\t%s\n", strings.Join(key.Build.Env, " "))
+		}
+		if len(key.Build.Tags) > 0 {
+			fmt.Fprintf(w, "Build tags:\t%s\n", strings.Join(key.Build.Tags, ","))
+		}
+		if key.Build.Ldflags != "" {
+			fmt.Fprintf(w, "Ldflags:\t%s\n", key.Build.Ldflags)
+		}
+		fmt.Fprintf(w, "Binary:\t%s\n", entry.Tool())
+		fmt.Fprintf(w, "SHA-256:\t%s\n", entry.Meta.SHA256)
+		fmt.Fprintf(w, "Size:\t%s\n", formatSize(entry.Size))
+		fmt.Fprintf(w, "Built:\t%s\n", entry.Meta.Built.Format(time.RFC3339))
+		fmt.Fprintf(w, "Last used:\t%s\n", entry.Used.Format(time.RFC3339))
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cmdCacheRm removes the cached builds of a tool.
+func cmdCacheRm(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: va cache rm <path|short>[@version]...")
+	}
+	for _, arg := range args {
+		entries, err := matchingEntries(cacheDir, links, arg)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := os.RemoveAll(entry.Dir); err != nil {
+				return err
+			}
+			logInfof("removed %s@%s", entry.ToolPath(), entry.Meta.Key.Version)
+		}
+	}
+	return nil
+}
+
+// cmdCachePurge removes everything from the cache.
+func cmdCachePurge(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	files, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Name() == cacheVersionFile {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(cacheDir, f.Name())); err != nil {
+			return err
+		}
+	}
+	logInfof("purged %s", cacheDir)
+	return nil
+}
+
+// matchingEntries returns the tools in the cache built from the path, which
+// may be a shortened link. The version is only matched if one is given
+// explicitly, so that a link for "latest" matches every version cached.
+func matchingEntries(cacheDir string, links map[string]Link, arg string) ([]cacheEntry, error) {
+	mod, _, _ := expandLink(links, arg)
+	pkgPath, version, _ := strings.Cut(mod, "@")
+	explicit := strings.Contains(arg, "@")
+
+	entries, err := cacheEntries(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	var matched []cacheEntry
+	for _, entry := range entries {
+		if entry.ToolPath() == pkgPath && (!explicit || entry.Meta.Key.Version == version) {
+			matched = append(matched, entry)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%s is not in the cache", arg)
+	}
+	return matched, nil
+}
+
+// cmdVerify checks that the binaries of the tools in the cache have not been
+// modified or corrupted since they were built.
+func cmdVerify(links map[string]Link, args []string) error {
+	fs := newFlagSet("verify", "verify [flags] [<path|short>[@version]...]", "")
+	remove := fs.Bool("remove", false, "remove tools which fail verification, so that they are built again")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	var entries []cacheEntry
+	if fs.NArg() == 0 {
+		if entries, err = cacheEntries(cacheDir); err != nil {
+			return err
+		}
+	}
+	for _, arg := range fs.Args() {
+		matched, err := matchingEntries(cacheDir, links, arg)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, matched...)
+	}
+
+	failed := 0
+	for _, entry := range entries {
+		tool := entry.ToolPath() + "@" + entry.Meta.Key.Version
+		err := verifyEntry(entry.Dir)
+		switch {
+		case err == nil:
+			fmt.Printf("ok\t%s\t%s\n", tool, entry.Hash[:12])
+			continue
+		case errors.Is(err, errNoChecksum):
+			fmt.Printf("unknown\t%s\t%s\n", tool, entry.Hash[:12])
+			continue
+		}
+		failed++
+		fmt.Printf("FAILED\t%s\t%s\n", tool, entry.Hash[:12])
+		logWarnf("verify: %s: %v", tool, err)
+		if *remove {
+			if err := os.RemoveAll(entry.Dir); err != nil {
+				return err
+			}
+			os.Remove(filepath.Join(cacheDir, objectsDir, entry.Meta.SHA256))
+			logInfof("removed %s", tool)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tools failed verification", failed, len(entries))
+	}
+	return nil
+}
+
+// statsCommands are the subcommands of the stats command.
+var statsCommands = map[string]func(cacheDir string, args []string) error{
+	"builds": cmdStatsBuilds,
+	"usage":  cmdStatsUsage,
+}
+
+// cmdStats reports statistics about how va has been used.
+func cmdStats(links map[string]Link, args []string) error {
+	fs := newFlagSet("stats", "stats builds [flags]\n"+
+		"       va stats usage [flags]", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing subcommand: builds or usage")
+	}
+	sub, ok := statsCommands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown subcommand: %s", fs.Arg(0))
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	return sub(cacheDir, fs.Args()[1:])
+}
+
+// cmdStatsBuilds reports where the time went in recent builds, and how much
+// of each came from the go build cache.
+func cmdStatsBuilds(cacheDir string, args []string) error {
+	fs := flag.NewFlagSet("stats builds", flag.ContinueOnError)
+	limit := fs.Int("n", 20, "number of most recent builds to report (0 is all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	recs, err := readBuildRecords(cacheDir)
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(recs) > *limit {
+		recs = recs[len(recs)-*limit:]
+	}
+
+	round := func(d time.Duration) string {
+		return d.Round(10 * time.Millisecond).String()
+	}
+	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	fmt.Fprint(w, "WHEN\tTOOL\tVERSION\tDOWNLOAD\tCOMPILE\tLINK\tTOTAL\tCACHED\tBOUND BY\n")
+	for _, rec := range recs {
+		cached := "-"
+		if rec.Packages > 0 {
+			cached = fmt.Sprintf("%d/%d (%d%%)", rec.Cached, rec.Packages, 100*rec.Cached/rec.Packages)
+		}
+		bound := "network"
+		if rec.Compile > rec.Download && rec.Compile >= rec.Link {
+			bound = "compile"
+		} else if rec.Link > rec.Download && rec.Link > rec.Compile {
+			bound = "link"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			rec.Time.Format("2006-01-02 15:04"), rec.Tool, rec.Version,
+			round(rec.Download), round(rec.Compile), round(rec.Link), round(rec.Download+rec.Build),
+			cached, bound)
+	}
+	return w.Flush()
+}
+
+// cmdStatsUsage summarises how va has been used: which tools are run most,
+// how often they fail, how quickly they start, and how much time the cache
+// has saved.
+func cmdStatsUsage(cacheDir string, args []string) error {
+	fs := flag.NewFlagSet("stats usage", flag.ContinueOnError)
+	limit := fs.Int("n", 10, "number of most used tools to report (0 is all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	runs, err := readHistory(cacheDir)
+	if err != nil {
+		return err
+	}
+	builds, err := readBuildRecords(cacheDir)
+	if err != nil {
+		return err
+	}
+	entries, err := cacheEntries(cacheDir)
+	if err != nil {
+		return err
+	}
+	u := summariseUsage(runs, builds)
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+
+	average := func(total time.Duration, n int) string {
+		if n == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%s over %d runs", (total / time.Duration(n)).Round(time.Millisecond), n)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Runs:\t%d\n", u.Runs)
+	fmt.Fprintf(w, "Warm start:\t%s\n", average(u.WarmTime, u.Warm))
+	fmt.Fprintf(w, "Cold start:\t%s\n", average(u.ColdTime, u.Cold))
+	fmt.Fprintf(w, "Time saved:\t%s\n", u.Saved.Round(time.Second))
+	fmt.Fprintf(w, "Cache:\t%d tools, %s\n", len(entries), formatSize(size))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(u.Tools) == 0 {
+		return nil
+	}
+
+	tools := u.Tools
+	if *limit > 0 && len(tools) > *limit {
+		tools = tools[:*limit]
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	fmt.Fprint(w, "TOOL\tRUNS\tFAILED\tLAST RUN\n")
+	for _, tu := range tools {
+		fmt.Fprintf(w, "%s\t%d\t%d (%d%%)\t%s\n", tu.Tool, tu.Runs, tu.Failed, 100*tu.Failed/tu.Runs, tu.Last.Local().Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// cmdCacheServer serves built tools to other machines, which use it by
+// setting $VA_REMOTE_CACHE to its URL.
+func cmdCacheServer(links map[string]Link, args []string) error {
+	fs := newFlagSet("cache-server", "cache-server [flags]", "")
+	listen := fs.String("listen", "localhost:8080", "address to listen on, e.g. :8080 for every interface")
+	dir := fs.String("dir", "", "directory to store tools in (default \"remote\" within the cache directory)")
+	readOnly := fs.Bool("read-only", false, "serve tools, but refuse to store any")
+	maxSize := fs.String("max-size", "1G", "refuse to store tools bigger than this, e.g. 512M (0 is unlimited)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	size, err := parseSize(*maxSize)
+	if err != nil {
+		return err
+	}
+	// Anyone who can store a tool can have it run by every client, so a
+	// server which stores tools must be told who may.
+	token := remoteCacheToken()
+	if token == "" && !*readOnly {
+		return errors.New("$VA_REMOTE_CACHE_TOKEN (or remote-cache-token in config.toml) must be set for clients to store tools, or --read-only given")
+	}
+
+	if *dir == "" {
+		cacheDir, err := OpenCache()
+		if err != nil {
+			return err
+		}
+		*dir = filepath.Join(cacheDir, "remote")
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	srv := &cacheServer{
+		dir:      *dir,
+		token:    token,
+		readOnly: *readOnly,
+		maxSize:  size,
+	}
+	logInfof("serving %s on %s", *dir, *listen)
+	return http.ListenAndServe(*listen, srv)
+}
+
+// cmdVersions lists the versions of the module containing a tool, marking
+// which the tool is pinned to and which are cached.
+func cmdVersions(links map[string]Link, args []string) error {
+	fs := newFlagSet("versions", "versions [flags] <path|short>[@version]", "")
+	pre := fs.Bool("pre", false, "include pre-releases")
+	pseudo := fs.Bool("pseudo", false, "include pseudo-versions found in the module cache")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one tool must be given")
+	}
+	mod, _, _ := expandLink(links, fs.Arg(0))
+	if err := checkTool(links, mod); err != nil {
+		return err
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		logWarnf("cache: %v", err)
+	} else {
+		UseGoEnvCache(cacheDir)
+	}
+	ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+	defer cancel()
+	modPath, versions, err := ToolVersions(ctx, cacheDir, mod, *pre, *pseudo)
+	if err != nil {
+		return err
+	}
+
+	// The versions are padded by hand, as only some are highlighted, and
+	// the escape sequences would otherwise upset the alignment.
+	_, query, _ := strings.Cut(mod, "@")
+	color, width := useColor(os.Stdout), 0
+	for _, v := range versions {
+		if len(v.Version) > width {
+			width = len(v.Version)
+		}
+	}
+	for _, v := range versions {
+		var notes []string
+		if v.Pinned {
+			pinned := "pinned"
+			if isQuery(query) {
+				pinned += " (" + query + ")"
+			}
+			notes = append(notes, pinned)
+		}
+		if v.Downloaded {
+			notes = append(notes, "downloaded")
+		}
+		if v.Built {
+			notes = append(notes, "built")
+		}
+		version := fmt.Sprintf("%-*s", width, v.Version)
+		switch {
+		case v.Pinned:
+			version = paint(color, colorBold, version)
+		case v.Built || v.Downloaded:
+			version = paint(color, colorGreen, version)
+		}
+		fmt.Println(strings.TrimRight(version+"  "+paint(color, colorDim, strings.Join(notes, ", ")), " "))
+	}
+	logInfof("%d versions of %s", len(versions), modPath)
+	return nil
+}
+
+// cmdOutdated lists the links pinned to a version for which there is a newer
+// version. Like diff, it exits with 1 if there are any, and 2 if any link
+// could not be checked.
+func cmdOutdated(links map[string]Link, args []string) error {
+	fs := newFlagSet("outdated", "outdated [flags] [short...]",
+		"Checks each link pinned to a version, rather than to a query such as \"latest\", for a\n"+
+			"newer version which has not been retracted. Exits with 1 if there are any upgrades, and\n"+
+			"with 2 if any link could not be checked.")
+	asJSON := fs.Bool("json", false, "print the upgrades as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var checked []Link
+	if fs.NArg() == 0 {
+		checked = sortedLinks(links, nil)
+	}
+	for _, short := range fs.Args() {
+		link, ok := links[short]
+		if !ok {
+			return checkTool(links, short)
+		}
+		checked = append(checked, link)
+	}
+	if offline {
+		return fmt.Errorf("checking for newer versions: %w", errOffline)
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		logWarnf("cache: %v", err)
+	} else {
+		UseGoEnvCache(cacheDir)
+	}
+	if len(pinnedLinks(checked)) == 0 {
+		logInfof("none of the links are pinned to a version")
+	}
+	ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+	defer cancel()
+	failed := 0
+	upgrades := Outdated(ctx, cacheDir, checked, func(link Link, err error) {
+		logWarnf("outdated: %s: %v", link.Short, err)
+		failed++
+	})
+
+	if err := writeUpgrades(os.Stdout, upgrades, *asJSON); err != nil {
+		return err
+	}
+	switch {
+	case failed > 0:
+		return exitError(2)
+	case len(upgrades) > 0:
+		return exitError(1)
+	}
+	return nil
+}
+
+// writeUpgrades writes a table of the upgrades, one to a line, or a JSON
+// array of them, which is empty rather than null if there are none.
+func writeUpgrades(out io.Writer, upgrades []Upgrade, asJSON bool) error {
+	if asJSON {
+		if upgrades == nil {
+			upgrades = []Upgrade{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "\t")
+		return enc.Encode(upgrades)
+	}
+	color := useColor(out)
+	w := tabwriter.NewWriter(out, 1, 4, 2, ' ', 0)
+	for _, u := range upgrades {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", paint(color, colorCyan, u.Short), u.Current, paint(color, colorDim, "->"), paint(color, colorGreen, u.Latest), u.Module)
+	}
+	return w.Flush()
+}
+
+// trustCommands are the subcommands of the trust command.
+var trustCommands = map[string]func(cacheDir string, links map[string]Link, args []string) error{
+	"add": cmdTrustAdd,
+	"ls":  cmdTrustLs,
+	"rm":  cmdTrustRm,
+}
+
+// cmdTrust manages the tools trusted to run. The first time a tool is going
+// to be run, whether it is trusted is asked, and the answer remembered.
+func cmdTrust(links map[string]Link, args []string) error {
+	fs := newFlagSet("trust", "trust ls\n"+
+		"       va trust add <path|short>...\n"+
+		"       va trust rm <path|short>...",
+		"Before a tool which has never been run before is downloaded and run, whether it is trusted\n"+
+			"is asked, and the answer remembered. Adding a tool trusts it without asking, and removing\n"+
+			"one forgets the answer, so that it is asked again.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing subcommand: ls, add, or rm")
+	}
+	sub, ok := trustCommands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown subcommand: %s", fs.Arg(0))
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	return sub(cacheDir, links, fs.Args()[1:])
+}
+
+// cmdTrustLs lists the decisions made about which tools to trust.
+func cmdTrustLs(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	store, err := readTrust(cacheDir)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(store))
+	for path := range store {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	fmt.Fprint(w, "TOOL\tTRUSTED\tDECIDED\tFROM\n")
+	for _, path := range paths {
+		d := store[path]
+		trusted := "no"
+		if d.Trusted {
+			trusted = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", path, trusted, d.Time.Format("2006-01-02 15:04"), d.Origin)
+	}
+	return w.Flush()
+}
+
+// cmdTrustAdd trusts the tools, so that they run without asking.
+func cmdTrustAdd(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: va trust add <path|short>...")
+	}
+	paths, err := trustPaths(links, args)
+	if err != nil {
+		return err
+	}
+	return updateTrust(cacheDir, func(store map[string]TrustDecision) error {
+		for _, pkgPath := range paths {
+			store[pkgPath] = TrustDecision{Trusted: true, Origin: "va trust add", Time: time.Now()}
+		}
+		return nil
+	})
+}
+
+// cmdTrustRm forgets whether the tools are trusted, so that it is asked
+// again when they are next run.
+func cmdTrustRm(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: va trust rm <path|short>...")
+	}
+	paths, err := trustPaths(links, args)
+	if err != nil {
+		return err
+	}
+	return updateTrust(cacheDir, func(store map[string]TrustDecision) error {
+		for _, pkgPath := range paths {
+			if _, ok := store[pkgPath]; !ok {
+				return fmt.Errorf("%s: not in the trust store", pkgPath)
+			}
+			delete(store, pkgPath)
+		}
+		return nil
+	})
+}
+
+// trustPaths expands the links to the package paths of their tools, as
+// trust is given to a tool whatever its version.
+func trustPaths(links map[string]Link, args []string) ([]string, error) {
+	paths := make([]string, 0, len(args))
+	for _, arg := range args {
+		mod, _, _ := expandLink(links, arg)
+		pkgPath, version, _ := strings.Cut(mod, "@")
+		if version == "" {
+			version = "latest"
+		}
+		if err := checkTool(links, pkgPath+"@"+version); err != nil {
+			return nil, err
+		}
+		paths = append(paths, pkgPath)
+	}
+	return paths, nil
+}
+
+// cmdInstall builds tools and installs them into GOBIN, or the directory
+// given, both as their names and as their names and versions.
+func cmdInstall(links map[string]Link, args []string) error {
+	fs := newFlagSet("install", "install [flags] <path|short>[@version]...",
+		"Installs each tool as its name, such as \"stringer\", and as its name and version, such as\n"+
+			"\"stringer@v0.1.0\", so that several versions can be installed alongside each other. The\n"+
+			"tools installed are listed by \"va list --installed\", and removed by \"va uninstall\".")
+	dir := fs.String("dir", "", "directory to install into, instead of GOBIN")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no tools to install")
+	}
+	mods, err := expandMods(links, fs.Args())
+	if err != nil {
+		return err
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	UseGoEnvCache(cacheDir)
+	ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+	defer cancel()
+	if *dir == "" {
+		if *dir, err = installDir(ctx); err != nil {
+			return err
+		}
+	}
+	for i, mod := range mods {
+		_, link, _ := expandLink(links, fs.Arg(i))
+		if err := checkTrust(cacheDir, link, mod); err != nil {
+			return err
+		}
+		m, _, err := locateTool(ctx, cacheDir, mod)
+		if err != nil {
+			return err
+		}
+		tool, temp, err := prepareTool(ctx, cacheDir, m.ToolPath()+"@"+m.Version, linkBuildOptions(link))
+		if err != nil {
+			return err
+		}
+		inst, err := Install(*dir, tool, m.ToolPath(), m.Version)
+		if temp {
+			removeTemp(tool)
+		}
+		if err != nil {
+			return err
+		}
+		logInfof("installed %s@%s as %s", inst.Tool, inst.Version, strings.Join(inst.Files, " and "))
+	}
+	return nil
+}
+
+// cmdUninstall removes tools installed by va install.
+func cmdUninstall(links map[string]Link, args []string) error {
+	fs := newFlagSet("uninstall", "uninstall <name|path|short>[@version]...",
+		"Removes the tools installed by va install, every version of them unless a version is given.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no tools to uninstall")
+	}
+	for _, arg := range fs.Args() {
+		tool, version, _ := strings.Cut(arg, "@")
+		if link, ok := links[tool]; ok {
+			tool, _, _ = strings.Cut(link.Pkg, "@")
+		}
+		removed, err := Uninstall(tool, version)
+		if err != nil {
+			return err
+		}
+		if len(removed) == 0 {
+			return fmt.Errorf("%s is not installed (see \"va list --installed\")", arg)
+		}
+		for _, inst := range removed {
+			logInfof("removed %s", strings.Join(inst.Files, " and "))
+		}
+	}
+	return nil
+}
+
+// listInstalled lists the tools installed by va install, or those whose
+// name or package contains any of the patterns.
+func listInstalled(patterns []string, asJSON bool) error {
+	installs, err := readInstalls()
+	if err != nil {
+		return err
+	}
+	matched := installs[:0]
+	for _, inst := range installs {
+		ok := len(patterns) == 0
+		for _, pattern := range patterns {
+			ok = ok || strings.Contains(inst.Name, pattern) || strings.Contains(inst.Tool, pattern)
+		}
+		if ok {
+			matched = append(matched, inst)
+		}
+	}
+	if asJSON {
+		if matched == nil {
+			matched = []Installation{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(matched)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	fmt.Fprint(w, "NAME\tVERSION\tDIR\tTOOL\n")
+	for _, inst := range matched {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", inst.Name, inst.Version, inst.Dir, inst.Tool)
+	}
+	return w.Flush()
+}
+
+// cmdShim writes shims for links, small scripts which run the link through
+// va, so that tools appear to be on the PATH while still being built when
+// first run and following the versions the links are pinned to.
+func cmdShim(links map[string]Link, args []string) error {
+	fs := newFlagSet("shim", "shim [flags] <short>...",
+		"Writes a shim for each link, a script named after it which runs \"va run <short>\" with its\n"+
+			"arguments, or a symlink to va, which runs the link it is named after. Shims are written\n"+
+			"into ~/.local/bin unless another directory is given.")
+	dir := fs.String("dir", "", "directory to write the shims into, instead of ~/.local/bin")
+	remove := fs.Bool("rm", false, "remove the shims instead")
+	force := fs.Bool("force", false, "overwrite files which are not shims")
+	symlink := fs.Bool("symlink", false, "make each shim a symlink to va, which runs the link it is named after")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no links given")
+	}
+	if *dir == "" {
+		var err error
+		if *dir, err = shimDir(); err != nil {
+			return err
+		}
+	}
+	for _, short := range fs.Args() {
+		if _, ok := links[short]; !ok && !*remove {
+			return checkTool(links, short)
+		}
+		if *remove {
+			name, err := RemoveShim(*dir, short)
+			if err != nil {
+				return err
+			}
+			logInfof("removed %s", name)
+			continue
+		}
+		name, err := WriteShim(*dir, short, *force, *symlink)
+		if err != nil {
+			return err
+		}
+		logInfof("wrote %s", name)
+	}
+	if !*remove && !inPath(*dir) {
+		logWarnf("%s is not in $PATH, so the shims cannot be found until it is added", *dir)
+	}
+	return nil
+}
+
+// inPath reports whether the directory is in $PATH.
+func inPath(dir string) bool {
+	for _, p := range filepath.SplitList(os.Getenv("PATH")) {
+		if filepath.Clean(p) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// cmdExec runs a batch of tools read from stdin, exiting with the exit code
+// of the first in the batch to fail, if any did.
+func cmdExec(links map[string]Link, args []string) error {
+	fs := newFlagSet("exec", "exec --stdin [flags]",
+		"Runs the tools read from stdin, one to a line: a link or package path, with any version,\n"+
+			"followed by the arguments for the tool, quoted as a shell would quote them. Blank lines,\n"+
+			"and those starting with #, are skipped. Every tool is run, even if one before it fails,\n"+
+			"and va exits with the exit code of the first in the batch which failed. Whether to trust a\n"+
+			"tool which has never been run before is asked at the terminal, rather than on stdin, so\n"+
+			"without one, such as in CI, va --yes must be given to run such tools.")
+	stdin := fs.Bool("stdin", false, "read the tools to run from stdin")
+	jobs := fs.Int("j", 1, "number of tools to run at once")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !*stdin || fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("the tools to run must be given on stdin, with --stdin")
+	}
+	if *jobs < 1 {
+		return errors.New("-j must be at least 1")
+	}
+	wrap, err := splitFields(*flagWrap)
+	if err != nil {
+		return fmt.Errorf("wrap: %w", err)
+	}
+	batch, err := readBatch(links, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	if _, err := sweepTemps(); err != nil {
+		logWarnf("clean: %v", err)
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		logWarnf("cache: %v", err)
+	} else {
+		UseGoEnvCache(cacheDir)
+	}
+	for _, inv := range batch {
+		if err := checkTrust(cacheDir, inv.Link, inv.Tool); err != nil {
+			return fmt.Errorf("line %d: %w", inv.Line, err)
+		}
+	}
+	exitCodes := RunBatch(cacheDir, batch, wrap, *jobs)
+	failed, status := 0, 0
+	for _, code := range exitCodes {
+		if code == 0 {
+			continue
+		}
+		if failed == 0 {
+			status = code
+		}
+		failed++
+	}
+	if failed == 0 {
+		return nil
+	}
+	logWarnf("%d of %d tools failed", failed, len(batch))
+	if status < 0 {
+		status = 1
+	}
+	return exitError(status)
+}
+
+// cmdSelfUpdate updates va to its newest version, or only says whether there
+// is one with --check.
+func cmdSelfUpdate(links map[string]Link, args []string) error {
+	fs := newFlagSet("self-update", "self-update [flags]",
+		"Builds the newest version of va with the go command, which checks it against the checksum\n"+
+			"database, checks the binary is va at that version, and then replaces the va which is\n"+
+			"running with it. With --check, va exits with 1 if there is a newer version.")
+	check := fs.Bool("check", false, "only say whether there is a newer version, without updating")
+	force := fs.Bool("force", false, "update even if va is already the newest version, or was built from source")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if *flagOffline {
+		return errors.New("cannot update while offline")
+	}
+	ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+	defer cancel()
+	current := selfVersion()
+	latest, err := latestSelf(ctx)
+	if err != nil {
+		return err
+	}
+	shown := current
+	if current == "" {
+		shown = "built from source"
+	}
+	if !needsUpdate(current, latest, *force) {
+		if current == "" {
+			logInfof("va was built from source, so is only updated with --force; %s is the newest version", latest)
+		} else {
+			logInfof("%s is the newest version of va", current)
+		}
+		return nil
+	}
+	if *check {
+		fmt.Printf("va %s can be updated to %s\n", shown, latest)
+		if current == "" {
+			return nil
+		}
+		return exitError(1)
+	}
+	self, err := SelfUpdate(ctx, latest)
+	if err != nil {
+		return err
+	}
+	logInfof("updated %s from %s to %s", self, shown, latest)
+	return nil
+}
+
+// cmdVersion shows the version of va, the Go it was built with, and a hash of
+// the lists of links embedded in it.
+func cmdVersion(links map[string]Link, args []string) error {
+	fs := newFlagSet("version", "version [--json]",
+		"Shows the version of va, the version of Go it was built with, and the SHA-256 of the lists\n"+
+			"of links built into it, so that bug reports can say exactly which links va knew of.")
+	asJSON := fs.Bool("json", false, "print the version information as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	info, err := versionInfo()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(info)
+	}
+	fmt.Printf("va %s\n", info.Version)
+	fmt.Printf("go:     %s %s\n", info.GoVersion, info.Platform)
+	if info.Revision != "" {
+		modified := ""
+		if info.Modified {
+			modified = ", modified"
+		}
+		fmt.Printf("commit: %s (%s%s)\n", info.Revision, info.Time, modified)
+	}
+	fmt.Printf("lists:  sha256:%s (%d links in %d files)\n", info.Lists.Hash, info.Lists.Links, info.Lists.Files)
+	return nil
+}
+
+// listsCommands are the subcommands of the lists command.
+var listsCommands = map[string]func(cacheDir string, links map[string]Link, args []string) error{
+	"add":    cmdListsAdd,
+	"ls":     cmdListsLs,
+	"rm":     cmdListsRm,
+	"sync":   cmdListsUpdate,
+	"update": cmdListsUpdate,
+}
+
+// cmdLists manages the remote lists subscribed to.
+func cmdLists(links map[string]Link, args []string) error {
+	fs := newFlagSet("lists", "lists ls\n"+
+		"       va lists add [--name <name>] [--key <key|file>] <url>\n"+
+		"       va lists add --git [--ref <branch|tag>] [--dir <dir>] [--name <name>] <url>\n"+
+		"       va lists rm <url|name>...\n"+
+		"       va lists update|sync",
+		"Remote lists are lists of short names fetched over HTTPS, which are fetched again once they\n"+
+			"are older than --lists-ttl, if the server says they have changed: in the background while\n"+
+			"a tool runs, by va daemon, or at once by va lists sync. Their links are prefixed\n"+
+			"by the name of the list, as other lists' are, and override the embedded links, but are\n"+
+			"overridden by the user's own lists and the project's.\n\n"+
+			"A git repository of lists, such as one a team curates its approved tools in, is fetched\n"+
+			"into the cache in the same way, and its lists are merged as those of a directory are.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing subcommand: ls, add, rm, or update (or sync)")
+	}
+	sub, ok := listsCommands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown subcommand: %s", fs.Arg(0))
+	}
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return err
+	}
+	return sub(cacheDir, links, fs.Args()[1:])
+}
+
+// cmdListsAdd subscribes to a remote list, or a git repository of lists,
+// fetching it first to check it.
+func cmdListsAdd(cacheDir string, links map[string]Link, args []string) error {
+	fs := flag.NewFlagSet("lists add", flag.ContinueOnError)
+	name := fs.String("name", "", "name to keep the list as, which gives its prefix, instead of the last element of the URL")
+	key := fs.String("key", "", "public key which must have signed the list, as a line of authorized_keys or a file holding one")
+	git := fs.Bool("git", false, "the URL is of a git repository of lists (implied by URLs ending in .git, and ssh ones)")
+	ref := fs.String("ref", "", "with --git, the branch or tag to use, instead of the repository's default branch")
+	dir := fs.String("dir", "", "with --git, the directory within the repository the lists are in, instead of its root")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: va lists add [--name <name>] [--key <key|file>] <url>\n"+
+			"       va lists add --git [--ref <branch|tag>] [--dir <dir>] [--name <name>] <url>\n\n"+
+			"With --key, the list must be signed, with \"ssh-keygen -Y sign -n va\", and the signature\n"+
+			"served from the URL of the list with \".sig\" appended.\n\n"+
+			"With --git, only the newest commit of the branch or tag is fetched, by git, so that any\n"+
+			"credentials git has for the repository are used. Every list file in the directory, and\n"+
+			"in those within it, is merged; the name only says which repository it is.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a single URL must be given")
+	}
+	var sub Subscription
+	if *git || isGitListURL(fs.Arg(0)) {
+		if *key != "" {
+			return errors.New("git repositories of lists cannot be signed, so --key cannot be used with --git")
+		}
+		var err error
+		if sub, err = newGitSubscription(fs.Arg(0), *name, *ref, *dir); err != nil {
+			return err
+		}
+	} else if *ref != "" || *dir != "" {
+		return errors.New("--ref and --dir can only be used with --git")
+	} else {
+		u, err := checkListURL(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		sub = Subscription{URL: u.String(), Name: *name, Time: time.Now()}
+		if sub.Name == "" {
+			if sub.Name, err = subscriptionName(u); err != nil {
+				return err
+			}
+		} else if _, ok := listPrefix(sub.Name); !ok || sub.Name != filepath.Base(sub.Name) {
+			return fmt.Errorf("bad name: %s (must be a file name ending in .list or .toml)", sub.Name)
+		}
+	}
+	if *key != "" {
+		if b, err := os.ReadFile(*key); err == nil {
+			*key = string(b)
+		}
+		*key = strings.TrimSpace(*key)
+		if _, err := parseSSHKey(*key); err != nil {
+			return err
+		}
+		sub.Key = *key
+	}
+	if err := checkSigned(sub); err != nil {
+		return err
+	}
+	subs, err := readSubscriptions()
+	if err != nil {
+		return err
+	}
+	for _, other := range subs {
+		if other.URL == sub.URL {
+			return fmt.Errorf("already subscribed to %s", sub.URL)
+		}
+	}
+	ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+	defer cancel()
+	if err := fetchSubscription(ctx, cacheDir, sub, true); err != nil {
+		return err
+	}
+	if err := writeSubscriptions(append(subs, sub)); err != nil {
+		return err
+	}
+	logInfof("subscribed to %s, as %s", sub.URL, sub.Name)
+	return nil
+}
+
+// cmdListsLs lists the remote lists subscribed to, and when each was last
+// fetched.
+func cmdListsLs(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	subs, err := readSubscriptions()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
+	fmt.Fprint(w, "NAME\tURL\tFETCHED\tSIGNED BY\n")
+	for _, sub := range subs {
+		fetched := "never"
+		if meta := readRemoteListMeta(remoteListDir(cacheDir, sub.URL)); !meta.Fetched.IsZero() {
+			fetched = meta.Fetched.Format("2006-01-02 15:04")
+		}
+		signedBy := "-"
+		if key, err := parseSSHKey(sub.Key); err == nil {
+			signedBy = sshFingerprint(key)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", sub.Name, sub.URL, fetched, signedBy)
+	}
+	return w.Flush()
+}
+
+// cmdListsRm unsubscribes from remote lists, given by URL or name.
+func cmdListsRm(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: va lists rm <url|name>...")
+	}
+	subs, err := readSubscriptions()
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		kept := subs[:0]
+		for _, sub := range subs {
+			if sub.URL != arg && sub.Name != arg {
+				kept = append(kept, sub)
+				continue
+			}
+			if err := os.RemoveAll(remoteListDir(cacheDir, sub.URL)); err != nil {
+				return err
+			}
+			logInfof("unsubscribed from %s", sub.URL)
+		}
+		if len(kept) == len(subs) {
+			return fmt.Errorf("not subscribed to %s (see \"va lists ls\")", arg)
+		}
+		subs = kept
+	}
+	return writeSubscriptions(subs)
+}
+
+// cmdListsUpdate fetches every remote list again, if it has changed, however
+// recently it was fetched.
+func cmdListsUpdate(cacheDir string, links map[string]Link, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	subs, err := readSubscriptions()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+	defer cancel()
+	failed := false
+	for _, sub := range subs {
+		err := checkSigned(sub)
+		if err == nil {
+			err = fetchSubscription(ctx, cacheDir, sub, true)
+		}
+		if err != nil {
+			logErrorf("lists: %v", err)
+			failed = true
+		}
+	}
+	if failed {
+		return exitError(1)
+	}
+	return nil
+}
+
+// aliasCommands are the subcommands of the alias command.
+var aliasCommands = map[string]func(links map[string]Link, args []string) error{
+	"add":  cmdAliasAdd,
+	"edit": cmdAliasEdit,
+	"rm":   cmdAliasRm,
+}
+
+// cmdAlias manages the links in the user's own lists.
+func cmdAlias(links map[string]Link, args []string) error {
+	fs := newFlagSet("alias", "alias add [--force] <short> <path@version|short> [key=value...] [description...]\n"+
+		"       va alias edit [flags] <short>\n"+
+		"       va alias rm <short>...",
+		"Adds, changes, or removes links in your own lists, in the lists directory of va's configuration\n"+
+			"directory, checking each change as va checks every list when it starts. A short name with a\n"+
+			"prefix, such as \"team/lint\", is kept in the list named after it, team.list, and one without\n"+
+			"in _.list. A short name in place of the package makes the link an alias of that link.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing subcommand: add, edit, or rm")
+	}
+	sub, ok := aliasCommands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown subcommand: %s", fs.Arg(0))
+	}
+	return sub(links, fs.Args()[1:])
+}
+
+// cmdAliasAdd adds a link to the user's lists.
+func cmdAliasAdd(links map[string]Link, args []string) error {
+	fs := flag.NewFlagSet("alias add", flag.ContinueOnError)
+	force := fs.Bool("force", false, "replace the link if the list already has it")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: va alias add [--force] <short> <path@version|short> [key=value...] [description...]\n\n"+
+			"Options are those of a line of a list, such as args=\"run ./...\" or tags=lint.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("a short name and a package, or another short name, must be given")
+	}
+	short := fs.Arg(0)
+	file, name := userListFile(short)
+	line := listLine{Short: name, Pkg: fs.Arg(1)}
+	rest := fs.Args()[2:]
+	for len(rest) > 0 {
+		key, value, ok := strings.Cut(rest[0], "=")
+		if _, known := linkOptions[key]; !ok || !known {
+			break
+		}
+		line.Options = append(line.Options, listOption{key, value})
+		rest = rest[1:]
+	}
+	line.Desc = strings.Join(rest, " ")
+
+	list, err := readUserList(file)
+	if err != nil {
+		return err
+	}
+	if i := list.Find(name); i >= 0 && !*force {
+		return fmt.Errorf("%s is already in %s (use --force to replace it)", short, file)
+	} else if i >= 0 {
+		list.Lines[i] = line.String()
+	} else {
+		list.Lines = append(list.Lines, line.String())
+	}
+	if err := list.Check(links); err != nil {
+		return err
+	}
+	if err := list.Write(); err != nil {
+		return err
+	}
+	if link, ok := links[short]; ok && link.Source != "user" {
+		logWarnf("%s overrides the link in %s", short, link.Origin())
+	}
+	logInfof("added %s to %s", short, file)
+	return nil
+}
+
+// cmdAliasEdit changes a link in the user's lists.
+func cmdAliasEdit(links map[string]Link, args []string) error {
+	fs := flag.NewFlagSet("alias edit", flag.ContinueOnError)
+	pkg := fs.String("pkg", "", "change the package, with its version, or the short name the link is an alias of")
+	desc := fs.String("desc", "", "change the description")
+	var set []listOption
+	var unset []string
+	fs.Func("set", "set an option, as key=value, such as args=\"run ./...\" (may be repeated)", func(s string) error {
+		key, value, ok := strings.Cut(s, "=")
+		if _, known := linkOptions[key]; !ok || !known {
+			return fmt.Errorf("unknown option: %s", s)
+		}
+		set = append(set, listOption{key, value})
+		return nil
+	})
+	fs.Func("unset", "remove an option, such as args (may be repeated)", func(key string) error {
+		if _, known := linkOptions[key]; !known {
+			return fmt.Errorf("unknown option: %s", key)
+		}
+		unset = append(unset, key)
+		return nil
+	})
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: va alias edit [flags] <short>\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a single short name must be given")
+	}
+	short := fs.Arg(0)
+	file, name := userListFile(short)
+	list, err := readUserList(file)
+	if err != nil {
+		return err
+	}
+	i := list.Find(name)
+	if i < 0 {
+		return fmt.Errorf("%s is not in %s", short, file)
+	}
+	line, err := parseListLine(list.Lines[i])
+	if err != nil {
+		return err
+	}
+	if *pkg != "" {
+		line.Pkg = *pkg
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "desc" {
+			line.Desc = *desc
+		}
+	})
+	for _, key := range unset {
+		kept := line.Options[:0]
+		for _, opt := range line.Options {
+			if opt.Key != key {
+				kept = append(kept, opt)
+			}
+		}
+		line.Options = kept
+	}
+	for _, opt := range set {
+		replaced := false
+		for j := range line.Options {
+			if line.Options[j].Key == opt.Key {
+				line.Options[j], replaced = opt, true
+			}
+		}
+		if !replaced {
+			line.Options = append(line.Options, opt)
+		}
+	}
+	list.Lines[i] = line.String()
+	if err := list.Check(links); err != nil {
+		return err
+	}
+	if err := list.Write(); err != nil {
+		return err
+	}
+	logInfof("changed %s in %s", short, file)
+	return nil
+}
+
+// cmdAliasRm removes links from the user's lists.
+func cmdAliasRm(links map[string]Link, args []string) error {
+	if len(args) == 0 {
+		return errors.New("no short names to remove")
+	}
+	for _, short := range args {
+		file, name := userListFile(short)
+		list, err := readUserList(file)
+		if err != nil {
+			return err
+		}
+		i := list.Find(name)
+		if i < 0 {
+			if link, ok := links[short]; ok {
+				return fmt.Errorf("%s is not in your lists, but in %s", short, link.Origin())
+			}
+			return fmt.Errorf("%s is not in %s", short, file)
+		}
+		list.Lines = append(list.Lines[:i], list.Lines[i+1:]...)
+		if err := list.Write(); err != nil {
+			return err
+		}
+		logInfof("removed %s from %s", short, file)
+	}
+	return nil
+}
+
+// cmdImport makes links of the tools managed some other way, printing them
+// as lines of a list, or adding them to the project's list.
+func cmdImport(links map[string]Link, args []string) error {
+	fs := newFlagSet("import", "import [flags] [dir|file...]",
+		"Finds the tools in bingo's .bingo directory, the blank imports of a tools.go file (at the\n"+
+			"versions its go.mod requires), and the .tool-versions file of asdf or mise, in the\n"+
+			"directories given, or the current directory, or in the files given. Prints them as lines\n"+
+			"of a list, or with -w, adds them to the project's list in .va/lists.")
+	write := fs.Bool("w", false, "add the links to the project's list, instead of printing them")
+	user := fs.Bool("user", false, "with -w, add the links to your own lists, instead of the project's")
+	file := fs.String("list", "_.list", "with -w, the list file to add the links to, whose name prefixes their short names")
+	force := fs.Bool("force", false, "with -w, replace any links the list already has")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(*file, ".list") {
+		return fmt.Errorf("--list %s: must be a .list file", *file)
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"."}
+	}
+	tools, err := ImportTools(links, names)
+	if err != nil {
+		return err
+	}
+	if len(tools) == 0 {
+		return fmt.Errorf("no tools found in %s", strings.Join(names, ", "))
+	}
+	if !*write {
+		for _, tool := range tools {
+			fmt.Println(listLine{Short: tool.Short, Pkg: tool.Pkg}.String())
+		}
+		return nil
+	}
+
+	var list *UserList
+	if *user {
+		list, err = readUserList(*file)
+	} else {
+		dir, ok := projectListsDir()
+		if !ok {
+			dir = filepath.Join(".va", "lists")
+		}
+		list, err = readListLines(dir, *file, "project")
+	}
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, tool := range tools {
+		line := listLine{Short: tool.Short, Pkg: tool.Pkg}.String()
+		switch i := list.Find(tool.Short); {
+		case i < 0:
+			list.Lines = append(list.Lines, line)
+		case *force:
+			list.Lines[i] = line
+		default:
+			logWarnf("%s is already in %s (use --force to replace it)", tool.Short, *file)
+			continue
+		}
+		added++
+	}
+	if err := list.Check(links); err != nil {
+		return err
+	}
+	if err := list.Write(); err != nil {
+		return err
+	}
+	logInfof("added %d links to %s", added, filepath.Join(list.Dir, filepath.FromSlash(list.File)))
+	return nil
+}
+
+// cmdExport prints definitions which run links through va, for shells,
+// Makefiles, or Taskfiles to use instead of the tools themselves.
+func cmdExport(links map[string]Link, args []string) error {
+	fs := newFlagSet("export", "export [flags] [short...]",
+		"Prints a definition for each link given, or every link for this system, which runs it\n"+
+			"through va: an alias for shells, a variable for Makefiles to include, such as\n"+
+			"$(GOLANGCI_LINT), or a task for Taskfiles, such as go:golangci-lint.")
+	format := fs.String("format", "shell", "what to print: \"shell\", \"make\", or \"taskfile\"")
+	tag := fs.String("tag", "", "only export the links with the tag")
+	va := fs.String("va", "va", "the command the definitions run va with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	export, ok := exporters[*format]
+	if !ok {
+		return fmt.Errorf("unknown format: %s (must be shell, make, or taskfile)", *format)
+	}
+	var exported []Link
+	if fs.NArg() == 0 {
+		for _, link := range sortedLinks(links, nil) {
+			if !isRewrite(link.Short) && link.supported() && (*tag == "" || link.HasTag(*tag)) {
+				exported = append(exported, link)
+			}
+		}
+	}
+	for _, short := range fs.Args() {
+		link, ok := links[short]
+		if !ok || isRewrite(short) {
+			return checkTool(links, short)
+		}
+		exported = append(exported, link)
+	}
+	switch {
+	case len(exported) > 0:
+	case *tag != "":
+		return fmt.Errorf("no links have the tag %s", *tag)
+	default:
+		return errors.New("no links to export")
+	}
+	return export(os.Stdout, links, exported, *va)
+}
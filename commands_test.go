@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// captureStdout returns what the function wrote to standard output.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdout := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = stdout }()
+	fn()
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCmdSources(t *testing.T) {
+	links, err := loadLinks([]LinkSource{
+		{Name: "embedded", FS: fstest.MapFS{
+			"lists/_.list":  {Data: []byte("hello example.com/hello@latest\n")},
+			"lists/go.list": {Data: []byte("a example.com/a@latest\nb example.com/b@latest\n")},
+		}},
+		{Name: "user", FS: fstest.MapFS{
+			"lists/team.list": {Data: []byte("lint example.com/lint@latest\nfmt example.com/fmt@latest\nvet example.com/vet@latest\n")},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := captureStdout(t, func() { err = cmdSources(links, nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"PREFIX", "SOURCE", "LINKS"},
+		{"(none)", "embedded:lists/_.list", "1"},
+		{"go/", "embedded:lists/go.list", "2"},
+		{"team/", "user:lists/team.list", "3"},
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("va sources wrote:\n%s\nwant %d lines", out, len(want))
+	}
+	for i, line := range lines {
+		if got := strings.Fields(line); strings.Join(got, " ") != strings.Join(want[i], " ") {
+			t.Errorf("line %d = %q, want %q", i+1, got, want[i])
+		}
+	}
+
+	if err := cmdSources(links, []string{"extra"}); err == nil {
+		t.Error("va sources extra succeeded, want it refused")
+	}
+}
+
+func TestSearchRemoteOffline(t *testing.T) {
+	offline = true
+	t.Cleanup(func() { offline = false })
+	links := map[string]Link{"hello": {Short: "hello", Pkg: "example.com/hello@latest", Desc: "Says hello"}}
+	if err := cmdSearch(links, []string{"--remote", "hello"}); !errors.Is(err, errOffline) {
+		t.Errorf("va search --remote when offline: %v, want %v", err, errOffline)
+	}
+}
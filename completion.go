@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// completionScripts are the scripts which have each shell complete the
+// arguments of va, by asking "va __complete" for the candidates, so that
+// links are completed from whichever lists va loads at the time.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for va, e.g. in ~/.bashrc: source <(va completion bash)
+_va() {
+	local IFS=$'\n'
+	COMPREPLY=($(va __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _va va
+`,
+	"zsh": `#compdef va
+# zsh completion for va, e.g. in ~/.zshrc: source <(va completion zsh)
+_va() {
+	local -a candidates
+	candidates=("${(@f)$(va __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -n ${candidates[1]} ]]; then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+compdef _va va
+`,
+	"fish": `# fish completion for va, e.g.: va completion fish > ~/.config/fish/completions/va.fish
+complete -c va -a '(va __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`,
+	"powershell": `# PowerShell completion for va, e.g. in $PROFILE: va completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName va -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+	if ($wordToComplete -eq '') { $words += '""' }
+	& va __complete @words 2>$null | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`,
+}
+
+// toolCommands are the commands whose arguments are tools, so which complete
+// the short names of links.
+var toolCommands = map[string]bool{
+	"bench":    true,
+	"daemon":   true,
+	"info":     true,
+	"install":  true,
+	"outdated": true,
+	"prefetch": true,
+	"resolve":  true,
+	"run":      true,
+	"shim":     true,
+	"verify":   true,
+	"versions": true,
+	"which":    true,
+}
+
+// lastFlagSet is the flag set most recently made by newFlagSet, which is how
+// the flags of a command are found to complete them.
+var lastFlagSet *flag.FlagSet
+
+// cmdCompletion prints the completion script for the shell.
+func cmdCompletion(links map[string]Link, args []string) error {
+	shells := make([]string, 0, len(completionScripts))
+	for shell := range completionScripts {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	fs := newFlagSet("completion", "completion <"+strings.Join(shells, "|")+">",
+		"Prints a script which has the shell complete the commands, flags, and short names va knows.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one shell must be given")
+	}
+	script, ok := completionScripts[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown shell: %s", fs.Arg(0))
+	}
+	_, err := io.WriteString(os.Stdout, script)
+	return err
+}
+
+// cmdComplete prints the candidates for the last of the arguments, which are
+// those given to va so far, one to a line. It is run by the completion
+// scripts, and is not meant to be run by hand.
+func cmdComplete(links map[string]Link, args []string) error {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	for _, candidate := range completions(links, args[:len(args)-1], args[len(args)-1]) {
+		fmt.Println(candidate)
+	}
+	return nil
+}
+
+// completions returns the candidates for word, which follows the arguments
+// before it, sorted.
+func completions(links map[string]Link, before []string, word string) []string {
+	// Skip past the global flags to find the command, if there is one.
+	i := 0
+	for ; i < len(before) && strings.HasPrefix(before[i], "-"); i++ {
+		if before[i] == "--" {
+			return nil
+		}
+		if f := flag.Lookup(strings.TrimLeft(before[i], "-")); f != nil && !isBoolFlag(f) {
+			i++ // The value of the flag.
+		}
+	}
+	if i > len(before) {
+		return nil // The word is the value of a flag.
+	}
+	var candidates []string
+	if i == len(before) {
+		if strings.HasPrefix(word, "-") {
+			flag.VisitAll(func(f *flag.Flag) {
+				if !hiddenFlags[f.Name] {
+					candidates = append(candidates, "--"+f.Name)
+				}
+			})
+			return matching(candidates, word)
+		}
+		for name, cmd := range commands {
+			if cmd.summary != "" {
+				candidates = append(candidates, name)
+			}
+		}
+		return matching(append(candidates, linkNames(links)...), word)
+	}
+
+	name, rest := before[i], before[i+1:]
+	if _, ok := commands[name]; !ok {
+		return nil // The arguments of a tool are its own.
+	}
+	for _, arg := range rest {
+		if arg == "--" {
+			return nil
+		}
+	}
+	switch {
+	case strings.HasPrefix(word, "-"):
+		if fs := commandFlagSet(links, name); fs != nil {
+			fs.VisitAll(func(f *flag.Flag) {
+				candidates = append(candidates, "--"+f.Name)
+			})
+		}
+	case name == "help" && len(rest) == 0:
+		for name, cmd := range commands {
+			if cmd.summary != "" {
+				candidates = append(candidates, name)
+			}
+		}
+	case name == "completion" && len(rest) == 0:
+		for shell := range completionScripts {
+			candidates = append(candidates, shell)
+		}
+	case name == "cache" && len(rest) == 0:
+		for sub := range cacheCommands {
+			candidates = append(candidates, sub)
+		}
+	case name == "bundle" && len(rest) == 0:
+		for sub := range bundleCommands {
+			candidates = append(candidates, sub)
+		}
+	case name == "stats" && len(rest) == 0:
+		for sub := range statsCommands {
+			candidates = append(candidates, sub)
+		}
+	case name == "cache" && (rest[0] == "info" || rest[0] == "rm"),
+		name == "bundle" && rest[0] == "create",
+		toolCommands[name]:
+		candidates = linkNames(links)
+	}
+	return matching(candidates, word)
+}
+
+// commandFlagSet returns the flag set of the command, by asking it for help
+// without letting it print anything.
+func commandFlagSet(links map[string]Link, name string) *flag.FlagSet {
+	lastFlagSet = nil
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() {
+		os.Stderr.Close()
+		os.Stderr = stderr
+	}()
+	if err := commands[name].run(links, []string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return lastFlagSet
+}
+
+// isBoolFlag reports whether the flag needs no value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// linkNames returns the short names of the links, other than those for other
+// systems.
+func linkNames(links map[string]Link) []string {
+	names := make([]string, 0, len(links))
+	for short, link := range links {
+		if !isRewrite(short) && link.supported() {
+			names = append(names, short)
+		}
+	}
+	return names
+}
+
+// matching returns the candidates which start with the prefix, sorted.
+func matching(candidates []string, prefix string) []string {
+	var matched []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matched = append(matched, c)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configEnvOnly are the settings in the configuration file which are not
+// flags, but are otherwise only given by their environment variables.
+var configEnvOnly = map[string]bool{
+	"cache-dir":          true,
+	"lists-dir":          true,
+	"overrides":          true,
+	"remote-cache":       true,
+	"remote-cache-token": true,
+	"state-dir":          true,
+}
+
+// configFile returns the path of va's configuration file: $VA_CONFIG, or
+// else config.toml in va's configuration directory.
+func configFile() (string, error) {
+	if name := os.Getenv("VA_CONFIG"); name != "" {
+		return name, nil
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// configEnv returns the environment variable which overrides the setting,
+// such as $VA_RESOLVE_TTL for "resolve-ttl".
+func configEnv(key string) string {
+	return "VA_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// loadConfig applies the settings in the configuration file, if there is
+// one. Each setting is named after one of va's flags, and becomes that
+// flag's default, such as:
+//
+//	log-level = "verbose"
+//	proxy = "https://goproxy.example.com,direct"
+//	reproducible = true
+//	tool-timeout = "10m"
+//
+// Only cache-dir, lists-dir, overrides, remote-cache, remote-cache-token,
+// and state-dir are not flags, but settings of the environment variables
+// they are named after, such as $VA_REMOTE_CACHE_TOKEN. The environment
+// variable of a setting takes precedence over the file, as does its flag.
+func loadConfig() error {
+	name, err := configFile()
+	if err != nil {
+		return nil
+	}
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) && os.Getenv("VA_CONFIG") == "" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	config, err := parseTOML(string(b))
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", name, err)
+	}
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := applyConfig(key, config[key]); err != nil {
+			return fmt.Errorf("config: %s: %s: %w", name, key, err)
+		}
+	}
+	return nil
+}
+
+// applyConfig applies the setting from the configuration file, unless its
+// environment variable is set.
+func applyConfig(key string, value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case bool, int64, float64:
+		s = fmt.Sprint(v)
+	default:
+		return errors.New("must be a string, number, or boolean")
+	}
+	env := configEnv(key)
+	if _, ok := os.LookupEnv(env); ok {
+		return nil
+	}
+	if configEnvOnly[key] {
+		return os.Setenv(env, s)
+	}
+	if flag.Lookup(key) == nil || hiddenFlags[key] {
+		return errors.New("unknown setting")
+	}
+	return flag.Set(key, s)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigRemoteCache(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.toml")
+	const config = "remote-cache = \"https://cache.example.com\"\nremote-cache-token = \"secret\"\n"
+	if err := os.WriteFile(name, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VA_CONFIG", name)
+
+	for _, tt := range []struct {
+		name               string
+		env                string // $VA_REMOTE_CACHE_TOKEN, if not empty.
+		wantURL, wantToken string
+	}{
+		{name: "from the file", wantURL: "https://cache.example.com", wantToken: "secret"},
+		{name: "environment first", env: "other", wantURL: "https://cache.example.com", wantToken: "other"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Unset, so that the file may set them, and restored after.
+			for _, env := range []string{"VA_REMOTE_CACHE", "VA_REMOTE_CACHE_TOKEN"} {
+				t.Setenv(env, "")
+				os.Unsetenv(env)
+			}
+			if tt.env != "" {
+				t.Setenv("VA_REMOTE_CACHE_TOKEN", tt.env)
+			}
+			if err := loadConfig(); err != nil {
+				t.Fatal(err)
+			}
+			if got := os.Getenv("VA_REMOTE_CACHE"); got != tt.wantURL {
+				t.Errorf("$VA_REMOTE_CACHE = %q, want %q", got, tt.wantURL)
+			}
+			if got := remoteCacheToken(); got != tt.wantToken {
+				t.Errorf("remoteCacheToken = %q, want %q", got, tt.wantToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var flagRedirectDeprecated = flag.Bool("redirect-deprecated", envBool("VA_REDIRECT_DEPRECATED", false), "run the replacement of a deprecated link instead of the link itself, if it has one (or set $VA_REDIRECT_DEPRECATED)")
+
+// isDeprecated reports whether the link is deprecated, which it is if it
+// says why, or names its replacement.
+func (l Link) isDeprecated() bool {
+	return l.Deprecated != "" || l.ReplacedBy != ""
+}
+
+// followDeprecation warns if the tool given by arg is a deprecated link,
+// returning the tool to run: the link's replacement, if it has one and
+// --redirect-deprecated is set, or else the tool as given. A replacement
+// which is deprecated itself is followed in turn.
+func followDeprecation(links map[string]Link, arg string) string {
+	seen := make(map[string]bool)
+	for {
+		_, link, ok := expandLink(links, arg)
+		if !ok || !link.isDeprecated() || seen[link.Short] {
+			return arg
+		}
+		seen[link.Short] = true
+		msg := "link " + link.Short + " is deprecated"
+		if link.Deprecated != "" {
+			msg += ": " + link.Deprecated
+		}
+		replacedBy := relativeShort(links, link, link.ReplacedBy)
+		_, exists := links[replacedBy]
+		switch {
+		case link.ReplacedBy == "":
+			logWarnf("%s", msg)
+			return arg
+		case !exists:
+			logWarnf("%s (its replacement, %s, does not exist)", msg, replacedBy)
+			return arg
+		case !*flagRedirectDeprecated:
+			logWarnf("%s (use %s instead, or --redirect-deprecated to do so automatically)", msg, replacedBy)
+			return arg
+		}
+		logWarnf("%s, so running %s instead", msg, replacedBy)
+		arg = replacedBy
+	}
+}
+
+// deprecationNote notes that the link is deprecated, and what replaces it,
+// for listings.
+func deprecationNote(link Link) string {
+	parts := []string{"deprecated"}
+	if link.ReplacedBy != "" {
+		parts = append(parts, "use "+link.ReplacedBy)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// doctorTimeout bounds each check which goes online, so that an unreachable
+// host is reported rather than waited on forever.
+const doctorTimeout = 10 * time.Second
+
+// checkStatus is the outcome of a check made by va doctor.
+type checkStatus string
+
+const (
+	checkOK   checkStatus = "ok"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "FAIL"
+)
+
+// checkResult is the outcome of a check, along with what to do about it if
+// it did not pass.
+type checkResult struct {
+	Name   string
+	Status checkStatus
+	Detail string
+	Fix    string
+}
+
+// Doctor checks that everything va needs is present and working: the go
+// command, somewhere to write downloads and tools and to run them from, and
+// the module proxies and checksum database. Any configuration for private
+// modules is checked for credentials.
+func Doctor(ctx context.Context) []checkResult {
+	var results []checkResult
+	add := func(name string, status checkStatus, detail, fix string) {
+		results = append(results, checkResult{name, status, detail, fix})
+	}
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		add("go", checkFail, err.Error(), "install Go from https://go.dev/dl/, and make sure it is in $PATH")
+		return results
+	}
+	vars, err := goEnv(ctx)
+	if err != nil {
+		add("go", checkFail, err.Error(), "run \"go env\" to see what is wrong with the go command")
+		return results
+	}
+	add("go", checkOK, fmt.Sprintf("%s at %s", vars["GOVERSION"], goBin), "")
+
+	if err := checkWritable(vars["GOMODCACHE"]); err != nil {
+		add("module cache", checkFail, err.Error(), "set GOMODCACHE to a directory you can write to, with \"go env -w GOMODCACHE=...\"")
+	} else {
+		add("module cache", checkOK, vars["GOMODCACHE"], "")
+	}
+
+	cacheDir, err := OpenCache()
+	switch {
+	case err != nil:
+		add("va cache", checkFail, err.Error(), "set $VA_CACHE_DIR to a directory you can write to")
+	default:
+		if err := checkWritable(cacheDir); err != nil {
+			add("va cache", checkFail, err.Error(), "set $VA_CACHE_DIR to a directory you can write to")
+		} else if err := checkExecutable(filepath.Join(cacheDir, binDir)); err != nil {
+			add("va cache", checkFail, err.Error(), "set $VA_CACHE_DIR to a directory on a filesystem which is not mounted noexec")
+		} else {
+			add("va cache", checkOK, cacheDir, "")
+		}
+	}
+	if err := checkExecutable(os.TempDir()); err != nil {
+		add("temp dir", checkWarn, err.Error(), "set $TMPDIR to a directory on a filesystem which is not mounted noexec, or use --memfd")
+	} else {
+		add("temp dir", checkOK, os.TempDir(), "")
+	}
+
+	if offline {
+		add("network", checkWarn, "offline, so proxies and the checksum database were not checked", "")
+	} else {
+		results = append(results, checkProxies(ctx, vars["GOPROXY"])...)
+		results = append(results, checkSumDB(ctx, vars["GOSUMDB"], vars["GOPROXY"]))
+	}
+	return append(results, checkPrivate(vars["GOPRIVATE"])...)
+}
+
+// checkWritable checks files can be created in the directory, creating it
+// if need be.
+func checkWritable(dir string) error {
+	if dir == "" {
+		return errors.New("not set")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "va-doctor-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkExecutable checks programs can be run from the directory, by copying
+// va there and running it.
+func checkExecutable(dir string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	src, err := os.Open(self)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp(dir, "va-doctor-*"+filepath.Ext(self))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(dst.Name(), 0o755); err != nil {
+		return err
+	}
+	if out, err := exec.Command(dst.Name(), "-h").CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot run programs from %s: %v: %s", dir, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// checkProxies checks each module proxy in the GOPROXY list can be reached.
+func checkProxies(ctx context.Context, goproxy string) []checkResult {
+	var results []checkResult
+	for _, p := range newProxyClient(goproxy, "").proxies {
+		name := "proxy " + p.url
+		switch p.url {
+		case "off":
+			results = append(results, checkResult{name, checkWarn, "modules which are not already downloaded cannot be", "set GOPROXY to use a proxy, or \"direct\""})
+			continue
+		case "direct":
+			status, detail := checkOK, "modules are downloaded from their repositories"
+			if _, err := exec.LookPath("git"); err != nil {
+				status, detail = checkWarn, "git is not installed, so most repositories cannot be downloaded from"
+			}
+			results = append(results, checkResult{name, status, detail, "install git"})
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+		_, err := newProxyClient(p.url, "").fetch(ctx, p.url+"/golang.org/x/mod/@v/list")
+		cancel()
+		if err != nil && !errors.Is(err, errProxyNotFound) {
+			results = append(results, checkResult{name, checkFail, err.Error(), "check the proxy's URL, your network, and any $HTTPS_PROXY, or try --proxy with another proxy"})
+			continue
+		}
+		results = append(results, checkResult{name, checkOK, "reachable", ""})
+	}
+	if len(results) == 0 {
+		results = append(results, checkResult{"proxy", checkWarn, "GOPROXY is empty", "set GOPROXY, e.g. \"go env -w GOPROXY=https://proxy.golang.org,direct\""})
+	}
+	return results
+}
+
+// checkSumDB checks the checksum database can be reached, either directly or
+// through the first module proxy, as the go command tries both.
+func checkSumDB(ctx context.Context, gosumdb, goproxy string) checkResult {
+	if gosumdb == "" {
+		gosumdb = "sum.golang.org"
+	}
+	if gosumdb == "off" {
+		return checkResult{"checksum database", checkWarn, "GOSUMDB is off, so downloads are not checked against it", "unset GOSUMDB, unless every module used is private"}
+	}
+	fields := strings.Fields(gosumdb)
+	name := fields[0]
+	if i := strings.IndexByte(name, '+'); i >= 0 {
+		name = name[:i]
+	}
+	url := "https://" + name
+	if len(fields) > 1 {
+		url = strings.TrimSuffix(fields[1], "/")
+	}
+	urls := []string{url + "/latest"}
+	for _, p := range newProxyClient(goproxy, "").proxies {
+		if p.url != "direct" && p.url != "off" {
+			urls = append(urls, p.url+"/sumdb/"+name+"/supported")
+			break
+		}
+	}
+	var err error
+	for _, u := range urls {
+		ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+		_, err = newProxyClient("", "").fetch(ctx, u)
+		cancel()
+		if err == nil {
+			return checkResult{"checksum database", checkOK, name + " is reachable", ""}
+		}
+	}
+	return checkResult{"checksum database", checkFail, fmt.Sprintf("%s: %v", name, err),
+		"check your network, or set GONOSUMDB or GOPRIVATE for modules the checksum database cannot see"}
+}
+
+// checkPrivate checks there are credentials in the netrc file for each host
+// of the private modules in GOPRIVATE, which is how the go command
+// authenticates to private proxies and most hosts of repositories.
+func checkPrivate(goprivate string) []checkResult {
+	if goprivate == "" {
+		return []checkResult{{"private modules", checkOK, "GOPRIVATE is not set", ""}}
+	}
+	netrc := netrcPath()
+	machines, err := netrcMachines(netrc)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return []checkResult{{"netrc", checkFail, err.Error(), "fix the permissions of " + netrc}}
+	}
+	var results []checkResult
+	for _, pattern := range strings.Split(goprivate, ",") {
+		host, _, _ := strings.Cut(strings.TrimSpace(pattern), "/")
+		name := "private " + pattern
+		switch {
+		case host == "":
+			continue
+		case strings.ContainsAny(host, "*?["):
+			results = append(results, checkResult{name, checkOK, "a pattern, so its credentials cannot be checked", ""})
+		case machines[host]:
+			results = append(results, checkResult{name, checkOK, "credentials for " + host + " are in " + netrc, ""})
+		default:
+			results = append(results, checkResult{name, checkWarn, "no credentials for " + host + " in " + netrc,
+				"add \"machine " + host + " login <user> password <token>\" to " + netrc + ", or set up a git credential helper"})
+		}
+	}
+	return results
+}
+
+// netrcPath returns where the netrc file is, as the go command looks for it.
+func netrcPath() string {
+	if name := os.Getenv("NETRC"); name != "" {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// netrcMachines returns the machines which have entries in the netrc file.
+func netrcMachines(name string) (map[string]bool, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	machines := make(map[string]bool)
+	fields := strings.Fields(string(b))
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "machine" {
+			machines[fields[i+1]] = true
+		}
+	}
+	return machines, nil
+}
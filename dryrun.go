@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// dryRun prints what running the tool would do, step by step, without going
+// online, building, or running anything. Where a step depends on something
+// which is not cached, such as what a version query resolves to, it says so
+// and carries on as best it can.
+func dryRun(ctx context.Context, out io.Writer, links map[string]Link, arg string, wrap, args []string) error {
+	w := tabwriter.NewWriter(out, 1, 4, 2, ' ', 0)
+	mod, link, ok := expandLink(links, arg)
+	if ok {
+		fmt.Fprintf(w, "link:\t%s => %s, from %s\n", link.Short, link.Pkg, link.File)
+	}
+	fmt.Fprintf(w, "tool:\t%s\n", mod)
+
+	cacheDir, err := OpenCache()
+	if err != nil {
+		logWarnf("cache: %v", err)
+	} else {
+		UseGoEnvCache(cacheDir)
+	}
+	pkgPath, version, _ := strings.Cut(mod, "@")
+	if isQuery(version) {
+		resolved := mod
+		if !*flagRefresh {
+			resolved = lookupResolution(cacheDir, mod, *flagResolveTTL)
+		}
+		if _, v, _ := strings.Cut(resolved, "@"); v != version {
+			fmt.Fprintf(w, "resolve:\t%s was resolved to %s within the last %s\n", version, v, *flagResolveTTL)
+			version = v
+		} else {
+			fmt.Fprintf(w, "resolve:\t%s would be resolved online\n", version)
+		}
+	}
+
+	// Without the module, neither where the tool would be built nor its
+	// binary can be known, so the rest is only an outline.
+	tool := filepath.Join(cacheDir, binDir, "<key>", binaryName(pkgPath))
+	if cacheDir == "" {
+		tool = filepath.Join(os.TempDir(), "<temp>", binaryName(pkgPath))
+	}
+	var m Module
+	downloaded := false
+	if modCache, err := GoModCache(ctx); err == nil && !isQuery(version) {
+		m, downloaded = findDownloaded(modCache, pkgPath, version)
+	}
+	if !downloaded {
+		fmt.Fprintf(w, "download:\t%s@%s would be downloaded\n", pkgPath, version)
+		fmt.Fprintf(w, "build:\t%s would be built\n", pkgPath)
+	} else {
+		fmt.Fprintf(w, "download:\t%s@%s is in the module cache at %s\n", m.Path, m.Version, m.Dir)
+		opts := linkBuildOptions(link)
+		env, err := ReadGoEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if cacheDir != "" {
+			key := NewToolKey(m, env, opts)
+			tool = key.CachePath(cacheDir)
+		}
+		if _, err := os.Stat(tool); err == nil && cacheDir != "" {
+			fmt.Fprintf(w, "build:\t%s is cached\n", tool)
+		} else {
+			fmt.Fprintf(w, "build:\t%s\n", NewBuildCommand(m.ToolDir(), tool, opts))
+		}
+	}
+	if env := linkEnv(link.Env); len(env) > 0 {
+		fmt.Fprintf(w, "env:\t%s\n", strings.Join(env, " "))
+	}
+	fmt.Fprintf(w, "run:\t%s\n", toolCommand(wrap, tool, defaultArgs(link, args)))
+	if link.Post != "" {
+		fmt.Fprintf(w, "post:\t%s\n", link.Post)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,29 @@
+//go:build !plan9
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// signaled is implemented by the system-dependent exit status of a process
+// on platforms with signals.
+type signaled interface {
+	Signaled() bool
+	Signal() syscall.Signal
+}
+
+// exitStatus returns the exit code of a process. A process killed by a
+// signal is given 128 plus the signal number, as a shell would, so that
+// (for example) a tool killed by SIGPIPE because its output was piped into
+// "head" exits with 141 rather than being mistaken for a failure of va.
+func exitStatus(state *os.ProcessState) int {
+	if state == nil {
+		return -1
+	}
+	if ws, ok := state.Sys().(signaled); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return state.ExitCode()
+}
@@ -0,0 +1,8 @@
+package main
+
+import "os"
+
+// exitStatus returns the exit code of a process.
+func exitStatus(state *os.ProcessState) int {
+	return state.ExitCode()
+}
@@ -0,0 +1,36 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestRunExitStatusSignaled(t *testing.T) {
+	sh := shell(t)
+	for _, tt := range []struct {
+		sig  syscall.Signal
+		want int
+	}{
+		{syscall.SIGPIPE, 141},
+		{syscall.SIGKILL, 137},
+		{syscall.SIGTERM, 143},
+	} {
+		script := fmt.Sprintf("kill -%d $$", tt.sig)
+		code, err := Run(context.Background(), nil, sh, []string{"-c", script}, nil, nil)
+		if err != nil || code != tt.want {
+			t.Errorf("Run of a tool killed by %v = %d, %v, want %d", tt.sig, code, err, tt.want)
+		}
+	}
+	// A tool which exits is given its own exit code, however large.
+	code, err := Run(context.Background(), nil, sh, []string{"-c", "exit 141"}, nil, nil)
+	if err != nil || code != 141 {
+		t.Errorf("Run of a tool exiting 141 = %d, %v, want 141", code, err)
+	}
+	if code := exitStatus(nil); code != -1 {
+		t.Errorf("exitStatus of a tool never started = %d, want -1", code)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+)
+
+// explainKey is the context key for where to explain each step of resolving
+// a tool, as it is taken.
+type explainKey struct{}
+
+// withExplain returns a context in which each step of resolving a tool is
+// explained to w.
+func withExplain(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, explainKey{}, w)
+}
+
+// explainf explains a step of resolving a tool, if asked to within the
+// context.
+func explainf(ctx context.Context, format string, args ...interface{}) {
+	if w, ok := ctx.Value(explainKey{}).(io.Writer); ok {
+		fmt.Fprintf(w, format+"\n", args...)
+	}
+}
+
+// explain explains how the tool given by arg is resolved, step by step: the
+// link it matched and the list that defined it, where the version came from,
+// what a version query resolved to, and how the module containing the tool
+// was found. The module is only looked for online if it is not already in
+// the module cache, and nothing is downloaded, built, or run.
+func explain(ctx context.Context, out io.Writer, links map[string]Link, arg string) error {
+	ctx = withExplain(ctx, out)
+	mod, link, ok := expandLink(links, arg)
+	short, argVersion, hasVersion := strings.Cut(arg, "@")
+	_, linkVersion, _ := strings.Cut(link.Pkg, "@")
+	if isRewrite(link.Short) {
+		// A rule without a version of its own has --default-version's.
+		_, linkVersion, _ = strings.Cut(mod, "@")
+	}
+	switch {
+	case !ok:
+		explainf(ctx, "link: %s is not a short name, so it is a package path", short)
+	case isRewrite(link.Short):
+		explainf(ctx, "link: %s is rewritten by %s, defined at %s (%s) as %s", short, link.Short, link.Location(), describeSource(link.Source), link.Pkg)
+	default:
+		explainf(ctx, "link: %s is defined at %s (%s) as %s", short, link.Location(), describeSource(link.Source), link.Pkg)
+		if link.Alias != "" {
+			explainf(ctx, "link: %s is an alias of %s", short, link.Alias)
+		}
+		for i := len(link.Overrides) - 1; i >= 0; i-- {
+			explainf(ctx, "link: %s overrides the definition at %s", short, link.Overrides[i])
+		}
+		if link.Override != "" {
+			explainf(ctx, "link: %s has its version overridden by %s", short, link.Override)
+		}
+		if len(link.Via) > 0 {
+			explainf(ctx, "link: %s is included by %s", link.File, strings.Join(link.Via, " <- "))
+		}
+		if prefix, _ := listPrefix(link.ListFile()); prefix != "" {
+			explainf(ctx, "link: short names in %s are prefixed with %q", link.ListFile(), prefix)
+		}
+		if link.Deprecated != "" {
+			explainf(ctx, "link: %s is deprecated: %s", short, link.Deprecated)
+		}
+		if link.ReplacedBy != "" {
+			explainf(ctx, "link: %s is replaced by %s", short, link.ReplacedBy)
+		}
+		if len(link.BuildTags) > 0 || link.Ldflags != "" {
+			explainf(ctx, "link: %s is built with tags %q and ldflags %q", short, strings.Join(link.BuildTags, ","), link.Ldflags)
+		}
+		if len(link.BuildEnv) > 0 {
+			explainf(ctx, "link: %s is built with the environment %q", short, link.BuildEnv)
+		}
+		if len(link.Env) > 0 {
+			explainf(ctx, "link: %s is run with the environment %q", short, link.Env)
+		}
+		if len(link.Args) > 0 {
+			explainf(ctx, "link: %s is run with the arguments %q first", short, link.Args)
+		}
+		if len(link.GOOS) > 0 {
+			explainf(ctx, "link: %s only works on GOOS %s%s", short, strings.Join(link.GOOS, ", "), notThisSystem(matchPlatform(link.GOOS, runtime.GOOS, unixGOOS)))
+		}
+		if len(link.GOARCH) > 0 {
+			explainf(ctx, "link: %s only works on GOARCH %s%s", short, strings.Join(link.GOARCH, ", "), notThisSystem(matchPlatform(link.GOARCH, runtime.GOARCH, nil)))
+		}
+	}
+	switch {
+	case hasVersion && ok:
+		explainf(ctx, "version: %s was given, overriding %s from the link", argVersion, linkVersion)
+	case hasVersion:
+		explainf(ctx, "version: %s was given", argVersion)
+	case ok:
+		explainf(ctx, "version: none was given, so %s from the link is used", linkVersion)
+	}
+	if err := checkTool(links, mod); err != nil {
+		return err
+	}
+
+	cacheDir, err := OpenCache()
+	if err != nil {
+		logWarnf("cache: %v", err)
+	} else {
+		UseGoEnvCache(cacheDir)
+	}
+	m, downloaded, err := locateTool(ctx, cacheDir, mod)
+	if err != nil {
+		return err
+	}
+	if m.Tail != "" {
+		explainf(ctx, "module: %s is the module, and the package is %s within it", m.Path, m.Tail)
+	} else {
+		explainf(ctx, "module: %s is the module, and the package is at its root", m.Path)
+	}
+	if !downloaded {
+		explainf(ctx, "download: %s@%s has not been downloaded", m.Path, m.Version)
+		return nil
+	}
+	explainf(ctx, "download: %s@%s is in the module cache at %s", m.Path, m.Version, m.Dir)
+	if cacheDir != "" {
+		if tool, ok := FindCachedTool(ctx, cacheDir, m.ToolPath()+"@"+m.Version, linkBuildOptions(link)); ok {
+			explainf(ctx, "build: %s is cached", tool)
+			return nil
+		}
+	}
+	explainf(ctx, "build: %s@%s has not been built", m.ToolPath(), m.Version)
+	return nil
+}
+
+// notThisSystem notes that a link does not work on the system va is running
+// on, unless it does.
+func notThisSystem(works bool) string {
+	if works {
+		return ""
+	}
+	return fmt.Sprintf(", which %s/%s is not", runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// exporters write definitions which run each link through va, for va export,
+// by the format they are in: shell aliases, Make variables, or Task tasks.
+var exporters = map[string]func(w io.Writer, links map[string]Link, exported []Link, va string) error{
+	"shell":    exportShell,
+	"make":     exportMake,
+	"taskfile": exportTaskfile,
+}
+
+// exportName returns the name the link is exported as: the last element of
+// its short name, as va shim names it, if that finds the link, or else the
+// whole short name with "-" for "/".
+func exportName(links map[string]Link, short string) string {
+	if name := path.Base(short); linkNamed(links, name) == short {
+		return name
+	}
+	return strings.ReplaceAll(short, "/", "-")
+}
+
+// exportShell writes an alias for each link, for sh, bash, zsh, and fish,
+// which all understand the same syntax:
+//
+//	alias golangci-lint='va run go/golangci-lint --'
+func exportShell(w io.Writer, links map[string]Link, exported []Link, va string) error {
+	fmt.Fprintf(w, "# Aliases which run tools through va, written by va export.\n")
+	for _, link := range exported {
+		if desc := exportComment(link.Desc); desc != "" {
+			fmt.Fprintf(w, "\n# %s\n", desc)
+		} else {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "alias %s=%s\n", exportName(links, link.Short), shellQuote(va+" run "+link.Short+" --"))
+	}
+	return nil
+}
+
+// exportMake writes a variable for each link, named after it in upper case,
+// which a Makefile can include and then run the tool with, such as
+// "$(GOLANGCI_LINT) run ./...". Each may be set differently, as they are
+// only set if they are not already, and so may va itself, through $(VA).
+func exportMake(w io.Writer, links map[string]Link, exported []Link, va string) error {
+	fmt.Fprintf(w, "# Variables which run tools through va, written by va export.\n\nVA ?= %s\n", va)
+	for _, link := range exported {
+		if desc := exportComment(link.Desc); desc != "" {
+			fmt.Fprintf(w, "\n# %s\n", desc)
+		} else {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s ?= $(VA) run %s --\n", makeVariable(exportName(links, link.Short)), link.Short)
+	}
+	return nil
+}
+
+// exportComment returns the description of a link as a comment of a single
+// line, to write after "# ". A description from a list could otherwise end
+// the comment with a newline, and write whatever it liked after it, or in a
+// Makefile, carry the comment on to the next line with a backslash.
+func exportComment(desc string) string {
+	desc = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, desc)
+	return strings.TrimRight(desc, ` \`)
+}
+
+// makeVariable returns the name of the Make variable for the exported name,
+// in upper case, with "_" for anything other than a letter or digit.
+func makeVariable(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, name)
+}
+
+// exportTaskfile writes a Taskfile for Task, with a task for each link named
+// after its short name, with ":" for "/" as Task namespaces tasks, which runs
+// the tool with the arguments given after "--", such as
+// "task go:golangci-lint -- run ./...". It can be included into another
+// Taskfile, or used as it is.
+func exportTaskfile(w io.Writer, links map[string]Link, exported []Link, va string) error {
+	fmt.Fprintf(w, "# Tasks which run tools through va, written by va export.\nversion: '3'\n\nvars:\n  VA: %s\n\ntasks:\n", strconv.Quote(va))
+	for i, link := range exported {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "  %s:\n", strings.ReplaceAll(link.Short, "/", ":"))
+		if link.Desc != "" {
+			fmt.Fprintf(w, "    desc: %s\n", strconv.Quote(link.Desc))
+		}
+		fmt.Fprintf(w, "    cmds:\n      - '{{.VA}} run %s -- {{.CLI_ARGS}}'\n", link.Short)
+	}
+	return nil
+}
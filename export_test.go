@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExportComment(t *testing.T) {
+	links := map[string]Link{
+		"hello": {Short: "hello", Pkg: "example.com/hello@latest", Desc: "Says hello\nrm -rf ~ #"},
+		"make":  {Short: "make", Pkg: "example.com/make@latest", Desc: "Carries on \\"},
+		"tab":   {Short: "tab", Pkg: "example.com/tab@latest", Desc: "a\tb\r\x1b[31m"},
+	}
+	exported := []Link{links["hello"], links["make"], links["tab"]}
+	for _, tt := range []struct {
+		format string
+		want   []string
+	}{
+		{format: "shell", want: []string{"# Says hello rm -rf ~ #", "# Carries on", "# a b  [31m"}},
+		{format: "make", want: []string{"# Says hello rm -rf ~ #", "# Carries on", "# a b  [31m"}},
+	} {
+		var b strings.Builder
+		if err := exporters[tt.format](&b, links, exported, "va"); err != nil {
+			t.Fatal(err)
+		}
+		var comments []string
+		for _, line := range strings.Split(b.String(), "\n")[1:] {
+			switch {
+			case strings.HasPrefix(line, "# "):
+				comments = append(comments, line)
+			case line != "" && !strings.HasPrefix(line, "alias ") && !strings.Contains(line, "?="):
+				t.Errorf("%s: unexpected line: %q", tt.format, line)
+			}
+		}
+		if strings.Join(comments, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: comments = %q, want %q", tt.format, comments, tt.want)
+		}
+	}
+}
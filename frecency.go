@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// frecencyWeights weigh each run of a tool by how long ago it was, so that
+// tools used often, and recently, come first. A run counts for the weight of
+// the first age it is within, or the last weight if it is older than them
+// all.
+var frecencyWeights = []struct {
+	age    time.Duration
+	weight float64
+}{
+	{4 * time.Hour, 100},
+	{24 * time.Hour, 80},
+	{7 * 24 * time.Hour, 60},
+	{30 * 24 * time.Hour, 40},
+	{0, 20},
+}
+
+// frecencyScores scores each link by how often and how recently it has been
+// run, as recorded in the history. Runs of a package path which a link is
+// short for count towards the link.
+func frecencyScores(cacheDir string, links map[string]Link) map[string]float64 {
+	scores := make(map[string]float64)
+	if cacheDir == "" {
+		return scores
+	}
+	recs, err := readHistory(cacheDir)
+	if err != nil {
+		return scores
+	}
+	byPkg := make(map[string]string)
+	for short, link := range links {
+		pkgPath, _, _ := strings.Cut(link.Pkg, "@")
+		byPkg[pkgPath] = short
+	}
+	now := time.Now()
+	for _, rec := range recs {
+		short := rec.Short
+		if _, ok := links[short]; !ok {
+			pkgPath, _, _ := strings.Cut(rec.Tool, "@")
+			if short, ok = byPkg[pkgPath]; !ok {
+				continue
+			}
+		}
+		age := now.Sub(rec.Start)
+		for _, w := range frecencyWeights {
+			if age < w.age || w.age == 0 {
+				scores[short] += w.weight
+				break
+			}
+		}
+	}
+	return scores
+}
+
+// sortedLinks returns the links sorted by their short name, or, if scores
+// are given, highest score first, then by short name.
+func sortedLinks(links map[string]Link, scores map[string]float64) []Link {
+	sorted := make([]Link, 0, len(links))
+	for _, link := range links {
+		sorted = append(sorted, link)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if si, sj := scores[sorted[i].Short], scores[sorted[j].Short]; si != sj {
+			return si > sj
+		}
+		return sorted[i].Short < sorted[j].Short
+	})
+	return sorted
+}
+
+// linksByFrecency returns the links sorted by their frecency scores, or by
+// short name if the cache, and so the history, cannot be opened.
+func linksByFrecency(links map[string]Link) []Link {
+	cacheDir, err := OpenCache()
+	if err != nil {
+		return sortedLinks(links, nil)
+	}
+	return sortedLinks(links, frecencyScores(cacheDir, links))
+}
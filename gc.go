@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gcStampFile is the file within the cache directory whose modification time
+// records when the cache was last garbage collected automatically.
+const gcStampFile = "gc-stamp"
+
+// gcInterval is how often the cache is garbage collected automatically.
+const gcInterval = 24 * time.Hour
+
+// gcTempAge is how old a temporary build directory must be before it is
+// assumed to have been abandoned by a build which crashed or was killed.
+const gcTempAge = 24 * time.Hour
+
+// GCPolicy decides which tools are evicted from the cache.
+type GCPolicy struct {
+	MaxSize int64         // Evict least recently used tools until the cache is no bigger than this.
+	MaxAge  time.Duration // Evict tools which have not been used for this long.
+}
+
+// defaultGCPolicy returns the garbage collection policy, which keeps up to
+// 1GiB of tools used within the last 30 days unless $VA_CACHE_MAX_SIZE or
+// $VA_CACHE_MAX_AGE say otherwise.
+func defaultGCPolicy() (GCPolicy, error) {
+	policy := GCPolicy{
+		MaxSize: 1 << 30,
+		MaxAge:  30 * 24 * time.Hour,
+	}
+	if s := os.Getenv("VA_CACHE_MAX_SIZE"); s != "" {
+		size, err := parseSize(s)
+		if err != nil {
+			return policy, fmt.Errorf("VA_CACHE_MAX_SIZE: %w", err)
+		}
+		policy.MaxSize = size
+	}
+	if s := os.Getenv("VA_CACHE_MAX_AGE"); s != "" {
+		age, err := parseAge(s)
+		if err != nil {
+			return policy, fmt.Errorf("VA_CACHE_MAX_AGE: %w", err)
+		}
+		policy.MaxAge = age
+	}
+	return policy, nil
+}
+
+// cacheEntry is a tool in the cache.
+type cacheEntry struct {
+	Hash string    // Hash of the key of the tool, which names its directory.
+	Dir  string    // Directory holding the tool.
+	Size int64     // Total size of the files in the directory.
+	Bin  int64     // Size of the binary alone.
+	Used time.Time // When the tool was last used.
+	Meta ToolMeta  // Description of the tool.
+}
+
+// ToolPath returns the path of the package of the tool, without a version.
+func (e cacheEntry) ToolPath() string {
+	return path.Join(e.Meta.Key.Path, e.Meta.Key.Tail)
+}
+
+// Tool returns the path of the tool's binary.
+func (e cacheEntry) Tool() string {
+	return filepath.Join(e.Dir, e.Meta.Key.Binary())
+}
+
+// touchEntry marks the tool in the cache directory entryDir as just used.
+func touchEntry(entryDir string) error {
+	now := time.Now()
+	return os.Chtimes(filepath.Join(entryDir, binMetaFile), now, now)
+}
+
+// cacheEntries returns the tools in the cache, most recently used first.
+func cacheEntries(cacheDir string) ([]cacheEntry, error) {
+	dirs, err := os.ReadDir(filepath.Join(cacheDir, binDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []cacheEntry
+	for _, d := range dirs {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), "tmp-") {
+			continue
+		}
+		entry := cacheEntry{
+			Hash: d.Name(),
+			Dir:  filepath.Join(cacheDir, binDir, d.Name()),
+		}
+		files, err := os.ReadDir(entry.Dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			info, err := f.Info()
+			if err != nil {
+				return nil, err
+			}
+			entry.Size += info.Size()
+			if f.Name() == binMetaFile {
+				entry.Used = info.ModTime()
+			} else {
+				entry.Bin = info.Size()
+			}
+		}
+		meta, err := os.ReadFile(filepath.Join(entry.Dir, binMetaFile))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(meta, &entry.Meta); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Dir, err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Used.After(entries[j].Used)
+	})
+
+	// A binary shared with a more recently used tool takes up no more
+	// space, so only count it once.
+	stored := make(map[string]bool)
+	for i, entry := range entries {
+		if sum := entry.Meta.SHA256; sum != "" {
+			if stored[sum] {
+				entries[i].Size -= entry.Bin
+			}
+			stored[sum] = true
+		}
+	}
+	return entries, nil
+}
+
+// GC evicts tools from the cache according to the policy, except for the
+// tool with the hash keep (if any), which is in use. Temporary directories
+// abandoned by builds that never finished are also removed. If dryRun is set,
+// nothing is removed, but the tools which would have been are still returned.
+func GC(cacheDir string, policy GCPolicy, keep string, dryRun bool) ([]cacheEntry, error) {
+	entries, err := cacheEntries(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var evicted, kept []cacheEntry
+	var size int64
+	now := time.Now()
+	for _, entry := range entries {
+		switch {
+		case entry.Hash == keep:
+		case policy.MaxAge > 0 && now.Sub(entry.Used) > policy.MaxAge:
+			evicted = append(evicted, entry)
+			continue
+		case policy.MaxSize > 0 && size+entry.Size > policy.MaxSize:
+			// Entries are most recently used first, so everything
+			// from here onwards is less recently used than what we
+			// have kept already.
+			evicted = append(evicted, entry)
+			continue
+		}
+		size += entry.Size
+		kept = append(kept, entry)
+	}
+	if dryRun {
+		return evicted, nil
+	}
+
+	for _, entry := range evicted {
+		if err := os.RemoveAll(entry.Dir); err != nil {
+			return evicted, err
+		}
+		os.Remove(filepath.Join(cacheDir, lockDir, entry.Hash))
+	}
+	if err := gcObjects(cacheDir, kept); err != nil {
+		return evicted, err
+	}
+
+	temps, err := filepath.Glob(filepath.Join(cacheDir, binDir, "tmp-*"))
+	if err != nil {
+		return evicted, err
+	}
+	for _, temp := range temps {
+		if info, err := os.Stat(temp); err == nil && now.Sub(info.ModTime()) > gcTempAge {
+			os.RemoveAll(temp)
+		}
+	}
+	return evicted, nil
+}
+
+// autoGC garbage collects the cache with the default policy, if it has not
+// been done within the last gcInterval. The tool with the hash keep (if any)
+// is never evicted, as it is about to be used.
+func autoGC(cacheDir, keep string) error {
+	stamp := filepath.Join(cacheDir, gcStampFile)
+	if info, err := os.Stat(stamp); err == nil && time.Since(info.ModTime()) < gcInterval {
+		return nil
+	}
+	if err := os.WriteFile(stamp, nil, 0o644); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := os.Chtimes(stamp, now, now); err != nil {
+		return err
+	}
+
+	policy, err := defaultGCPolicy()
+	if err != nil {
+		return err
+	}
+	_, err = GC(cacheDir, policy, keep, false)
+	return err
+}
+
+// parseSize parses a size in bytes, such as "512M" or "2GiB". Suffixes are
+// powers of 1024.
+func parseSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	shift := 0
+	if len(num) > 0 {
+		if i := strings.IndexByte("KMGT", num[len(num)-1]); i >= 0 {
+			shift = 10 * (i + 1)
+			num = num[:len(num)-1]
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad size: %q", s)
+	}
+	if n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("size too large: %q", s)
+	}
+	return n << shift, nil
+}
+
+// formatSize formats a size in bytes for people to read, e.g. "8.2MiB".
+func formatSize(n int64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	f := float64(n)
+	i := -1
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return strconv.FormatFloat(f, 'f', 1, 64) + string(units[i]) + "iB"
+}
+
+// parseAge parses a duration, as understood by time.ParseDuration, but also
+// allowing a number of days such as "30d".
+func parseAge(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("bad age: %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
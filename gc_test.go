@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		want    int64
+		wantErr string
+	}{
+		{s: "0", want: 0},
+		{s: "512", want: 512},
+		{s: "1K", want: 1 << 10},
+		{s: "512M", want: 512 << 20},
+		{s: "2GiB", want: 2 << 30},
+		{s: "2gb", want: 2 << 30},
+		{s: "1T", want: 1 << 40},
+		{s: "8388607T", want: 8388607 << 40},
+		{s: "9223372036854775807", want: 9223372036854775807},
+		{s: "8388608T", wantErr: `size too large: "8388608T"`},
+		{s: "9007199254740992K", wantErr: `size too large: "9007199254740992K"`},
+		{s: "9223372036854775808", wantErr: `bad size: "9223372036854775808"`},
+		{s: "-1M", wantErr: `bad size: "-1M"`},
+		{s: "", wantErr: `bad size: ""`},
+		{s: "M", wantErr: `bad size: "M"`},
+		{s: "1.5G", wantErr: `bad size: "1.5G"`},
+	} {
+		got, err := parseSize(tt.s)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("parseSize(%q) = %d, %v, want %q", tt.s, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+	}
+}
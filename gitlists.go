@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// reSCPURL matches the scp-like addresses git understands for repositories
+// reached over ssh, such as git@github.com:team/lists.git, whose host is
+// more than one character so as not to be taken for a drive letter.
+var reSCPURL = regexp.MustCompile(`^(?:[^@/:]+@)?[^@/:-][^@/:]+:`)
+
+// isGitListURL reports whether the URL is of a git repository of lists,
+// rather than of a single list: one ending in ".git", or one reached over
+// ssh.
+func isGitListURL(rawURL string) bool {
+	return strings.HasSuffix(rawURL, ".git") || strings.HasPrefix(rawURL, "ssh://") || !strings.Contains(rawURL, "://") && reSCPURL.MatchString(rawURL)
+}
+
+// checkGitURL checks the URL of a git repository of lists is one va will
+// fetch: over HTTPS or ssh, from a repository on this machine, or over plain
+// HTTP only from this machine.
+func checkGitURL(rawURL string) error {
+	if strings.HasPrefix(rawURL, "-") {
+		return fmt.Errorf("%s: bad URL", rawURL)
+	}
+	if !strings.Contains(rawURL, "://") && reSCPURL.MatchString(rawURL) {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	switch {
+	case (u.Scheme == "https" || u.Scheme == "ssh") && u.Host != "":
+		return nil
+	case u.Scheme == "file" && u.Path != "":
+		return nil
+	case u.Scheme == "http" && isLoopback(u.Hostname()):
+		return nil
+	}
+	return fmt.Errorf("%s: git repositories of lists must be fetched over https or ssh, or from file:// URLs", rawURL)
+}
+
+// gitRepoName returns the name a git repository of lists is known by unless
+// another is given, the last element of its URL without any ".git", such as
+// "lists" for git@github.com:team/lists.git.
+func gitRepoName(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		_, rawURL, _ = strings.Cut(rawURL, ":")
+	} else if u, err := url.Parse(rawURL); err == nil {
+		rawURL = u.Path
+	}
+	return strings.TrimSuffix(path.Base(strings.TrimSuffix(rawURL, "/")), ".git")
+}
+
+// newGitSubscription returns a subscription to the git repository of lists
+// at the URL, known by the name, or by gitRepoName if none is given, of the
+// lists in dir within the repository at ref.
+func newGitSubscription(rawURL, name, ref, dir string) (Subscription, error) {
+	if err := checkGitURL(rawURL); err != nil {
+		return Subscription{}, err
+	}
+	if name == "" {
+		name = gitRepoName(rawURL)
+	}
+	if name == "" || name == "." || strings.ContainsAny(name, `/\`) {
+		return Subscription{}, fmt.Errorf("bad name: %q (must be given with --name)", name)
+	}
+	if strings.HasPrefix(ref, "-") {
+		return Subscription{}, fmt.Errorf("bad ref: %s", ref)
+	}
+	if dir = path.Clean(filepath.ToSlash(dir)); dir == "." {
+		dir = ""
+	} else if !fs.ValidPath(dir) {
+		return Subscription{}, fmt.Errorf("bad directory: %s (must be within the repository)", dir)
+	}
+	return Subscription{URL: rawURL, Name: name, Time: time.Now(), Git: true, Ref: ref, Dir: dir}, nil
+}
+
+// gitListsDir returns the directory the lists of the git repository are in,
+// within its checkout in the cache.
+func gitListsDir(cacheDir string, sub Subscription) string {
+	return filepath.Join(remoteListDir(cacheDir, sub.URL), "lists", filepath.FromSlash(sub.Dir))
+}
+
+// syncGitSubscription fetches the git repository of lists into the cache,
+// unless it was fetched within --lists-ttl and force is not set, checking out
+// its newest commit of the subscription's ref. Only the newest commit is
+// fetched, and the git directory is kept apart from the checkout, so that
+// only the repository's own files are read as lists. The new commit is only
+// kept if every line of every list in it is valid; otherwise the one checked
+// out before is put back.
+func syncGitSubscription(ctx context.Context, cacheDir string, sub Subscription, force bool) error {
+	dir := remoteListDir(cacheDir, sub.URL)
+	gitDir, tree := filepath.Join(dir, "git"), filepath.Join(dir, "lists")
+	fresh := func() bool {
+		_, err := os.Stat(tree)
+		return err == nil && !force && time.Since(readRemoteListMeta(dir).Fetched) < *flagListsTTL
+	}
+	if fresh() || *flagOffline {
+		return nil
+	}
+
+	// Another va may be fetching the repository at the same time, and may
+	// have just done so once it is done.
+	if err := os.MkdirAll(filepath.Join(cacheDir, lockDir), 0o755); err != nil {
+		return err
+	}
+	lockFile, err := lock(ctx, filepath.Join(cacheDir, lockDir, remoteListsDir+"-"+filepath.Base(dir)), nil)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+	if fresh() {
+		return nil
+	}
+
+	if _, err := os.Stat(gitDir); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		if _, err := runGit(exec.CommandContext(ctx, "git", "init", "--quiet", "--bare", gitDir)); err != nil {
+			return err
+		}
+	}
+	ref := sub.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := runGit(gitListsCommand(ctx, gitDir, tree, "fetch", "--quiet", "--depth=1", "--no-tags", "--", sub.URL, ref)); err != nil {
+		return fmt.Errorf("%s: %w", sub.URL, err)
+	}
+	commit, err := runGit(gitListsCommand(ctx, gitDir, tree, "rev-parse", "--verify", "FETCH_HEAD^{commit}"))
+	if err != nil {
+		return fmt.Errorf("%s: %w", sub.URL, err)
+	}
+	// There is no commit checked out before the first.
+	old, _ := runGit(gitListsCommand(ctx, gitDir, tree, "rev-parse", "--verify", "--quiet", "HEAD"))
+
+	if commit != old {
+		if err := checkoutGitLists(ctx, gitDir, tree, commit); err != nil {
+			return fmt.Errorf("%s: %w", sub.URL, err)
+		}
+		if err := checkGitLists(gitListsDir(cacheDir, sub)); err != nil {
+			var undoErr error
+			if old != "" {
+				undoErr = checkoutGitLists(ctx, gitDir, tree, old)
+			} else {
+				undoErr = os.RemoveAll(tree)
+			}
+			if undoErr != nil {
+				logWarnf("lists: %s: %v", sub.URL, undoErr)
+			}
+			return fmt.Errorf("%s: %s: %w", sub.URL, commit, err)
+		}
+		logVerbosef("lists: %s: checked out %s", sub.URL, commit)
+	}
+	return writeRemoteListMeta(dir, remoteListMeta{Commit: commit, Fetched: time.Now()})
+}
+
+// checkoutGitLists checks out the commit of the git repository of lists,
+// with any symbolic links as plain files, so that they cannot lead outside
+// the checkout.
+func checkoutGitLists(ctx context.Context, gitDir, tree, commit string) error {
+	if err := os.MkdirAll(tree, 0o755); err != nil {
+		return err
+	}
+	_, err := runGit(gitListsCommand(ctx, gitDir, tree, "-c", "core.symlinks=false", "checkout", "--quiet", "--force", "--detach", commit))
+	return err
+}
+
+// checkGitLists checks every line of every list file in the directory, and
+// in those within it, is valid, as loadLinks would read them.
+func checkGitLists(dir string) error {
+	if fi, err := os.Stat(dir); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s: not a directory", dir)
+	}
+	_, err := fsToLinks(os.DirFS(dir))
+	return err
+}
+
+// gitListsCommand returns the git command with the arguments, for the git
+// directory and checkout of a git repository of lists.
+func gitListsCommand(ctx context.Context, gitDir, tree string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "git", append([]string{"--git-dir=" + gitDir, "--work-tree=" + tree}, args...)...)
+}
+
+// runGit runs the git command, returning its output without the trailing
+// newline, or an error with what git said went wrong. git is told not to ask
+// for credentials, as va may be fetching a repository as it starts, when no
+// one is expecting to be asked.
+func runGit(cmd *exec.Cmd) (string, error) {
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	logCommand(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git: %s", msg)
+		}
+		return "", fmt.Errorf("git: %w", err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
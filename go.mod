@@ -4,10 +4,10 @@ go 1.18
 
 require (
 	golang.org/x/mod v0.6.0-dev.0.20220106191415-9b9b3d81d5e3
+	golang.org/x/sys v0.0.0-20220513210249-45d2b4557a2a
 	golang.org/x/tools v0.1.10
 )
 
 require (
-	golang.org/x/sys v0.0.0-20220513210249-45d2b4557a2a // indirect
 	golang.org/x/xerrors v0.0.0-20220411194840-2f41105eb62f // indirect
 )
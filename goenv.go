@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// goEnvFile is the file within the cache directory holding the snapshot of
+// the go command's environment.
+const goEnvFile = "goenv.json"
+
+// goEnvNames are the variables captured in the snapshot of the go command's
+// environment. Anything which needs another variable should add it here,
+// rather than asking the go command for it separately.
+var goEnvNames = []string{
+	"GOOS", "GOARCH", "GOVERSION", "CGO_ENABLED", "GOFLAGS", "GOAMD64", "GOARM",
+	"GOROOT", "GOPATH", "GOBIN", "GOMODCACHE", "GOPROXY", "GONOPROXY", "GOPRIVATE",
+	"GOSUMDB", "GONOSUMDB",
+}
+
+// goEnvSnapshot is the go command's environment, along with a fingerprint
+// of everything which could change it.
+type goEnvSnapshot struct {
+	Toolchain string
+	Vars      map[string]string
+}
+
+// goEnvState memoizes the go command's environment for the life of the
+// process. If a cache directory has been set with UseGoEnvCache, the
+// snapshot is also kept there, so that most runs never ask the go command.
+var goEnvState struct {
+	sync.Mutex
+	cacheDir string
+	vars     map[string]string
+}
+
+// UseGoEnvCache keeps the snapshot of the go command's environment in the
+// cache directory.
+func UseGoEnvCache(cacheDir string) {
+	goEnvState.Lock()
+	defer goEnvState.Unlock()
+	goEnvState.cacheDir = cacheDir
+}
+
+// goEnv returns the snapshot of the go command's environment, asking the go
+// command for it only if there is no snapshot for the current toolchain.
+func goEnv(ctx context.Context) (map[string]string, error) {
+	goEnvState.Lock()
+	defer goEnvState.Unlock()
+	if goEnvState.vars != nil {
+		return goEnvState.vars, nil
+	}
+
+	toolchain, err := toolchainFingerprint()
+	if err != nil {
+		return nil, err
+	}
+	name := ""
+	if goEnvState.cacheDir != "" {
+		name = filepath.Join(goEnvState.cacheDir, goEnvFile)
+		var snap goEnvSnapshot
+		if b, err := os.ReadFile(name); err == nil && json.Unmarshal(b, &snap) == nil && snap.Toolchain == toolchain {
+			goEnvState.vars = snap.Vars
+			return snap.Vars, nil
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "go", append([]string{"env", "-json"}, goEnvNames...)...)
+	logCommand(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go env: %w", err)
+	}
+	vars := make(map[string]string)
+	if err := json.Unmarshal(out, &vars); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+	goEnvState.vars = vars
+
+	// Failing to save the snapshot only means asking again next time.
+	if name != "" {
+		if b, err := json.Marshal(goEnvSnapshot{Toolchain: toolchain, Vars: vars}); err == nil {
+			writeFileAtomic(name, b)
+		}
+	}
+	return vars, nil
+}
+
+// toolchainFingerprint returns a hash of everything which can change the go
+// command's environment: the go binary found in $PATH, the go-related
+// environment variables, the file "go env -w" writes to, and which
+// variables are in the snapshot.
+func toolchainFingerprint() (string, error) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		return "", fmt.Errorf("go env: %w", err)
+	}
+	h := sha256.New()
+	fingerprintFile(h, goBin)
+
+	// A snapshot taken before a variable was needed does not have it.
+	fmt.Fprintf(h, "%s\n", strings.Join(goEnvNames, " "))
+
+	var env []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "GO") || strings.HasPrefix(kv, "CGO_") {
+			env = append(env, kv)
+		}
+	}
+	sort.Strings(env)
+	for _, kv := range env {
+		fmt.Fprintf(h, "%s\n", kv)
+	}
+
+	goEnvConfig := os.Getenv("GOENV")
+	if goEnvConfig == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			goEnvConfig = filepath.Join(dir, "go", "env")
+		}
+	}
+	if goEnvConfig != "" && goEnvConfig != "off" {
+		fingerprintFile(h, goEnvConfig)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fingerprintFile writes the name, size and modification time of the file to
+// w, or just the name if it does not exist.
+func fingerprintFile(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s\n", name)
+	if info, err := os.Stat(name); err == nil {
+		fmt.Fprintf(w, "%d %d\n", info.Size(), info.ModTime().UnixNano())
+	}
+}
+
+// GoEnv is the subset of the go command's environment which affects the
+// binaries it builds.
+type GoEnv struct {
+	GOOS        string
+	GOARCH      string
+	GOVERSION   string
+	CGO_ENABLED string
+	GOFLAGS     string
+	GOAMD64     string
+	GOARM       string
+}
+
+// ReadGoEnv returns the go command's environment.
+func ReadGoEnv(ctx context.Context) (GoEnv, error) {
+	vars, err := goEnv(ctx)
+	if err != nil {
+		return GoEnv{}, err
+	}
+	return GoEnv{
+		GOOS:        vars["GOOS"],
+		GOARCH:      vars["GOARCH"],
+		GOVERSION:   vars["GOVERSION"],
+		CGO_ENABLED: vars["CGO_ENABLED"],
+		GOFLAGS:     vars["GOFLAGS"],
+		GOAMD64:     vars["GOAMD64"],
+		GOARM:       vars["GOARM"],
+	}, nil
+}
+
+// GoModCache returns where the module cache is.
+func GoModCache(ctx context.Context) (string, error) {
+	vars, err := goEnv(ctx)
+	if err != nil {
+		return "", err
+	}
+	if vars["GOMODCACHE"] == "" {
+		return "", errors.New("go env: GOMODCACHE is not set")
+	}
+	return vars["GOMODCACHE"], nil
+}
+
+// goEnvVars returns the values of the variables in the go command's
+// environment, which must be listed in goEnvNames.
+func goEnvVars(ctx context.Context, names ...string) (map[string]string, error) {
+	vars, err := goEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subset := make(map[string]string, len(names))
+	for _, name := range names {
+		subset[name] = vars[name]
+	}
+	return subset, nil
+}
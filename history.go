@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyFile is the file within the state directory recording each tool
+// that has been run, one JSON record per line. Earlier versions of va kept
+// it in the cache directory, from where it is moved when a run is next
+// recorded.
+const historyFile = "history.jsonl"
+
+// maxHistory is how many runs are remembered.
+const maxHistory = 1000
+
+// RunRecord describes a run of a tool, in enough detail to run it again in
+// exactly the same way.
+type RunRecord struct {
+	Short    string        `json:",omitempty"` // Short name of the link run, if it was one.
+	Tool     string        // Package path and the version it resolved to.
+	Args     []string      // Arguments given to the tool.
+	Dir      string        // Directory the tool was run in.
+	ExitCode int           // Exit code of the tool, or -1 if it could not be run.
+	Start    time.Time     // When the tool started running.
+	Duration time.Duration // How long the tool ran for.
+
+	// Prepare is how long it took to get the tool ready to run, which
+	// is how long va kept the tool waiting. If the tool was not already
+	// built, Built is set.
+	Prepare time.Duration
+	Built   bool `json:",omitempty"`
+}
+
+// recordRun records the run of a tool, resolving the version it was asked
+// for to the version that was run. Failing to record the run is no reason
+// for the run to fail, so any error is only reported.
+func recordRun(cacheDir string, rec RunRecord) {
+	if cacheDir == "" {
+		return
+	}
+	rec.Tool = lookupResolution(cacheDir, rec.Tool, *flagResolveTTL)
+	rec.Dir, _ = os.Getwd()
+	if err := appendHistory(cacheDir, rec); err != nil {
+		logWarnf("history: %v", err)
+	}
+}
+
+// historyPath returns the path of the history of runs.
+func historyPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, historyFile), nil
+}
+
+// appendHistory adds the run to the end of the history. The history is
+// only rewritten, forgetting the oldest runs, once it is twice as long as
+// need be, or to move it from the cache directory, or to start again if it
+// cannot be read at all.
+func appendHistory(cacheDir string, rec RunRecord) error {
+	name, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return err
+	}
+	lockFile, err := lock(context.Background(), name+".lock", nil)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	recs, err := readHistoryFile(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		recs, _ = readHistoryFile(filepath.Join(cacheDir, historyFile))
+	case err == nil && len(recs) < 2*maxHistory:
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	recs = append(recs, rec)
+	if len(recs) > maxHistory {
+		recs = recs[len(recs)-maxHistory:]
+	}
+	var b []byte
+	for _, r := range recs {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, line...), '\n')
+	}
+	if err := writeFileAtomicPerm(name, b, 0o600); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(cacheDir, historyFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logDebugf("history: %v", err)
+	}
+	return nil
+}
+
+// readHistory reads the most recent runs recorded, oldest first. Until a run
+// is recorded in the state directory, the history earlier versions kept in
+// the cache directory is read instead.
+func readHistory(cacheDir string) ([]RunRecord, error) {
+	name, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	recs, err := readHistoryFile(name)
+	if errors.Is(err, fs.ErrNotExist) && cacheDir != "" {
+		recs, err = readHistoryFile(filepath.Join(cacheDir, historyFile))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if len(recs) > maxHistory {
+		recs = recs[len(recs)-maxHistory:]
+	}
+	return recs, err
+}
+
+// readHistoryFile reads every run recorded in the file. A line which cannot
+// be read, such as one cut short by va being killed as it wrote it, is
+// skipped, rather than losing the rest of the history.
+func readHistoryFile(name string) ([]RunRecord, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recs []RunRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20) // Arguments can make for long lines.
+	for n := 1; scanner.Scan(); n++ {
+		var rec RunRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			logDebugf("history: %s:%d: %v", name, n, err)
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	return recs, scanner.Err()
+}
+
+// ToolUsage summarises the runs of a tool.
+type ToolUsage struct {
+	Tool   string // Short name of the link, or else the package path.
+	Runs   int
+	Failed int // Runs which could not be run, or exited with an error.
+	Last   time.Time
+}
+
+// Usage summarises how va has been used, from its history and its records
+// of builds.
+type Usage struct {
+	Runs  int
+	Tools []ToolUsage // Most run first.
+
+	// Warm starts are runs of tools which were already built, and cold
+	// starts those which were not, along with the total time each kept
+	// tools waiting.
+	Warm, Cold         int
+	WarmTime, ColdTime time.Duration
+
+	// Saved is roughly how much time was saved by tools already being
+	// built: for each warm start, how long building the tool took, less
+	// the time the warm start took.
+	Saved time.Duration
+}
+
+// summariseUsage summarises the runs, using the builds to work out how long
+// each tool takes to build.
+func summariseUsage(runs []RunRecord, builds []BuildRecord) Usage {
+	var u Usage
+	buildTime := make(map[string]time.Duration)
+	buildCount := make(map[string]int)
+	var allBuilds time.Duration
+	for _, b := range builds {
+		buildTime[b.Tool] += b.Download + b.Build
+		buildCount[b.Tool]++
+		allBuilds += b.Download + b.Build
+	}
+
+	byTool := make(map[string]*ToolUsage)
+	for _, run := range runs {
+		u.Runs++
+		name := run.Short
+		pkgPath, _, _ := strings.Cut(run.Tool, "@")
+		if name == "" {
+			name = pkgPath
+		}
+		tu := byTool[name]
+		if tu == nil {
+			tu = &ToolUsage{Tool: name}
+			byTool[name] = tu
+		}
+		tu.Runs++
+		if run.ExitCode != 0 {
+			tu.Failed++
+		}
+		if run.Start.After(tu.Last) {
+			tu.Last = run.Start
+		}
+		if run.ExitCode < 0 {
+			continue // It never started, so the start cannot be timed.
+		}
+		if run.Built {
+			u.Cold++
+			u.ColdTime += run.Prepare
+			continue
+		}
+		u.Warm++
+		u.WarmTime += run.Prepare
+		switch {
+		case buildCount[pkgPath] > 0:
+			u.Saved += buildTime[pkgPath]/time.Duration(buildCount[pkgPath]) - run.Prepare
+		case len(builds) > 0:
+			u.Saved += allBuilds/time.Duration(len(builds)) - run.Prepare
+		}
+	}
+	if u.Saved < 0 {
+		u.Saved = 0
+	}
+
+	for _, tu := range byTool {
+		u.Tools = append(u.Tools, *tu)
+	}
+	sort.Slice(u.Tools, func(i, j int) bool {
+		if u.Tools[i].Runs != u.Tools[j].Runs {
+			return u.Tools[i].Runs > u.Tools[j].Runs
+		}
+		return u.Tools[i].Tool < u.Tools[j].Tool
+	})
+	return u
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAppendHistory(t *testing.T) {
+	cacheDir := t.TempDir()
+	stateDir := t.TempDir()
+	t.Setenv("VA_STATE_DIR", stateDir)
+
+	// The history earlier versions kept in the cache, with a line cut short.
+	legacy := filepath.Join(cacheDir, historyFile)
+	const old = `{"Tool":"example.com/old@v1.0.0","Args":null,"Dir":"","ExitCode":0}` + "\n" + `{"Tool":"example.com/cut`
+	if err := os.WriteFile(legacy, []byte(old), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := readHistory(cacheDir)
+	if err != nil || len(recs) != 1 || recs[0].Tool != "example.com/old@v1.0.0" {
+		t.Fatalf("readHistory = %+v, %v, want the run from the cache", recs, err)
+	}
+
+	for _, tool := range []string{"example.com/a@v1.0.0", "example.com/b@v1.0.0"} {
+		if err := appendHistory(cacheDir, RunRecord{Tool: tool}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("history in the cache was not removed: %v", err)
+	}
+	name := filepath.Join(stateDir, historyFile)
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o600 {
+		t.Errorf("history mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	// A line which cannot be read is skipped, and the rest kept.
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("not json\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := appendHistory(cacheDir, RunRecord{Tool: "example.com/c@v1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	recs, err = readHistory(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tools []string
+	for _, rec := range recs {
+		tools = append(tools, rec.Tool)
+	}
+	if got, want := strings.Join(tools, " "), "example.com/old@v1.0.0 example.com/a@v1.0.0 example.com/b@v1.0.0 example.com/c@v1.0.0"; got != want {
+		t.Errorf("readHistory = %s, want %s", got, want)
+	}
+}
+
+func TestAppendHistoryForgetsOldest(t *testing.T) {
+	cacheDir := t.TempDir()
+	stateDir := t.TempDir()
+	t.Setenv("VA_STATE_DIR", stateDir)
+
+	for i := 0; i < 2*maxHistory; i++ {
+		if err := appendHistory(cacheDir, RunRecord{Tool: "example.com/old@v1.0.0"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs, err := readHistory(cacheDir)
+	if err != nil || len(recs) != maxHistory {
+		t.Fatalf("readHistory = %d runs, %v, want %d", len(recs), err, maxHistory)
+	}
+
+	// The file is only rewritten once it holds twice as many runs as are
+	// remembered.
+	if err := appendHistory(cacheDir, RunRecord{Tool: "example.com/new@v1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(stateDir, historyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(b), "\n"); got != maxHistory {
+		t.Errorf("history has %d lines, want %d", got, maxHistory)
+	}
+	recs, err = readHistory(cacheDir)
+	if err != nil || len(recs) != maxHistory || recs[len(recs)-1].Tool != "example.com/new@v1.0.0" {
+		t.Errorf("readHistory = %d runs, %v, want %d ending with the new run", len(recs), err, maxHistory)
+	}
+}
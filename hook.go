@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// RunHook runs a post-run hook through the shell, once the tool has exited.
+// The exit code of the tool is passed to the hook in the VA_EXIT_CODE
+// environment variable. The hook is run as Run runs tools, in the same
+// directory as the tool, and is stopped, along with whatever it started,
+// once the context ends.
+func RunHook(ctx context.Context, hook string, exitCode int) error {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	code, err := Run(ctx, nil, shell, []string{flag, hook}, []string{"VA_EXIT_CODE=" + strconv.Itoa(exitCode)}, nil)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("exit status %d", code)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRunHook(t *testing.T) {
+	shell(t)
+	ran := filepath.Join(t.TempDir(), "ran")
+	for _, tt := range []struct {
+		hook    string
+		wantErr string
+	}{
+		{fmt.Sprintf(`test "$VA_EXIT_CODE" = 3 && echo ran > %s`, ran), ""},
+		{`test "$VA_EXIT_CODE" = 0`, "exit status 1"},
+		{"exit 2", "exit status 2"},
+	} {
+		err := RunHook(context.Background(), tt.hook, 3)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("RunHook(%q): %v", tt.hook, err)
+		} else if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("RunHook(%q) = %v, want %q", tt.hook, err, tt.wantErr)
+		}
+	}
+	if _, err := os.Stat(ran); err != nil {
+		t.Errorf("hook was not run with the tool's exit code: %v", err)
+	}
+}
+
+func TestRunToolPostHook(t *testing.T) {
+	sh := shell(t)
+	for _, tt := range []struct {
+		tool, hook string
+		want       int
+	}{
+		{"exit 0", "true", 0},
+		{"exit 3", "true", 3},
+		// A hook which fails is warned about, but does not change how va
+		// exits, which is as the tool did.
+		{"exit 0", "exit 1", 0},
+		{"exit 3", "exit 1", 3},
+	} {
+		got := filepath.Join(t.TempDir(), "got")
+		link := Link{Short: "tool", Post: fmt.Sprintf(`echo "$VA_EXIT_CODE" > %s; %s`, got, tt.hook)}
+		if code := runTool(link, nil, sh, []string{"-c", tt.tool}, false); code != tt.want {
+			t.Errorf("runTool(%q) with the hook %q = %d, want %d", tt.tool, tt.hook, code, tt.want)
+		}
+		if b, err := os.ReadFile(got); err != nil || strings.TrimSpace(string(b)) != strconv.Itoa(tt.want) {
+			t.Errorf("runTool(%q) ran the hook with $VA_EXIT_CODE=%q, %v, want %d", tt.tool, b, err, tt.want)
+		}
+	}
+}
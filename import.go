@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// ImportedTool is a tool found by va import in the files of another way of
+// managing tools, to become a link.
+type ImportedTool struct {
+	Short string
+	Pkg   string // Package path and version.
+	From  string // The file the tool was found in.
+}
+
+// importers find the tools in each kind of file va import understands, by
+// the name of the file or directory: bingo's directory of module files, a
+// tools.go file of blank imports, and the .tool-versions file of asdf and
+// mise.
+var importers = map[string]func(links map[string]Link, name string) ([]ImportedTool, error){
+	".bingo":         importBingo,
+	"tools.go":       importToolsGo,
+	".tool-versions": importToolVersions,
+}
+
+// ImportTools finds the tools in the files or directories, each of which is
+// one va import understands, or a directory containing any of them, in order
+// of their short names. A short name found twice is kept the first time.
+func ImportTools(links map[string]Link, names []string) ([]ImportedTool, error) {
+	var tools []ImportedTool
+	for _, name := range names {
+		importer, ok := importers[filepath.Base(name)]
+		if ok {
+			found, err := importer(links, name)
+			if err != nil {
+				return nil, err
+			}
+			tools = append(tools, found...)
+			continue
+		}
+		if fi, err := os.Stat(name); err != nil {
+			return nil, err
+		} else if !fi.IsDir() {
+			return nil, fmt.Errorf("%s: not a file va import understands (%s)", name, strings.Join(importerNames(), ", "))
+		}
+		for _, base := range importerNames() {
+			within := filepath.Join(name, base)
+			if _, err := os.Stat(within); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			found, err := importers[base](links, within)
+			if err != nil {
+				return nil, err
+			}
+			tools = append(tools, found...)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var unique []ImportedTool
+	for _, tool := range tools {
+		if seen[tool.Short] {
+			logWarnf("import: %s in %s is already in %s, so is skipped", tool.Short, tool.From, importedFrom(tools, tool.Short))
+			continue
+		}
+		seen[tool.Short] = true
+		unique = append(unique, tool)
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i].Short < unique[j].Short })
+	return unique, nil
+}
+
+// importerNames returns the names of the files va import understands, in
+// order.
+func importerNames() []string {
+	names := make([]string, 0, len(importers))
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// importedFrom returns the file the first tool of the short name was found
+// in.
+func importedFrom(tools []ImportedTool, short string) string {
+	for _, tool := range tools {
+		if tool.Short == short {
+			return tool.From
+		}
+	}
+	return ""
+}
+
+// importBingo finds the tools in bingo's directory, which has a module file
+// for each tool, named after it, such as golangci-lint.mod, requiring the
+// module the tool is in, with the rest of the package path in a comment:
+//
+//	require github.com/golangci/golangci-lint v1.55.2 // cmd/golangci-lint
+//
+// bingo's own go.mod is not a tool, nor are the extra module files of tools
+// kept at several versions, such as golangci-lint.1.mod.
+func importBingo(links map[string]Link, dir string) ([]ImportedTool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var tools []ImportedTool
+	for _, entry := range entries {
+		short := strings.TrimSuffix(entry.Name(), ".mod")
+		if entry.IsDir() || short == entry.Name() || short == "go" || !validateShort(short) {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		mf, err := modfile.ParseLax(file, b, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(mf.Require) == 0 {
+			logWarnf("import: %s: requires no module, so is skipped", file)
+			continue
+		}
+		req := mf.Require[0]
+		pkgPath := req.Mod.Path
+		if comments := req.Syntax.Suffix; len(comments) > 0 {
+			if tail := strings.TrimSpace(strings.TrimPrefix(comments[0].Token, "//")); tail != "" {
+				pkgPath = path.Join(pkgPath, tail)
+			}
+		}
+		tools = append(tools, ImportedTool{Short: short, Pkg: pkgPath + "@" + req.Mod.Version, From: file})
+	}
+	return tools, nil
+}
+
+// importToolsGo finds the tools imported for their side effects by a
+// tools.go file, at the versions the go.mod beside it requires, or the
+// default version, or "latest", if it does not require their modules. Each is named after
+// the last element of its path which is not a major version, such as
+// "stringer" for golang.org/x/tools/cmd/stringer.
+func importToolsGo(links map[string]Link, file string) ([]ImportedTool, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	var requires []*modfile.Require
+	goMod := filepath.Join(filepath.Dir(file), "go.mod")
+	if b, err := os.ReadFile(goMod); err == nil {
+		mf, err := modfile.ParseLax(goMod, b, nil)
+		if err != nil {
+			return nil, err
+		}
+		requires = mf.Require
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	var tools []ImportedTool
+	for _, spec := range f.Imports {
+		if spec.Name == nil || spec.Name.Name != "_" {
+			continue
+		}
+		pkgPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		version, best := "", ""
+		for _, req := range requires {
+			if (pkgPath == req.Mod.Path || strings.HasPrefix(pkgPath, req.Mod.Path+"/")) && len(req.Mod.Path) > len(best) {
+				best, version = req.Mod.Path, req.Mod.Version
+			}
+		}
+		if version == "" {
+			if version = *flagDefaultVersion; version == "" {
+				version = "latest"
+			}
+			logWarnf("import: %s: the module of %s is not required by %s, so it is imported at %s", file, pkgPath, goMod, version)
+		}
+		short := binaryName(pkgPath)
+		if !validateShort(short) {
+			logWarnf("import: %s: %s cannot be a short name, so %s is skipped", file, short, pkgPath)
+			continue
+		}
+		tools = append(tools, ImportedTool{Short: short, Pkg: pkgPath + "@" + version, From: file})
+	}
+	return tools, nil
+}
+
+// importToolVersions finds the tools in a .tool-versions file, as asdf and
+// mise use, which has the name of a tool and its version on each line:
+//
+//	golangci-lint 1.55.2
+//
+// Only tools with links, found as a command of the tool's name would find
+// them, such as go/golangci-lint, are Go tools va knows of, so any others,
+// such as golang itself, are skipped, as are tools whose version is "system",
+// which is whatever is installed. Versions are given without their "v",
+// which is put back.
+func importToolVersions(links map[string]Link, file string) ([]ImportedTool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var tools []ImportedTool
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: no version for %s", file, n, fields[0])
+		}
+		name, version := fields[0], strings.TrimPrefix(fields[1], "ref:")
+		if version == "system" {
+			// The tool installed outside asdf or mise is used.
+			continue
+		}
+		link, ok := links[linkNamed(links, name)]
+		if !ok || link.Pkg == "" || isRewrite(link.Short) {
+			logInfof("import: %s:%d: %s is not a Go tool va has a link for, so is skipped", file, n, name)
+			continue
+		}
+		if v := "v" + version; semver.IsValid(v) {
+			version = v
+		}
+		pkgPath, _, _ := strings.Cut(link.Pkg, "@")
+		tools = append(tools, ImportedTool{Short: name, Pkg: pkgPath + "@" + version, From: file})
+	}
+	return tools, scanner.Err()
+}
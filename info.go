@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ToolInfo describes a tool and the module it is in.
+type ToolInfo struct {
+	Tool       string // Package path of the tool.
+	Module     string // Module path.
+	Pinned     string // Version asked for, which may be a query such as "latest".
+	Version    string // Version the pinned version resolved to.
+	Latest     string // Newest version of the module, if it could be found.
+	Desc       string
+	License    string
+	Repository string
+	Binary     string // Path of the cached binary, if the tool has been built.
+	Size       int64  // Size of the cached binary.
+}
+
+// licenseSigns identifies common licenses by phrases found in their text,
+// most specific first.
+var licenseSigns = []struct {
+	id    string
+	signs []string
+}{
+	{"AGPL-3.0", []string{"GNU AFFERO GENERAL PUBLIC LICENSE"}},
+	{"LGPL-3.0", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"LGPL-2.1", []string{"GNU LESSER GENERAL PUBLIC LICENSE"}},
+	{"GPL-3.0", []string{"GNU GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"GPL-2.0", []string{"GNU GENERAL PUBLIC LICENSE"}},
+	{"MPL-2.0", []string{"Mozilla Public License", "2.0"}},
+	{"Apache-2.0", []string{"Apache License", "Version 2.0"}},
+	{"BSD-3-Clause", []string{"Redistribution and use in source and binary forms", "Neither the name"}},
+	{"BSD-2-Clause", []string{"Redistribution and use in source and binary forms"}},
+	{"MIT", []string{"Permission is hereby granted, free of charge"}},
+	{"ISC", []string{"Permission to use, copy, modify, and/or distribute this software"}},
+	{"Unlicense", []string{"This is free and unencumbered software released into the public domain"}},
+}
+
+// detectLicense identifies the license of the module in dir from its license
+// file, returning an empty string if there is none.
+func detectLicense(dir string) string {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, f := range files {
+		name := strings.ToUpper(f.Name())
+		if f.IsDir() || !(strings.HasPrefix(name, "LICENSE") || strings.HasPrefix(name, "LICENCE") || strings.HasPrefix(name, "COPYING")) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			continue
+		}
+		text := strings.Join(strings.Fields(string(b)), " ")
+	license:
+		for _, license := range licenseSigns {
+			for _, sign := range license.signs {
+				if !strings.Contains(text, sign) {
+					continue license
+				}
+			}
+			return license.id
+		}
+		return "unknown (" + f.Name() + ")"
+	}
+	return ""
+}
+
+// repositoryURL returns the URL of the repository the module version came
+// from, as recorded by the module proxy, or as implied by the module path
+// for well known hosts.
+func repositoryURL(modCache, modPath, version string) string {
+	if src, _, err := downloadFiles(modCache, modPath, version); err == nil {
+		var info struct {
+			Origin *struct {
+				URL string
+			}
+		}
+		if b, err := os.ReadFile(src + ".info"); err == nil && json.Unmarshal(b, &info) == nil && info.Origin != nil && info.Origin.URL != "" {
+			return info.Origin.URL
+		}
+	}
+	parts := strings.Split(modPath, "/")
+	switch parts[0] {
+	case "github.com", "gitlab.com", "bitbucket.org", "codeberg.org":
+		if len(parts) >= 3 {
+			return "https://" + strings.Join(parts[:3], "/")
+		}
+	}
+	return ""
+}
+
+// latestVersion returns the version the "latest" query resolves to for the
+// module, asking the module proxy if it can answer, or the go command if not.
+func latestVersion(ctx context.Context, modPath string) (string, error) {
+	if proxy, err := NewProxyClient(ctx); err == nil {
+		v, err := proxy.Latest(ctx, modPath)
+		if err == nil || errors.Is(err, errProxyNotFound) {
+			return v, err
+		}
+	}
+	mod, err := goListModule(ctx, modPath+"@latest")
+	return mod.Version, err
+}
+
+// Info describes the tool, downloading its module if need be. The latest
+// version is left empty if it cannot be found, such as when offline.
+func Info(ctx context.Context, cacheDir string, link Link, mod string) (ToolInfo, error) {
+	m, err := resolveTool(ctx, cacheDir, mod)
+	if err != nil {
+		return ToolInfo{}, err
+	}
+	_, pinned, _ := strings.Cut(mod, "@")
+	info := ToolInfo{
+		Tool:    m.ToolPath(),
+		Module:  m.Path,
+		Pinned:  pinned,
+		Version: m.Version,
+		Desc:    link.Desc,
+		License: detectLicense(m.Dir),
+	}
+	if info.Desc == "" {
+		info.Desc, _ = packageSynopsis(m.ToolDir())
+	}
+	if modCache, err := GoModCache(ctx); err == nil {
+		info.Repository = repositoryURL(modCache, m.Path, m.Version)
+	}
+	if !offline {
+		info.Latest, _ = latestVersion(ctx, m.Path)
+	}
+	if cacheDir != "" {
+		if tool, ok := FindCachedTool(ctx, cacheDir, m.ToolPath()+"@"+m.Version, linkBuildOptions(link)); ok {
+			if fi, err := os.Stat(tool); err == nil {
+				info.Binary, info.Size = tool, fi.Size()
+			}
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteInfo(t *testing.T) {
+	info := ToolInfo{
+		Tool:    "example.com/hello/cmd/hello",
+		Module:  "example.com/hello",
+		Pinned:  "latest",
+		Version: "v1.0.0",
+		Desc:    "Hello says hello.",
+		License: "MIT",
+	}
+	for _, tt := range []struct {
+		name   string
+		binary string
+		size   int64
+		want   []string
+	}{
+		{"not built", "", 0, []string{"Binary: not built"}},
+		{"built", "/cache/bin/abc/hello", 2 << 20, []string{"Binary: /cache/bin/abc/hello", "Size: " + formatSize(2<<20)}},
+	} {
+		info.Binary, info.Size = tt.binary, tt.size
+		var out bytes.Buffer
+		if err := writeInfo(&out, info, false); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			got = append(got, strings.Join(strings.Fields(line), " "))
+		}
+		want := append([]string{
+			"Tool: example.com/hello/cmd/hello",
+			"Module: example.com/hello",
+			"Pinned: latest",
+			"Version: v1.0.0",
+			"Latest: unknown",
+			"Description: Hello says hello.",
+			"License: MIT",
+			"Repository: unknown",
+		}, tt.want...)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: writeInfo wrote\n%s\nwant\n%s", tt.name, strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+
+		out.Reset()
+		if err := writeInfo(&out, info, true); err != nil {
+			t.Fatal(err)
+		}
+		var decoded ToolInfo
+		if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || decoded != info {
+			t.Errorf("%s: writeInfo as JSON = %s, %v, want %+v", tt.name, out.Bytes(), err, info)
+		}
+	}
+}
+
+func TestInfo(t *testing.T) {
+	useTestProxy(t,
+		testModule{Path: "example.com/hello", Version: "v1.0.0", Files: map[string]string{
+			"LICENSE":           "Permission is hereby granted, free of charge, to any person",
+			"cmd/hello/main.go": "// Hello says hello. It says nothing else.\npackage main\n",
+		}},
+		testModule{Path: "example.com/hello", Version: "v1.1.0", Files: map[string]string{
+			"cmd/hello/main.go": "package main\n",
+		}},
+	)
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+	link := Link{Short: "hello", Pkg: "example.com/hello/cmd/hello@v1.0.0"}
+
+	info, err := Info(ctx, cacheDir, link, link.Pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ToolInfo{
+		Tool:    "example.com/hello/cmd/hello",
+		Module:  "example.com/hello",
+		Pinned:  "v1.0.0",
+		Version: "v1.0.0",
+		Latest:  "v1.1.0",
+		Desc:    "Hello says hello.",
+		License: "MIT",
+	}
+	if info != want {
+		t.Errorf("Info before the tool was built = %+v, want %+v", info, want)
+	}
+
+	// Once built, where the tool is kept in the cache is given too.
+	modCache, err := GoModCache(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := findDownloaded(modCache, "example.com/hello/cmd/hello", "v1.0.0")
+	if !ok {
+		t.Fatal("Info did not download the module")
+	}
+	env, err := ReadGoEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := NewToolKey(m, env, linkBuildOptions(link)).CachePath(cacheDir)
+	if err := os.MkdirAll(filepath.Dir(tool), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(tool), binMetaFile), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err = Info(ctx, cacheDir, link, link.Pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Binary, want.Size = tool, int64(len("#!/bin/sh\n"))
+	if info != want {
+		t.Errorf("Info once the tool was built = %+v, want %+v", info, want)
+	}
+
+	// A description in the list is used rather than the package's.
+	link.Desc = "Greets you"
+	if info, err := Info(ctx, cacheDir, link, link.Pkg); err != nil || info.Desc != link.Desc {
+		t.Errorf("Info of a described link = %q, %v, want %q", info.Desc, err, link.Desc)
+	}
+}
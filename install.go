@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// installsFile is the file within the state directory recording the tools
+// installed by va install, so that they can be listed and uninstalled. It is
+// kept apart from the cache, as the tools stay installed when it is purged.
+const installsFile = "installed.json"
+
+// Installation is a tool installed by va install. It is installed both as
+// its name, and as its name and version, so that several versions can be
+// installed alongside each other.
+type Installation struct {
+	Name    string // Name the tool is installed as, without its version.
+	Tool    string // Package path of the tool.
+	Version string
+	Dir     string
+	Files   []string // Files installed, which the newest install of the name takes over.
+	Time    time.Time
+}
+
+// installsPath returns the path of the record of tools installed.
+func installsPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, installsFile), nil
+}
+
+// readInstalls reads the tools installed, most recently installed first.
+func readInstalls() ([]Installation, error) {
+	name, err := installsPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var installs []Installation
+	if err := json.Unmarshal(b, &installs); err != nil {
+		return nil, fmt.Errorf("%s: %w", installsFile, err)
+	}
+	return installs, nil
+}
+
+// updateInstalls changes the record of tools installed with the function,
+// holding the lock on it throughout so that concurrent changes are not lost.
+func updateInstalls(update func([]Installation) ([]Installation, error)) error {
+	name, err := installsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return err
+	}
+	lockFile, err := lock(context.Background(), name+".lock", nil)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	installs, err := readInstalls()
+	if err != nil {
+		return err
+	}
+	installs, err = update(installs)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(installs, func(i, j int) bool { return installs[i].Time.After(installs[j].Time) })
+	b, err := json.MarshalIndent(installs, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, append(b, '\n'))
+}
+
+// installDir returns where the go command installs binaries: GOBIN, or else
+// the bin directory of the first entry in GOPATH.
+func installDir(ctx context.Context) (string, error) {
+	vars, err := goEnvVars(ctx, "GOBIN", "GOPATH")
+	if err != nil {
+		return "", err
+	}
+	if vars["GOBIN"] != "" {
+		return vars["GOBIN"], nil
+	}
+	gopath := filepath.SplitList(vars["GOPATH"])
+	if len(gopath) == 0 || gopath[0] == "" {
+		return "", errors.New("neither GOBIN nor GOPATH is set")
+	}
+	return filepath.Join(gopath[0], "bin"), nil
+}
+
+// toolName returns the name the go command would give the binary of the
+// tool, as binaryName does, with ".exe" on Windows.
+func toolName(pkgPath string) string {
+	name := binaryName(pkgPath)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Install installs the built tool into the directory, as both its name and
+// its name and version, recording that it was installed.
+func Install(dir, tool, pkgPath, version string) (Installation, error) {
+	name := toolName(pkgPath)
+	versioned := strings.TrimSuffix(name, ".exe") + "@" + version
+	if strings.HasSuffix(name, ".exe") {
+		versioned += ".exe"
+	}
+	inst := Installation{
+		Name:    name,
+		Tool:    pkgPath,
+		Version: version,
+		Dir:     dir,
+		Files:   []string{filepath.Join(dir, versioned), filepath.Join(dir, name)},
+		Time:    time.Now(),
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Installation{}, err
+	}
+	for _, file := range inst.Files {
+		if err := copyExecutable(tool, file); err != nil {
+			return Installation{}, err
+		}
+	}
+	err := updateInstalls(func(installs []Installation) ([]Installation, error) {
+		kept := installs[:0]
+		for _, other := range installs {
+			// Whatever was installed as any of the same files has been
+			// replaced by this install.
+			other.Files = withoutFiles(other.Files, inst.Files)
+			if len(other.Files) > 0 {
+				kept = append(kept, other)
+			}
+		}
+		return append(kept, inst), nil
+	})
+	return inst, err
+}
+
+// Uninstall removes the installed tools which match the tool, given as its
+// name or package path, at the version if one is given, returning those it
+// removed.
+func Uninstall(tool, version string) ([]Installation, error) {
+	var removed []Installation
+	err := updateInstalls(func(installs []Installation) ([]Installation, error) {
+		kept := installs[:0]
+		for _, inst := range installs {
+			matched := inst.Tool == tool || strings.TrimSuffix(inst.Name, ".exe") == tool
+			if !matched || (version != "" && inst.Version != version) {
+				kept = append(kept, inst)
+				continue
+			}
+			for _, file := range inst.Files {
+				if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return nil, err
+				}
+			}
+			removed = append(removed, inst)
+		}
+		return kept, nil
+	})
+	return removed, err
+}
+
+// withoutFiles returns the files, less any of those to remove.
+func withoutFiles(files, remove []string) []string {
+	var kept []string
+	for _, file := range files {
+		found := false
+		for _, r := range remove {
+			found = found || file == r
+		}
+		if !found {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+// copyExecutable copies the binary to dest, alongside it first and then
+// renamed into place, so that a binary which is running is never half
+// overwritten.
+func copyExecutable(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	f, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, in)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dest)
+}
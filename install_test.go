@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestInstallMajorVersion(t *testing.T) {
+	t.Setenv("VA_STATE_DIR", t.TempDir())
+	dir := t.TempDir()
+	tool := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	inst, err := Install(dir, tool, "github.com/mikefarah/yq/v4", "v4.44.1")
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	name, versioned := "yq", "yq@v4.44.1"
+	if runtime.GOOS == "windows" {
+		name, versioned = name+".exe", versioned+".exe"
+	}
+	if inst.Name != name {
+		t.Errorf("installed as %q, want %q", inst.Name, name)
+	}
+	for _, file := range []string{name, versioned} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	installs, err := readInstalls()
+	if err != nil || len(installs) != 1 || installs[0].Tool != "github.com/mikefarah/yq/v4" {
+		t.Fatalf("readInstalls() = %v, %v, want the install of yq", installs, err)
+	}
+	removed, err := Uninstall("yq", "")
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("Uninstall(yq) = %v, %v, want the install of yq removed", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+		t.Errorf("%s is still installed: %v", name, err)
+	}
+}
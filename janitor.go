@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// tempStateFile is the file within the temporary state directory recording
+// the temporary binaries which runs of va have created, so that any left
+// behind by a run which was killed can be found and removed later.
+const tempStateFile = "temps.json"
+
+// tempArtifact is a temporary file created by a run of va. While the run is
+// alive it holds a lock on Lock, so a lock which can be taken means the file
+// has been orphaned.
+type tempArtifact struct {
+	Path string
+	Lock string
+}
+
+// tempLocks are the locks held on the temporary files this run of va has
+// created, keyed by their paths.
+var tempLocks = struct {
+	sync.Mutex
+	m map[string]*os.File
+}{m: make(map[string]*os.File)}
+
+// tempStateDir returns the directory holding the state of temporary files,
+// within va's state directory rather than the temporary directory, which may
+// be shared with other users, any of whom could otherwise plant a record of
+// files for va to remove.
+func tempStateDir() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "temps"), nil
+}
+
+// inTempDir reports whether the file is within the temporary directory, as
+// only the temporary files va creates there are ever removed by sweepTemps.
+func inTempDir(name string) bool {
+	rel, err := filepath.Rel(os.TempDir(), name)
+	return err == nil && filepath.IsAbs(name) && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// trackTemp records the temporary file as created by this run of va, so
+// that it can be removed by a later run should this one die before it can
+// remove the file itself with removeTemp.
+func trackTemp(name string) error {
+	dir, err := tempStateDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	lockName := filepath.Join(dir, filepath.Base(name)+".lock")
+	f, err := tryLock(lockName)
+	if err != nil {
+		return err
+	}
+	tempLocks.Lock()
+	tempLocks.m[name] = f
+	tempLocks.Unlock()
+	return updateTempState(func(temps []tempArtifact) []tempArtifact {
+		return append(temps, tempArtifact{Path: name, Lock: lockName})
+	})
+}
+
+// removeTemp removes a temporary file created by this run of va, and its
+// record if it was tracked.
+func removeTemp(name string) error {
+	err := os.Remove(name)
+	tempLocks.Lock()
+	f, ok := tempLocks.m[name]
+	delete(tempLocks.m, name)
+	tempLocks.Unlock()
+	if !ok {
+		return err
+	}
+	updateTempState(func(temps []tempArtifact) []tempArtifact {
+		return dropTemp(temps, name)
+	})
+	unlock(f)
+	os.Remove(f.Name())
+	return err
+}
+
+// sweepTemps removes the temporary files left behind by runs of va which
+// died before they could remove them, returning the files removed. Records
+// of files outside the temporary directory, or of locks outside the state
+// directory, are not va's own, so are dropped without removing anything.
+func sweepTemps() ([]string, error) {
+	dir, err := tempStateDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, tempStateFile)); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	var removed []string
+	err = updateTempState(func(temps []tempArtifact) []tempArtifact {
+		kept := temps[:0]
+		for _, t := range temps {
+			if !inTempDir(t.Path) || filepath.Dir(t.Lock) != dir {
+				logWarnf("janitor: not removing %s, which va did not create", t.Path)
+				continue
+			}
+			f, err := tryLock(t.Lock)
+			if err != nil {
+				kept = append(kept, t)
+				continue
+			}
+			if err := os.Remove(t.Path); err == nil || errors.Is(err, fs.ErrNotExist) {
+				removed = append(removed, t.Path)
+			}
+			unlock(f)
+			os.Remove(t.Lock)
+		}
+		return kept
+	})
+	return removed, err
+}
+
+// updateTempState updates the record of temporary files, holding a lock on
+// it so that concurrent runs of va do not lose each other's updates. Once no
+// temporary files remain, the record is removed.
+func updateTempState(update func([]tempArtifact) []tempArtifact) error {
+	dir, err := tempStateDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, tempStateFile)
+	lockFile, err := lock(context.Background(), name+".lock", nil)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	var temps []tempArtifact
+	b, err := os.ReadFile(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(b, &temps); err != nil {
+			return err
+		}
+	}
+
+	temps = update(temps)
+	if len(temps) == 0 {
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err = json.Marshal(temps)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, b)
+}
+
+// dropTemp returns the temporary files without the one named.
+func dropTemp(temps []tempArtifact, name string) []tempArtifact {
+	kept := temps[:0]
+	for _, t := range temps {
+		if t.Path != name {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,805 @@
+package main
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// Link defines a shortened link.
+type Link struct {
+	Short string
+	Pkg   string
+	Desc  string
+
+	// Alias is the short name of the link this one is an alias of, such as
+	// "golangci-lint", along with any version, if it is one. Once aliases
+	// are resolved, Pkg is the package of that link.
+	Alias string `json:",omitempty"`
+
+	// Tags categorise the link, such as "lint" or "protobuf", so that
+	// links can be found by what they are for.
+	Tags []string `json:",omitempty"`
+
+	// Post is a command run through the shell after the tool exits,
+	// whether it succeeded or not. The exit code of the tool is
+	// available to it in the VA_EXIT_CODE environment variable.
+	Post string `json:",omitempty"`
+
+	// Args are given to the tool before any others, such as "run ./..."
+	// for golangci-lint.
+	Args []string `json:",omitempty"`
+
+	// Env are environment variables set for the tool as it runs, and
+	// BuildEnv those set for the go command as it builds the tool, each as
+	// "KEY=value". A variable which is already set in va's environment
+	// keeps its value, so that whoever runs va has the last word.
+	Env      []string `json:",omitempty"`
+	BuildEnv []string `json:",omitempty"`
+
+	// BuildTags and Ldflags are given to the go command as it builds the
+	// tool, for tools which need them, such as hugo's "extended" tag.
+	BuildTags []string `json:",omitempty"`
+	Ldflags   string   `json:",omitempty"`
+
+	// GOOS and GOARCH are the operating systems and architectures the tool
+	// works on, if it does not work on all of them.
+	GOOS   []string `json:",omitempty"`
+	GOARCH []string `json:",omitempty"`
+
+	// Deprecated says why the link should no longer be used, if it should
+	// not be, and ReplacedBy is the short name of the link to use instead,
+	// if there is one. Either makes the link deprecated.
+	Deprecated string `json:",omitempty"`
+	ReplacedBy string `json:",omitempty"`
+
+	// Override is where the version of the link was overridden, such as
+	// "$VA_VERSION_STATICCHECK", if it was.
+	Override string `json:",omitempty"`
+
+	// Source is the name of the LinkSource the link was loaded from, and
+	// File is the path of the list file within it that defined the link,
+	// on Line. Path is the path of File on disk, if the source is a
+	// directory of lists of the user's or the project's.
+	Source string
+	File   string
+	Line   int    `json:",omitempty"`
+	Path   string `json:",omitempty"`
+
+	// Via are the list files which included File, outermost first, if it
+	// was included by another.
+	Via []string `json:",omitempty"`
+
+	// Overrides are the locations of the links of the same short name,
+	// from sources of lower precedence, which this link overrides.
+	Overrides []string `json:",omitempty"`
+}
+
+// Origin describes where the link was defined, e.g. "embedded:lists/go.list".
+func (l Link) Origin() string {
+	return l.Source + ":" + l.File
+}
+
+// Location returns where the link is defined, to the line: the path of its
+// list file and the line, if the list is on disk, such as
+// "/home/me/.config/va/lists/team.list:3", or else its origin and the line,
+// such as "embedded:lists/go.list:12".
+func (l Link) Location() string {
+	loc := l.Path
+	if loc == "" {
+		loc = l.Origin()
+	}
+	if l.Line > 0 {
+		loc += ":" + strconv.Itoa(l.Line)
+	}
+	return loc
+}
+
+// describeSource describes the source of links of the name, as linkSources
+// names them, for people wondering where a link came from.
+func describeSource(name string) string {
+	switch name {
+	case "embedded":
+		return "built into va"
+	case "user":
+		return "your own lists"
+	case "$VA_LISTS_DIR":
+		return "the lists in $VA_LISTS_DIR"
+	case "project":
+		return "the project's lists"
+	}
+	if strings.Contains(name, "://") || isGitListURL(name) {
+		return "lists subscribed to with \"va lists add\""
+	}
+	return name
+}
+
+// ListFile returns the list file the link is in, which is the outermost one
+// if it was included from another file.
+func (l Link) ListFile() string {
+	if len(l.Via) > 0 {
+		return l.Via[0]
+	}
+	return l.File
+}
+
+//go:embed lists/*.list
+var listfs embed.FS
+
+// LinkSource is a filesystem containing list files, along with a name used
+// to describe where the links within it came from.
+type LinkSource struct {
+	Name string
+	FS   fs.FS
+
+	// Dir is the directory FS is of, if the list files are the user's own
+	// on disk, so that problems with them can be reported by path.
+	Dir string
+
+	// Allow reports whether the link of the short name may be loaded
+	// from the source. If nil, every link may be.
+	Allow func(short string) bool
+}
+
+var flagEmbeddedLists = flag.String("embedded-lists", envOr("VA_EMBEDDED_LISTS", "all"), "which links built into va to load: \"all\", \"none\", or a comma-separated list of patterns of short names, such as \"go/*,dlv\" (or set $VA_EMBEDDED_LISTS)")
+
+// checkEmbeddedLists checks the patterns of --embedded-lists are valid.
+func checkEmbeddedLists() error {
+	_, err := embeddedAllowed("")
+	return err
+}
+
+// embeddedAllowed reports whether the link of the short name may be loaded
+// from the lists built into va, as --embedded-lists says.
+func embeddedAllowed(short string) (bool, error) {
+	switch *flagEmbeddedLists {
+	case "all":
+		return true, nil
+	case "none":
+		return false, nil
+	}
+	for _, pattern := range strings.Split(*flagEmbeddedLists, ",") {
+		ok, err := path.Match(strings.TrimSpace(pattern), short)
+		if err != nil {
+			return false, fmt.Errorf("embedded-lists: %s: %w", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// linkSources returns the sources that links are loaded from, in order of
+// precedence, lowest first: the lists embedded in va, unless
+// --embedded-lists leaves them out, then the user's own
+// lists in the lists directory of va's configuration directory, then any in
+// $VA_LISTS_DIR, and then the project's, in the .va/lists directory of the
+// current directory or the nearest directory above it which has one.
+// Directories which do not exist are skipped.
+func linkSources() []LinkSource {
+	var sources []LinkSource
+	switch *flagEmbeddedLists {
+	case "all":
+		sources = append(sources, LinkSource{Name: "embedded", FS: listfs})
+	case "none":
+	default:
+		sources = append(sources, LinkSource{Name: "embedded", FS: listfs, Allow: func(short string) bool {
+			ok, _ := embeddedAllowed(short)
+			return ok
+		}})
+	}
+	sources = appendSubscriptions(sources)
+	if dir, err := userListsDir(); err == nil {
+		sources = appendDirSource(sources, "user", dir)
+	}
+	if dir := os.Getenv("VA_LISTS_DIR"); dir != "" {
+		sources = appendDirSource(sources, "$VA_LISTS_DIR", dir)
+	}
+	if dir, ok := projectListsDir(); ok {
+		sources = appendDirSource(sources, "project", dir)
+	}
+	return sources
+}
+
+// projectListsDir returns the .va/lists directory of the current directory,
+// or of the nearest directory above it which has one.
+func projectListsDir() (string, bool) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	for {
+		lists := filepath.Join(dir, ".va", "lists")
+		if fi, err := os.Stat(lists); err == nil && fi.IsDir() {
+			return lists, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// appendDirSource appends the directory of list files to the sources, if
+// it is a directory.
+func appendDirSource(sources []LinkSource, name, dir string) []LinkSource {
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return sources
+	}
+	return append(sources, LinkSource{Name: name, FS: os.DirFS(dir), Dir: dir})
+}
+
+// configDir returns the directory va's configuration is kept in, such as
+// ~/.config/va, which $XDG_CONFIG_HOME moves.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "va"), nil
+}
+
+// loadLinks merges the links from each of the sources into a single map of
+// shortened links. A link from a source overrides any of the same short name
+// from the sources before it, so that (for example) a user's own list can
+// pin a link from the embedded lists to another version, or to a fork.
+func loadLinks(sources []LinkSource) (map[string]Link, error) {
+	links := make(map[string]Link)
+	for _, src := range sources {
+		srcLinks, err := fsToLinks(src.FS)
+		if err != nil {
+			return links, fmt.Errorf("%s: %w", src.Name, err)
+		}
+		for short, link := range srcLinks {
+			if src.Allow != nil && !src.Allow(short) {
+				continue
+			}
+			link.Source = src.Name
+			if src.Dir != "" {
+				link.Path = filepath.Join(src.Dir, filepath.FromSlash(link.File))
+			}
+			if prev, ok := links[short]; ok {
+				link.Overrides = append(prev.Overrides, prev.Location())
+			}
+			links[short] = link
+		}
+	}
+	return links, nil
+}
+
+// warnOverrides warns of each link which overrides another, in case it was
+// not meant to.
+func warnOverrides(links map[string]Link) {
+	shorts := make([]string, 0, len(links))
+	for short, link := range links {
+		if len(link.Overrides) > 0 {
+			shorts = append(shorts, short)
+		}
+	}
+	sort.Strings(shorts)
+	for _, short := range shorts {
+		link := links[short]
+		logWarnf("link %s at %s overrides the one at %s", short, link.Location(), link.Overrides[len(link.Overrides)-1])
+	}
+}
+
+// listPrefix returns the prefix given to links within the list file at path,
+// which is derived from the filename. List files end in ".list", or ".toml"
+// for those in TOML. If the path is not a list file, ok will be false.
+func listPrefix(path string) (prefix string, ok bool) {
+	// Strip the embedded filesystem prefix and extension suffix.
+	name := strings.TrimPrefix(path, "lists/")
+	switch {
+	case strings.HasSuffix(name, ".list"):
+		name = strings.TrimSuffix(name, ".list")
+	case strings.HasSuffix(name, ".toml"):
+		name = strings.TrimSuffix(name, ".toml")
+	default:
+		return "", false
+	}
+
+	if name == "_" {
+		// "_" is a special name meaning "no prefix".
+		return "", true
+	}
+	// otherwise, use the filename as the prefix.
+	return name + "/", true
+}
+
+// fsToLinks converts a filesystem of list files into a map of shortened links.
+func fsToLinks(f fs.FS) (map[string]Link, error) {
+	links := make(map[string]Link)
+
+	fsWalker := func(path string, d fs.DirEntry, errWalker error) error {
+		if errWalker != nil {
+			return errWalker
+		}
+
+		// Skip directories, needs to be a file.
+		if d.IsDir() {
+			return nil
+		}
+
+		name, ok := listPrefix(path)
+		if !ok {
+			// Not a list file, so skip over the file.
+			return nil
+		}
+
+		// Read the file to get the shortenings.
+		fileLinks, err := readList(f, path, name)
+		if err != nil {
+			return err
+		}
+
+		// Ensure each link has not already been seen, then add it.
+		for _, link := range fileLinks {
+			if _, ok := links[link.Short]; ok {
+				return fmt.Errorf("link %s already exists, file: %s", link.Short, path)
+			}
+			links[link.Short] = link
+		}
+		return nil
+	}
+
+	if err := fs.WalkDir(f, ".", fsWalker); err != nil {
+		return links, err
+	}
+	return links, nil
+}
+
+// readList reads the links from the list file within the filesystem, giving
+// each the prefix of the file.
+func readList(f fs.FS, file, prefix string) ([]Link, error) {
+	list, err := f.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer list.Close()
+	return readListFrom(f, list, file, prefix, nil)
+}
+
+// readListFrom reads the links from the list file, whose contents are read
+// from r, giving each the prefix of the file. A line such as "#include
+// common.inc" includes the links of another file, relative to this one
+// within the filesystem, as if they were in this one; via are the files
+// which included this one, outermost first, so that a file which would
+// include itself is caught. Without a filesystem, including files is an
+// error. A file ending in ".toml" is read as readTOMLList reads it.
+func readListFrom(f fs.FS, r io.Reader, file, prefix string, via []string) ([]Link, error) {
+	return scanList(f, r, file, prefix, via, nil)
+}
+
+// badLine reports a problem with a line of a list file, or with the whole
+// file if line is 0.
+type badLine func(file string, line int, err error)
+
+// scanList reads the links from the list file as readListFrom does. If bad
+// is not nil, each line which cannot be read is reported to it, and skipped,
+// rather than ending the scan, so that every problem with a file can be
+// found at once; the error returned is then only for a file which cannot be
+// read at all.
+func scanList(f fs.FS, r io.Reader, file, prefix string, via []string, bad badLine) ([]Link, error) {
+	if path.Ext(file) == ".toml" {
+		return scanTOMLList(r, file, prefix, via, bad)
+	}
+	var links []Link
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		if target, ok := includeTarget(scanner.Text()); ok {
+			included, err := includeList(f, path.Join(path.Dir(file), target), prefix, append(via[:len(via):len(via)], file), bad)
+			if err != nil {
+				if bad == nil {
+					return nil, fmt.Errorf("%s:%d: %w", file, n, err)
+				}
+				bad(file, n, err)
+			}
+			links = append(links, included...)
+			continue
+		}
+
+		link, err := lineToLink(scanner.Text())
+		if err != nil {
+			if bad == nil {
+				return nil, fmt.Errorf("%s:%d: %w", file, n, err)
+			}
+			bad(file, n, err)
+			continue
+		}
+
+		// Skip empty links.
+		if link.Short == "" {
+			continue
+		}
+
+		// Rewrite the short name with any prefix, and note where the
+		// link came from.
+		link.Short = prefix + link.Short
+		link.File = file
+		link.Line = n
+		link.Via = via
+		links = append(links, link)
+	}
+	return links, scanner.Err()
+}
+
+// includeTarget returns the file a line includes, if it is an include
+// directive: "#include", or "@include", followed by the file.
+func includeTarget(line string) (string, bool) {
+	for _, directive := range []string{"#include ", "@include "} {
+		if target := strings.TrimPrefix(line, directive); target != line {
+			return strings.TrimSpace(target), true
+		}
+	}
+	return "", false
+}
+
+// includeList reads the links of the included file, refusing to include a
+// file which is already being read. Problems within the file are reported to
+// bad, as scanList reports them.
+func includeList(f fs.FS, file, prefix string, via []string, bad badLine) ([]Link, error) {
+	if f == nil {
+		return nil, fmt.Errorf("include %s: lists cannot include files here", file)
+	}
+	for _, including := range via {
+		if including == file {
+			return nil, fmt.Errorf("include %s: cycle: %s -> %s", file, strings.Join(via, " -> "), file)
+		}
+	}
+	list, err := f.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", file, errors.Unwrap(err))
+	}
+	defer list.Close()
+	return scanList(f, list, file, prefix, via, bad)
+}
+
+// lineToLink converts a line of text, as parseListLine splits it, into a
+// Link. A blank line, or one which is only a comment, is an empty Link.
+func lineToLink(line string) (Link, error) {
+	l, err := parseListLine(line)
+	if err != nil || l.Short == "" {
+		return Link{}, err
+	}
+	short, pkg := l.Short, l.Pkg
+	link := Link{
+		Short: short,
+		Pkg:   pkg,
+		Desc:  l.Desc,
+	}
+	// A short name, rather than a module, makes the link an alias, and a
+	// short name ending in "/*" makes it a rewrite rule.
+	switch {
+	case validateShort(short) && validateAlias(pkg):
+		link.Pkg, link.Alias = "", pkg
+	case isRewrite(short):
+		if !validateRewrite(short, pkg) {
+			return Link{}, fmt.Errorf("bad rewrite rule: %s %s", short, pkg)
+		}
+	case !validateShort(short):
+		return Link{}, fmt.Errorf("bad short name: %s", short)
+	default:
+		if err := checkMod(pkg); err != nil {
+			return Link{}, fmt.Errorf("bad module: %s %s: %w", short, pkg, err)
+		}
+	}
+	for _, opt := range l.Options {
+		if err := linkOptions[opt.Key](&link, opt.Value); err != nil {
+			return Link{}, fmt.Errorf("bad option: %s %s: %w", short, opt.Key, err)
+		}
+	}
+	return link, nil
+}
+
+// expandLink looks up the path to see if it is a shortened link, or is
+// shortened by a rewrite rule, returning the module path and version it is
+// short for along with the link if so. Otherwise the path is returned as it
+// is, at --default-version if it has no version of its own.
+func expandLink(links map[string]Link, mod string) (string, Link, bool) {
+	modPath := strings.Split(mod, "@")
+	link, ok := links[modPath[0]]
+	if isRewrite(modPath[0]) {
+		link, ok = Link{}, false
+	}
+	if !ok {
+		if pkgPath, version, rule, ok := expandRewrite(links, modPath[0]); ok {
+			modPath[0] = pkgPath
+			if len(modPath) == 1 && version == "" {
+				version = *flagDefaultVersion
+			}
+			if len(modPath) == 1 && version != "" {
+				modPath = append(modPath, version)
+			}
+			return strings.Join(modPath, "@"), rule, true
+		}
+		link, ok = expandAbbreviation(links, modPath[0])
+	}
+	if ok {
+		modLink := strings.Split(link.Pkg, "@")
+		modPath[0] = modLink[0]
+		// No version specified? Take the version from the link. The
+		// user-specified version is always preferred over the
+		// version specified in the shortened version.
+		if len(modPath) == 1 {
+			modPath = append(modPath, modLink[1])
+		}
+	} else if len(modPath) == 1 && *flagDefaultVersion != "" {
+		modPath = append(modPath, *flagDefaultVersion)
+	}
+	return strings.Join(modPath, "@"), link, ok
+}
+
+// linkOptions maps the options which may be given in a list line to the
+// functions which apply them to a Link.
+var linkOptions = map[string]func(link *Link, value string) error{
+	"args": func(link *Link, value string) (err error) {
+		link.Args, err = splitFields(value)
+		return err
+	},
+	"build-env": func(link *Link, value string) (err error) {
+		link.BuildEnv, err = parseEnv(value)
+		return err
+	},
+	"build-tags": func(link *Link, value string) error {
+		for _, tag := range strings.Split(value, ",") {
+			if tag == "" || strings.ContainsAny(tag, " \t") {
+				return fmt.Errorf("bad build tag: %q", tag)
+			}
+			link.BuildTags = append(link.BuildTags, tag)
+		}
+		return nil
+	},
+	"env": func(link *Link, value string) (err error) {
+		link.Env, err = parseEnv(value)
+		return err
+	},
+	"deprecated": func(link *Link, value string) error {
+		link.Deprecated = value
+		return nil
+	},
+	"goarch": func(link *Link, value string) (err error) {
+		link.GOARCH, err = parsePlatforms(value)
+		return err
+	},
+	"goos": func(link *Link, value string) (err error) {
+		link.GOOS, err = parsePlatforms(value)
+		return err
+	},
+	"ldflags": func(link *Link, value string) error {
+		link.Ldflags = value
+		return nil
+	},
+	"post": func(link *Link, value string) error {
+		link.Post = value
+		return nil
+	},
+	"replaced-by": func(link *Link, value string) error {
+		if !validateAlias(value) || strings.Contains(value, "@") {
+			return fmt.Errorf("bad short name: %q", value)
+		}
+		link.ReplacedBy = value
+		return nil
+	},
+	"tags": func(link *Link, value string) error {
+		for _, tag := range strings.Split(value, ",") {
+			if !validateShort(tag) {
+				return fmt.Errorf("bad tag: %q", tag)
+			}
+			link.Tags = append(link.Tags, tag)
+		}
+		return nil
+	},
+}
+
+// parseEnv parses environment variables given as an option in a list line,
+// such as env="GOFLAGS=-mod=mod TOOL_CONFIG=ci.yaml".
+func parseEnv(value string) ([]string, error) {
+	env, err := splitFields(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range env {
+		if err := checkEnv(kv); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// checkEnv checks the environment variable, as "KEY=value", has a name.
+func checkEnv(kv string) error {
+	name, _, ok := strings.Cut(kv, "=")
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("bad variable: %q (must be KEY=value)", kv)
+	}
+	return nil
+}
+
+// HasTag reports whether the link has the tag.
+func (l Link) HasTag(tag string) bool {
+	for _, t := range l.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	reShort = regexp.MustCompile(`^(?:[0-9A-Za-z]+[0-9A-Za-z_-]*[0-9A-Za-z]+|[0-9A-Za-z]+)$`)
+)
+
+// validateShort validates a short name, to ensure it starts and ends with an
+// alphanumeric character, and optionally has underscores or dashes in the
+// middle of it.
+func validateShort(short string) bool {
+	return reShort.MatchString(short)
+}
+
+// validateMod takes a module name and ensures it is a valid Go module name.
+func validateMod(mod string) bool {
+	return checkMod(mod) == nil
+}
+
+// checkMod checks the module name as validateMod does, saying what is wrong
+// with it if it is not valid.
+func checkMod(mod string) error {
+	split := strings.Split(mod, "@")
+	if len(split) != 2 {
+		// For module mode, must specify a version.
+		return errors.New("must be path@version")
+	}
+	if err := module.CheckPath(split[0]); err != nil {
+		// Must be a valid module path.
+		return err
+	}
+
+	// LGTM.
+	return nil
+}
+
+// checkTool checks the tool, as expanded from its link if it had one, is a
+// valid module path and version. A tool which cannot be a module path was
+// most likely meant to be a short name, so the closest short names are
+// suggested.
+func checkTool(links map[string]Link, mod string) error {
+	if validateMod(mod) {
+		return nil
+	}
+	pkgPath, _, _ := strings.Cut(mod, "@")
+	if first, _, _ := strings.Cut(pkgPath, "/"); !strings.Contains(first, ".") {
+		if shorts := abbreviations(links, pkgPath); *flagFuzzy && len(shorts) > 1 {
+			return fmt.Errorf("ambiguous short name: %s (could be %s)", pkgPath, strings.Join(shorts, ", "))
+		}
+		if suggestions := suggestLinks(links, pkgPath, 3); len(suggestions) > 0 {
+			return fmt.Errorf("unknown short name: %s (did you mean %s?)", pkgPath, strings.Join(suggestions, ", "))
+		}
+		return fmt.Errorf("unknown short name: %s (see \"va list\")", pkgPath)
+	}
+	return fmt.Errorf("invalid pkg: %s (must be path@version)", mod)
+}
+
+// suggestLinks returns at most n of the short names closest to the given
+// one, closest first, which are near enough that they may have been meant.
+func suggestLinks(links map[string]Link, short string, n int) []string {
+	type suggestion struct {
+		short    string
+		distance int
+	}
+	limit := (len(short) + 2) / 3
+	var suggestions []suggestion
+	for s := range links {
+		// The prefix given by the list is easily forgotten, so the
+		// name without it is as good a match.
+		d := editDistance(short, s)
+		if i := strings.LastIndexByte(s, '/'); i >= 0 && !strings.Contains(short, "/") {
+			if unprefixed := editDistance(short, s[i+1:]); unprefixed < d {
+				d = unprefixed
+			}
+		}
+		if d <= limit {
+			suggestions = append(suggestions, suggestion{s, d})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].distance != suggestions[j].distance {
+			return suggestions[i].distance < suggestions[j].distance
+		}
+		return suggestions[i].short < suggestions[j].short
+	})
+	var shorts []string
+	for i := 0; i < len(suggestions) && i < n; i++ {
+		shorts = append(shorts, suggestions[i].short)
+	}
+	return shorts
+}
+
+// editDistance returns the distance between a and b: the number of
+// characters which must be inserted, deleted, substituted, or swapped with
+// their neighbour to turn one into the other.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j-1] + cost
+			if d[i-1][j]+1 < d[i][j] {
+				d[i][j] = d[i-1][j] + 1
+			}
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// calledAs returns the short name of the link va was run as, if it was run
+// through a file named after one, such as a symlink to va named
+// "staticcheck", along with the links loaded to find it, so that they need
+// not be loaded again.
+func calledAs(argv0 string) (string, map[string]Link) {
+	name := strings.TrimSuffix(filepath.Base(argv0), ".exe")
+	if name == "va" {
+		return "", nil
+	}
+	links, err := loadLinks(linkSources())
+	if err != nil {
+		return "", nil
+	}
+	short := linkNamed(links, name)
+	if short == "" {
+		return "", nil
+	}
+	return short, links
+}
+
+// linkNamed returns the short name of the link a command of that name would
+// run, or "" if there is none. A link whose short name has a prefix is
+// found by the last element alone, as long as no other link has the same
+// last element.
+func linkNamed(links map[string]Link, name string) string {
+	if _, ok := links[name]; ok {
+		return name
+	}
+	var found []string
+	for short := range links {
+		if path.Base(short) == name {
+			found = append(found, short)
+		}
+	}
+	if len(found) != 1 {
+		return ""
+	}
+	return found[0]
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// lintConcurrency is how many modules va lint-lists checks online at once.
+const lintConcurrency = 8
+
+// ListProblem is a problem with a list file, found by va lint-lists.
+type ListProblem struct {
+	Source  string
+	File    string
+	Line    int    `json:",omitempty"` // 0 if the problem is with the whole file.
+	Short   string `json:",omitempty"`
+	Problem string
+
+	// Path is the path of File on disk, if the source is a directory.
+	Path string `json:",omitempty"`
+
+	// Warning is set for problems which do not stop va from loading the
+	// lists, such as a link overriding another, which may be meant.
+	Warning bool `json:",omitempty"`
+}
+
+// Location returns where the problem is: the path of the file, and the line,
+// such as "/home/me/.config/va/lists/team.list:12", or for a source which is
+// not a directory, such as the embedded lists, the source and file, such as
+// "embedded:lists/go.list:12".
+func (p ListProblem) Location() string {
+	return location(p.Source, p.File, p.Path, p.Line)
+}
+
+// location returns where a line of a file of a source is, as
+// ListProblem.Location does.
+func location(source, file, path string, line int) string {
+	loc := path
+	if loc == "" {
+		loc = source + ":" + file
+	}
+	if line > 0 {
+		loc += ":" + strconv.Itoa(line)
+	}
+	return loc
+}
+
+// ListLint is the outcome of linting list sources: the problems found, in
+// order, and the links which would be loaded, with aliases resolved where
+// they could be.
+type ListLint struct {
+	Problems []ListProblem
+	Links    map[string]Link
+	Files    int // The number of list files read.
+
+	dirs map[string]string // The directory of each source which is one.
+}
+
+// add adds a problem with the line of the file of the source.
+func (l *ListLint) add(source, file string, line int, short string, warning bool, problem string) {
+	p := ListProblem{Source: source, File: file, Line: line, Short: short, Problem: problem, Warning: warning}
+	if dir := l.dirs[source]; dir != "" && file != "" {
+		p.Path = filepath.Join(dir, filepath.FromSlash(file))
+	}
+	l.Problems = append(l.Problems, p)
+}
+
+// problem adds a problem with the link, where it is defined.
+func (l *ListLint) problem(link Link, warning bool, format string, args ...interface{}) {
+	l.add(link.Source, link.File, link.Line, link.Short, warning, fmt.Sprintf(format, args...))
+}
+
+// LintLists checks every list file of the sources, reporting every problem
+// with them rather than stopping at the first, as loading them does: lines
+// and tables which cannot be read, short names defined more than once within
+// a source, aliases which cannot be resolved, and deprecated links replaced
+// by links which do not exist. Links which override those of another source,
+// short names which can only be run with "va run", as a command of va has
+// the same name, and operating systems and architectures the go command does
+// not know of, are warned of.
+func LintLists(sources []LinkSource) ListLint {
+	lint := ListLint{Links: make(map[string]Link), dirs: make(map[string]string)}
+	for _, src := range sources {
+		lint.dirs[src.Name] = src.Dir
+	}
+	for _, src := range sources {
+		defined := make(map[string]Link)
+		walkErr := fs.WalkDir(src.FS, ".", func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				lint.add(src.Name, file, 0, "", false, err.Error())
+				return nil
+			}
+			prefix, ok := listPrefix(file)
+			if d.IsDir() || !ok {
+				return nil
+			}
+			lint.Files++
+			for _, link := range lintListFile(&lint, src, file, prefix) {
+				link.Source = src.Name
+				if src.Dir != "" {
+					link.Path = filepath.Join(src.Dir, filepath.FromSlash(link.File))
+				}
+				if prev, ok := defined[link.Short]; ok {
+					lint.problem(link, false, "%s is already defined at %s", link.Short, prev.Location())
+					continue
+				}
+				defined[link.Short] = link
+			}
+			return nil
+		})
+		if walkErr != nil {
+			lint.add(src.Name, "", 0, "", false, walkErr.Error())
+		}
+
+		shorts := make([]string, 0, len(defined))
+		for short := range defined {
+			shorts = append(shorts, short)
+		}
+		sort.Strings(shorts)
+		for _, short := range shorts {
+			link := defined[short]
+			if src.Allow != nil && !src.Allow(short) {
+				continue
+			}
+			if prev, ok := lint.Links[short]; ok {
+				link.Overrides = append(prev.Overrides, prev.Location())
+				lint.problem(link, true, "%s overrides the link at %s", short, prev.Location())
+			}
+			lint.Links[short] = link
+		}
+	}
+
+	// Aliases and replacements may refer to links in any source, so they
+	// are checked once every link is known.
+	shorts := make([]string, 0, len(lint.Links))
+	for short := range lint.Links {
+		shorts = append(shorts, short)
+	}
+	sort.Strings(shorts)
+	resolved := make(map[string]Link)
+	for _, short := range shorts {
+		link := lint.Links[short]
+		if link.Alias != "" {
+			if _, err := resolveAlias(lint.Links, resolved, short, nil); err != nil {
+				lint.problem(link, false, "%s", strings.TrimPrefix(err.Error(), fmt.Sprintf("link %s in %s: ", short, link.Origin())))
+			}
+		}
+		if link.ReplacedBy != "" {
+			if replacedBy := relativeShort(lint.Links, link, link.ReplacedBy); !hasLink(lint.Links, replacedBy) {
+				lint.problem(link, false, "replaced by unknown short name: %s", replacedBy)
+			}
+		}
+		for _, goos := range link.GOOS {
+			if !knownGOOS[goos] && goos != "unix" {
+				lint.problem(link, true, "unknown GOOS: %s", goos)
+			}
+		}
+		for _, goarch := range link.GOARCH {
+			if !knownGOARCH[goarch] {
+				lint.problem(link, true, "unknown GOARCH: %s", goarch)
+			}
+		}
+		if _, ok := commands[short]; ok {
+			lint.problem(link, true, "%s is also a command of va, so can only be run with \"va run %s\"", short, short)
+		}
+	}
+	for short, link := range resolved {
+		lint.Links[short] = link
+	}
+	sortProblems(sources, lint.Problems)
+	return lint
+}
+
+// lintListFile reads the links of the list file, reporting each line or
+// table which cannot be read as a problem.
+func lintListFile(lint *ListLint, src LinkSource, file, prefix string) []Link {
+	bad := func(badFile string, line int, err error) {
+		lint.add(src.Name, badFile, line, "", false, err.Error())
+	}
+	list, err := src.FS.Open(file)
+	if err != nil {
+		bad(file, 0, err)
+		return nil
+	}
+	defer list.Close()
+	links, err := scanList(src.FS, list, file, prefix, nil, bad)
+	if err != nil {
+		bad(file, 0, err)
+	}
+	return links
+}
+
+// sortProblems sorts the problems by where they are: in the order of their
+// sources, then by file, then by line.
+func sortProblems(sources []LinkSource, problems []ListProblem) {
+	order := make(map[string]int, len(sources))
+	for i, src := range sources {
+		order[src.Name] = i
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		switch {
+		case a.Source != b.Source:
+			return order[a.Source] < order[b.Source]
+		case a.File != b.File:
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+}
+
+// LintOnline checks that the module of each link can be found at its
+// version, and that the version has not been retracted, adding a problem for
+// each link which fails. Links of the same package and version are checked
+// once. Rewrite rules, which are not of any one module, are skipped.
+func LintOnline(ctx context.Context, lint *ListLint) {
+	byPkg := make(map[string][]Link)
+	for _, link := range lint.Links {
+		if link.Pkg != "" && !isRewrite(link.Short) {
+			byPkg[link.Pkg] = append(byPkg[link.Pkg], link)
+		}
+	}
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, lintConcurrency)
+	)
+	for pkg, links := range byPkg {
+		wg.Add(1)
+		go func(pkg string, links []Link) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			problem, warning := checkPkgOnline(ctx, pkg)
+			if problem == "" {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, link := range links {
+				lint.problem(link, warning, "%s", problem)
+			}
+		}(pkg, links)
+	}
+	wg.Wait()
+}
+
+// checkPkgOnline checks the package can be found at its version, and that
+// the version has not been retracted, returning what is wrong if not, and
+// whether it is only worth a warning. A retracted version still builds, so
+// it is.
+func checkPkgOnline(ctx context.Context, pkg string) (problem string, warning bool) {
+	pkgPath, version, _ := strings.Cut(pkg, "@")
+	mod, _, err := findModule(ctx, pkgPath, version)
+	if err != nil {
+		return fmt.Sprintf("%s is unreachable: %v", pkg, strings.TrimPrefix(err.Error(), "mod-download: ")), false
+	}
+	if isQuery(version) {
+		// The proxies do not resolve queries to retracted versions.
+		return "", false
+	}
+	rationale, err := Retraction(ctx, mod.Path, mod.Version)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("checking whether %s@%s is retracted: %v", mod.Path, mod.Version, err), true
+	case rationale != nil:
+		msg := fmt.Sprintf("%s@%s is retracted", mod.Path, mod.Version)
+		if len(rationale) > 0 && rationale[0] != "" {
+			msg += ": " + strings.Join(rationale, "; ")
+		}
+		return msg, true
+	}
+	return "", false
+}
+
+// lintSources returns the sources of the list files or directories given to
+// va lint-lists, each named after its path. A list file is read as the only
+// list file in its directory, so that any files it includes are found.
+func lintSources(paths []string) ([]LinkSource, error) {
+	var sources []LinkSource
+	for _, name := range paths {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if fi.IsDir() {
+			sources = append(sources, LinkSource{Name: name, FS: os.DirFS(name), Dir: name})
+			continue
+		}
+		base := filepath.Base(name)
+		if _, ok := listPrefix(base); !ok {
+			return nil, fmt.Errorf("%s: not a list file (must end in .list or .toml)", name)
+		}
+		dir := filepath.Dir(name)
+		sources = append(sources, LinkSource{Name: name, FS: onlyFile{os.DirFS(dir), base}, Dir: dir})
+	}
+	return sources, nil
+}
+
+// hasLink reports whether there is a link of the short name.
+func hasLink(links map[string]Link, short string) bool {
+	_, ok := links[short]
+	return ok
+}
+
+// onlyFile is a filesystem which walks as if it had only the one file, while
+// still opening any other, so that files the list includes can be read.
+type onlyFile struct {
+	fs.FS
+	name string
+}
+
+func (f onlyFile) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, fs.ErrNotExist
+	}
+	fi, err := fs.Stat(f.FS, f.name)
+	if err != nil {
+		return nil, err
+	}
+	return []fs.DirEntry{fs.FileInfoToDirEntry(fi)}, nil
+}
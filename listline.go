@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// listLine is a line of a list file split into its fields, which are yet to
+// be checked: the short name, the package, any options, and the description.
+// A line with no fields, which is blank or only a comment, has an empty short
+// name.
+type listLine struct {
+	Short   string
+	Pkg     string
+	Options []listOption
+	Desc    string
+}
+
+// listOption is an option given in a line of a list file, as key=value.
+type listOption struct {
+	Key   string
+	Value string
+}
+
+// parseListLine splits a line of a list file into its fields:
+//
+//	short path@version [key=value...] [description...] [# comment]
+//
+// Fields are separated by any number of spaces or tabs. The short name,
+// package, and options may be quoted with single or double quotes, as in a
+// POSIX shell, and outside of single quotes a backslash escapes the
+// character after it, so an option's value may have spaces in it:
+//
+//	golangci-lint github.com/golangci/golangci-lint/cmd/golangci-lint@latest args="run ./..."
+//
+// The description is every field after the options, joined by single
+// spaces, so it needs no quoting, but may be quoted to keep its spacing. As
+// descriptions are prose, a quote only quotes in a word which starts with
+// one, so that words such as "don't" need no escaping, and a backslash only
+// escapes a space, a tab, a quote, "#", or another backslash.
+//
+// A field starting with "#" starts a comment, which runs to the end of the
+// line, so "#" at the start of a word of a description must be escaped or
+// quoted.
+func parseListLine(line string) (listLine, error) {
+	sc := &listScanner{s: line}
+	var fields []string
+	for len(fields) < 2 {
+		field, ok, err := sc.field(false)
+		if err != nil {
+			return listLine{}, fmt.Errorf("bad line: %w", err)
+		}
+		if !ok {
+			break
+		}
+		fields = append(fields, field)
+	}
+	switch len(fields) {
+	case 0:
+		return listLine{}, nil
+	case 1:
+		return listLine{}, fmt.Errorf("bad line: no package for %s", fields[0])
+	}
+	l := listLine{Short: fields[0], Pkg: fields[1]}
+
+	// Any options come before the description, in the form key=value.
+	for {
+		key, ok := sc.optionKey()
+		if !ok {
+			// Not an option, so must be the start of the description.
+			break
+		}
+		field, _, err := sc.field(false)
+		if err != nil {
+			return listLine{}, fmt.Errorf("bad option: %s %s: %w", l.Short, key, err)
+		}
+		l.Options = append(l.Options, listOption{key, strings.TrimPrefix(field, key+"=")})
+	}
+
+	var desc []string
+	for {
+		word, ok, err := sc.field(true)
+		if err != nil {
+			return listLine{}, fmt.Errorf("bad description: %s: %w", l.Short, err)
+		}
+		if !ok {
+			break
+		}
+		desc = append(desc, word)
+	}
+	l.Desc = strings.Join(desc, " ")
+	return l, nil
+}
+
+// String formats the line as it is written in a list file, quoting the
+// values of options, and the description, if they need it to be read back
+// as they are.
+func (l listLine) String() string {
+	fields := []string{l.Short, l.Pkg}
+	for _, opt := range l.Options {
+		fields = append(fields, opt.Key+"="+shellQuote(opt.Value))
+	}
+	if l.Desc != "" {
+		fields = append(fields, quoteDesc(l.Desc))
+	}
+	return strings.Join(fields, " ")
+}
+
+// quoteDesc quotes the description, if parseListLine would not read it back
+// as it is: if its spacing would be lost, or it has anything which would be
+// taken for quotes, escapes, or a comment, or it starts with what would be
+// taken for an option.
+func quoteDesc(desc string) string {
+	sc := &listScanner{s: desc}
+	if _, ok := sc.optionKey(); !ok {
+		var words []string
+		for {
+			word, ok, err := sc.field(true)
+			if err != nil || !ok {
+				if err == nil && strings.Join(words, " ") == desc {
+					return desc
+				}
+				break
+			}
+			words = append(words, word)
+		}
+	}
+	return shellQuote(desc)
+}
+
+// listScanner splits a line of a list file into its fields, for
+// parseListLine.
+type listScanner struct {
+	s   string
+	pos int
+}
+
+// isListSpace reports whether the character separates fields.
+func isListSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// skipSpace skips the spaces and tabs before the next field.
+func (sc *listScanner) skipSpace() {
+	for sc.pos < len(sc.s) && isListSpace(sc.s[sc.pos]) {
+		sc.pos++
+	}
+}
+
+// optionKey returns the key of the next field, if it is an option: an
+// unquoted key which linkOptions has, followed by "=".
+func (sc *listScanner) optionKey() (string, bool) {
+	sc.skipSpace()
+	end := sc.pos
+	for end < len(sc.s) && !isListSpace(sc.s[end]) && sc.s[end] != '=' {
+		end++
+	}
+	key := sc.s[sc.pos:end]
+	if _, ok := linkOptions[key]; !ok || end == len(sc.s) || sc.s[end] != '=' {
+		return "", false
+	}
+	return key, true
+}
+
+// field returns the next field, with its quotes and escapes removed, or
+// false if there are no more, either as the line has ended or as a comment
+// has started. If loose is set, the field is a word of a description, which
+// is only quoted if it starts with a quote, and in which a backslash only
+// escapes a space, a tab, a quote, "#", or a backslash.
+func (sc *listScanner) field(loose bool) (string, bool, error) {
+	sc.skipSpace()
+	if sc.pos == len(sc.s) || sc.s[sc.pos] == '#' {
+		sc.pos = len(sc.s)
+		return "", false, nil
+	}
+	quoting := !loose || sc.s[sc.pos] == '"' || sc.s[sc.pos] == '\''
+	var b strings.Builder
+	var quote byte
+	for ; sc.pos < len(sc.s); sc.pos++ {
+		c := sc.s[sc.pos]
+		switch {
+		case c == '\\' && quote != '\'':
+			if sc.pos+1 == len(sc.s) {
+				return "", false, errors.New("trailing backslash")
+			}
+			next := sc.s[sc.pos+1]
+			if !quoting && !strings.ContainsRune(" \t\"'#\\", rune(next)) {
+				b.WriteByte(c)
+				continue
+			}
+			b.WriteByte(next)
+			sc.pos++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			b.WriteByte(c)
+		case quoting && (c == '"' || c == '\''):
+			quote = c
+		case isListSpace(c):
+			return b.String(), true, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if quote != 0 {
+		return "", false, errors.New("unterminated quote")
+	}
+	return b.String(), true, nil
+}
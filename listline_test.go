@@ -0,0 +1,214 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseListLine(t *testing.T) {
+	for _, tt := range []struct {
+		line    string
+		want    listLine
+		wantErr string
+	}{
+		{line: ""},
+		{line: " \t "},
+		{line: "# a comment"},
+		{line: "  # an indented comment"},
+		{line: "hello", wantErr: "bad line: no package for hello"},
+		{line: "hello # a comment", wantErr: "bad line: no package for hello"},
+		{
+			line: "hello example.com/hello@v1.0.0",
+			want: listLine{Short: "hello", Pkg: "example.com/hello@v1.0.0"},
+		},
+		{
+			line: "hello\texample.com/hello@latest   Says\thello   world",
+			want: listLine{Short: "hello", Pkg: "example.com/hello@latest", Desc: "Says hello world"},
+		},
+		{
+			line: "hello example.com/hello@latest Says hello # to the world",
+			want: listLine{Short: "hello", Pkg: "example.com/hello@latest", Desc: "Says hello"},
+		},
+		{
+			line: "hello example.com/hello@latest #1 in the charts",
+			want: listLine{Short: "hello", Pkg: "example.com/hello@latest"},
+		},
+		{
+			line: `hello example.com/hello@latest \#1 in C# and "Go"`,
+			want: listLine{Short: "hello", Pkg: "example.com/hello@latest", Desc: "#1 in C# and Go"},
+		},
+		{
+			line: `hello example.com/hello@latest Don't panic`,
+			want: listLine{Short: "hello", Pkg: "example.com/hello@latest", Desc: "Don't panic"},
+		},
+		{
+			line: `hello example.com/hello@latest "Says   hello" 'to  you'`,
+			want: listLine{Short: "hello", Pkg: "example.com/hello@latest", Desc: "Says   hello to  you"},
+		},
+		{
+			line: `hello example.com/hello@latest Reads C:\dir and a\ b`,
+			want: listLine{Short: "hello", Pkg: "example.com/hello@latest", Desc: `Reads C:\dir and a b`},
+		},
+		{
+			line: `"my tool" 'example.com/my tool'@latest`,
+			want: listLine{Short: "my tool", Pkg: "example.com/my tool@latest"},
+		},
+		{
+			line: `my\ tool example.com/tool@latest`,
+			want: listLine{Short: "my tool", Pkg: "example.com/tool@latest"},
+		},
+		{
+			line: `lint github.com/golangci/golangci-lint/cmd/golangci-lint@latest args="run ./..." build-tags=a,b Lints code`,
+			want: listLine{
+				Short:   "lint",
+				Pkg:     "github.com/golangci/golangci-lint/cmd/golangci-lint@latest",
+				Options: []listOption{{"args", "run ./..."}, {"build-tags", "a,b"}},
+				Desc:    "Lints code",
+			},
+		},
+		{
+			line: `t example.com/t@latest args='say "hi"\' args="a\"b" args=a\ b`,
+			want: listLine{
+				Short:   "t",
+				Pkg:     "example.com/t@latest",
+				Options: []listOption{{"args", `say "hi"\`}, {"args", `a"b`}, {"args", "a b"}},
+			},
+		},
+		{
+			line: "t example.com/t@latest args= Runs t",
+			want: listLine{Short: "t", Pkg: "example.com/t@latest", Options: []listOption{{"args", ""}}, Desc: "Runs t"},
+		},
+		{
+			line: "t example.com/t@latest Sets args=x",
+			want: listLine{Short: "t", Pkg: "example.com/t@latest", Desc: "Sets args=x"},
+		},
+		{
+			line: "t example.com/t@latest unknown=x Runs t",
+			want: listLine{Short: "t", Pkg: "example.com/t@latest", Desc: "unknown=x Runs t"},
+		},
+		{line: `hello "example.com/hello@latest`, wantErr: "bad line: unterminated quote"},
+		{line: `hello example.com/hello@latest args="a b`, wantErr: "bad option: hello args: unterminated quote"},
+		{line: `hello example.com/hello@latest "Says hello`, wantErr: "bad description: hello: unterminated quote"},
+		{line: `hello\`, wantErr: "bad line: trailing backslash"},
+		{line: `hello example.com/hello@latest args=a\`, wantErr: "bad option: hello args: trailing backslash"},
+		{line: `hello example.com/hello@latest Says hello\`, wantErr: "bad description: hello: trailing backslash"},
+	} {
+		got, err := parseListLine(tt.line)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("parseListLine(%q) error = %v, want %q", tt.line, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseListLine(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseListLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestListScannerField(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		loose   bool
+		want    []string
+		wantErr string
+	}{
+		{s: "", want: nil},
+		{s: "a  b\tc", want: []string{"a", "b", "c"}},
+		{s: "a # b", want: []string{"a"}},
+		{s: "a#b", want: []string{"a#b"}},
+		{s: `"a b"c 'd'"e"`, want: []string{"a bc", "de"}},
+		{s: `'a\b' "a\b" a\b`, want: []string{`a\b`, "ab", "ab"}},
+		{s: `a\'b`, want: []string{"a'b"}},
+		{s: `don't "a b" it's`, loose: true, want: []string{"don't", "a b", "it's"}},
+		{s: `a\b a\ b a\#b a\\b`, loose: true, want: []string{`a\b`, "a b", "a#b", `a\b`}},
+		{s: `'a\' b`, want: []string{`a\`, "b"}},
+		{s: `"a`, wantErr: "unterminated quote"},
+		{s: `'a`, loose: true, wantErr: "unterminated quote"},
+		{s: `a\`, wantErr: "trailing backslash"},
+		{s: `a\`, loose: true, wantErr: "trailing backslash"},
+	} {
+		sc := &listScanner{s: tt.s}
+		var got []string
+		var err error
+		for {
+			var field string
+			var ok bool
+			field, ok, err = sc.field(tt.loose)
+			if err != nil || !ok {
+				break
+			}
+			got = append(got, field)
+		}
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("fields of %q (loose %v): error = %v, want %q", tt.s, tt.loose, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("fields of %q (loose %v): %v", tt.s, tt.loose, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("fields of %q (loose %v) = %q, want %q", tt.s, tt.loose, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteDesc(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		want string
+	}{
+		{"", ""},
+		{"Says hello", "Says hello"},
+		{"Don't panic", "Don't panic"},
+		{"Written in C#", "Written in C#"},
+		{`Reads C:\dir`, `Reads C:\dir`},
+		{"Says  hello", "'Says  hello'"},
+		{" Says hello", "' Says hello'"},
+		{"Says\thello", "'Says\thello'"},
+		{"#1 tool", "'#1 tool'"},
+		{`"Quoted" word`, `'"Quoted" word'`},
+		{`a\ b`, `'a\ b'`},
+		{"args=x is not an option", "'args=x is not an option'"},
+		{"It's  spaced", `'It'\''s  spaced'`},
+	} {
+		if got := quoteDesc(tt.desc); got != tt.want {
+			t.Errorf("quoteDesc(%q) = %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestListLineRoundTrip(t *testing.T) {
+	for _, l := range []listLine{
+		{Short: "hello", Pkg: "example.com/hello@latest"},
+		{Short: "hello", Pkg: "example.com/hello@v1.0.0", Desc: "Says hello"},
+		{Short: "hello", Pkg: "example.com/hello@latest", Desc: "Says  hello,\tspaced"},
+		{Short: "hello", Pkg: "example.com/hello@latest", Desc: "#1 in C# and \"Go\", isn't it?"},
+		{Short: "hello", Pkg: "example.com/hello@latest", Desc: `Reads C:\dir and a\ b and a trailing \`},
+		{Short: "hello", Pkg: "example.com/hello@latest", Desc: "args=x is not an option"},
+		{Short: "hello", Pkg: "example.com/hello@latest", Desc: "'quoted'"},
+		{
+			Short:   "lint",
+			Pkg:     "github.com/golangci/golangci-lint/cmd/golangci-lint@latest",
+			Options: []listOption{{"args", "run ./..."}, {"build-tags", "a,b"}, {"args", ""}, {"args", `it's "quoted" \ # too`}},
+			Desc:    "Lints code",
+		},
+	} {
+		s := l.String()
+		got, err := parseListLine(s)
+		if err != nil {
+			t.Errorf("parseListLine(%q), from %+v: %v", s, l, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, l) {
+			t.Errorf("parseListLine(%q) = %+v, want %+v", s, got, l)
+		}
+	}
+}
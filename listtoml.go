@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// readTOMLList reads the links from a list file in TOML, which is the second
+// format of list file, for links which need more than a package and a
+// description. Each link is a table named after its short name:
+//
+//	[hugo]
+//	pkg = "github.com/gohugoio/hugo@latest"
+//	desc = "static site generator"
+//	tags = ["web"]
+//	build-tags = ["extended"]
+//	ldflags = "-s -w"
+//	env = { HUGO_ENVIRONMENT = "development" }
+//	build-env = { CGO_ENABLED = "1" }
+//	args = ["--quiet"]
+//	goos = ["linux", "darwin", "windows"]
+//	goarch = ["amd64", "arm64"]
+//	deprecated = "no longer maintained"
+//	replaced-by = "zola"
+//
+// Only pkg is required, unless the link is an alias of another, in which
+// case alias is given instead:
+//
+//	[lint]
+//	alias = "golangci-lint"
+//	args = ["run", "./..."]
+//
+// The links are prefixed by the name of the file, as
+// they are for the first format, so hugo in web.toml is "web/hugo".
+func readTOMLList(r io.Reader, file, prefix string, via []string) ([]Link, error) {
+	return scanTOMLList(r, file, prefix, via, nil)
+}
+
+// scanTOMLList reads the links from a list file in TOML as readTOMLList does,
+// reporting each table which cannot be read to bad, if it is not nil, as
+// scanList does each line.
+func scanTOMLList(r io.Reader, file, prefix string, via []string, bad badLine) ([]Link, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc, headers, err := parseTOMLHeaders(string(b))
+	if err != nil {
+		var tomlErr *tomlError
+		if bad == nil || !errors.As(err, &tomlErr) {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		bad(file, tomlErr.Line, tomlErr.Err)
+		return nil, nil
+	}
+
+	shorts := make([]string, 0, len(doc))
+	for short := range doc {
+		shorts = append(shorts, short)
+	}
+	sort.Strings(shorts)
+	links := make([]Link, 0, len(shorts))
+	for _, short := range shorts {
+		line := headers[short]
+		table, ok := doc[short].(map[string]interface{})
+		if !ok {
+			err = fmt.Errorf("%s: must be a table of the link's fields", short)
+		} else {
+			var link Link
+			if link, err = tableToLink(short, table); err == nil {
+				link.Short = prefix + link.Short
+				link.File = file
+				link.Line = line
+				link.Via = via
+				links = append(links, link)
+				continue
+			}
+		}
+		switch {
+		case bad != nil:
+			bad(file, line, err)
+		case line > 0:
+			return nil, fmt.Errorf("%s:%d: %w", file, line, err)
+		default:
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return links, nil
+}
+
+// tableToLink converts the table of a link in a TOML list file into a Link,
+// checking it as lineToLink does a line of the first format.
+func tableToLink(short string, table map[string]interface{}) (Link, error) {
+	if !validateShort(short) && !isRewrite(short) {
+		return Link{}, fmt.Errorf("bad short name: %s", short)
+	}
+	link := Link{Short: short}
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		setField, ok := linkFields[key]
+		if !ok {
+			return Link{}, fmt.Errorf("%s: unknown field: %s", short, key)
+		}
+		if err := setField(&link, table[key]); err != nil {
+			return Link{}, fmt.Errorf("%s: %s: %w", short, key, err)
+		}
+	}
+	switch {
+	case link.Alias != "" && link.Pkg != "":
+		return Link{}, fmt.Errorf("%s: only one of pkg and alias may be given", short)
+	case link.Alias != "":
+		if !validateAlias(link.Alias) {
+			return Link{}, fmt.Errorf("bad alias: %s %s", short, link.Alias)
+		}
+		return link, nil
+	case link.Pkg == "":
+		return Link{}, fmt.Errorf("%s: missing pkg, or alias", short)
+	case isRewrite(short):
+		if !validateRewrite(short, link.Pkg) {
+			return Link{}, fmt.Errorf("bad rewrite rule: %s %s", short, link.Pkg)
+		}
+		return link, nil
+	}
+	if err := checkMod(link.Pkg); err != nil {
+		return Link{}, fmt.Errorf("bad module: %s %s: %w", short, link.Pkg, err)
+	}
+	return link, nil
+}
+
+// linkFields maps the fields of a link in a TOML list file to the functions
+// which apply them to a Link.
+var linkFields = map[string]func(link *Link, value interface{}) error{
+	"pkg": func(link *Link, value interface{}) (err error) {
+		link.Pkg, err = tomlString(value)
+		return err
+	},
+	"alias": func(link *Link, value interface{}) (err error) {
+		link.Alias, err = tomlString(value)
+		return err
+	},
+	"desc": func(link *Link, value interface{}) (err error) {
+		link.Desc, err = tomlString(value)
+		return err
+	},
+	"post": func(link *Link, value interface{}) (err error) {
+		link.Post, err = tomlString(value)
+		return err
+	},
+	"tags": func(link *Link, value interface{}) error {
+		tags, err := tomlStrings(value)
+		if err != nil {
+			return err
+		}
+		return linkOptions["tags"](link, strings.Join(tags, ","))
+	},
+	"args": func(link *Link, value interface{}) (err error) {
+		link.Args, err = tomlStrings(value)
+		return err
+	},
+	"env": func(link *Link, value interface{}) (err error) {
+		link.Env, err = tomlEnv(value)
+		return err
+	},
+	"build-env": func(link *Link, value interface{}) (err error) {
+		link.BuildEnv, err = tomlEnv(value)
+		return err
+	},
+	"build-tags": func(link *Link, value interface{}) (err error) {
+		link.BuildTags, err = tomlWords(value)
+		return err
+	},
+	"ldflags": func(link *Link, value interface{}) (err error) {
+		link.Ldflags, err = tomlString(value)
+		return err
+	},
+	"goos": func(link *Link, value interface{}) (err error) {
+		link.GOOS, err = tomlWords(value)
+		return err
+	},
+	"goarch": func(link *Link, value interface{}) (err error) {
+		link.GOARCH, err = tomlWords(value)
+		return err
+	},
+	"deprecated": func(link *Link, value interface{}) (err error) {
+		link.Deprecated, err = tomlString(value)
+		return err
+	},
+	"replaced-by": func(link *Link, value interface{}) error {
+		s, err := tomlString(value)
+		if err != nil {
+			return err
+		}
+		return linkOptions["replaced-by"](link, s)
+	},
+}
+
+// tomlString returns the value as a string, if it is one.
+func tomlString(value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", errors.New("must be a string")
+	}
+	return s, nil
+}
+
+// tomlStrings returns the value as a slice of strings, if it is an array of
+// them.
+func tomlStrings(value interface{}) ([]string, error) {
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("must be an array of strings")
+	}
+	strs := make([]string, 0, len(array))
+	for _, v := range array {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("must be an array of strings")
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+// tomlEnv returns the value as environment variables, "KEY=value", if it is
+// a table of strings.
+func tomlEnv(value interface{}) ([]string, error) {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("must be a table of variables, such as { CGO_ENABLED = \"0\" }")
+	}
+	env := make([]string, 0, len(table))
+	for name, v := range table {
+		s, err := tomlString(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if strings.Contains(name, "=") {
+			return nil, fmt.Errorf("bad variable name: %q", name)
+		}
+		if err := checkEnv(name + "=" + s); err != nil {
+			return nil, err
+		}
+		env = append(env, name+"="+s)
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// tomlWords returns the value as a slice of strings, as tomlStrings does,
+// checking none is empty or has spaces in it, as build tags and platforms
+// cannot.
+func tomlWords(value interface{}) ([]string, error) {
+	words, err := tomlStrings(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range words {
+		if word == "" || strings.ContainsAny(word, " \t,") {
+			return nil, fmt.Errorf("bad value: %q", word)
+		}
+	}
+	return words, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTOMLList has a link with every field, an alias, and a rewrite rule.
+const testTOMLList = `# Tools for the web.
+[hugo]
+pkg = "github.com/gohugoio/hugo@latest"
+desc = "static site generator"
+tags = ["web", "docs"]
+build-tags = ["extended"]
+ldflags = "-s -w"
+env = { HUGO_ENVIRONMENT = "development", HUGO_CACHEDIR = "/tmp/hugo" }
+build-env = { CGO_ENABLED = "1" }
+args = ["--quiet"]
+post = "echo done"
+goos = ["linux", "darwin", "windows"]
+goarch = ["amd64", "arm64"]
+deprecated = "no longer maintained"
+replaced-by = "zola"
+
+[lint]
+alias = "golangci-lint@v1"
+args = ["run", "./..."]
+
+["gh/*"]
+pkg = "github.com/*@latest"
+`
+
+func TestReadTOMLList(t *testing.T) {
+	via := []string{"all.list"}
+	links, err := readTOMLList(strings.NewReader(testTOMLList), "web.toml", "web/", via)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{
+		{Short: "web/gh/*", Pkg: "github.com/*@latest", File: "web.toml", Line: 21, Via: via},
+		{
+			Short:      "web/hugo",
+			Pkg:        "github.com/gohugoio/hugo@latest",
+			Desc:       "static site generator",
+			Tags:       []string{"web", "docs"},
+			Post:       "echo done",
+			Args:       []string{"--quiet"},
+			Env:        []string{"HUGO_CACHEDIR=/tmp/hugo", "HUGO_ENVIRONMENT=development"},
+			BuildEnv:   []string{"CGO_ENABLED=1"},
+			BuildTags:  []string{"extended"},
+			Ldflags:    "-s -w",
+			GOOS:       []string{"linux", "darwin", "windows"},
+			GOARCH:     []string{"amd64", "arm64"},
+			Deprecated: "no longer maintained",
+			ReplacedBy: "zola",
+			File:       "web.toml",
+			Line:       2,
+			Via:        via,
+		},
+		{Short: "web/lint", Alias: "golangci-lint@v1", Args: []string{"run", "./..."}, File: "web.toml", Line: 17, Via: via},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("readTOMLList =\n%+v\nwant\n%+v", links, want)
+	}
+}
+
+func TestReadTOMLListBad(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "not a table", data: `hugo = "github.com/gohugoio/hugo@latest"`, wantErr: "web.toml: hugo: must be a table of the link's fields"},
+		{name: "bad short name", data: "[\"my tool\"]\npkg = \"example.com/tool@latest\"", wantErr: "web.toml:1: bad short name: my tool"},
+		{name: "unknown field", data: "\n[t]\npkg = \"example.com/t@latest\"\nversion = \"v1\"", wantErr: "web.toml:2: t: unknown field: version"},
+		{name: "missing pkg", data: "[t]\ndesc = \"a tool\"", wantErr: "web.toml:1: t: missing pkg, or alias"},
+		{name: "pkg and alias", data: "[t]\npkg = \"example.com/t@latest\"\nalias = \"u\"", wantErr: "web.toml:1: t: only one of pkg and alias may be given"},
+		{name: "bad module", data: "[t]\npkg = \"t\"", wantErr: "web.toml:1: bad module: t t: "},
+		{name: "bad alias", data: "[t]\nalias = \"example.com/u\"", wantErr: "web.toml:1: bad alias: t example.com/u"},
+		{name: "bad rewrite", data: "[\"gh/*\"]\npkg = \"github.com/x\"", wantErr: "web.toml:1: bad rewrite rule: gh/* github.com/x"},
+		{name: "pkg not a string", data: "[t]\npkg = 1", wantErr: "web.toml:1: t: pkg: must be a string"},
+		{name: "alias not a string", data: "[t]\nalias = [\"u\"]", wantErr: "web.toml:1: t: alias: must be a string"},
+		{name: "desc not a string", data: "[t]\npkg = \"example.com/t@latest\"\ndesc = true", wantErr: "web.toml:1: t: desc: must be a string"},
+		{name: "post not a string", data: "[t]\npkg = \"example.com/t@latest\"\npost = [\"echo\"]", wantErr: "web.toml:1: t: post: must be a string"},
+		{name: "ldflags not a string", data: "[t]\npkg = \"example.com/t@latest\"\nldflags = [\"-s\"]", wantErr: "web.toml:1: t: ldflags: must be a string"},
+		{name: "deprecated not a string", data: "[t]\npkg = \"example.com/t@latest\"\ndeprecated = true", wantErr: "web.toml:1: t: deprecated: must be a string"},
+		{name: "tags not an array", data: "[t]\npkg = \"example.com/t@latest\"\ntags = \"web\"", wantErr: "web.toml:1: t: tags: must be an array of strings"},
+		{name: "bad tag", data: "[t]\npkg = \"example.com/t@latest\"\ntags = [\"a b\"]", wantErr: `web.toml:1: t: tags: bad tag: "a b"`},
+		{name: "args not strings", data: "[t]\npkg = \"example.com/t@latest\"\nargs = [\"-v\", 1]", wantErr: "web.toml:1: t: args: must be an array of strings"},
+		{name: "env not a table", data: "[t]\npkg = \"example.com/t@latest\"\nenv = [\"X=1\"]", wantErr: "web.toml:1: t: env: must be a table of variables, such as { CGO_ENABLED = \"0\" }"},
+		{name: "env not a string", data: "[t]\npkg = \"example.com/t@latest\"\nenv = { X = 1 }", wantErr: "web.toml:1: t: env: X: must be a string"},
+		{name: "bad env name", data: "[t]\npkg = \"example.com/t@latest\"\nenv = { \"A B\" = \"1\" }", wantErr: `web.toml:1: t: env: bad variable: "A B=1" (must be KEY=value)`},
+		{name: "env name with =", data: "[t]\npkg = \"example.com/t@latest\"\nbuild-env = { \"A=B\" = \"1\" }", wantErr: `web.toml:1: t: build-env: bad variable name: "A=B"`},
+		{name: "bad build tag", data: "[t]\npkg = \"example.com/t@latest\"\nbuild-tags = [\"a,b\"]", wantErr: `web.toml:1: t: build-tags: bad value: "a,b"`},
+		{name: "empty goos", data: "[t]\npkg = \"example.com/t@latest\"\ngoos = [\"\"]", wantErr: `web.toml:1: t: goos: bad value: ""`},
+		{name: "bad goarch", data: "[t]\npkg = \"example.com/t@latest\"\ngoarch = [\"arm 64\"]", wantErr: `web.toml:1: t: goarch: bad value: "arm 64"`},
+		{name: "bad replaced-by", data: "[t]\npkg = \"example.com/t@latest\"\nreplaced-by = \"u@v1\"", wantErr: `web.toml:1: t: replaced-by: bad short name: "u@v1"`},
+		{name: "bad TOML", data: "[t]\npkg = \"example.com/t@latest\n", wantErr: "web.toml: line 2: unterminated string"},
+	} {
+		_, err := readTOMLList(strings.NewReader(tt.data), "web.toml", "web/", nil)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+			t.Errorf("%s: readTOMLList error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestScanTOMLListReportsBad(t *testing.T) {
+	const data = `[good]
+pkg = "example.com/good@latest"
+
+[bad]
+pkg = "example.com/bad@latest"
+colour = "red"
+
+[worse]
+desc = "no package"
+`
+	var reported []string
+	bad := func(file string, line int, err error) {
+		reported = append(reported, fmt.Sprintf("%s:%d: %v", file, line, err))
+	}
+	links, err := scanTOMLList(strings.NewReader(data), "team.toml", "", nil, bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Short != "good" {
+		t.Errorf("scanTOMLList = %+v, want only good", links)
+	}
+	want := []string{"team.toml:4: bad: unknown field: colour", "team.toml:8: worse: missing pkg, or alias"}
+	if !reflect.DeepEqual(reported, want) {
+		t.Errorf("reported %q, want %q", reported, want)
+	}
+
+	// A file which is not TOML at all is reported on the line it breaks.
+	reported = nil
+	links, err = scanTOMLList(strings.NewReader("[good]\npkg = \"example.com/good@latest\"\n[oops\n"), "team.toml", "", nil, bad)
+	if err != nil || links != nil {
+		t.Errorf("scanTOMLList = %v, %v, want nothing", links, err)
+	}
+	if want := []string{`team.toml:3: expected "]" after table name`}; !reflect.DeepEqual(reported, want) {
+		t.Errorf("reported %q, want %q", reported, want)
+	}
+}
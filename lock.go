@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// errLocked is returned by tryLock when the lock is held elsewhere.
+var errLocked = errors.New("locked")
+
+// lockPoll is how often an unavailable lock is retried.
+const lockPoll = 100 * time.Millisecond
+
+// lock takes an exclusive lock on the file, creating it if needed, waiting
+// until the lock is available or the context ends. If the lock is not
+// immediately available, waiting is called once before waiting begins.
+func lock(ctx context.Context, name string, waiting func()) (*os.File, error) {
+	notified := false
+	for {
+		f, err := tryLock(name)
+		if !errors.Is(err, errLocked) {
+			return f, err
+		}
+		if !notified && waiting != nil {
+			waiting()
+			notified = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+}
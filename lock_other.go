@@ -0,0 +1,33 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// staleLock is how old a lock file must be before it is assumed to have been
+// left behind by a va which died while holding it.
+const staleLock = time.Hour
+
+// tryLock attempts to take an exclusive lock on the file, without waiting.
+// Without advisory locks, the lock is the existence of the file itself.
+func tryLock(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(name)
+		}
+		return nil, errLocked
+	}
+	return f, err
+}
+
+// unlock releases a lock taken by tryLock.
+func unlock(f *os.File) error {
+	f.Close()
+	return os.Remove(f.Name())
+}
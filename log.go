@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// logLevel is how much va says about what it is doing.
+type logLevel int
+
+const (
+	logError   logLevel = iota // Why va failed, which is always said.
+	logWarn                    // Things which went wrong, but not badly enough to stop.
+	logInfo                    // Things worth knowing, such as waiting for another build.
+	logVerbose                 // What va is doing, step by step.
+	logDebug                   // Everything, including every command va runs.
+)
+
+// logLevelNames are the names of the levels, as given to --log-level and
+// written in JSON logs.
+var logLevelNames = map[logLevel]string{
+	logError:   "error",
+	logWarn:    "warn",
+	logInfo:    "info",
+	logVerbose: "verbose",
+	logDebug:   "debug",
+}
+
+// logColors are the colors of the prefix of each level, when logged as
+// text.
+var logColors = map[logLevel]color{
+	logError:   colorRed,
+	logWarn:    colorYellow,
+	logInfo:    colorBold,
+	logVerbose: colorDim,
+	logDebug:   colorDim,
+}
+
+// logVerbosities are the verbosities which may be given to --log-level, and
+// the most detailed level each logs.
+var logVerbosities = map[string]logLevel{
+	"quiet":   logError,
+	"normal":  logInfo,
+	"verbose": logVerbose,
+	"debug":   logDebug,
+}
+
+var (
+	flagLogLevel  = flag.String("log-level", envOr("VA_LOG_LEVEL", "normal"), "how much to say: \"quiet\" (errors only), \"normal\", \"verbose\", or \"debug\" (or set $VA_LOG_LEVEL)")
+	flagLogFormat = flag.String("log-format", envOr("VA_LOG_FORMAT", "text"), "format of what va says: \"text\", or \"json\" for one object per line (or set $VA_LOG_FORMAT)")
+)
+
+// logger is where va says what it is doing, which is always stderr, so that
+// it is never mixed up with the output of va or the tools it runs.
+var logger = struct {
+	sync.Mutex
+	level logLevel
+	json  bool
+	out   io.Writer
+
+	// progress is the progress line being shown on stderr, if any, which
+	// is cleared before logging and redrawn afterwards.
+	progress string
+}{level: logInfo, out: os.Stderr}
+
+// setupLogging configures the logger from the flags.
+func setupLogging() error {
+	level, ok := logVerbosities[*flagLogLevel]
+	if !ok {
+		return fmt.Errorf("unknown log level: %s", *flagLogLevel)
+	}
+	var asJSON bool
+	switch *flagLogFormat {
+	case "text":
+	case "json":
+		asJSON = true
+	default:
+		return fmt.Errorf("unknown log format: %s", *flagLogFormat)
+	}
+	logger.Lock()
+	defer logger.Unlock()
+	logger.level, logger.json = level, asJSON
+	return nil
+}
+
+// logging reports whether messages at the level are logged.
+func logging(level logLevel) bool {
+	logger.Lock()
+	defer logger.Unlock()
+	return level <= logger.level
+}
+
+// logf logs the message at the level, if that level is being logged.
+func logf(level logLevel, format string, args ...interface{}) {
+	logger.Lock()
+	defer logger.Unlock()
+	if level > logger.level {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if logger.progress != "" {
+		fmt.Fprint(logger.out, "\r\x1b[K")
+		defer fmt.Fprint(logger.out, logger.progress)
+	}
+	if !logger.json {
+		fmt.Fprintf(logger.out, "%s %s\n", paint(useColor(logger.out), logColors[level], "va:"), msg)
+		return
+	}
+	b, err := json.Marshal(struct {
+		Time  time.Time `json:"time"`
+		Level string    `json:"level"`
+		Msg   string    `json:"msg"`
+	}{time.Now(), logLevelNames[level], msg})
+	if err != nil {
+		return
+	}
+	logger.out.Write(append(b, '\n'))
+}
+
+// logErrorf logs why va failed.
+func logErrorf(format string, args ...interface{}) { logf(logError, format, args...) }
+
+// logWarnf logs something which went wrong, but not badly enough to stop.
+func logWarnf(format string, args ...interface{}) { logf(logWarn, format, args...) }
+
+// logInfof logs something worth knowing.
+func logInfof(format string, args ...interface{}) { logf(logInfo, format, args...) }
+
+// logVerbosef logs a step of what va is doing.
+func logVerbosef(format string, args ...interface{}) { logf(logVerbose, format, args...) }
+
+// logDebugf logs the finest details of what va is doing.
+func logDebugf(format string, args ...interface{}) { logf(logDebug, format, args...) }
+
+// logCommand logs the external command about to be run.
+func logCommand(cmd *exec.Cmd) {
+	if logging(logDebug) {
+		if cmd.Dir != "" {
+			logDebugf("exec: cd %s && %s", cmd.Dir, cmd)
+		} else {
+			logDebugf("exec: %s", cmd)
+		}
+	}
+}
+
+// envBool returns the value of the environment variable as a boolean, such
+// as "1" or "true", or def if it is not set. A value strconv.ParseBool does
+// not take to be a boolean is warned of, and def used instead.
+func envBool(name string, def bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		logWarnf("ignoring $%s=%s, which is neither true nor false", name, v)
+		return def
+	}
+	return on
+}
+
+// envOr returns the value of the environment variable, or def if it is not
+// set.
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
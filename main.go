@@ -1,229 +1,693 @@
 package main
 
 import (
-	"bufio"
-	"embed"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
-	"os/exec"
-	"regexp"
+	"path/filepath"
 	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
+)
 
-	"golang.org/x/mod/module"
+var (
+	flagTimeout        = flag.Duration("timeout", 0, "maximum time to spend downloading and building the tool (0 is unlimited)")
+	flagToolTimeout    = flag.Duration("tool-timeout", toolTimeout(), "maximum time the tool may run for before it and its process group are stopped, exiting with 124, as is its post-run hook after the same time (0 is unlimited, or set $VA_TOOL_TIMEOUT)")
+	flagArgsFile       = flag.String("args-file", "", "file of arguments for the tool, one per line, which come before any given after the tool")
+	flagChdir          = flag.String("chdir", "", "directory to run the tool in, instead of the current one")
+	flagDefaultVersion = flag.String("default-version", os.Getenv("VA_DEFAULT_VERSION"), "version to run a package path given without one at, such as \"latest\", instead of it being an error (or set $VA_DEFAULT_VERSION)")
+	flagDryRun         = flag.Bool("dry-run", false, "print what running the tool would download, build, and run, without doing any of it")
+	flagExplain        = flag.Bool("explain", false, "print how the tool is resolved, step by step, instead of running it")
+	flagFuzzy          = flag.Bool("fuzzy", envBool("VA_FUZZY", false), "let unambiguous abbreviations stand for short names, e.g. \"sc\" for \"staticcheck\", asking which was meant if there is more than one (or set $VA_FUZZY)")
+	flagKeep           = flag.Bool("keep", false, "keep a copy of the built tool in the current directory, as well as running it")
+	flagMemfd          = flag.Bool("memfd", envBool("VA_MEMFD", false), "run the tool from an anonymous in-memory file, so that it never runs from disk (Linux only, or set $VA_MEMFD)")
+	flagNoDefaultArgs  = flag.Bool("no-default-args", false, "run the tool with only the arguments given, without the default arguments of its link")
+	flagNoRetracted    = flag.Bool("no-retracted", false, "run the newest version which has not been retracted, instead of a retracted one")
+	flagOffline        = flag.Bool("offline", envBool("VA_OFFLINE", false), "only run tools whose modules or binaries are already cached, never going online (or set $VA_OFFLINE)")
+	flagOutput         = flag.String("output", "", "write a copy of the built tool to the file, or into the directory, as well as running it")
+	flagProxy          = flag.String("proxy", os.Getenv("VA_PROXY"), "comma-separated module proxies to try in order, e.g. \"https://goproxy.example.com,https://proxy.golang.org,direct\" (or set $VA_PROXY)")
+	flagRefresh        = flag.Bool("refresh", false, "resolve version queries such as \"latest\" again, even if they were resolved recently")
+	flagRetries        = flag.Int("retries", retryPolicy.Retries, "times to retry downloads which fail for reasons that may be transient (or set $VA_RETRIES)")
+	flagReproducible   = flag.Bool("reproducible", reproducibleDefault(), "build binaries which are identical wherever they are built, with -trimpath (or set $VA_REPRODUCIBLE=0 to disable)")
+	flagResolveTTL     = flag.Duration("resolve-ttl", resolveTTL(), "how long resolved version queries such as \"latest\" are reused for (or set $VA_RESOLVE_TTL)")
+	flagShowBuildCmd   = flag.Bool("show-build-cmd", false, "print the command which would build the tool, instead of building and running it")
+	flagStatic         = flag.Bool("static", false, "build a statically linked binary, with cgo disabled unless CGO_ENABLED=1 is set")
+	flagVerboseBuild   = flag.Bool("verbose-build", false, "show the output of building the tool, even if the build succeeds")
+	flagVerify         = flag.Bool("verify", envBool("VA_VERIFY", false), "check the SHA-256 of a cached tool before running it (or set $VA_VERIFY)")
+	flagWrap           = flag.String("wrap", os.Getenv("VA_WRAP"), "command to run the tool under, e.g. \"strace -f\" (or set $VA_WRAP)")
 )
 
+// started is when va started, for measuring how long it keeps a tool
+// waiting.
+var started = time.Now()
+
 func main() {
-	// Convert embedded lists into links.
-	links, err := fsToLinks(listfs)
+	flag.Usage = printUsage
+
+	// The configuration file sets the defaults of flags, so it is read
+	// before they are parsed.
+	if err := loadConfig(); err != nil {
+		logErrorf("%v", err)
+		exit(2)
+	}
+
+	// Run through a link named after a short name, as busybox is, va runs
+	// that tool, and every argument is the tool's rather than va's.
+	args := os.Args[1:]
+	calledAs, links := calledAs(os.Args[0])
+	if calledAs == "" {
+		var err error
+		args, err = parseFlags(flag.CommandLine, args)
+		switch {
+		case errors.Is(err, flag.ErrHelp):
+			flag.Usage()
+			exit(0)
+		case err != nil:
+			logErrorf("%v", err)
+			exit(2)
+		}
+	} else {
+		args = append([]string{calledAs}, args...)
+	}
+	for _, check := range []func() error{checkColor, checkProgress, setupLogging, checkChdir, checkEmbeddedLists} {
+		if err := check(); err != nil {
+			logErrorf("%v", err)
+			exit(2)
+		}
+	}
+	if err := startProfiling(); err != nil {
+		logErrorf("profile: %v", err)
+		exit(1)
+	}
+	startRootSpan(args)
+	retryPolicy.Retries = *flagRetries
+	if *flagOffline {
+		if err := goOffline(); err != nil {
+			logErrorf("offline: %v", err)
+			exit(1)
+		}
+	} else if err := useProxyChain(*flagProxy); err != nil {
+		logErrorf("proxy: %v", err)
+		exit(1)
+	}
+
+	// Convert the lists into links, unless they already were to find the
+	// link va was run as, in which case no flags were parsed to change them.
+	var err error
+	if links == nil {
+		links, err = loadLinks(linkSources())
+	}
+	if err == nil {
+		err = applyOverrides(links)
+	}
+	if err == nil {
+		err = resolveAliases(links)
+	}
+	// va lint-lists reports every problem with the lists itself, so the
+	// first must not stop it from starting.
+	linting := len(args) > 0 && calledAs == "" && args[0] == "lint-lists"
+	switch {
+	case err != nil && !linting:
+		logErrorf("%v", err)
+		exit(1)
+	case !linting:
+		warnOverrides(links)
+	}
+
+	name, run := "", runSingle
+	if calledAs == "" {
+		name, run, args = selectCommand(args)
+	}
+	if err := run(links, args); err != nil {
+		var status exitError
+		switch {
+		case errors.As(err, &status):
+			exit(int(status))
+		case errors.Is(err, flag.ErrHelp):
+			exit(0)
+		case name == "":
+			logErrorf("%v", err)
+		default:
+			logErrorf("%s: %v", name, err)
+		}
+		exit(1)
+	}
+	exit(0)
+}
+
+// parseFlags parses the flags of va, which all come before the tool, and
+// returns the arguments after them. Parsing stops at the tool, or at "--",
+// so every argument after the tool is the tool's, even if it looks like one
+// of va's flags. A flag va does not know is most likely meant for the tool,
+// so the error says where such flags go.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	out := fs.Output()
+	fs.Init(fs.Name(), flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args)
+	fs.SetOutput(out)
+	if err != nil && strings.HasPrefix(err.Error(), "flag provided but not defined") {
+		return nil, fmt.Errorf("%w (flags for the tool go after it: va [flags] <tool> [--] [args...])", err)
+	}
+	return fs.Args(), err
+}
+
+// selectCommand returns the command given by the first of the arguments,
+// and the arguments for it. Commands take precedence over any path of the
+// same name. Anything else is a tool to run, as if "run" had been given
+// first, in which case a "--" straight after the tool only separates it
+// from its arguments.
+func selectCommand(args []string) (name string, run func(links map[string]Link, args []string) error, _ []string) {
+	if len(args) == 0 {
+		return "", runSingle, args
+	}
+	if cmd, ok := commands[args[0]]; ok {
+		return args[0], cmd.run, args[1:]
+	}
+	if len(args) > 1 && args[1] == "--" {
+		args = append(args[:1:1], args[2:]...)
+	}
+	return "", runSingle, args
+}
+
+// checkChdir checks the directory the tool is to be run in, if one is given,
+// is a directory.
+func checkChdir() error {
+	if *flagChdir == "" {
+		return nil
+	}
+	fi, err := os.Stat(*flagChdir)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("chdir: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("chdir: %s is not a directory", *flagChdir)
+	}
+	return nil
+}
+
+// printUsage prints how to use va, including its commands and flags.
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprint(out, "Usage: va [flags] <path|short>[@version] [--] [args...]\n"+
+		"       va [flags] run <path|short>[@version]... -- [args...]\n"+
+		"       va [flags] <command> [args...]\n\n"+
+		"Commands:\n\n")
+	names := make([]string, 0, len(commands))
+	for name, cmd := range commands {
+		if cmd.summary != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(out, 1, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%s\n", name, commands[name].summary)
 	}
+	w.Flush()
+	fmt.Fprint(out, "\nRun \"va help <command>\" for more about a command.\n\nFlags:\n\n")
+	printDefaults()
+}
 
+// runSingle downloads, builds, and runs the tool given by the first
+// argument, with the rest of the arguments. This is what va does unless it
+// is given a command.
+func runSingle(links map[string]Link, args []string) error {
 	// If no path is provided, print registered links.
-	if len(os.Args) < 2 {
-		fmt.Fprint(os.Stderr, "ERROR: No supplied path.\n\n")
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, paint(useColor(os.Stderr), colorRed, "ERROR: No supplied path.")+"\n\n")
 		fmt.Fprint(os.Stderr, "Registered short paths:\n\n")
-		w := tabwriter.NewWriter(os.Stderr, 1, 4, 2, ' ', 0)
-		keys := make([]string, 0, len(links))
-		for k := range links {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		for _, k := range keys {
-			desc := links[k].Desc
-			if desc != "" {
-				// Make descriptions prettier.
-				desc = "(" + desc + ")"
-			}
-			fmt.Fprintf(w, "%s\t=>\t%s %s\n", links[k].Short, links[k].Pkg, desc)
-		}
-		w.Flush()
+		printLinks(os.Stderr, linksByFrecency(links), false)
 		fmt.Fprint(os.Stderr, "\n")
-		os.Exit(1)
+		return exitError(1)
 	}
 
-	// Lookup the path to see if it is a shortened link.
-	mod := os.Args[1]
-	modPath := strings.Split(mod, "@")
-	if link, ok := links[modPath[0]]; ok {
-		modLink := strings.Split(link.Pkg, "@")
-		modPath[0] = modLink[0]
-		// No version specified? Take the version from the link. The
-		// user-specified version is always preferred over the
-		// version specified in the shortened version.
-		if len(modPath) == 1 {
-			modPath = append(modPath, modLink[1])
-		}
+	// Lookup the path to see if it is a shortened link, and whether that
+	// link is deprecated, or for another system.
+	args[0] = followDeprecation(links, args[0])
+	warnUnsupported(links, args[0])
+	mod, link, _ := expandLink(links, args[0])
+
+	toolArgs, err := withArgsFile(args[1:])
+	if err != nil {
+		return err
+	}
+
+	// Split the wrapper command up now, so that a mistake is found before
+	// any time is spent downloading and building.
+	wrap, err := splitFields(*flagWrap)
+	if err != nil {
+		return fmt.Errorf("wrap: %w", err)
 	}
-	mod = strings.Join(modPath, "@")
 
 	// Ensure we actually have a valid module path.
-	if !validateMod(mod) {
-		fmt.Fprintf(os.Stderr, "invalid pkg: %s (must be path@version)\n", mod)
-		os.Exit(1)
-	}
-
-	// Construct the command line, and run it.
-	run := []string{"run", mod}
-	run = append(run, os.Args[2:]...)
-	cmdRun := exec.Command("go", run...)
-	cmdRun.Stdin, cmdRun.Stdout, cmdRun.Stderr = os.Stdin, os.Stdout, os.Stderr
-	if err := cmdRun.Run(); err == nil {
-		// Everything ran fine, so quit now.
-		// Using "go run" masks the exit code of the application
-		// so we are fine just stomping over it with "0" here.
-		os.Exit(0)
-	}
-
-	// If we got this far, using "go run" did not work, but we are not
-	// ready to give up just yet! We shall download the module, build it,
-	// and then run it in a temporary location.
-	fmt.Fprintf(os.Stderr, "\nva: Using \"go run\" failed, trying fallback mechanism.\n\n")
-	toolDir, err := Download(mod)
+	if err := checkTool(links, mod); err != nil {
+		return err
+	}
+
+	switch {
+	case *flagExplain:
+		return explain(rootCtx, os.Stdout, links, args[0])
+	case *flagDryRun:
+		return dryRun(rootCtx, os.Stdout, links, args[0], wrap, toolArgs)
+	}
+
+	// Clean up after any earlier run which was killed while running a
+	// temporary build of its tool. This costs nothing if there are none.
+	if _, err := sweepTemps(); err != nil {
+		logWarnf("clean: %v", err)
+	}
+
+	// Prepare the cache up front, so that any cache left behind by another
+	// version of va is dealt with before anything could misread it. The
+	// cache is an optimisation, so a broken one is not fatal.
+	cacheDir, err := OpenCache()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "va: download: %v\n", err)
-		os.Exit(1)
+		logWarnf("cache: %v", err)
+	} else {
+		UseGoEnvCache(cacheDir)
+	}
+
+	// Download and build the tool, bounded by the timeout if one was
+	// requested. This deliberately does not use "go run", as that would
+	// make it impossible to bound the build without also bounding the
+	// tool itself.
+	buildCtx, cancel := withTimeout(rootCtx, *flagTimeout)
+	defer cancel()
+	buildOpts := linkBuildOptions(link)
+	if *flagShowBuildCmd {
+		m, err := resolveTool(buildCtx, cacheDir, mod)
+		if err != nil {
+			return err
+		}
+		output, err := buildOutput(buildCtx, cacheDir, m, buildOpts)
+		if err != nil {
+			return fmt.Errorf("show-build-cmd: %w", err)
+		}
+		fmt.Println(NewBuildCommand(m.ToolDir(), output, buildOpts))
+		return nil
+	}
+	if err := checkTrust(cacheDir, link, mod); err != nil {
+		return err
 	}
-	tool, err := Build(toolDir)
+	buildCtx, buildRec := withBuildRecord(buildCtx)
+	run := RunRecord{Short: link.Short, Tool: mod, Args: toolArgs, ExitCode: -1}
+	tool, temp, err := prepareTool(buildCtx, cacheDir, mod, buildOpts)
+	run.Start = time.Now()
+	run.Prepare, run.Built = time.Since(started), buildRec.Download > 0 || buildRec.Build > 0
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "va: build: %v\n", err)
-		os.Exit(1)
+		recordRun(cacheDir, run)
+		return err
+	}
+	cancel()
+	if err := keepTool(tool, mod); err != nil {
+		if temp {
+			removeTemp(tool)
+		}
+		return fmt.Errorf("output: %w", err)
 	}
-	defer os.Remove(tool) // Remove the binary once we are done with it.
 
-	// Run the freshly built binary.
-	cmd := exec.Command(tool, os.Args[2:]...)
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
-	if err := cmd.Run(); err != nil {
-		if _, ok := err.(*exec.ExitError); !ok {
-			fmt.Fprintf(os.Stderr, "va: built: %v\n", err)
-			os.Exit(cmd.ProcessState.ExitCode())
+	// Garbage collect the cache in the background while the tool runs,
+	// taking care not to evict the tool itself.
+	gcDone := make(chan struct{})
+	go func() {
+		defer close(gcDone)
+		if temp {
+			return
+		}
+		if err := autoGC(cacheDir, filepath.Base(filepath.Dir(tool))); err != nil {
+			logWarnf("cache gc: %v", err)
 		}
+	}()
+
+	// Remote lists which are due to be fetched again are fetched while the
+	// tool runs too, for later runs, as this one has already read them. A
+	// fetch still going once the tool exits is abandoned.
+	go refreshSubscriptions(rootCtx, cacheDir)
+
+	exitCode := runTool(link, wrap, tool, toolArgs, temp)
+	run.ExitCode, run.Duration = exitCode, time.Since(run.Start)
+	recordRun(cacheDir, run)
+	<-gcDone
+	if exitCode != 0 {
+		return exitError(exitCode)
 	}
+	return nil
 }
 
-// Link defines a shortened link.
-type Link struct {
-	Short string
-	Pkg   string
-	Desc  string
+// keepTool copies the tool to where --output or --keep say to keep it, if
+// they do. A directory is kept in under the name the go command would give
+// the binary.
+func keepTool(tool, mod string) error {
+	dest := *flagOutput
+	if dest == "" && !*flagKeep {
+		return nil
+	}
+	pkgPath, _, _ := strings.Cut(mod, "@")
+	if dest == "" {
+		dest = toolName(pkgPath)
+	} else if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		dest = filepath.Join(dest, toolName(pkgPath))
+	}
+	if err := copyExecutable(tool, dest); err != nil {
+		return err
+	}
+	logInfof("kept %s as %s", pkgPath, dest)
+	return nil
 }
 
-//go:embed lists/*.list
-var listfs embed.FS
+// buildOptions returns the options for building tools given by the flags.
+func buildOptions() BuildOptions {
+	return BuildOptions{
+		Static:       *flagStatic,
+		Reproducible: *flagReproducible,
+		Verbose:      *flagVerboseBuild,
+	}
+}
 
-// fsToLinks converts an embedded filesystem into a map of shortened links.
-func fsToLinks(f fs.FS) (map[string]Link, error) {
-	links := make(map[string]Link)
+// linkBuildOptions returns the options for building the tool of the link:
+// those given by the flags, along with those the link asks for.
+func linkBuildOptions(link Link) BuildOptions {
+	opts := buildOptions()
+	opts.Env = linkEnv(link.BuildEnv)
+	opts.Tags, opts.Ldflags = link.BuildTags, link.Ldflags
+	return opts
+}
 
-	fsWalker := func(path string, d fs.DirEntry, errWalker error) error {
-		// Skip directories, needs to be a file.
-		if d.IsDir() {
-			return nil
+// linkEnv returns the environment variables of a link which are not already
+// set in va's environment, since those which are take precedence.
+func linkEnv(env []string) []string {
+	var unset []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := os.LookupEnv(name); !ok {
+			unset = append(unset, kv)
 		}
+	}
+	return unset
+}
 
-		// Strip the embedded filesystem prefix and extension suffix.
-		name := strings.TrimPrefix(path, "lists/")
-		if !strings.HasSuffix(name, ".list") {
-			// If the suffix is not present, skip over the file.
-			return nil
-		}
-		name = strings.TrimSuffix(name, ".list")
+// reproducibleDefault reports whether builds are reproducible unless the
+// --reproducible flag says otherwise, which they are unless turned off with
+// $VA_REPRODUCIBLE.
+func reproducibleDefault() bool {
+	return envBool("VA_REPRODUCIBLE", true)
+}
 
-		if name == "_" {
-			// "_" is a special name meaning "no prefix".
-			name = ""
-		} else {
-			// otherwise, use the filename as the prefix.
-			name = name + "/"
+// resolveTool resolves the version of the tool, which may be a query such as
+// "latest", and downloads the module containing it.
+func resolveTool(ctx context.Context, cacheDir, mod string) (Module, error) {
+	resolved := mod
+	if !*flagRefresh {
+		resolved = lookupResolution(cacheDir, mod, *flagResolveTTL)
+	}
+	m, err := Download(ctx, resolved)
+	if err != nil {
+		return Module{}, fmt.Errorf("download: %w", err)
+	}
+	if err := recordResolution(cacheDir, resolved, m.Version); err != nil {
+		logWarnf("cache: %v", err)
+	}
+	m, err = checkRetracted(ctx, m, *flagNoRetracted)
+	if err != nil {
+		return Module{}, fmt.Errorf("retracted: %w", err)
+	}
+	return m, nil
+}
+
+// prepareTool returns the path to the tool, ready to run, downloading and
+// building it if need be. If temp is set, the tool was built into a
+// temporary file, which the caller must remove.
+//
+// Most of the time the tool has been built before, in which case it is run
+// straight from the cache without starting the go command at all, so that va
+// adds as little as possible to the time the tool takes to run. Checking for
+// retractions needs the go command, so it is only done when the tool is
+// first built, unless asked for.
+func prepareTool(ctx context.Context, cacheDir, mod string, opts BuildOptions) (tool string, temp bool, err error) {
+	emitEvent(progressEvent{Event: "resolve-start", Tool: mod})
+	if cacheDir != "" && !*flagNoRetracted {
+		_, end := startSpan(ctx, "resolve", "va.tool", mod)
+		resolved := mod
+		if !*flagRefresh {
+			resolved = lookupResolution(cacheDir, mod, *flagResolveTTL)
+		}
+		tool, ok := FindCachedTool(ctx, cacheDir, resolved, opts)
+		end(nil)
+		if ok {
+			logVerbosef("%s is already built, as %s", resolved, tool)
+			return tool, false, verifyTool(tool)
+		}
+	}
+	rec := buildRecordFrom(ctx)
+	if rec == nil {
+		ctx, rec = withBuildRecord(ctx)
+	}
+	m, err := resolveTool(ctx, cacheDir, mod)
+	if err != nil {
+		return "", false, err
+	}
+	logVerbosef("building %s@%s", m.ToolPath(), m.Version)
+	tool, temp, err = buildTool(ctx, cacheDir, m, opts)
+	if err != nil {
+		return "", false, fmt.Errorf("build: %w", err)
+	}
+	if rec.Build > 0 {
+		logVerbosef("built %s@%s in %v", m.ToolPath(), m.Version, rec.Build.Round(time.Millisecond))
+	}
+	if cacheDir != "" && rec.Build > 0 {
+		rec.Tool, rec.Version, rec.Time = m.ToolPath(), m.Version, time.Now()
+		if err := recordBuild(cacheDir, *rec); err != nil {
+			logWarnf("cache: %v", err)
 		}
+	}
+	if !temp {
+		err = verifyTool(tool)
+	}
+	return tool, temp, err
+}
+
+// verifyTool checks the cached tool has not been modified since it was
+// built, if asked to.
+func verifyTool(tool string) error {
+	if !*flagVerify {
+		return nil
+	}
+	if err := verifyEntry(filepath.Dir(tool)); err != nil {
+		return fmt.Errorf("verify: %s: %w", tool, err)
+	}
+	return nil
+}
 
-		// Read the file to get the shortenings.
-		list, err := f.Open(path)
+// runTool runs the tool, followed by the post-run hook of the link, and
+// returns the exit code of the tool. The tool is only bounded by a timeout
+// if explicitly asked for, since many tools (servers, watchers, etc.) are
+// expected to run indefinitely. If temp is set, the tool is removed once it
+// has finished.
+//
+// If asked to, the tool is first copied into memory and run from there, so
+// a temporary build is removed before the tool runs. This also allows tools
+// to run on machines whose temporary directory is mounted noexec.
+func runTool(link Link, wrap []string, tool string, args []string, temp bool) int {
+	var mem *os.File
+	if *flagMemfd {
+		f, err := loadMemfd(tool)
+		if temp {
+			removeTemp(tool)
+			temp = false
+		}
 		if err != nil {
-			return err
+			logErrorf("memfd: %v", err)
+			return 1
 		}
-		defer list.Close()
-		scanner := bufio.NewScanner(list)
-		for scanner.Scan() {
-			link, err := lineToLink(scanner.Text())
-			if err != nil {
-				return err
-			}
+		defer f.Close()
+		mem = f
+	}
 
-			// Skip empty links.
-			if link == (Link{}) {
-				continue
-			}
+	toolCtx, cancel := withTimeout(rootCtx, *flagToolTimeout)
+	exitCode, err := Run(toolCtx, wrap, tool, defaultArgs(link, args), linkEnv(link.Env), mem)
+	cancel()
+	postRun(link, exitCode)
+	if temp {
+		removeTemp(tool) // Remove the binary once we are done with it.
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		logErrorf("run: %v", err)
+		exitCode = exitTimeout
+	case err != nil:
+		logErrorf("run: %v", err)
+		if exitCode < 0 {
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
 
-			// Rewrite the short name with any prefix.
-			link.Short = name + link.Short
+// withArgsFile returns the arguments in the --args-file, if there is one,
+// followed by those given. Arguments from a file come before those given on
+// the command line, so that the command line can add to, or override, those
+// in the file.
+func withArgsFile(args []string) ([]string, error) {
+	if *flagArgsFile == "" {
+		return args, nil
+	}
+	fileArgs, err := ReadArgsFile(*flagArgsFile)
+	if err != nil {
+		return nil, fmt.Errorf("args-file: %w", err)
+	}
+	return append(fileArgs, args...), nil
+}
 
-			// Ensure the link has not already been seen, then add it.
-			if _, ok := links[link.Short]; ok {
-				return fmt.Errorf("link %s already exists, file: %s", link.Short, path)
-			}
-			links[link.Short] = link
-		}
-		return nil
+// defaultArgs returns the arguments to run the tool of the link with: the
+// default arguments of the link, unless --no-default-args is set, followed by
+// those given.
+func defaultArgs(link Link, args []string) []string {
+	if *flagNoDefaultArgs || len(link.Args) == 0 {
+		return args
 	}
+	return append(link.Args[:len(link.Args):len(link.Args)], args...)
+}
 
-	if err := fs.WalkDir(f, ".", fsWalker); err != nil {
-		return links, err
+// exitTimeout is the exit code of va when the tool runs for longer than
+// --tool-timeout, which is the exit code timeout(1) uses too.
+const exitTimeout = 124
+
+// toolTimeout returns the default for --tool-timeout, from $VA_TOOL_TIMEOUT.
+func toolTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("VA_TOOL_TIMEOUT"))
+	if err != nil {
+		return 0
 	}
-	return links, nil
+	return timeout
 }
 
-// lineToLink converts a line of text into a Link.
-func lineToLink(line string) (Link, error) {
-	if strings.HasPrefix(line, "#") {
-		// Ignore line, it is a comment.
-		return Link{}, nil
+// buildTool returns the path to the built tool, which is cached so that it
+// only needs building once. Without a cache directory, the tool is instead
+// built into a temporary file, which the caller must remove.
+func buildTool(ctx context.Context, cacheDir string, m Module, opts BuildOptions) (tool string, temp bool, err error) {
+	if cacheDir != "" {
+		env, err := ReadGoEnv(ctx)
+		if err != nil {
+			return "", false, err
+		}
+		remote, err := remoteCacheFromEnv()
+		if err != nil {
+			return "", false, err
+		}
+		tool, err := CachedTool(ctx, cacheDir, remote, m, NewToolKey(m, env, opts))
+		return tool, false, err
 	}
-	split := strings.Split(line, " ")
-	if len(split) < 2 {
-		return Link{}, errors.New("bad line")
+	tool, err = BuildTemp(ctx, m.ToolDir(), opts)
+	return tool, true, err
+}
+
+// buildOutput returns where the tool of the module is built to: its place in
+// the cache, or without a cache, the current directory, which is the most
+// useful place to build to when the command is run by hand.
+func buildOutput(ctx context.Context, cacheDir string, m Module, opts BuildOptions) (string, error) {
+	if cacheDir != "" {
+		env, err := ReadGoEnv(ctx)
+		if err != nil {
+			return "", err
+		}
+		return NewToolKey(m, env, opts).CachePath(cacheDir), nil
 	}
-	short, pkg, desc := split[0], split[1], strings.Join(split[2:], " ")
-	if !validateShort(short) || !validateMod(pkg) {
-		return Link{}, fmt.Errorf("bad module: %s %s", short, pkg)
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
 	}
-	return Link{
-		Short: short,
-		Pkg:   pkg,
-		Desc:  desc,
-	}, nil
+	return filepath.Join(wd, toolName(m.ToolPath())), nil
+}
 
+// printLinks prints the links, in order, along with their tags, and if
+// origin is set, where each is defined, and the definitions it overrides.
+func printLinks(out io.Writer, links []Link, origin bool) error {
+	// Every cell of a column is colored alike, so the escape sequences
+	// do not upset the alignment of the columns.
+	color := useColor(out)
+	w := tabwriter.NewWriter(out, 1, 4, 2, ' ', 0)
+	for _, link := range links {
+		rest := link.Pkg
+		if link.Desc != "" {
+			// Make descriptions prettier.
+			rest += " " + paint(color, colorDim, "("+link.Desc+")")
+		}
+		if len(link.Tags) > 0 {
+			rest += " " + paint(color, colorYellow, "["+strings.Join(link.Tags, ",")+"]")
+		}
+		if link.isDeprecated() {
+			rest += " " + paint(color, colorRed, "["+deprecationNote(link)+"]")
+		}
+		if !link.supported() {
+			rest += " " + paint(color, colorRed, "["+platformNote(link)+"]")
+		}
+		if origin {
+			rest += " " + paint(color, colorDim, "from "+link.Location())
+			for i := len(link.Overrides) - 1; i >= 0; i-- {
+				rest += " " + paint(color, colorYellow, "overriding "+link.Overrides[i])
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", paint(color, colorCyan, link.Short), paint(color, colorDim, "=>"), rest)
+	}
+	return w.Flush()
 }
 
-var (
-	reShort = regexp.MustCompile(`^([0-9A-Za-z]+[0-9A-Za-z_-]*[0-9A-Za-z]+)|([0-9A-Za-z]+)$`)
-)
+// checkRetracted warns if the version of the module has been retracted by its
+// author. If avoid is set, the newest version which has not been retracted is
+// downloaded and returned instead. Retractions are not checked while offline.
+func checkRetracted(ctx context.Context, m Module, avoid bool) (Module, error) {
+	if offline {
+		return m, nil
+	}
+	rationale, err := Retraction(ctx, m.Path, m.Version)
+	if err != nil {
+		// Not being able to check is no reason not to run the tool.
+		logWarnf("unable to check for retraction: %v", err)
+		return m, nil
+	}
+	if len(rationale) == 0 {
+		return m, nil
+	}
+	logWarnf("warning: %s@%s has been retracted: %s", m.Path, m.Version, strings.Join(rationale, "; "))
 
-// validateShort validates a short name, to ensure it starts and ends with an
-// alphanumeric character, and optionally has underscores or dashes in the
-// middle of it.
-func validateShort(short string) bool {
-	return reShort.MatchString(short)
+	latest, err := LatestUnretracted(ctx, m.Path)
+	switch {
+	case err != nil && avoid:
+		return m, err
+	case err != nil:
+		return m, nil
+	case !avoid:
+		logInfof("the newest version which has not been retracted is %s", latest)
+		return m, nil
+	}
+	logInfof("using %s@%s instead", m.Path, latest)
+	return Download(ctx, m.ToolPath()+"@"+latest)
 }
 
-// validateMod takes a module name and ensures it is a valid Go module name.
-func validateMod(mod string) bool {
-	split := strings.Split(mod, "@")
-	if len(split) != 2 {
-		// For module mode, must specify a version.
-		return false
-	}
-	if err := module.CheckPath(split[0]); err != nil {
-		// Must be a valid module path.
-		return false
+// withTimeout returns a context bounded by the timeout, unless the timeout is
+// zero in which case the context is unbounded.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, timeout)
+}
 
-	// LGTM.
-	return true
+// postRun runs the post-run hook of a link, if it has one, reporting rather
+// than acting upon any failure since the tool itself has already run. The
+// hook may run for as long as --tool-timeout lets the tool run.
+func postRun(link Link, exitCode int) {
+	if link.Post == "" {
+		return
+	}
+	ctx, cancel := withTimeout(rootCtx, *flagToolTimeout)
+	defer cancel()
+	if err := RunHook(ctx, link.Post, exitCode); err != nil {
+		logWarnf("post-run hook: %v", err)
+	}
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildOutput(t *testing.T) {
+	ctx := context.Background()
+	m := Module{Path: "github.com/mikefarah/yq/v4", Version: "v4.44.1", Dir: "/mod/yq"}
+	opts := BuildOptions{Reproducible: true}
+
+	// With a cache, the tool is built to where CachedTool keeps it.
+	cacheDir := t.TempDir()
+	env, err := ReadGoEnv(ctx)
+	if err != nil {
+		t.Skip(err)
+	}
+	got, err := buildOutput(ctx, cacheDir, m, opts)
+	if want := NewToolKey(m, env, opts).CachePath(cacheDir); err != nil || got != want {
+		t.Errorf("buildOutput with a cache = %s, %v, want %s", got, err, want)
+	}
+	if filepath.Base(got) != "yq" {
+		t.Errorf("buildOutput with a cache = %s, want the binary named yq", got)
+	}
+
+	// Without one, it is built into the current directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = buildOutput(ctx, "", m, opts)
+	if want := filepath.Join(wd, toolName(m.ToolPath())); err != nil || got != want {
+		t.Errorf("buildOutput without a cache = %s, %v, want %s", got, err, want)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	for _, tt := range []struct {
+		args     []string
+		want     []string
+		wantKeep bool
+		wantErr  string
+	}{
+		{args: []string{"hello", "-v"}, want: []string{"hello", "-v"}},
+		{args: []string{"-keep", "hello", "-v"}, want: []string{"hello", "-v"}, wantKeep: true},
+		{args: []string{"-keep", "hello", "-keep"}, want: []string{"hello", "-keep"}, wantKeep: true},
+		{args: []string{"hello", "--", "-v"}, want: []string{"hello", "--", "-v"}},
+		{args: []string{"-keep", "--", "hello", "-v"}, want: []string{"hello", "-v"}, wantKeep: true},
+		{args: []string{"--", "-v"}, want: []string{"-v"}},
+		{args: []string{"-v", "hello"}, wantErr: "flag provided but not defined: -v (flags for the tool go after it: va [flags] <tool> [--] [args...])"},
+		{args: []string{"-chdir"}, wantErr: "flag needs an argument: -chdir"},
+	} {
+		fs := flag.NewFlagSet("va", flag.ExitOnError)
+		keep := fs.Bool("keep", false, "")
+		fs.String("chdir", "", "")
+		got, err := parseFlags(fs, tt.args)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("parseFlags(%q) = %q, %v, want %q", tt.args, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) || *keep != tt.wantKeep {
+			t.Errorf("parseFlags(%q) = %q, %v, with -keep %v, want %q, with -keep %v", tt.args, got, err, *keep, tt.want, tt.wantKeep)
+		}
+	}
+
+	fs := flag.NewFlagSet("va", flag.ExitOnError)
+	if _, err := parseFlags(fs, []string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("parseFlags(-h) = %v, want %v", err, flag.ErrHelp)
+	}
+}
+
+func TestSelectCommand(t *testing.T) {
+	for _, tt := range []struct {
+		args     []string
+		wantName string
+		want     []string
+	}{
+		{args: nil, want: nil},
+		{args: []string{"hello"}, want: []string{"hello"}},
+		{args: []string{"hello", "-v"}, want: []string{"hello", "-v"}},
+		// A "--" straight after the tool only separates it from its
+		// arguments; any other is the tool's.
+		{args: []string{"hello", "--", "-v"}, want: []string{"hello", "-v"}},
+		{args: []string{"hello", "--", "--", "-v"}, want: []string{"hello", "--", "-v"}},
+		{args: []string{"hello", "-v", "--"}, want: []string{"hello", "-v", "--"}},
+		{args: []string{"hello", "--"}, want: []string{"hello"}},
+		// Commands take precedence over links of the same name, and keep
+		// their arguments as they are.
+		{args: []string{"list", "-v"}, wantName: "list", want: []string{"-v"}},
+		{args: []string{"run", "hello", "--", "-v"}, wantName: "run", want: []string{"hello", "--", "-v"}},
+	} {
+		name, run, got := selectCommand(tt.args)
+		if name != tt.wantName || run == nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("selectCommand(%q) = %q, %q, want %q, %q", tt.args, name, got, tt.wantName, tt.want)
+		}
+	}
+}
+
+func TestSelectCommandShadowsLink(t *testing.T) {
+	t.Setenv("VA_CACHE_DIR", t.TempDir())
+	t.Setenv("VA_STATE_DIR", t.TempDir())
+	// A link named after a command can only be run through "va run".
+	links := map[string]Link{"list": {Short: "list", Pkg: "example.com/list@latest"}}
+	name, run, args := selectCommand([]string{"list", "--json"})
+	if name != "list" {
+		t.Fatalf("selectCommand(list) = %q, want the list command", name)
+	}
+	var err error
+	out := captureStdout(t, func() { err = run(links, args) })
+	if err != nil || !strings.Contains(out, "example.com/list@latest") {
+		t.Errorf("va list --json = %q, %v, want the links listed", out, err)
+	}
+}
+
+func TestReproducibleDefault(t *testing.T) {
+	for _, tt := range []struct {
+		env  string
+		want bool
+	}{
+		{"", true},
+		{"1", true},
+		{"true", true},
+		{"yes", true},
+		{"0", false},
+		{"false", false},
+	} {
+		t.Setenv("VA_REPRODUCIBLE", tt.env)
+		if got := reproducibleDefault(); got != tt.want {
+			t.Errorf("reproducibleDefault with $VA_REPRODUCIBLE=%q = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestEnvBool(t *testing.T) {
+	for _, tt := range []struct {
+		env       string
+		def, want bool
+	}{
+		{"", false, false},
+		{"", true, true},
+		{"1", false, true},
+		{"true", false, true},
+		{"TRUE", false, true},
+		{"0", true, false},
+		{"false", true, false},
+		// Not a boolean, so the default, rather than true for being set.
+		{"no", false, false},
+		{"yes", false, false},
+		{"off", true, true},
+	} {
+		t.Setenv("VA_TEST_BOOL", tt.env)
+		if got := envBool("VA_TEST_BOOL", tt.def); got != tt.want {
+			t.Errorf("envBool with $VA_TEST_BOOL=%q and default %v = %v, want %v", tt.env, tt.def, got, tt.want)
+		}
+	}
+}
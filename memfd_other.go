@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// loadMemfd is only supported on Linux, which has memfd_create.
+func loadMemfd(name string) (*os.File, error) {
+	return nil, errors.New("only supported on Linux")
+}
@@ -1,28 +1,127 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	"golang.org/x/mod/module"
 	"golang.org/x/tools/go/packages"
 )
 
+// Module is a downloaded module, along with where the tool is within it.
+type Module struct {
+	Path    string // Module path, e.g. "example.com/a/b".
+	Version string // Resolved version, e.g. "v1.2.3".
+	Dir     string // Directory the module was unpacked to.
+	Tail    string // Path of the tool within the module, e.g. "cmd/d".
+}
+
+// ToolDir returns the directory containing the tool within the module.
+func (m Module) ToolDir() string {
+	return filepath.Join(m.Dir, m.Tail)
+}
+
+// ToolPath returns the package path of the tool, e.g. "example.com/a/b/cmd/d".
+func (m Module) ToolPath() string {
+	return path.Join(m.Path, m.Tail)
+}
+
 // Download goes out and downloads the module requested to the usual module cache location.
-func Download(mod string) (dir string, err error) {
+func Download(ctx context.Context, mod string) (_ Module, err error) {
+	ctx, end := startSpan(ctx, "download", "va.module", mod)
+	defer func() { end(err) }()
+	if rec := buildRecordFrom(ctx); rec != nil {
+		defer func(start time.Time) {
+			rec.Download += time.Since(start)
+		}(time.Now())
+	}
+
 	// Split out the path and version from the module.
 	split := strings.Split(mod, "@")
 	if len(split) != 2 {
 		// For module mode, must specify a version.
-		return "", fmt.Errorf("not a module")
+		return Module{}, fmt.Errorf("not a module")
 	}
 	path := split[0]
 	version := split[1]
 
+	// A specific version may well have been downloaded before, in which
+	// case it can be found in the module cache without asking the go
+	// command to go looking for it. Queries like "latest" still need the
+	// go command to find out what they refer to.
+	if module.CanonicalVersion(version) == version {
+		if modCache, err := GoModCache(ctx); err == nil {
+			if m, ok := findDownloaded(modCache, path, version); ok {
+				return m, nil
+			}
+		}
+	}
+
+	if offline {
+		return Module{}, fmt.Errorf("%s@%s: %w", path, version, errOffline)
+	}
+	if len(proxyChain) > 0 {
+		return fetchFromChain(ctx, path, version)
+	}
+	return fetchModule(ctx, path, version)
+}
+
+// fetchModule finds the module containing the package path, resolving the
+// version query, and downloads it to the module cache.
+func fetchModule(ctx context.Context, path, version string) (Module, error) {
+	found, tail, err := findModule(ctx, path, version)
+	if err != nil {
+		return Module{}, err
+	}
+
+	// Download the module that was found, at the version the query
+	// resolved to, so that the query cannot resolve differently now.
+	pathVersion := found.Path + "@" + found.Version
+	var out []byte
+	stop := startDownloadProgress(ctx, found.Path, found.Version)
+	err = retry(ctx, retryPolicy, func() (err error) {
+		cmd := goCommand(ctx, "mod", "download", "-json", pathVersion)
+		logCommand(cmd)
+		out, err = cmd.CombinedOutput()
+		if err != nil {
+			msg := downloadErrorText(out)
+			return transientGoError(fmt.Errorf("mod-download: %s: %s", pathVersion, msg), msg)
+		}
+		return nil
+	})
+	stop()
+	if err != nil {
+		return Module{}, err
+	}
+
+	// From the output of "go mod download" we can extract the information
+	// about where the unpacked module can be found.
+	modinfo := packages.Module{}
+	if err := json.Unmarshal(out, &modinfo); err != nil {
+		return Module{}, fmt.Errorf("json: %w", err)
+	}
+
+	return Module{
+		Path:    modinfo.Path,
+		Version: modinfo.Version,
+		Dir:     modinfo.Dir,
+		Tail:    tail,
+	}, nil
+}
+
+// findModule finds the module containing the package path, and resolves the
+// version query for it, without downloading anything more than it must. The
+// path of the package within the module is returned as the tail.
+func findModule(ctx context.Context, path, version string) (_ listModule, tail string, _ error) {
 	// The "tail" can be thought of like this:
 	// example.com/a/b/cmd/d@latest
 	// The module is at example.com/a/b so trying to get that will fail.
@@ -30,39 +129,212 @@ func Download(mod string) (dir string, err error) {
 	// in the "tail" which we will add to the module directory later.
 	// "example.com/a/b" will be the path, "cmd/d" will be the tail, and
 	// "latest" will be the version.
-	tail := ""
-	var out []byte
-	found := false
-	for !found {
-		// Reconstitute the module string, and download it.
-		pathVersion := path + "@" + version
-		out, err = exec.Command("go", "mod", "download", "-json", pathVersion).CombinedOutput()
-		if err != nil {
-			path, tail = pathTrim(path, tail)
-			if path == "." {
-				// The command failed all the way up to the root.
-				return "", fmt.Errorf("mod-download: %w", err)
+	//
+	// Rather than trying each in turn, every prefix of the path is probed
+	// at once, and the deepest one which is a module wins. Probing only
+	// resolves the version, so nothing is downloaded until we know which
+	// module we want.
+	//
+	// The module proxy is asked directly where possible, as that is much
+	// faster than starting the go command for every prefix. If the proxy
+	// configuration cannot be read, the go command is asked instead.
+	proxy, _ := NewProxyClient(ctx)
+	type probe struct {
+		path, tail string
+		mod        listModule
+		err        error
+	}
+	var probes []*probe
+	for tail := ""; path != "."; path, tail = pathTrim(path, tail) {
+		probes = append(probes, &probe{path: path, tail: tail})
+	}
+	var wg sync.WaitGroup
+	for _, p := range probes {
+		wg.Add(1)
+		go func(p *probe) {
+			defer wg.Done()
+			p.mod, p.err = probeModule(ctx, proxy, p.path, version)
+		}(p)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return listModule{}, "", fmt.Errorf("mod-download: %w", ctx.Err())
+	}
+	for _, p := range probes {
+		if p.err == nil {
+			explainf(ctx, "module: probing %s@%s: a module, at %s", p.path, version, p.mod.Version)
+		} else {
+			msg, _, _ := strings.Cut(p.err.Error(), "\n")
+			explainf(ctx, "module: probing %s@%s: %s", p.path, version, msg)
+		}
+	}
+
+	// A deeper path which failed for a reason other than not being a
+	// module might have been the module, so a shallower one which worked
+	// cannot be trusted; the failure is reported instead.
+	var found *probe
+	for _, p := range probes {
+		if p.err == nil {
+			found = p
+			break
+		}
+		if fatal := fatalDownloadError(p.path, p.err.Error()); fatal != nil && !errors.Is(fatal, errImportHost) {
+			return listModule{}, "", fmt.Errorf("mod-download: %w", fatal)
+		}
+	}
+	if found == nil {
+		// Some failures would happen wherever we look, such as the host
+		// of the import path being unreachable, which are more useful
+		// to report than the path not being a module.
+		for _, p := range probes {
+			if errors.Is(p.err, errProxy) {
+				return listModule{}, "", fmt.Errorf("mod-download: %w", p.err)
+			}
+			if fatal := fatalDownloadError(p.path, p.err.Error()); fatal != nil {
+				return listModule{}, "", fmt.Errorf("mod-download: %w", fatal)
 			}
-			// The command failed, assume it was because the path
-			// was not where a module was located, and ascend the
-			// path tree to try again elsewhere.
+		}
+		return listModule{}, "", fmt.Errorf("mod-download: %w", probes[0].err)
+	}
+	return found.mod, found.tail, nil
+}
+
+// probeModule resolves the version query for the module path, asking the
+// module proxy if it can answer, or the go command if not. If the proxy
+// fails, rather than saying it does not know of the module, the go command
+// is asked too, as it may know better; if it fails as well, the proxy's
+// error is returned, as that is the more useful of the two.
+func probeModule(ctx context.Context, proxy *ProxyClient, modPath, query string) (listModule, error) {
+	if proxy == nil {
+		return goListModule(ctx, modPath+"@"+query)
+	}
+	v, err := proxy.Query(ctx, modPath, query)
+	switch {
+	case err == nil:
+		return listModule{Path: modPath, Version: v}, nil
+	case errors.Is(err, errProxyNotFound):
+		return listModule{}, err
+	case errors.Is(err, errNoProxy):
+		return goListModule(ctx, modPath+"@"+query)
+	}
+	if mod, goErr := goListModule(ctx, modPath+"@"+query); goErr == nil {
+		return mod, nil
+	}
+	return listModule{}, fmt.Errorf("%w: %v", errProxy, err)
+}
+
+// findDownloaded looks in the module cache for the module containing the
+// package path at the version, which must not be a query like "latest". As
+// with Download, the module is assumed to be the longest prefix of the path
+// which is a module in the cache, and which has the package's directory in
+// it: a module nested within another, such as golang.org/x/tools/gopls, is
+// left out of the zip of the one it is nested in, so a shorter prefix which
+// is in the cache does not contain the package unless it has its directory.
+func findDownloaded(modCache, pkgPath, version string) (Module, bool) {
+	encVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return Module{}, false
+	}
+	for modPath, tail := pkgPath, ""; modPath != "."; modPath, tail = pathTrim(modPath, tail) {
+		encPath, err := module.EscapePath(modPath)
+		if err != nil {
+			return Module{}, false
+		}
+
+		// The go command writes the ziphash once the zip has been
+		// verified, and extracts the zip before that, so if it is
+		// present the module is ready to use.
+		ziphash := filepath.Join(modCache, "cache", "download", filepath.FromSlash(encPath), "@v", encVersion+".ziphash")
+		dir := filepath.Join(modCache, filepath.FromSlash(encPath)+"@"+encVersion)
+		if _, err := os.Stat(ziphash); err != nil {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(tail))); err != nil || !info.IsDir() {
 			continue
 		}
-		// We got what we were looking for, so stop looking.
-		found = true
+		return Module{
+			Path:    modPath,
+			Version: version,
+			Dir:     dir,
+			Tail:    tail,
+		}, true
 	}
+	return Module{}, false
+}
 
-	// From the output of "go mod download" we can extract the information
-	// about where the unpacked module can be found.
-	modinfo := packages.Module{}
-	if err := json.Unmarshal(out, &modinfo); err != nil {
-		return "", fmt.Errorf("json: %w", err)
+// errImportHost is returned when the host of an import path could not be
+// resolved to a repository, such as when a vanity import server is down or
+// serves bad go-import meta tags.
+var errImportHost = errors.New("could not resolve import path host")
+
+// errProxy is returned when a module proxy failed in a way which suggests it
+// is misconfigured or unreachable, rather than it not knowing of the module.
+var errProxy = errors.New("module proxy failed, check GOPROXY")
+
+// downloadErrorText extracts the error message from the output of a failed
+// "go mod download -json", falling back to the raw output if there is none.
+func downloadErrorText(out []byte) string {
+	var modinfo struct {
+		Error string
+	}
+	if err := json.Unmarshal(out, &modinfo); err != nil || modinfo.Error == "" {
+		return strings.TrimSpace(string(out))
 	}
+	return modinfo.Error
+}
 
-	// Construct the full package directory for the tool we are building.
-	dir = filepath.Join(modinfo.Dir, tail)
+// Failures of the go command which mean that looking for the module
+// elsewhere would be pointless, as trimming the path cannot fix them.
+var (
+	errNetwork  = errors.New("network failure")
+	errAuth     = errors.New("authentication failure")
+	errChecksum = errors.New("checksum failure, the module may have been tampered with")
+)
 
-	return dir, nil
+// fatalDownloadSigns maps signs in the go command's output to the failures
+// they show, along with advice on what to do about them.
+var fatalDownloadSigns = []struct {
+	signs  []string
+	err    error
+	advice string
+}{
+	{
+		signs:  []string{"SECURITY ERROR", "checksum mismatch"},
+		err:    errChecksum,
+		advice: "the download does not match go.sum or the checksum database",
+	},
+	{
+		signs:  []string{"terminal prompts disabled", "could not read Username", "could not read Password", "Authentication failed", "401 Unauthorized", "Permission denied (publickey)"},
+		err:    errAuth,
+		advice: "for private modules, set GOPRIVATE and configure credentials for git or the proxy",
+	},
+	{
+		signs:  []string{"no such host", "Could not resolve host", "dial tcp", "dial udp", "i/o timeout", "connection refused", "connection reset", "network is unreachable", "TLS handshake timeout"},
+		err:    errNetwork,
+		advice: "check the network connection, and GOPROXY",
+	},
+}
+
+// fatalDownloadError inspects the error message from the go command failing
+// to find the module at the path, and returns an error if the failure was not
+// caused by the path being somewhere other than the root of a module.
+func fatalDownloadError(path, msg string) error {
+	for _, fatal := range fatalDownloadSigns {
+		for _, sign := range fatal.signs {
+			if strings.Contains(msg, sign) {
+				return fmt.Errorf("%w for %s (%s): %s", fatal.err, path, fatal.advice, msg)
+			}
+		}
+	}
+
+	// The go command says this when it could not fetch the go-import meta
+	// tags for the path, or could not find any in what it fetched. Vanity
+	// import servers must serve those tags for every package path beneath
+	// them, so a shorter path on the same host will not fare any better.
+	if strings.Contains(msg, "unrecognized import path") {
+		return fmt.Errorf("%w for %s: %s", errImportHost, path, msg)
+	}
+	return nil
 }
 
 // pathTrim chops off the last part of the path, prepends it onto the tail,
@@ -73,10 +345,83 @@ func pathTrim(curPath, curTail string) (newPath, newTail string) {
 	return newPath, newTail
 }
 
-// Build changes to where the module has been unpacked to, and builds it
-// into a temporary file. It is the caller's responsibility to remove
-// the temporary file once they have finished with it.
-func Build(dir string) (cmdPath string, err error) {
+// BuildOptions alter how a tool is built.
+type BuildOptions struct {
+	// Static produces a statically linked binary, suitable for copying
+	// into an otherwise empty container. Pure Go tools are built with
+	// cgo disabled, which always produces a static binary. Tools which
+	// genuinely need cgo must be run with CGO_ENABLED=1 set, in which
+	// case the external linker is asked to link statically instead; this
+	// requires static versions of any C libraries the tool uses.
+	Static bool
+
+	// Reproducible builds the binary so that it is identical wherever it
+	// is built, by leaving out the paths of the machine it was built on,
+	// any version control information, and the build ID. This is what
+	// makes it safe to share binaries through a remote cache.
+	Reproducible bool
+
+	// Env are environment variables the go command builds the tool with,
+	// as "KEY=value", which the link of the tool asks for.
+	Env []string `json:",omitempty"`
+
+	// Tags are build tags, and Ldflags flags for the linker, which the link
+	// of the tool asks for, such as hugo's "extended" tag.
+	Tags    []string `json:",omitempty"`
+	Ldflags string   `json:",omitempty"`
+
+	// Verbose shows the output of the build as it happens, rather than
+	// only if the build fails. It does not affect the binary, so it is
+	// not part of the key the binary is cached under.
+	Verbose bool `json:"-"`
+}
+
+// Build changes to where the module has been unpacked to, and builds the tool
+// in dir, writing the binary to output. The output of the go command is only
+// shown if the build fails, unless opts.Verbose is set, so that it does not
+// get mixed up with the output of the tool.
+func Build(ctx context.Context, dir, output string, opts BuildOptions) (err error) {
+	ctx, end := startSpan(ctx, "build", "va.dir", dir)
+	defer func() { end(err) }()
+	b := NewBuildCommand(dir, output, opts)
+
+	// The go command's action graph records which packages were compiled
+	// and which came from the build cache, and how long everything took.
+	if rec := buildRecordFrom(ctx); rec != nil {
+		if f, err := os.CreateTemp("", "va-actiongraph-"); err == nil {
+			f.Close()
+			defer os.Remove(f.Name())
+			b.Args = append(b.Args, "-debug-actiongraph="+f.Name())
+			defer func(start time.Time) {
+				rec.Build = time.Since(start)
+				readActionGraph(f.Name(), rec)
+			}(time.Now())
+		}
+	}
+
+	emitEvent(progressEvent{Event: "build-start", Dir: dir})
+	defer func(start time.Time) {
+		emitEvent(progressEvent{Event: "build-done", Dir: dir, Duration: time.Since(start), Error: errorText(err)})
+	}(time.Now())
+	cmd := b.Cmd(ctx)
+	logCommand(cmd)
+	if opts.Verbose {
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		return cmd.Run()
+	}
+	stop := startProgress("building "+filepath.Base(dir), nil)
+	out, err := cmd.CombinedOutput()
+	stop()
+	if err != nil {
+		os.Stderr.Write(out)
+	}
+	return err
+}
+
+// BuildTemp builds the tool in dir into a temporary file. It is the caller's
+// responsibility to remove the temporary file with removeTemp once they have
+// finished with it. Should va die before then, a later run removes it.
+func BuildTemp(ctx context.Context, dir string, opts BuildOptions) (cmdPath string, err error) {
 	toolName := filepath.Base(dir)
 	tmpFile, err := os.CreateTemp("", toolName)
 	if err != nil {
@@ -89,15 +434,86 @@ func Build(dir string) (cmdPath string, err error) {
 	if err := tmpFile.Close(); err != nil {
 		return "", err
 	}
+	if err := trackTemp(tmpFileName); err != nil {
+		logWarnf("unable to track temporary file: %v", err)
+	}
 
 	// Build the tool in the place it was downloaded, dropping it
 	// in the temporary location we discovered earlier.
-	cmd := exec.Command("go", "build", "-v", "-o", tmpFileName)
-	cmd.Dir = dir
-	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
-	if err := cmd.Run(); err != nil {
-		os.Remove(tmpFileName)
+	if err := Build(ctx, dir, tmpFileName, opts); err != nil {
+		removeTemp(tmpFileName)
 		return "", err
 	}
 	return tmpFileName, nil
 }
+
+// BuildCommand is a go command which builds a tool.
+type BuildCommand struct {
+	Dir  string   // Directory to run the command in.
+	Env  []string // Environment variables, in addition to those inherited.
+	Args []string // Arguments to the go command.
+}
+
+// NewBuildCommand returns the command which builds the tool in dir, writing
+// the binary to output.
+func NewBuildCommand(dir, output string, opts BuildOptions) BuildCommand {
+	b := BuildCommand{
+		Dir:  dir,
+		Args: []string{"build", "-o", output},
+	}
+	if opts.Verbose {
+		b.Args = append(b.Args, "-v")
+	}
+	tags := opts.Tags
+	var ldflags []string
+	if opts.Ldflags != "" {
+		ldflags = append(ldflags, opts.Ldflags)
+	}
+	if opts.Reproducible {
+		b.Args = append(b.Args, "-trimpath", "-buildvcs=false")
+		ldflags = append(ldflags, "-buildid=")
+	}
+	b.Env = append(b.Env, opts.Env...)
+	if opts.Static {
+		cgo := os.Getenv("CGO_ENABLED")
+		for _, kv := range opts.Env {
+			if v := strings.TrimPrefix(kv, "CGO_ENABLED="); v != kv {
+				cgo = v
+			}
+		}
+		if cgo == "1" {
+			tags = append(tags[:len(tags):len(tags)], "netgo", "osusergo")
+			ldflags = append(ldflags, `-extldflags "-static"`)
+		} else {
+			b.Env = append(b.Env, "CGO_ENABLED=0")
+		}
+	}
+	if len(tags) > 0 {
+		b.Args = append(b.Args, "-tags", strings.Join(tags, ","))
+	}
+	if len(ldflags) > 0 {
+		b.Args = append(b.Args, "-ldflags", strings.Join(ldflags, " "))
+	}
+	return b
+}
+
+// Cmd returns the command, ready to be run.
+func (b BuildCommand) Cmd(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "go", b.Args...)
+	cmd.Dir = b.Dir
+	cmd.Env = append(os.Environ(), b.Env...)
+	return cmd
+}
+
+// String renders the command as a line which can be pasted into a shell.
+func (b BuildCommand) String() string {
+	parts := []string{"cd", shellQuote(b.Dir), "&&"}
+	for _, env := range b.Env {
+		parts = append(parts, shellQuote(env))
+	}
+	parts = append(parts, "go")
+	for _, arg := range b.Args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
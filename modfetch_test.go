@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeMainModule writes a module holding only a main package, returning
+// its directory.
+func writeMainModule(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/hello\n\ngo 1.18\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuildStatic(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	t.Setenv("GOFLAGS", "-buildvcs=false")
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOTOOLCHAIN", "local")
+	dir := writeMainModule(t)
+	for _, tt := range []struct {
+		name   string
+		cgoEnv string // $CGO_ENABLED
+		want   map[string]string
+	}{
+		{
+			name: "cgo not set",
+			want: map[string]string{"CGO_ENABLED": "0", "-tags": "", "-ldflags": ""},
+		},
+		{
+			name:   "cgo=1",
+			cgoEnv: "1",
+			want:   map[string]string{"CGO_ENABLED": "1", "-tags": "netgo,osusergo", "-ldflags": `-extldflags "-static"`},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CGO_ENABLED", tt.cgoEnv)
+			tool := filepath.Join(t.TempDir(), "hello")
+			if err := Build(context.Background(), dir, tool, BuildOptions{Static: true}); err != nil {
+				t.Fatal(err)
+			}
+			info, err := buildinfo.ReadFile(tool)
+			if err != nil {
+				t.Fatal(err)
+			}
+			settings := make(map[string]string)
+			for _, s := range info.Settings {
+				settings[s.Key] = s.Value
+			}
+			for k, want := range tt.want {
+				if got := settings[k]; got != want {
+					t.Errorf("built with %s=%q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewBuildCommandStatic(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		cgoEnv   string   // $CGO_ENABLED
+		env      []string // BuildOptions.Env
+		tags     []string
+		wantEnv  []string
+		wantArgs []string
+	}{
+		{
+			name:     "cgo not set",
+			wantEnv:  []string{"CGO_ENABLED=0"},
+			wantArgs: []string{"build", "-o", "out"},
+		},
+		{
+			name:     "cgo=0",
+			cgoEnv:   "0",
+			wantEnv:  []string{"CGO_ENABLED=0"},
+			wantArgs: []string{"build", "-o", "out"},
+		},
+		{
+			name:     "cgo=1",
+			cgoEnv:   "1",
+			tags:     []string{"extra"},
+			wantArgs: []string{"build", "-o", "out", "-tags", "extra,netgo,osusergo", "-ldflags", `-extldflags "-static"`},
+		},
+		{
+			name:     "cgo=1 in the build environment",
+			cgoEnv:   "0",
+			env:      []string{"CGO_ENABLED=1"},
+			wantEnv:  []string{"CGO_ENABLED=1"},
+			wantArgs: []string{"build", "-o", "out", "-tags", "netgo,osusergo", "-ldflags", `-extldflags "-static"`},
+		},
+		{
+			name:     "cgo=0 in the build environment",
+			cgoEnv:   "1",
+			env:      []string{"CGO_ENABLED=0"},
+			wantEnv:  []string{"CGO_ENABLED=0", "CGO_ENABLED=0"},
+			wantArgs: []string{"build", "-o", "out"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CGO_ENABLED", tt.cgoEnv)
+			b := NewBuildCommand("dir", "out", BuildOptions{Static: true, Env: tt.env, Tags: tt.tags})
+			if !reflect.DeepEqual(b.Env, tt.wantEnv) {
+				t.Errorf("Env = %q, want %q", b.Env, tt.wantEnv)
+			}
+			if !reflect.DeepEqual(b.Args, tt.wantArgs) {
+				t.Errorf("Args = %q, want %q", b.Args, tt.wantArgs)
+			}
+			if len(tt.tags) > 0 && !reflect.DeepEqual(tt.tags, []string{"extra"}) {
+				t.Errorf("the tags asked for were changed to %q", tt.tags)
+			}
+		})
+	}
+}
+
+func TestFatalDownloadError(t *testing.T) {
+	for _, tt := range []struct {
+		msg  string
+		want error
+	}{
+		{`go: rsc.io/foo@latest: unrecognized import path "rsc.io/foo": reading https://rsc.io/foo?go-get=1: 404 Not Found`, errImportHost},
+		{`go: rsc.io/foo@latest: unrecognized import path "rsc.io/foo": parse https://rsc.io/foo?go-get=1: no go-import meta tags ()`, errImportHost},
+		// The host not answering at all is a network failure, which it
+		// would be for any path.
+		{`go: rsc.io/foo@latest: unrecognized import path "rsc.io/foo": https fetch: Get "https://rsc.io/foo?go-get=1": dial tcp: lookup rsc.io: no such host`, errNetwork},
+		{`verifying example.com/a@v1.0.0: checksum mismatch`, errChecksum},
+		{`fatal: could not read Username for 'https://github.com': terminal prompts disabled`, errAuth},
+		// The path being beneath the module, or not a module at all, is
+		// no reason to stop looking.
+		{`go: module example.com/a/cmd: no matching versions for query "latest"`, nil},
+		{`go: example.com/a/cmd@latest: reading https://proxy.golang.org/example.com/a/cmd/@v/list: 404 Not Found`, nil},
+		{`go: module example.com/a@latest found (v1.0.0), but does not contain package example.com/a/cmd`, nil},
+	} {
+		err := fatalDownloadError("rsc.io/foo", tt.msg)
+		switch {
+		case tt.want == nil && err != nil:
+			t.Errorf("fatalDownloadError(%q) = %v, want nil", tt.msg, err)
+		case tt.want != nil && !errors.Is(err, tt.want):
+			t.Errorf("fatalDownloadError(%q) = %v, want %v", tt.msg, err, tt.want)
+		}
+	}
+	err := fatalDownloadError("rsc.io/foo", `unrecognized import path "rsc.io/foo"`)
+	if want := "could not resolve import path host for rsc.io/foo"; err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("fatalDownloadError = %v, want it to start %q", err, want)
+	}
+}
+
+func TestBuildCommandString(t *testing.T) {
+	t.Setenv("CGO_ENABLED", "1")
+	b := NewBuildCommand("/go/pkg/mod/example.com/a b@v1.0.0/cmd/x", "/cache/bin/x", BuildOptions{
+		Static:       true,
+		Reproducible: true,
+		Verbose:      true,
+		Tags:         []string{"a", "b"},
+		Ldflags:      "-X 'main.version=v1.0.0'",
+		Env:          []string{"GOFLAGS=-mod=mod -tags=c", "GOEXPERIMENT=loopvar"},
+	})
+	cmd := b.Cmd(context.Background())
+
+	// The line, as a shell would split it, is the command which is run.
+	fields, err := splitFields(b.String())
+	if err != nil {
+		t.Fatalf("%s: %v", b, err)
+	}
+	env := cmd.Env[len(cmd.Env)-len(b.Env):]
+	var want []string
+	want = append(want, "cd", cmd.Dir, "&&")
+	want = append(want, env...)
+	want = append(want, "go")
+	want = append(want, cmd.Args[1:]...)
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("String() = %s, which runs %q, want %q", b, fields, want)
+	}
+	if filepath.Base(cmd.Path) != "go" && filepath.Base(cmd.Path) != "go.exe" {
+		t.Errorf("Cmd runs %s, want go", cmd.Path)
+	}
+}
+
+// fakeDownload lays out the module at the version in the module cache as the
+// go command does once it has downloaded it, with the directories in it.
+func fakeDownload(t *testing.T, modCache, modPath, version string, dirs ...string) {
+	t.Helper()
+	dir := filepath.Join(modCache, filepath.FromSlash(modPath)+"@"+version)
+	for _, d := range append(dirs, "") {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	download := filepath.Join(modCache, "cache", "download", filepath.FromSlash(modPath), "@v")
+	if err := os.MkdirAll(download, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(download, version+".ziphash"), []byte("h1:\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindDownloaded(t *testing.T) {
+	modCache := t.TempDir()
+	fakeDownload(t, modCache, "golang.org/x/tools", "v0.20.0", "cmd/stringer")
+
+	m, ok := findDownloaded(modCache, "golang.org/x/tools/cmd/stringer", "v0.20.0")
+	if !ok || m.Path != "golang.org/x/tools" || m.Tail != "cmd/stringer" {
+		t.Errorf("findDownloaded(stringer) = %+v, %v, want it in golang.org/x/tools", m, ok)
+	}
+
+	// gopls is a module of its own, nested within golang.org/x/tools, so
+	// is not in it.
+	if m, ok := findDownloaded(modCache, "golang.org/x/tools/gopls", "v0.20.0"); ok {
+		t.Errorf("findDownloaded(gopls) = %+v, want it not found", m)
+	}
+	fakeDownload(t, modCache, "golang.org/x/tools/gopls", "v0.20.0")
+	m, ok = findDownloaded(modCache, "golang.org/x/tools/gopls", "v0.20.0")
+	if !ok || m.Path != "golang.org/x/tools/gopls" || m.Tail != "" {
+		t.Errorf("findDownloaded(gopls) = %+v, %v, want it in golang.org/x/tools/gopls", m, ok)
+	}
+}
+
+func TestFindModuleImportHost(t *testing.T) {
+	// The proxy cannot find anything beneath the host, as it cannot reach
+	// its go-import meta tags, as proxy.golang.org says.
+	useProxyHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/@")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "not found: %s@latest: unrecognized import path %q: reading https://%s?go-get=1: 404 Not Found\n", path, path, path)
+	}))
+	_, _, err := findModule(context.Background(), "vanity.example/foo/cmd/x", "latest")
+	if !errors.Is(err, errImportHost) {
+		t.Fatalf("findModule = %v, want %v", err, errImportHost)
+	}
+	if !strings.Contains(err.Error(), "for vanity.example/foo/cmd/x") {
+		t.Errorf("findModule = %v, want the error for the path asked for", err)
+	}
+}
+
+func TestFindModuleAscends(t *testing.T) {
+	useTestProxy(t, testModule{Path: "example.com/a", Version: "v1.0.0"})
+	mod, tail, err := findModule(context.Background(), "example.com/a/cmd/x", "latest")
+	if err != nil || mod.Path != "example.com/a" || mod.Version != "v1.0.0" || tail != "cmd/x" {
+		t.Errorf("findModule = %s@%s, %q, %v, want example.com/a@v1.0.0 with the tail cmd/x", mod.Path, mod.Version, tail, err)
+	}
+}
+
+func TestNewBuildCommandReproducible(t *testing.T) {
+	t.Setenv("CGO_ENABLED", "1")
+	for _, tt := range []struct {
+		name     string
+		opts     BuildOptions
+		wantArgs []string
+	}{
+		{
+			name:     "not reproducible",
+			wantArgs: []string{"build", "-o", "out"},
+		},
+		{
+			name:     "reproducible",
+			opts:     BuildOptions{Reproducible: true},
+			wantArgs: []string{"build", "-o", "out", "-trimpath", "-buildvcs=false", "-ldflags", "-buildid="},
+		},
+		{
+			name:     "with ldflags",
+			opts:     BuildOptions{Reproducible: true, Verbose: true, Ldflags: "-s -w"},
+			wantArgs: []string{"build", "-o", "out", "-v", "-trimpath", "-buildvcs=false", "-ldflags", "-s -w -buildid="},
+		},
+		{
+			name:     "static",
+			opts:     BuildOptions{Reproducible: true, Static: true},
+			wantArgs: []string{"build", "-o", "out", "-trimpath", "-buildvcs=false", "-tags", "netgo,osusergo", "-ldflags", `-buildid= -extldflags "-static"`},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuildCommand("dir", "out", tt.opts)
+			if !reflect.DeepEqual(b.Args, tt.wantArgs) {
+				t.Errorf("Args = %q, want %q", b.Args, tt.wantArgs)
+			}
+		})
+	}
+
+	// A reproducible build is not the same tool as one which is not.
+	m := Module{Path: "example.com/hello", Version: "v1.0.0"}
+	if NewToolKey(m, GoEnv{}, BuildOptions{Reproducible: true}).Hash() == NewToolKey(m, GoEnv{}, BuildOptions{}).Hash() {
+		t.Error("reproducible and other builds are cached as the same tool")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"os"
+	"time"
+)
+
+// offline is set by --offline, in which case only modules and tools which
+// are already cached are used, and nothing is fetched from the network.
+var offline bool
+
+// errOffline is returned when something is needed from the network while
+// offline.
+var errOffline = errors.New("not cached, refusing to go online")
+
+// goOffline stops the go command from going online, so that it can only use
+// what is already in the module cache, and makes resolved version queries
+// such as "latest" last forever, since they cannot be resolved again.
+//
+// GOFLAGS is left alone, despite "-mod=mod" being the usual advice for
+// working offline, as it is part of the key of every cached tool, and
+// changing it would mean none of them could be found.
+func goOffline() error {
+	if *flagRefresh {
+		return errors.New("--refresh needs to go online")
+	}
+	if *flagNoRetracted {
+		return errors.New("--no-retracted needs to go online")
+	}
+	offline = true
+	*flagResolveTTL = time.Duration(math.MaxInt64)
+	return os.Setenv("GOPROXY", "off")
+}
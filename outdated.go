@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// outdatedConcurrency is how many links va outdated checks at once.
+const outdatedConcurrency = 8
+
+// Upgrade is a newer version available for a link pinned to a version.
+type Upgrade struct {
+	Short   string
+	Tool    string // Package path of the tool.
+	Module  string // Path of the module containing the tool.
+	Current string // Version the link is pinned to.
+	Latest  string // Newest version which has not been retracted.
+	Origin  string // Where the link was defined.
+}
+
+// pinnedLinks returns the links pinned to a version, rather than a query
+// such as "latest" or a branch, in order.
+func pinnedLinks(links []Link) []Link {
+	var pinned []Link
+	for _, link := range links {
+		_, version, _ := strings.Cut(link.Pkg, "@")
+		if version != "" && !isQuery(version) && !module.IsPseudoVersion(version) {
+			pinned = append(pinned, link)
+		}
+	}
+	return pinned
+}
+
+// Outdated checks each link pinned to a version for a newer one, returning
+// the upgrades available, in order of the links' short names. A link which
+// cannot be checked is reported through failed, and left out.
+func Outdated(ctx context.Context, cacheDir string, links []Link, failed func(Link, error)) []Upgrade {
+	pinned := pinnedLinks(links)
+	found := make([]*Upgrade, len(pinned))
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, outdatedConcurrency)
+	)
+	for i, link := range pinned {
+		wg.Add(1)
+		go func(i int, link Link) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			upgrade, err := checkOutdated(ctx, cacheDir, link)
+			if err != nil {
+				mu.Lock()
+				failed(link, err)
+				mu.Unlock()
+				return
+			}
+			found[i] = upgrade
+		}(i, link)
+	}
+	wg.Wait()
+
+	var upgrades []Upgrade
+	for _, upgrade := range found {
+		if upgrade != nil {
+			upgrades = append(upgrades, *upgrade)
+		}
+	}
+	sort.Slice(upgrades, func(i, j int) bool { return upgrades[i].Short < upgrades[j].Short })
+	return upgrades
+}
+
+// checkOutdated returns the upgrade available for the pinned link, or nil
+// if it is pinned to the newest version. Links pinned to a pre-release may be
+// upgraded to a newer pre-release, but others only to releases.
+func checkOutdated(ctx context.Context, cacheDir string, link Link) (*Upgrade, error) {
+	pkgPath, current, _ := strings.Cut(link.Pkg, "@")
+	m, _, err := locateTool(ctx, cacheDir, link.Pkg)
+	if err != nil {
+		return nil, err
+	}
+	// Without -retracted, the versions listed exclude retracted ones.
+	mod, err := goListModule(ctx, m.Path, "-versions")
+	if err != nil {
+		return nil, err
+	}
+	latest := current
+	for _, v := range mod.Versions {
+		if semver.Prerelease(v) != "" && semver.Prerelease(current) == "" {
+			continue
+		}
+		if semver.Compare(v, latest) > 0 {
+			latest = v
+		}
+	}
+	if latest == current {
+		return nil, nil
+	}
+	return &Upgrade{
+		Short:   link.Short,
+		Tool:    pkgPath,
+		Module:  m.Path,
+		Current: current,
+		Latest:  latest,
+		Origin:  link.Origin(),
+	}, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPinnedLinks(t *testing.T) {
+	links := []Link{
+		{Short: "a", Pkg: "example.com/a@v1.0.0"},
+		{Short: "b", Pkg: "example.com/b@latest"},
+		{Short: "c", Pkg: "example.com/c@main"},
+		{Short: "d", Pkg: "example.com/d@v0.0.0-20240101000000-abcdefabcdef"},
+		{Short: "e", Pkg: "example.com/e"},
+		{Short: "f", Pkg: "example.com/f@v1.0.0-rc.1"},
+	}
+	var got []string
+	for _, link := range pinnedLinks(links) {
+		got = append(got, link.Short)
+	}
+	if want := []string{"a", "f"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pinnedLinks = %q, want %q", got, want)
+	}
+}
+
+func TestWriteUpgrades(t *testing.T) {
+	upgrades := []Upgrade{
+		{Short: "a", Tool: "example.com/a/cmd/a", Module: "example.com/a", Current: "v1.0.0", Latest: "v1.1.0", Origin: "user:go.list"},
+		{Short: "long-name", Tool: "example.com/b", Module: "example.com/b", Current: "v0.1.0-alpha", Latest: "v0.1.0-beta", Origin: "user:go.list"},
+	}
+	var out bytes.Buffer
+	if err := writeUpgrades(&out, upgrades, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"a          v1.0.0        ->  v1.1.0       example.com/a\n" +
+		"long-name  v0.1.0-alpha  ->  v0.1.0-beta  example.com/b\n"
+	if out.String() != want {
+		t.Errorf("writeUpgrades wrote\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := writeUpgrades(&out, upgrades, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Upgrade
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || !reflect.DeepEqual(decoded, upgrades) {
+		t.Errorf("writeUpgrades as JSON = %s, %v, want %+v", out.Bytes(), err, upgrades)
+	}
+
+	// No upgrades are an empty table, or an empty array rather than null.
+	out.Reset()
+	if err := writeUpgrades(&out, nil, false); err != nil || out.Len() != 0 {
+		t.Errorf("writeUpgrades of none wrote %q, %v, want nothing", out.String(), err)
+	}
+	out.Reset()
+	if err := writeUpgrades(&out, nil, true); err != nil || out.String() != "[]\n" {
+		t.Errorf("writeUpgrades of none as JSON = %q, %v, want []", out.String(), err)
+	}
+}
+
+func TestCmdOutdated(t *testing.T) {
+	useTestProxy(t,
+		testModule{Path: "example.com/a", Version: "v1.0.0"},
+		testModule{Path: "example.com/a", Version: "v1.1.0"},
+		// The newest version is retracted, so is no upgrade.
+		testModule{Path: "example.com/a", Version: "v1.2.0", GoMod: "module example.com/a\n\nretract v1.2.0\n"},
+		testModule{Path: "example.com/a", Version: "v1.3.0-rc.1"},
+		testModule{Path: "example.com/b", Version: "v2.0.0"},
+		testModule{Path: "example.com/c", Version: "v0.1.0-alpha"},
+		testModule{Path: "example.com/c", Version: "v0.1.0-beta"},
+	)
+	t.Setenv("VA_CACHE_DIR", t.TempDir())
+	links := map[string]Link{
+		"a":       {Short: "a", Pkg: "example.com/a@v1.0.0"},
+		"b":       {Short: "b", Pkg: "example.com/b@v2.0.0"},
+		"c":       {Short: "c", Pkg: "example.com/c@v0.1.0-alpha"},
+		"latest":  {Short: "latest", Pkg: "example.com/b@latest"},
+		"missing": {Short: "missing", Pkg: "example.com/missing@v1.0.0"},
+	}
+	for _, tt := range []struct {
+		args     []string
+		wantOut  string
+		wantCode int
+	}{
+		{
+			args: []string{"a", "b", "c", "latest"},
+			wantOut: "" +
+				"a  v1.0.0        ->  v1.1.0       example.com/a\n" +
+				"c  v0.1.0-alpha  ->  v0.1.0-beta  example.com/c\n",
+			wantCode: 1,
+		},
+		{args: []string{"b", "latest"}},
+		{args: []string{"b", "missing"}, wantCode: 2},
+		// Failing to check any link is worse than there being upgrades.
+		{
+			args:     []string{"a", "missing"},
+			wantOut:  "a  v1.0.0  ->  v1.1.0  example.com/a\n",
+			wantCode: 2,
+		},
+	} {
+		var err error
+		out := captureStdout(t, func() { err = cmdOutdated(links, tt.args) })
+		if out != tt.wantOut {
+			t.Errorf("va outdated %s wrote\n%s\nwant\n%s", strings.Join(tt.args, " "), out, tt.wantOut)
+		}
+		var code exitError
+		if errors.As(err, &code) || err == nil {
+			if int(code) != tt.wantCode {
+				t.Errorf("va outdated %s exited %d, want %d", strings.Join(tt.args, " "), code, tt.wantCode)
+			}
+		} else {
+			t.Errorf("va outdated %s: %v", strings.Join(tt.args, " "), err)
+		}
+	}
+
+	var err error
+	out := captureStdout(t, func() { err = cmdOutdated(links, []string{"--json", "a", "b"}) })
+	var upgrades []Upgrade
+	if jsonErr := json.Unmarshal([]byte(out), &upgrades); jsonErr != nil {
+		t.Fatalf("va outdated --json wrote %q: %v", out, jsonErr)
+	}
+	want := []Upgrade{{Short: "a", Tool: "example.com/a", Module: "example.com/a", Current: "v1.0.0", Latest: "v1.1.0", Origin: ":"}}
+	if !reflect.DeepEqual(upgrades, want) || err != exitError(1) {
+		t.Errorf("va outdated --json = %+v, %v, want %+v, exit status 1", upgrades, err, want)
+	}
+	out = captureStdout(t, func() { err = cmdOutdated(links, []string{"--json", "b"}) })
+	if out != "[]\n" || err != nil {
+		t.Errorf("va outdated --json with no upgrades = %q, %v, want []", out, err)
+	}
+
+	offline = true
+	t.Cleanup(func() { offline = false })
+	if err := cmdOutdated(links, []string{"a"}); !errors.Is(err, errOffline) {
+		t.Errorf("va outdated when offline: %v, want %v", err, errOffline)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// overrideEnvPrefix prefixes the environment variables which override the
+// version of a link, such as VA_VERSION_STATICCHECK=v0.4.0.
+const overrideEnvPrefix = "VA_VERSION_"
+
+// overrideEnvName returns the environment variable which overrides the
+// version of the link: its short name in upper case, with anything which
+// cannot be in a variable name, such as "/" or "-", made an underscore.
+func overrideEnvName(short string) string {
+	name := []byte(strings.ToUpper(short))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+	return overrideEnvPrefix + string(name)
+}
+
+// readOverrides reads a file of version overrides, one to a line, each a
+// short name and version as "short@version". Blank lines, and those starting
+// with "#", are skipped.
+func readOverrides(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	overrides := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		short, version, _ := strings.Cut(line, "@")
+		if err := checkOverride(version); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		overrides[short] = version
+	}
+	return overrides, scanner.Err()
+}
+
+// checkOverride checks the version overriding a link's is one the go
+// command could be asked for.
+func checkOverride(version string) error {
+	if version == "" || strings.ContainsAny(version, "@ \t") {
+		return fmt.Errorf("bad version override: %q", version)
+	}
+	return nil
+}
+
+// applyOverrides changes the version of each link which has been overridden,
+// by its environment variable, or else by the file named by $VA_OVERRIDES.
+// An override for a link which does not exist is most likely a mistake, so
+// is an error in the file, and a warning in the environment, where the
+// variable may well be meant for another version of va.
+func applyOverrides(links map[string]Link) error {
+	overrides := make(map[string]string)
+	from := make(map[string]string)
+	if name := os.Getenv("VA_OVERRIDES"); name != "" {
+		fileOverrides, err := readOverrides(name)
+		if err != nil {
+			return fmt.Errorf("overrides: %w", err)
+		}
+		for short, version := range fileOverrides {
+			if _, ok := links[short]; !ok {
+				return fmt.Errorf("overrides: %s: unknown short name: %s", name, short)
+			}
+			overrides[short], from[short] = version, name
+		}
+	}
+
+	envShort := make(map[string]string)
+	for short := range links {
+		envShort[overrideEnvName(short)] = short
+	}
+	var unknown []string
+	for _, kv := range os.Environ() {
+		name, version, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, overrideEnvPrefix) || version == "" {
+			continue
+		}
+		short, ok := envShort[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		if err := checkOverride(version); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		overrides[short], from[short] = version, "$"+name
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		logWarnf("%s overrides the version of a link which does not exist", name)
+	}
+
+	for short, version := range overrides {
+		link := links[short]
+		if link.Alias != "" {
+			target, _, _ := strings.Cut(link.Alias, "@")
+			link.Alias = target + "@" + version
+		} else {
+			pkgPath, _, _ := strings.Cut(link.Pkg, "@")
+			link.Pkg = pkgPath + "@" + version
+		}
+		link.Override = from[short]
+		links[short] = link
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pickerHelp is shown above the picker, which is only ever as wide as this.
+const pickerHelp = "Type to filter, up/down to choose, enter to pick, esc to cancel."
+
+// pickLink shows the links at the terminal, for them to be filtered by
+// typing and one picked, returning the short name picked, or "" if none was.
+// Where the terminal cannot be put into raw mode, the filter and choice are
+// typed as lines instead.
+func pickLink(links map[string]Link, in, out *os.File) (string, error) {
+	restore, err := makeRaw(in)
+	if err != nil {
+		return pickLinkByLine(links, bufio.NewReader(in), out)
+	}
+	defer restore()
+
+	// Draw on the alternate screen, so that the picker leaves no trace.
+	fmt.Fprint(out, "\x1b[?1049h")
+	defer fmt.Fprint(out, "\x1b[?1049l")
+	query, selected := "", 0
+	buf := make([]byte, 64)
+	for {
+		results := searchLinks(links, query)
+		if selected >= len(results) {
+			selected = len(results) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+		drawPicker(out, query, results, selected)
+
+		n, err := in.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		switch key := string(buf[:n]); {
+		case key == "\x1b[A" || key == "\x1bOA" || key == "\x10": // Up, or ^P.
+			selected--
+		case key == "\x1b[B" || key == "\x1bOB" || key == "\x0e": // Down, or ^N.
+			selected++
+		case key == "\r" || key == "\n":
+			if len(results) > 0 {
+				return results[selected].Name, nil
+			}
+		case key == "\x1b" || key == "\x03" || key == "\x04": // Esc, ^C, or ^D.
+			return "", nil
+		case key == "\x7f" || key == "\x08": // Backspace.
+			if query != "" {
+				_, size := utf8.DecodeLastRuneInString(query)
+				query, selected = query[:len(query)-size], 0
+			}
+		case key == "\x15": // ^U.
+			query, selected = "", 0
+		case utf8.ValidString(key) && strings.IndexFunc(key, unicode.IsControl) < 0:
+			query, selected = query+key, 0
+		}
+	}
+}
+
+// drawPicker draws the picker: the query, and as many of the results as fit
+// on the terminal, scrolled so that the selected one is shown.
+func drawPicker(out *os.File, query string, results []searchResult, selected int) {
+	rows := 20
+	if height, err := terminalHeight(out); err == nil && height > 2 {
+		rows = height - 2
+	}
+	start := 0
+	if selected >= rows {
+		start = selected - rows + 1
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\x1b[H\x1b[2J%s\n> %s", pickerHelp, query)
+	for i := start; i < len(results) && i < start+rows; i++ {
+		line := fmt.Sprintf("%-24s %s", results[i].Name, truncate(results[i].Desc, len(pickerHelp)-27))
+		if i == selected {
+			fmt.Fprintf(&b, "\n\x1b[7m> %s\x1b[0m", line)
+		} else {
+			fmt.Fprintf(&b, "\n  %s", line)
+		}
+	}
+	// Leave the cursor after the query, where typing goes.
+	fmt.Fprintf(&b, "\x1b[2;%dH", utf8.RuneCountInString(query)+3)
+	io.WriteString(out, b.String())
+}
+
+// pickLinkByLine has a filter typed, then one of the links matching it
+// picked by number.
+func pickLinkByLine(links map[string]Link, in *bufio.Reader, out io.Writer) (string, error) {
+	fmt.Fprint(out, "Filter (enter for all): ")
+	query, err := readLine(in)
+	if err != nil {
+		return "", err
+	}
+	results := searchLinks(links, query)
+	if len(results) == 0 {
+		return "", fmt.Errorf("nothing found for %q", query)
+	}
+	for i, result := range results {
+		fmt.Fprintf(out, "%3d  %-24s %s\n", i+1, result.Name, truncate(result.Desc, 50))
+	}
+	fmt.Fprintf(out, "Which? [1-%d, or enter for none]: ", len(results))
+	answer, err := readLine(in)
+	if err != nil || answer == "" {
+		return "", err
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(results) {
+		return "", fmt.Errorf("no such link: %s", answer)
+	}
+	return results[n-1].Name, nil
+}
+
+// readLine reads a line, without its line ending or surrounding spaces. The
+// last line need not have a line ending.
+func readLine(in *bufio.Reader) (string, error) {
+	line, err := in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimSpace(line), err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// knownGOOS and knownGOARCH are the operating systems and architectures the
+// go command knows of, as "go tool dist list" lists them, so that a link
+// restricted to one it does not, most likely by a typo, can be warned of.
+var (
+	knownGOOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true,
+		"freebsd": true, "hurd": true, "illumos": true, "ios": true,
+		"js": true, "linux": true, "netbsd": true, "openbsd": true,
+		"plan9": true, "solaris": true, "wasip1": true, "windows": true,
+		"zos": true,
+	}
+	knownGOARCH = map[string]bool{
+		"386": true, "amd64": true, "arm": true, "arm64": true,
+		"loong64": true, "mips": true, "mips64": true, "mips64le": true,
+		"mipsle": true, "ppc64": true, "ppc64le": true, "riscv64": true,
+		"s390x": true, "wasm": true,
+	}
+)
+
+// unixGOOS are the operating systems "unix" stands for in a link's GOOS, as
+// it does in build constraints.
+var unixGOOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true,
+	"freebsd": true, "hurd": true, "illumos": true, "ios": true,
+	"linux": true, "netbsd": true, "openbsd": true, "solaris": true,
+}
+
+// Supports reports whether the link works on the operating system and
+// architecture, which it does unless it is restricted to others.
+func (l Link) Supports(goos, goarch string) bool {
+	return matchPlatform(l.GOOS, goos, unixGOOS) && matchPlatform(l.GOARCH, goarch, nil)
+}
+
+// supported reports whether the link works on the system va is running on.
+func (l Link) supported() bool {
+	return l.Supports(runtime.GOOS, runtime.GOARCH)
+}
+
+// matchPlatform reports whether the value is one of those allowed, or is
+// one of the values "unix" stands for if "unix" is allowed, or if any value
+// is allowed, as it is if none are given.
+func matchPlatform(allowed []string, value string, unix map[string]bool) bool {
+	for _, a := range allowed {
+		if a == value || a == "unix" && unix[value] {
+			return true
+		}
+	}
+	return len(allowed) == 0
+}
+
+// platformNote notes the systems the link is restricted to, for listings,
+// such as "linux, darwin only".
+func platformNote(link Link) string {
+	return strings.Join(append(link.GOOS[:len(link.GOOS):len(link.GOOS)], link.GOARCH...), ", ") + " only"
+}
+
+// supportedLinks returns the links which work on the system va is running
+// on, leaving out those restricted to others.
+func supportedLinks(links map[string]Link) map[string]Link {
+	supported := make(map[string]Link, len(links))
+	for short, link := range links {
+		if link.supported() {
+			supported[short] = link
+		}
+	}
+	return supported
+}
+
+// warnUnsupported warns if the tool given by arg is a link restricted to
+// systems other than this one, as it most likely will not build or run.
+func warnUnsupported(links map[string]Link, arg string) {
+	if _, link, ok := expandLink(links, arg); ok && !link.supported() {
+		logWarnf("link %s is for %s, so may not build or run on %s/%s", link.Short, platformNote(link), runtime.GOOS, runtime.GOARCH)
+	}
+}
+
+// parsePlatforms parses the comma-separated values of the goos or goarch
+// option of a link.
+func parsePlatforms(value string) ([]string, error) {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v == "" || strings.ContainsAny(v, " \t") {
+			return nil, fmt.Errorf("bad value: %q", v)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
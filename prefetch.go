@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// daemonPoll is how often the prefetch daemon checks whether the go
+// toolchain has changed.
+const daemonPoll = time.Minute
+
+// Prefetch downloads and builds the tool for the package path and version,
+// which may be a query such as "latest", without running it, so that running
+// it later is quick.
+func Prefetch(ctx context.Context, cacheDir, mod string, opts BuildOptions) (Module, error) {
+	m, err := Download(ctx, mod)
+	if err != nil {
+		return Module{}, fmt.Errorf("download: %w", err)
+	}
+	if err := recordResolution(cacheDir, mod, m.Version); err != nil {
+		return Module{}, fmt.Errorf("cache: %w", err)
+	}
+	if _, _, err := buildTool(ctx, cacheDir, m, opts); err != nil {
+		return Module{}, fmt.Errorf("build: %w", err)
+	}
+	return m, nil
+}
+
+// rebuildCached builds every tool in the cache for the current go toolchain,
+// if it has not been already, so that upgrading the toolchain does not leave
+// the next run of each tool waiting for a build. Each rebuilt tool keeps the
+// time it was last used, so that tools nobody uses are still evicted.
+func rebuildCached(ctx context.Context, cacheDir string) error {
+	entries, err := cacheEntries(cacheDir)
+	if err != nil {
+		return err
+	}
+	env, err := ReadGoEnv(ctx)
+	if err != nil {
+		return err
+	}
+	remote, err := remoteCacheFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// The same tool may be cached for several toolchains, so only the
+	// most recently used of them counts.
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		key := entry.Meta.Key
+		key.Env = GoEnv{}
+		if seen[key.Hash()] {
+			continue
+		}
+		seen[key.Hash()] = true
+
+		mod := entry.ToolPath() + "@" + entry.Meta.Key.Version
+		m, err := Download(ctx, mod)
+		if err != nil {
+			logWarnf("daemon: %s: download: %v", mod, err)
+			continue
+		}
+		newKey := NewToolKey(m, env, entry.Meta.Key.Build)
+		entryDir := filepath.Join(cacheDir, binDir, newKey.Hash())
+		if _, err := os.Stat(entryDir); err == nil {
+			continue
+		}
+		logInfof("daemon: rebuilding %s for %s", mod, env.GOVERSION)
+		if _, err := CachedTool(ctx, cacheDir, remote, m, newKey); err != nil {
+			logWarnf("daemon: %s: build: %v", mod, err)
+			continue
+		}
+		if err := os.Chtimes(filepath.Join(entryDir, binMetaFile), entry.Used, entry.Used); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetGoEnv forgets the go command's environment, so that it is read again
+// the next time it is needed, such as after the toolchain has changed.
+func resetGoEnv() {
+	goEnvState.Lock()
+	defer goEnvState.Unlock()
+	goEnvState.vars = nil
+}
+
+// Daemon keeps the tools warm: every interval it resolves the version queries
+// for the tools given again, downloading and building whatever they now
+// refer to, builds every tool in the cache for the current go toolchain, and
+// fetches the remote lists which are due to be fetched again. It also does
+// so as soon as the toolchain changes. Unless once is set, it
+// never returns.
+func Daemon(ctx context.Context, cacheDir string, mods []string, interval time.Duration, once bool) error {
+	var toolchain string
+	var last time.Time
+	for {
+		current, err := toolchainFingerprint()
+		if err != nil {
+			return err
+		}
+		if current != toolchain || time.Since(last) >= interval {
+			if toolchain != "" && current != toolchain {
+				logInfof("daemon: go toolchain changed")
+			}
+			resetGoEnv()
+			for _, mod := range mods {
+				if _, err := Prefetch(ctx, cacheDir, mod, buildOptions()); err != nil {
+					logWarnf("daemon: %s: %v", mod, err)
+				}
+			}
+			if err := rebuildCached(ctx, cacheDir); err != nil {
+				logWarnf("daemon: %v", err)
+			}
+			refreshSubscriptions(ctx, cacheDir)
+			toolchain, last = current, time.Now()
+		}
+		if once {
+			return nil
+		}
+		time.Sleep(daemonPoll)
+	}
+}
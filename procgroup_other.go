@@ -0,0 +1,37 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// stopSignals are the signals which would stop va. An interrupt is sent to
+// the tool as well as va, as they share the console, so it is only caught,
+// so that va outlives the tool.
+var stopSignals = []os.Signal{os.Interrupt}
+
+// newProcessGroup does nothing, as process groups are only used on Unix.
+func newProcessGroup(cmd *exec.Cmd) {}
+
+// restoreForeground does nothing, as tools are never put in the foreground
+// in va's place here.
+func restoreForeground(cmd *exec.Cmd) {}
+
+// ownGroup reports that the command does not run in a process group of its
+// own, as none do here.
+func ownGroup(cmd *exec.Cmd) bool {
+	return false
+}
+
+// stopProcess kills the command which has been started, as there is no
+// signal to ask it to stop with instead.
+func stopProcess(cmd *exec.Cmd, kill bool) error {
+	return cmd.Process.Kill()
+}
+
+// signalProcess sends the signal to the command which has been started.
+func signalProcess(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
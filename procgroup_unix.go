@@ -0,0 +1,80 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// stopSignals are the signals which would stop va, which are caught while a
+// tool runs and passed on to it, as they would otherwise stop only va,
+// leaving the tool running without it.
+var stopSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+
+// newProcessGroup has the command start in a process group of its own, so
+// that it can be stopped along with everything it starts. If va is in the
+// foreground of the terminal its input is, the command's group is put there
+// in its place, so that the command can still read from the terminal, and
+// the keys which interrupt or quit go to it rather than to va.
+func newProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	if f, ok := cmd.Stdin.(*os.File); ok && inForeground(f) {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = int(f.Fd())
+	}
+}
+
+// inForeground reports whether the file is a terminal whose foreground
+// process group is va's.
+func inForeground(f *os.File) bool {
+	pgrp, err := unix.IoctlGetInt(int(f.Fd()), unix.TIOCGPGRP)
+	return err == nil && pgrp == syscall.Getpgrp()
+}
+
+// restoreForeground puts va's process group back in the foreground of the
+// terminal, if the command's group was put there in its place. va is not in
+// the foreground until then, so would be stopped for changing it, were that
+// not ignored while it does so.
+func restoreForeground(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil || !cmd.SysProcAttr.Foreground {
+		return
+	}
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	if err := unix.IoctlSetPointerInt(cmd.SysProcAttr.Ctty, unix.TIOCSPGRP, syscall.Getpgrp()); err != nil {
+		logDebugf("run: taking back the terminal: %v", err)
+	}
+}
+
+// ownGroup reports whether the command runs in a process group of its own.
+func ownGroup(cmd *exec.Cmd) bool {
+	return cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid
+}
+
+// stopProcess asks the command which has been started, and the rest of its
+// process group if it has one of its own, to stop with SIGTERM, or makes
+// them with SIGKILL if kill is set.
+func stopProcess(cmd *exec.Cmd, kill bool) error {
+	sig := syscall.SIGTERM
+	if kill {
+		sig = syscall.SIGKILL
+	}
+	return signalProcess(cmd, sig)
+}
+
+// signalProcess sends the signal to the command which has been started, and
+// the rest of its process group if it has one of its own.
+func signalProcess(cmd *exec.Cmd, sig os.Signal) error {
+	if ownGroup(cmd) {
+		return syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+	}
+	return cmd.Process.Signal(sig)
+}
@@ -0,0 +1,161 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// waitForFile waits for the file to be written by the tool, returning what
+// it holds.
+func waitForFile(t *testing.T, name string) string {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if b, err := os.ReadFile(name); err == nil && strings.HasSuffix(string(b), "\n") {
+			return strings.TrimSpace(string(b))
+		}
+	}
+	t.Fatalf("%s was never written", name)
+	return ""
+}
+
+// running reports whether the process is running, rather than gone or a
+// zombie waiting to be reaped.
+func running(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	return err != nil || !strings.Contains(string(b), ") Z ")
+}
+
+func TestRunTimeoutStopsProcessGroup(t *testing.T) {
+	sh := shell(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	script := fmt.Sprintf("sleep 30 & echo $! > %s; wait", pidFile)
+	if _, err := Run(ctx, nil, sh, []string{"-c", script}, nil, nil); err == nil {
+		t.Fatal("Run succeeded, want it stopped by the timeout")
+	}
+	pid, err := strconv.Atoi(waitForFile(t, pidFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); running(pid); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("process %d started by the tool is still running", pid)
+		}
+	}
+}
+
+func TestRunHookTimeoutStopsProcessGroup(t *testing.T) {
+	shell(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := RunHook(ctx, fmt.Sprintf("sleep 30 & echo $! > %s; wait", pidFile), 0); err == nil {
+		t.Fatal("RunHook succeeded, want it stopped by the timeout")
+	}
+	if took := time.Since(start); took > stopGrace {
+		t.Errorf("RunHook returned after %v, want the hook stopped when asked to", took)
+	}
+	pid, err := strconv.Atoi(waitForFile(t, pidFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); running(pid); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("process %d started by the hook is still running", pid)
+		}
+	}
+}
+
+func TestRunForwardsSignals(t *testing.T) {
+	for _, sig := range []syscall.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP} {
+		t.Run(sig.String(), func(t *testing.T) {
+			sh := shell(t)
+			ready := filepath.Join(t.TempDir(), "ready")
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			type result struct {
+				code int
+				err  error
+			}
+			done := make(chan result)
+			go func() {
+				script := fmt.Sprintf(`trap 'kill $!; exit 7' %d; sleep 30 & echo ready > %s; wait`, sig, ready)
+				code, err := Run(ctx, nil, sh, []string{"-c", script}, nil, nil)
+				done <- result{code, err}
+			}()
+			waitForFile(t, ready)
+			// The signal is sent to va alone, as kill would send it.
+			if err := syscall.Kill(os.Getpid(), sig); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case r := <-done:
+				if r.err != nil || r.code != 7 {
+					t.Errorf("Run = %d, %v, want the tool to exit 7 on %v", r.code, r.err, sig)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("the tool was not passed %v", sig)
+			}
+		})
+	}
+}
+
+func TestRunToolSignalledWithoutTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { *flagToolTimeout = timeout }(*flagToolTimeout)
+	*flagToolTimeout = 0
+	for _, tt := range []struct {
+		sig  syscall.Signal
+		want int
+	}{
+		// The tool shares va's process group, which the terminal would
+		// have interrupted as a whole, so it is left to finish.
+		{syscall.SIGINT, 0},
+		// Other signals are passed on to the tool.
+		{syscall.SIGTERM, 143},
+		{syscall.SIGHUP, 129},
+	} {
+		t.Run(tt.sig.String(), func(t *testing.T) {
+			sh := shell(t)
+			dir := t.TempDir()
+			ready, hook := filepath.Join(dir, "ready"), filepath.Join(dir, "hook")
+			link := Link{Short: "tool", Post: fmt.Sprintf(`echo "$VA_EXIT_CODE" > %s`, hook)}
+			done := make(chan int)
+			go func() {
+				script := fmt.Sprintf("echo ready > %s; sleep 1", ready)
+				done <- runTool(link, nil, sh, []string{"-c", script}, false)
+			}()
+			waitForFile(t, ready)
+			// The signal is sent to va alone, as kill would send it.
+			if err := syscall.Kill(os.Getpid(), tt.sig); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case code := <-done:
+				if code != tt.want {
+					t.Errorf("runTool = %d, want %d", code, tt.want)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("runTool did not return")
+			}
+			if got := waitForFile(t, hook); got != strconv.Itoa(tt.want) {
+				t.Errorf("post-run hook ran with $VA_EXIT_CODE=%s, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// Profiling of va itself, rather than the tools it runs, for working out
+// why resolving or building is slow. These flags are hidden from the usage,
+// as they are only of interest to those working on va.
+var (
+	flagCPUProfile = flag.String("cpuprofile", "", "write a CPU profile of va to the file")
+	flagMemProfile = flag.String("memprofile", "", "write a memory profile of va to the file, as it exits")
+	flagTrace      = flag.String("trace", "", "write an execution trace of va to the file")
+)
+
+// hiddenFlags are the flags left out of the usage.
+var hiddenFlags = map[string]bool{
+	"cpuprofile": true,
+	"memprofile": true,
+	"trace":      true,
+}
+
+// printDefaults prints the defaults of the flags which are not hidden.
+func printDefaults() {
+	visible := flag.NewFlagSet(flag.CommandLine.Name(), flag.ContinueOnError)
+	visible.SetOutput(flag.CommandLine.Output())
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// stopProfiling finishes any profiles being written, and must be called
+// before va exits.
+var stopProfiling = func() {}
+
+// startProfiling starts writing the profiles asked for with the flags, or
+// all of them into the directory named by $VA_PPROF.
+func startProfiling() error {
+	if dir := os.Getenv("VA_PPROF"); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		set := func(f *string, name string) {
+			if *f == "" {
+				*f = filepath.Join(dir, name)
+			}
+		}
+		set(flagCPUProfile, "cpu.pprof")
+		set(flagMemProfile, "mem.pprof")
+		set(flagTrace, "trace.out")
+	}
+
+	var stops []func()
+	stopProfiling = func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+		stops = nil
+	}
+	if *flagCPUProfile != "" {
+		f, err := os.Create(*flagCPUProfile)
+		if err != nil {
+			return err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return err
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+	if *flagTrace != "" {
+		f, err := os.Create(*flagTrace)
+		if err != nil {
+			return err
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return err
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			f.Close()
+		})
+	}
+	if *flagMemProfile != "" {
+		name := *flagMemProfile
+		stops = append(stops, func() {
+			f, err := os.Create(name)
+			if err != nil {
+				logWarnf("memprofile: %v", err)
+				return
+			}
+			defer f.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				logWarnf("memprofile: %v", err)
+			}
+		})
+	}
+	return nil
+}
+
+// exit finishes any profiles and traces, then exits with the exit code.
+func exit(code int) {
+	var err error
+	if code != 0 {
+		err = fmt.Errorf("exit status %d", code)
+	}
+	endRootSpan(err)
+	flushTracing()
+	stopProfiling()
+	os.Exit(code)
+}
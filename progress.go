@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+var flagProgress = flag.String("progress", "auto", "show the progress of downloads and builds: \"auto\" (only to a terminal), \"always\", \"never\", or \"json\" for a stream of events on stderr")
+
+const (
+	// progressDelay is how long something must take before its progress
+	// is shown, so that quick downloads and builds do not flicker.
+	progressDelay = 250 * time.Millisecond
+
+	// progressInterval is how often the progress is redrawn.
+	progressInterval = 100 * time.Millisecond
+)
+
+// spinner is drawn in turn to show va is still busy when it cannot tell how
+// far along it is.
+var spinner = []string{"|", "/", "-", "\\"}
+
+// checkProgress checks the --progress flag is one va knows.
+func checkProgress() error {
+	switch *flagProgress {
+	case "auto", "always", "never", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown progress mode: %s", *flagProgress)
+}
+
+// showProgress reports whether progress should be shown, which by default is
+// only when stderr is a terminal and va is logging as text, and not quietly.
+func showProgress() bool {
+	switch *flagProgress {
+	case "always":
+		return true
+	case "never", "json":
+		return false
+	}
+	logger.Lock()
+	plain := !logger.json && logger.level > logError
+	logger.Unlock()
+	return plain && os.Getenv("TERM") != "dumb" && isTerminal(os.Stderr)
+}
+
+// startProgress shows the progress of what the label describes on stderr,
+// until stop is called. If sizes is given, it returns how many bytes have
+// been done and how many there are in all, either of which may be 0 if it
+// is not known.
+func startProgress(label string, sizes func() (done, total int64)) (stop func()) {
+	if !showProgress() {
+		return func() {}
+	}
+	quit, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		start := time.Now()
+		select {
+		case <-quit:
+			return
+		case <-time.After(progressDelay):
+		}
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			var done, total int64
+			if sizes != nil {
+				done, total = sizes()
+			}
+			drawProgress(progressLine(spinner[frame%len(spinner)], label, done, total, time.Since(start)))
+			select {
+			case <-quit:
+				drawProgress("")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-exited
+	}
+}
+
+// progressLine renders the progress, fitting it to the width of the
+// terminal so that it can be redrawn in place.
+func progressLine(frame, label string, done, total int64, elapsed time.Duration) string {
+	line := frame + " " + label
+	switch {
+	case total > 0:
+		if done > total {
+			done = total
+		}
+		const barWidth = 20
+		filled := int(done * barWidth / total)
+		line += fmt.Sprintf("  [%s%s] %s of %s", strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), formatSize(done), formatSize(total))
+	case done > 0:
+		line += "  " + formatSize(done)
+	}
+	line += "  " + elapsed.Truncate(time.Second).String()
+	if width, err := terminalWidth(os.Stderr); err == nil && width > 1 {
+		line = truncate(line, width-1)
+	}
+	return line
+}
+
+// drawProgress replaces the progress shown on stderr with the line, or
+// clears it if the line is empty. Anything logged in the meantime is
+// written above it.
+func drawProgress(line string) {
+	logger.Lock()
+	defer logger.Unlock()
+	fmt.Fprint(os.Stderr, "\r\x1b[K"+line)
+	logger.progress = line
+}
+
+// startDownloadProgress shows the progress of downloading the module into
+// the module cache, by watching its zip file grow, until stop is called.
+func startDownloadProgress(ctx context.Context, modPath, version string) (stop func()) {
+	if !showProgress() && *flagProgress != "json" {
+		return func() {}
+	}
+	var total int64
+	go func() {
+		proxy, err := NewProxyClient(ctx)
+		if err != nil {
+			return
+		}
+		if size, err := proxy.ZipSize(ctx, modPath, version); err == nil {
+			atomic.StoreInt64(&total, size)
+		}
+	}()
+
+	var zip string
+	modCache, err := GoModCache(ctx)
+	enc, perr := module.EscapePath(modPath)
+	encVersion, verr := module.EscapeVersion(version)
+	if err == nil && perr == nil && verr == nil {
+		zip = filepath.Join(modCache, "cache", "download", enc, "@v", encVersion+".zip")
+	}
+	sizes := func() (int64, int64) {
+		return downloadedSize(zip), atomic.LoadInt64(&total)
+	}
+	if *flagProgress == "json" {
+		return startDownloadEvents(modPath, version, sizes)
+	}
+	return startProgress("downloading "+modPath+"@"+version, sizes)
+}
+
+// downloadedSize returns how much of the zip file has been downloaded. The
+// go command downloads it to a temporary file alongside, then renames it.
+func downloadedSize(zip string) int64 {
+	if zip == "" {
+		return 0
+	}
+	names, _ := filepath.Glob(zip + "*")
+	var size int64
+	for _, name := range names {
+		if strings.HasSuffix(name, ".ziphash") {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil && info.Size() > size {
+			size = info.Size()
+		}
+	}
+	return size
+}
+
+// progressEvent is an event written to stderr by --progress=json, one to a
+// line, so that whatever runs va can show its progress in its own way.
+type progressEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"` // What happened, such as "build-start".
+
+	Tool     string        `json:"tool,omitempty"`     // Tool, as asked for.
+	Module   string        `json:"module,omitempty"`   // Module being downloaded.
+	Version  string        `json:"version,omitempty"`  // Version being downloaded.
+	Dir      string        `json:"dir,omitempty"`      // Directory being built.
+	Path     string        `json:"path,omitempty"`     // Binary being run.
+	Args     []string      `json:"args,omitempty"`     // Arguments it is run with.
+	Done     int64         `json:"done,omitempty"`     // Bytes downloaded so far.
+	Total    int64         `json:"total,omitempty"`    // Bytes to download, if known.
+	Duration time.Duration `json:"duration,omitempty"` // In nanoseconds.
+	ExitCode *int          `json:"exit_code,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// emitEvent writes the event, if --progress=json asks for events.
+func emitEvent(ev progressEvent) {
+	if *flagProgress != "json" {
+		return
+	}
+	ev.Time = time.Now()
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	logger.Lock()
+	defer logger.Unlock()
+	os.Stderr.Write(append(b, '\n'))
+}
+
+// startDownloadEvents emits download-progress events for the module as its
+// download grows, and a last one when stop is called.
+func startDownloadEvents(modPath, version string, sizes func() (done, total int64)) (stop func()) {
+	quit, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(progressDelay)
+		defer ticker.Stop()
+		last := int64(-1)
+		for {
+			var finished bool
+			select {
+			case <-quit:
+				finished = true
+			case <-ticker.C:
+			}
+			if done, total := sizes(); done != last || finished {
+				emitEvent(progressEvent{Event: "download-progress", Module: modPath, Version: version, Done: done, Total: total})
+				last = done
+			}
+			if finished {
+				return
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-exited
+	}
+}
+
+// errorText returns the text of the error, or "" if there is none.
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
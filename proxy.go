@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// errNoProxy is returned when a module proxy cannot answer a question, and
+// so the go command must be asked instead. This is the case when the proxy
+// list reaches "direct" or "off", when the module is private, and for
+// version queries more complex than "latest".
+var errNoProxy = errors.New("no module proxy can answer")
+
+// errProxyNotFound is returned when the module proxies do not know of the
+// module, or of the version asked for.
+var errProxyNotFound = errors.New("not found")
+
+// ProxyClient speaks the module proxy protocol (see "go help goproxy") to
+// the proxies listed in GOPROXY, which is much faster than asking the go
+// command to do the same.
+type ProxyClient struct {
+	proxies   []proxyEntry
+	noProxy   string // Patterns of module paths which must not use a proxy.
+	userAgent string
+}
+
+// proxyEntry is an entry in the GOPROXY list.
+type proxyEntry struct {
+	url string
+	// anyError is set when the entry was followed by "|", so the next
+	// entry is tried after any error, not just "not found".
+	anyError bool
+}
+
+// NewProxyClient returns a client for the proxies configured for the go
+// command, or for the single proxy within the context if there is one.
+func NewProxyClient(ctx context.Context) (*ProxyClient, error) {
+	vars, err := goEnvVars(ctx, "GOPROXY", "GONOPROXY")
+	if err != nil {
+		return nil, err
+	}
+	if source, ok := proxySourceFrom(ctx); ok {
+		return newProxyClient(source, vars["GONOPROXY"]), nil
+	}
+	return newProxyClient(vars["GOPROXY"], vars["GONOPROXY"]), nil
+}
+
+// newProxyClient returns a client for the proxies in the GOPROXY list, which
+// are not used for modules matching the GONOPROXY patterns.
+func newProxyClient(goproxy, noProxy string) *ProxyClient {
+	c := &ProxyClient{noProxy: noProxy, userAgent: "va"}
+	for goproxy != "" {
+		i := strings.IndexAny(goproxy, ",|")
+		entry := proxyEntry{url: goproxy}
+		if i >= 0 {
+			entry = proxyEntry{url: goproxy[:i], anyError: goproxy[i] == '|'}
+			goproxy = goproxy[i+1:]
+		} else {
+			goproxy = ""
+		}
+		entry.url = strings.TrimSuffix(strings.TrimSpace(entry.url), "/")
+		if entry.url != "" {
+			c.proxies = append(c.proxies, entry)
+		}
+	}
+	return c
+}
+
+// get fetches the file for the module from the first proxy that has it.
+func (c *ProxyClient) get(ctx context.Context, modPath, file string) ([]byte, error) {
+	if module.MatchPrefixPatterns(c.noProxy, modPath) {
+		return nil, errNoProxy
+	}
+	enc, err := module.EscapePath(modPath)
+	if err != nil {
+		return nil, err
+	}
+	notFound := errProxyNotFound
+	for _, p := range c.proxies {
+		if p.url == "direct" || p.url == "off" {
+			return nil, errNoProxy
+		}
+		var b []byte
+		err := retry(ctx, retryPolicy, func() (err error) {
+			b, err = c.fetch(ctx, p.url+"/"+enc+"/"+file)
+			return err
+		})
+		if err == nil {
+			return b, nil
+		}
+		if errors.Is(err, errProxyNotFound) {
+			notFound = err
+		} else if !p.anyError {
+			return nil, fmt.Errorf("proxy %s: %w", p.url, err)
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", modPath, notFound)
+}
+
+// fetch fetches the URL, returning errProxyNotFound if the proxy said the
+// file was not found or has gone, as the go command does. The proxy's reason
+// is kept, as it may tell why, such as the host of the import path not
+// serving go-import meta tags, which fatalDownloadError looks for.
+func (c *ProxyClient) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return b, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		if msg := strings.TrimPrefix(proxyMessage(b), "not found: "); msg != "" {
+			return nil, fmt.Errorf("%w: %s", errProxyNotFound, msg)
+		}
+		return nil, errProxyNotFound
+	default:
+		err := fmt.Errorf("%s: %s", resp.Status, proxyMessage(b))
+		if transientStatus(resp.StatusCode) {
+			return nil, transient(err)
+		}
+		return nil, err
+	}
+}
+
+// proxyMessage returns what the proxy said in the body of a response which
+// was not successful, cut short if it said a lot.
+func proxyMessage(b []byte) string {
+	msg := strings.TrimSpace(string(b))
+	if len(msg) > 200 {
+		msg = msg[:200]
+	}
+	return msg
+}
+
+// ZipSize returns the size of the zip file of the module at the version,
+// as the first proxy which has it says it is, without downloading it.
+func (c *ProxyClient) ZipSize(ctx context.Context, modPath, version string) (int64, error) {
+	if module.MatchPrefixPatterns(c.noProxy, modPath) {
+		return 0, errNoProxy
+	}
+	enc, err := module.EscapePath(modPath)
+	if err != nil {
+		return 0, err
+	}
+	encVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range c.proxies {
+		if p.url == "direct" || p.url == "off" {
+			return 0, errNoProxy
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.url+"/"+enc+"/@v/"+encVersion+".zip", nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("User-Agent", c.userAgent)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusOK && resp.ContentLength >= 0:
+			return resp.ContentLength, nil
+		case resp.StatusCode == http.StatusOK:
+			return 0, errors.New("size not given")
+		case resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone && !p.anyError:
+			return 0, fmt.Errorf("proxy %s: %s", p.url, resp.Status)
+		}
+	}
+	return 0, fmt.Errorf("%s@%s: %w", modPath, version, errProxyNotFound)
+}
+
+// Versions lists the released versions of the module, including any which
+// have been retracted, sorted in semver order.
+func (c *ProxyClient) Versions(ctx context.Context, modPath string) ([]string, error) {
+	b, err := c.get(ctx, modPath, "@v/list")
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, v := range strings.Fields(string(b)) {
+		if semver.IsValid(v) {
+			versions = append(versions, v)
+		}
+	}
+	semver.Sort(versions)
+	return versions, nil
+}
+
+// Latest returns the version that the "latest" query resolves to for the
+// module, as the go command would: the newest release, or the newest
+// pre-release if there are no releases, or the newest pseudo-version if
+// there are no tagged versions at all.
+//
+// Unlike the go command, retractions are not considered, as that would mean
+// downloading the go.mod file of the newest version.
+func (c *ProxyClient) Latest(ctx context.Context, modPath string) (string, error) {
+	versions, err := c.Versions(ctx, modPath)
+	if err != nil {
+		return "", err
+	}
+	var release, prerelease string
+	for _, v := range versions {
+		if semver.Prerelease(v) == "" {
+			release = v
+		} else {
+			prerelease = v
+		}
+	}
+	switch {
+	case release != "":
+		return release, nil
+	case prerelease != "":
+		return prerelease, nil
+	}
+
+	b, err := c.get(ctx, modPath, "@latest")
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		Version string
+	}
+	if err := json.Unmarshal(b, &info); err != nil {
+		return "", fmt.Errorf("json: %w", err)
+	}
+	return info.Version, nil
+}
+
+// Query resolves the version query for the module. Only "latest" and
+// specific versions are understood; other queries return errNoProxy, so
+// that the go command is asked instead.
+func (c *ProxyClient) Query(ctx context.Context, modPath, query string) (string, error) {
+	switch {
+	case query == "latest":
+		return c.Latest(ctx, modPath)
+	case !isQuery(query):
+		if _, err := c.get(ctx, modPath, "@v/"+query+".info"); err != nil {
+			return "", err
+		}
+		return query, nil
+	default:
+		return "", errNoProxy
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// testModule is a module served by a test proxy.
+type testModule struct {
+	Path    string
+	Version string
+	// GoMod is the go.mod file of the module, which is a bare module
+	// directive if it is not given.
+	GoMod string
+	// Files are the other files in the module, by their path within it.
+	Files map[string]string
+}
+
+// writeTestProxy writes the modules to a directory laid out as a module
+// proxy, returning the directory.
+func writeTestProxy(t *testing.T, mods ...testModule) string {
+	t.Helper()
+	dir := t.TempDir()
+	versions := make(map[string][]string)
+	for i, m := range mods {
+		goMod := m.GoMod
+		if goMod == "" {
+			goMod = "module " + m.Path + "\n"
+		}
+		vdir := filepath.Join(dir, filepath.FromSlash(m.Path), "@v")
+		if err := os.MkdirAll(vdir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		stamp := time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		info := fmt.Sprintf("{\"Version\":%q,\"Time\":%q}\n", m.Version, stamp)
+		if err := os.WriteFile(filepath.Join(vdir, m.Version+".info"), []byte(info), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(vdir, m.Version+".mod"), []byte(goMod), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(filepath.Join(vdir, m.Version+".zip"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		files := map[string]string{"go.mod": goMod}
+		for name, data := range m.Files {
+			files[name] = data
+		}
+		for name, data := range files {
+			w, err := zw.Create(m.Path + "@" + m.Version + "/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		versions[m.Path] = append(versions[m.Path], m.Version)
+	}
+	for path, vs := range versions {
+		semver.Sort(vs)
+		list := filepath.Join(dir, filepath.FromSlash(path), "@v", "list")
+		if err := os.WriteFile(list, []byte(strings.Join(vs, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// useTestProxy serves the modules from a test proxy, which both va and the
+// go command are told to use, with a module cache of their own, from a
+// directory of their own. It returns the URL of the proxy.
+func useTestProxy(t *testing.T, mods ...testModule) string {
+	t.Helper()
+	return useProxyHandler(t, http.FileServer(http.Dir(writeTestProxy(t, mods...))))
+}
+
+// useProxyHandler is useTestProxy for a proxy served by the handler.
+func useProxyHandler(t *testing.T, h http.Handler) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	for k, v := range map[string]string{
+		"GOPROXY":     srv.URL,
+		"GONOPROXY":   "",
+		"GOPRIVATE":   "",
+		"GOSUMDB":     "off",
+		"GOFLAGS":     "-modcacherw",
+		"GOMODCACHE":  t.TempDir(),
+		"GOTOOLCHAIN": "local",
+		"GOWORK":      "off",
+	} {
+		t.Setenv(k, v)
+	}
+	// The go command is run outside of any module, as it is by anyone
+	// running a tool from anywhere, rather than within va's own.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	// The go command's environment is remembered for the life of the
+	// process, so must be forgotten both now and once the test is done.
+	resetGoEnv := func() {
+		goEnvState.Lock()
+		goEnvState.vars = nil
+		goEnvState.Unlock()
+	}
+	resetGoEnv()
+	t.Cleanup(resetGoEnv)
+	return srv.URL
+}
+
+// proxyResponse is what a test proxy answers for a file.
+type proxyResponse struct {
+	status int
+	body   string
+}
+
+// startProxy starts a module proxy answering with the responses, by the
+// path of the file asked for, and "404 Not Found" for any other file. It
+// returns the URL of the proxy and the number of requests for each file.
+func startProxy(t *testing.T, files map[string]proxyResponse) (string, map[string]int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		resp, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(resp.status)
+		io.WriteString(w, resp.body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, requests
+}
+
+func TestProxyClientQuery(t *testing.T) {
+	old := retryPolicy
+	retryPolicy = RetryPolicy{Retries: 1, Base: time.Millisecond, Max: time.Millisecond}
+	t.Cleanup(func() { retryPolicy = old })
+
+	url, requests := startProxy(t, map[string]proxyResponse{
+		"/example.com/released/@v/list":        {200, "v1.2.0\nv1.10.0\nv1.11.0-rc.1\nnot-a-version\nv1.9.0\n"},
+		"/example.com/prerelease/@v/list":      {200, "v0.1.0-alpha\nv0.1.0-beta\n"},
+		"/example.com/untagged/@v/list":        {200, ""},
+		"/example.com/untagged/@latest":        {200, `{"Version":"v0.0.0-20240101000000-abcdefabcdef","Time":"2024-01-01T00:00:00Z"}`},
+		"/example.com/badjson/@v/list":         {200, ""},
+		"/example.com/badjson/@latest":         {200, "{"},
+		"/example.com/gone/@v/list":            {410, "not found: example.com/gone@latest: module removed\n"},
+		"/example.com/forbidden/@v/list":       {403, "forbidden\n"},
+		"/example.com/unavailable/@v/list":     {503, "try again later\n"},
+		"/example.com/released/@v/v1.2.0.info": {200, `{"Version":"v1.2.0"}`},
+		"/example.com/!upper!case/@v/list":     {200, "v2.0.0\n"},
+	})
+	ctx := context.Background()
+	c := newProxyClient(url, "")
+	for _, tt := range []struct {
+		modPath, query string
+		want           string
+		wantErr        error  // Wrapped by the error, if any.
+		wantMsg        string // Within the error, if any.
+	}{
+		{modPath: "example.com/released", query: "latest", want: "v1.10.0"},
+		{modPath: "example.com/prerelease", query: "latest", want: "v0.1.0-beta"},
+		{modPath: "example.com/untagged", query: "latest", want: "v0.0.0-20240101000000-abcdefabcdef"},
+		{modPath: "example.com/UpperCase", query: "latest", want: "v2.0.0"},
+		{modPath: "example.com/released", query: "v1.2.0", want: "v1.2.0"},
+		{modPath: "example.com/released", query: "v1.3.0", wantErr: errProxyNotFound},
+		{modPath: "example.com/released", query: "master", wantErr: errNoProxy},
+		{modPath: "example.com/missing", query: "latest", wantErr: errProxyNotFound},
+		{modPath: "example.com/gone", query: "latest", wantErr: errProxyNotFound, wantMsg: "module removed"},
+		{modPath: "example.com/badjson", query: "latest", wantMsg: "json: "},
+		{modPath: "example.com/forbidden", query: "latest", wantMsg: "403 Forbidden: forbidden"},
+		{modPath: "example.com/unavailable", query: "latest", wantMsg: "503 Service Unavailable: try again later"},
+	} {
+		got, err := c.Query(ctx, tt.modPath, tt.query)
+		if tt.wantErr == nil && tt.wantMsg == "" {
+			if err != nil || got != tt.want {
+				t.Errorf("Query(%s, %s) = %q, %v, want %s", tt.modPath, tt.query, got, err, tt.want)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Query(%s, %s) = %q, want an error", tt.modPath, tt.query, got)
+			continue
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("Query(%s, %s): %v, want %v", tt.modPath, tt.query, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && errors.Is(err, errProxyNotFound) {
+			t.Errorf("Query(%s, %s): %v, want it not to be %v", tt.modPath, tt.query, err, errProxyNotFound)
+		}
+		if !strings.Contains(err.Error(), tt.wantMsg) {
+			t.Errorf("Query(%s, %s): %v, want it to say %q", tt.modPath, tt.query, err, tt.wantMsg)
+		}
+	}
+
+	// Only failures which may go away are retried.
+	if n := requests["/example.com/unavailable/@v/list"]; n != 2 {
+		t.Errorf("503 was asked for %d times, want 2", n)
+	}
+	if n := requests["/example.com/forbidden/@v/list"]; n != 1 {
+		t.Errorf("403 was asked for %d times, want 1", n)
+	}
+}
+
+func TestProxyClientQueryList(t *testing.T) {
+	empty, _ := startProxy(t, nil)
+	failing, _ := startProxy(t, map[string]proxyResponse{
+		"/example.com/a/@v/list": {403, "forbidden\n"},
+	})
+	serving, _ := startProxy(t, map[string]proxyResponse{
+		"/example.com/a/@v/list": {200, "v1.0.0\n"},
+	})
+	ctx := context.Background()
+	for _, tt := range []struct {
+		goproxy, noProxy string
+		want             string
+		wantErr          error
+	}{
+		// Not found moves on to the next proxy, whichever the separator.
+		{goproxy: empty + "," + serving, want: "v1.0.0"},
+		{goproxy: empty + "|" + serving, want: "v1.0.0"},
+		// Other errors only do after "|".
+		{goproxy: failing + "|" + serving, want: "v1.0.0"},
+		{goproxy: failing + "," + serving},
+		{goproxy: empty, wantErr: errProxyNotFound},
+		// The go command is left to go direct, or not at all.
+		{goproxy: empty + ",direct", wantErr: errNoProxy},
+		{goproxy: "off", wantErr: errNoProxy},
+		{goproxy: serving, noProxy: "example.com", wantErr: errNoProxy},
+	} {
+		got, err := newProxyClient(tt.goproxy, tt.noProxy).Query(ctx, "example.com/a", "latest")
+		switch {
+		case tt.want != "":
+			if err != nil || got != tt.want {
+				t.Errorf("Query via %s = %q, %v, want %s", tt.goproxy, got, err, tt.want)
+			}
+		case tt.wantErr != nil:
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Query via %s = %q, %v, want %v", tt.goproxy, got, err, tt.wantErr)
+			}
+		case err == nil || errors.Is(err, errProxyNotFound):
+			t.Errorf("Query via %s = %q, %v, want the proxy's error", tt.goproxy, got, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// proxyChain is the ordered list of module proxies which Download tries in
+// turn, set by --proxy. Each entry is a proxy URL, or "direct" or "off" as
+// in GOPROXY. When it is empty, GOPROXY is used as the go command would.
+var proxyChain []string
+
+// parseProxyChain splits a list of proxies separated by commas or "|". Both
+// mean the same to va, which moves on to the next proxy after any error.
+func parseProxyChain(list string) []string {
+	var chain []string
+	for _, entry := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '|' }) {
+		if entry = strings.TrimSuffix(strings.TrimSpace(entry), "/"); entry != "" {
+			chain = append(chain, entry)
+		}
+	}
+	return chain
+}
+
+// useProxyChain sets the proxies for Download to try, and sets GOPROXY so
+// that the go command falls back through the same proxies after any error
+// when it downloads anything else, such as the dependencies of the tool.
+func useProxyChain(list string) error {
+	proxyChain = parseProxyChain(list)
+	if len(proxyChain) == 0 {
+		return nil
+	}
+	return os.Setenv("GOPROXY", strings.Join(proxyChain, "|"))
+}
+
+// proxySourceKey is the context key for the single proxy which the go
+// command and the proxy client must use, while Download tries it.
+type proxySourceKey struct{}
+
+// withProxySource returns a context in which only the proxy is used to find
+// and download modules.
+func withProxySource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, proxySourceKey{}, source)
+}
+
+// proxySourceFrom returns the single proxy to use within the context, if
+// there is one.
+func proxySourceFrom(ctx context.Context) (string, bool) {
+	source, ok := ctx.Value(proxySourceKey{}).(string)
+	return source, ok
+}
+
+// goCommand returns the go command with the arguments, using only the proxy
+// within the context if there is one.
+func goCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	if source, ok := proxySourceFrom(ctx); ok {
+		cmd.Env = append(os.Environ(), "GOPROXY="+source)
+	}
+	return cmd
+}
+
+// fetchFromChain tries each proxy in the chain in turn to find and download
+// the module, reporting which one served it. Every proxy is tried whatever
+// the error, as a proxy further along may well know of modules that one
+// before it does not, or be reachable when it is not.
+func fetchFromChain(ctx context.Context, path, version string) (Module, error) {
+	var failed []string
+	for i, source := range proxyChain {
+		m, err := fetchModule(withProxySource(ctx, source), path, version)
+		if err == nil {
+			logInfof("%s@%s served by %s", m.Path, m.Version, source)
+			return m, nil
+		}
+		if ctx.Err() != nil || i == len(proxyChain)-1 {
+			if len(failed) == 0 {
+				return Module{}, fmt.Errorf("%s: %w", source, err)
+			}
+			return Module{}, fmt.Errorf("no proxy could serve %s@%s:\n\t%s\n\t%s: %w", path, version, strings.Join(failed, "\n\t"), source, err)
+		}
+		failed = append(failed, fmt.Sprintf("%s: %v", source, err))
+	}
+	return Module{}, fmt.Errorf("no proxies to try")
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// errNotCached is returned by a RemoteCache which does not have a tool.
+var errNotCached = errors.New("not cached")
+
+// RemoteCache is a cache of built tools shared between machines, such as
+// those of an office or a CI fleet. Tools are identified by the hash of their
+// ToolKey, which covers everything that affects how the tool was built.
+//
+// A remote cache is trusted as much as the machines which build the tools
+// in it: the tools it serves are run as they are, as if they had been built
+// here. Each tool is stored with the SHA-256 of its contents, which is
+// checked when it is fetched, but as the SHA-256 comes from the cache too,
+// that only catches tools which were corrupted, or cut short, on the way to
+// or from the cache, not ones which anyone who can write to it changed.
+type RemoteCache interface {
+	// Get fetches the tool, returning errNotCached if it is not there,
+	// along with the SHA-256 of its contents in hex, if the cache has it.
+	Get(ctx context.Context, hash string) (io.ReadCloser, string, error)
+	// Put stores the tool, which is size bytes long, and whose contents
+	// have the SHA-256 sum, in hex.
+	Put(ctx context.Context, hash string, r io.Reader, size int64, sum string) error
+}
+
+// remoteCacheFromEnv returns the remote cache at the URL in
+// $VA_REMOTE_CACHE, or remote-cache in the configuration file, or nil if it
+// is not set. As well as the "http" and "https" schemes for a server such
+// as "va cache-server", cloud storage buckets may be used with
+// "s3://bucket/prefix", "gs://bucket/prefix", and
+// "azblob://account/container/prefix". It is also nil when offline.
+func remoteCacheFromEnv() (RemoteCache, error) {
+	raw := os.Getenv("VA_REMOTE_CACHE")
+	if raw == "" || offline {
+		return nil, nil
+	}
+	return newRemoteCache(raw)
+}
+
+// remoteCacheToken returns the token which clients of "va cache-server" give
+// it to store tools, and which the server expects of them:
+// $VA_REMOTE_CACHE_TOKEN, or remote-cache-token in the configuration file.
+func remoteCacheToken() string {
+	return os.Getenv("VA_REMOTE_CACHE_TOKEN")
+}
+
+// newRemoteCache returns the remote cache at the URL.
+func newRemoteCache(raw string) (RemoteCache, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("remote cache: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		base := strings.TrimSuffix(u.String(), "/")
+		return &objectCache{
+			url:    func(hash string) string { return base + "/bin/" + hash },
+			sign:   bearer(remoteCacheToken()),
+			digest: digestHeader,
+		}, nil
+	case "s3":
+		return newS3Cache(u)
+	case "gs":
+		return newGCSCache(u)
+	case "azblob":
+		return newAzureCache(u)
+	default:
+		return nil, fmt.Errorf("remote cache: unsupported scheme: %q", u.Scheme)
+	}
+}
+
+// fetchRemote fetches the tool from the remote cache into the file, checking
+// its contents have the SHA-256 the cache has for it, if it has one.
+func fetchRemote(ctx context.Context, remote RemoteCache, hash, name string) error {
+	r, sum, err := remote.Get(ctx, hash)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && sum != "" && hex.EncodeToString(h.Sum(nil)) != sum {
+		err = fmt.Errorf("get %s: contents do not match their SHA-256, %s", hash, sum)
+	}
+	if err != nil {
+		os.Remove(name)
+		return err
+	}
+	return nil
+}
+
+// pushRemote stores the tool in the file in the remote cache.
+func pushRemote(ctx context.Context, remote RemoteCache, hash, name string) error {
+	sum, err := hashFile(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return remote.Put(ctx, hash, f, info.Size(), sum)
+}
+
+// objectCache is a remote cache kept in an HTTP object store, such as that
+// served by "va cache-server" or a cloud storage bucket, where each tool is
+// an object fetched with GET and stored with PUT.
+type objectCache struct {
+	// url returns the URL of the object holding the tool.
+	url func(hash string) string
+	// sign authenticates the request, if needed.
+	sign func(req *http.Request) error
+	// digest is the header the SHA-256 of the tool is stored in alongside
+	// it, as the store's metadata, and is given back in.
+	digest string
+}
+
+func (c *objectCache) do(req *http.Request) (*http.Response, error) {
+	if c.sign != nil {
+		if err := c.sign(req); err != nil {
+			return nil, err
+		}
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func (c *objectCache) Get(ctx context.Context, hash string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(hash), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var sum string
+		if c.digest != "" {
+			sum = strings.ToLower(resp.Header.Get(c.digest))
+		}
+		return resp.Body, sum, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, "", errNotCached
+	default:
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("get %s: %s", hash, resp.Status)
+	}
+}
+
+func (c *objectCache) Put(ctx context.Context, hash string, r io.Reader, size int64, sum string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(hash), r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if c.digest != "" {
+		req.Header.Set(c.digest, sum)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("put %s: %s", hash, resp.Status)
+	}
+	return nil
+}
+
+// bearer returns a function which authenticates requests with the bearer
+// token, or nil if there is no token.
+func bearer(token string) func(req *http.Request) error {
+	if token == "" {
+		return nil
+	}
+	return func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+// reHash matches the hash of a ToolKey.
+var reHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// digestHeader is the header the SHA-256 of a tool is sent in, to and from
+// "va cache-server".
+const digestHeader = "X-Va-Sha256"
+
+// cacheServer serves a directory of tools to httpCache clients. Each tool is
+// stored with the SHA-256 of its contents, in a file named by its hash and
+// ".sha256". Without a token, tools are only ever served, never stored, as
+// anyone able to store a tool could have it run by every client.
+type cacheServer struct {
+	dir      string
+	token    string // Bearer token required of clients, if set.
+	readOnly bool   // Refuse to store tools sent by clients.
+	maxSize  int64  // Refuse to store tools bigger than this, if set.
+}
+
+func (s *cacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hash := strings.TrimPrefix(r.URL.Path, "/bin/")
+	if !reHash.MatchString(hash) {
+		http.NotFound(w, r)
+		return
+	}
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	name := filepath.Join(s.dir, hash)
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if sum, err := os.ReadFile(name + ".sha256"); err == nil {
+			w.Header().Set(digestHeader, strings.TrimSpace(string(sum)))
+		}
+		http.ServeFile(w, r, name)
+	case http.MethodPut:
+		if s.readOnly || s.token == "" {
+			http.Error(w, "read-only", http.StatusForbidden)
+			return
+		}
+		body := io.Reader(r.Body)
+		if s.maxSize > 0 {
+			body = http.MaxBytesReader(w, r.Body, s.maxSize)
+		}
+		if err := s.store(name, body, strings.ToLower(r.Header.Get(digestHeader))); err != nil {
+			switch {
+			case errors.Is(err, errToolTooLarge):
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			case errors.Is(err, errDigestMismatch):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// errToolTooLarge is returned by cacheServer.store when a tool sent by a
+// client is bigger than the server stores.
+var errToolTooLarge = errors.New("tool too large")
+
+// errDigestMismatch is returned by cacheServer.store when a tool sent by a
+// client does not have the SHA-256 it was sent with.
+var errDigestMismatch = errors.New("contents do not match their SHA-256")
+
+// store writes the tool to a temporary file, then moves it into place, so
+// that clients never see a partially written tool. If the client sent the
+// SHA-256 of the tool, it must match what was received. The SHA-256 is
+// written before the tool is moved into place, so that no client is served
+// the tool with the SHA-256 of the one it replaced.
+func (s *cacheServer) store(name string, r io.Reader, want string) error {
+	f, err := os.CreateTemp(s.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// The body is cut off by http.MaxBytesReader once it is bigger
+		// than the server stores.
+		if s.maxSize > 0 && n >= s.maxSize {
+			return errToolTooLarge
+		}
+		return err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if want != "" && sum != want {
+		return errDigestMismatch
+	}
+	if err := writeFileAtomic(name+".sha256", []byte(sum+"\n")); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
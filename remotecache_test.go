@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testHash is the hash of a ToolKey, which tools are stored by.
+var testHash = strings.Repeat("ab", 32)
+
+// startCacheServer starts a cacheServer storing tools in a temporary
+// directory, returning the server and a client of it.
+func startCacheServer(t *testing.T, srv *cacheServer) (*cacheServer, *objectCache) {
+	t.Helper()
+	srv.dir = t.TempDir()
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return srv, &objectCache{
+		url:    func(hash string) string { return ts.URL + "/bin/" + hash },
+		sign:   bearer(srv.token),
+		digest: digestHeader,
+	}
+}
+
+// writeTool writes a tool with the contents to a temporary file.
+func writeTool(t *testing.T, contents string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(name, []byte(contents), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestRemoteCacheRoundTrip(t *testing.T) {
+	srv, client := startCacheServer(t, &cacheServer{token: "secret"})
+	ctx := context.Background()
+	dest := filepath.Join(t.TempDir(), "fetched")
+	if err := fetchRemote(ctx, client, testHash, dest); !errors.Is(err, errNotCached) {
+		t.Fatalf("fetchRemote before push: %v, want %v", err, errNotCached)
+	}
+	if err := pushRemote(ctx, client, testHash, writeTool(t, "#!/bin/sh\necho hello\n")); err != nil {
+		t.Fatalf("pushRemote: %v", err)
+	}
+	if err := fetchRemote(ctx, client, testHash, dest); err != nil {
+		t.Fatalf("fetchRemote: %v", err)
+	}
+	if b, _ := os.ReadFile(dest); string(b) != "#!/bin/sh\necho hello\n" {
+		t.Errorf("fetched %q, want the tool pushed", b)
+	}
+
+	// A tool corrupted in the cache is not used.
+	if err := os.WriteFile(filepath.Join(srv.dir, testHash), []byte("#!/bin/sh\necho hellp\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchRemote(ctx, client, testHash, dest); err == nil || errors.Is(err, errNotCached) {
+		t.Errorf("fetchRemote of a corrupted tool: %v, want a mismatch", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("corrupted tool was left at %s", dest)
+	}
+}
+
+func TestCacheServerRefusals(t *testing.T) {
+	srv, client := startCacheServer(t, &cacheServer{token: "secret", maxSize: 16})
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name     string
+		token    string
+		contents string
+		sum      string
+		want     int
+	}{
+		{"no token", "", "small", "", http.StatusUnauthorized},
+		{"wrong token", "secrets", "small", "", http.StatusUnauthorized},
+		{"too large", "secret", strings.Repeat("x", 17), "", http.StatusRequestEntityTooLarge},
+		{"wrong digest", "secret", "small", strings.Repeat("0", 64), http.StatusBadRequest},
+		{"stored", "secret", strings.Repeat("x", 16), "", http.StatusCreated},
+	} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, client.url(testHash), strings.NewReader(tt.contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		if tt.sum != "" {
+			req.Header.Set(digestHeader, tt.sum)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: PUT = %s, want %d", tt.name, resp.Status, tt.want)
+		}
+		if _, err := os.Stat(filepath.Join(srv.dir, testHash)); (err == nil) != (tt.want == http.StatusCreated) {
+			t.Errorf("%s: tool stored = %v, want %v", tt.name, err == nil, tt.want == http.StatusCreated)
+		}
+	}
+}
+
+func TestCacheServerWithoutToken(t *testing.T) {
+	// Without a token, the server only serves tools, as anyone could store
+	// one for every client to run.
+	srv, client := startCacheServer(t, &cacheServer{})
+	ctx := context.Background()
+	if err := pushRemote(ctx, client, testHash, writeTool(t, "#!/bin/sh\necho hello\n")); err == nil {
+		t.Error("pushRemote to a server without a token succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(srv.dir, testHash)); err == nil {
+		t.Error("a server without a token stored a tool")
+	}
+
+	// Nor does cache-server start one which would store tools.
+	t.Setenv("VA_CACHE_DIR", t.TempDir())
+	t.Setenv("VA_STATE_DIR", t.TempDir())
+	t.Setenv("VA_REMOTE_CACHE_TOKEN", "")
+	if err := cmdCacheServer(nil, []string{"--listen", "localhost:0"}); err == nil || !strings.Contains(err.Error(), "VA_REMOTE_CACHE_TOKEN") {
+		t.Errorf("cache-server without a token = %v, want it to refuse to start", err)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// subscriptionsFile is the file within va's configuration directory which
+// records the remote lists subscribed to.
+const subscriptionsFile = "subscriptions.json"
+
+// remoteListsDir is the directory within the cache directory where remote
+// lists are kept between fetches.
+const remoteListsDir = "remote-lists"
+
+// remoteListTimeout bounds refreshing the remote lists in the background,
+// so that a server which does not answer is not waited on forever.
+const remoteListTimeout = 10 * time.Second
+
+// maxRemoteList is the largest remote list va fetches.
+const maxRemoteList = 1 << 20
+
+var flagSignedLists = flag.Bool("signed-lists", envBool("VA_SIGNED_LISTS", false), "only use remote lists which are signed, by the key given when they were added (or set $VA_SIGNED_LISTS)")
+
+var flagListsTTL = flag.Duration("lists-ttl", listsTTL(), "how long remote lists are used for before they are fetched again (or set $VA_LISTS_TTL)")
+
+// listsTTL returns the default for --lists-ttl, from $VA_LISTS_TTL.
+func listsTTL() time.Duration {
+	if ttl, err := parseAge(os.Getenv("VA_LISTS_TTL")); err == nil {
+		return ttl
+	}
+	return 24 * time.Hour
+}
+
+// Subscription is a remote list, fetched over HTTPS, or a git repository of
+// lists, whose links are merged with the others.
+type Subscription struct {
+	URL  string
+	Name string // Name of the list file, such as "team.list", which gives its prefix.
+	Time time.Time
+
+	// Git is set if URL is of a git repository of lists, rather than of a
+	// single list, whose list files are each prefixed by their own names,
+	// as those of the user's lists directory are. Name is then only what
+	// the repository is known by. Ref is the branch or tag checked out, or
+	// the repository's default branch if it is empty, and Dir is the
+	// directory within the repository the lists are in, or its root.
+	Git bool   `json:",omitempty"`
+	Ref string `json:",omitempty"`
+	Dir string `json:",omitempty"`
+
+	// Key is the public key, as a line of authorized_keys, which must have
+	// signed the list for it to be used. The signature is fetched from the
+	// URL of the list with ".sig" appended.
+	Key string `json:",omitempty"`
+}
+
+// remoteListMeta records when a remote list was last fetched, and what is
+// needed to ask whether it has changed since, or for a git repository of
+// lists, the commit checked out.
+type remoteListMeta struct {
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+	Commit       string `json:",omitempty"`
+	Fetched      time.Time
+}
+
+// readSubscriptions reads the remote lists subscribed to, in the order they
+// were added.
+func readSubscriptions() ([]Subscription, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(dir, subscriptionsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var subs []Subscription
+	if err := json.Unmarshal(b, &subs); err != nil {
+		return nil, fmt.Errorf("%s: %w", subscriptionsFile, err)
+	}
+	return subs, nil
+}
+
+// writeSubscriptions records the remote lists subscribed to.
+func writeSubscriptions(subs []Subscription) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(subs, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, subscriptionsFile), append(b, '\n'))
+}
+
+// checkListURL checks the URL of a remote list is one va will fetch: HTTPS,
+// or plain HTTP only to this machine.
+func checkListURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case u.Scheme == "https" && u.Host != "":
+		return u, nil
+	case u.Scheme == "http" && isLoopback(u.Hostname()):
+		return u, nil
+	}
+	return nil, fmt.Errorf("%s: remote lists must be fetched over https", rawURL)
+}
+
+// isLoopback reports whether the host is this machine.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// subscriptionName returns the name of the list file a remote list is kept
+// as, from the last element of its URL's path, so that "team.list" gives
+// its links the prefix "team/".
+func subscriptionName(u *url.URL) (string, error) {
+	name := path.Base(u.Path)
+	if _, ok := listPrefix(name); !ok || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("%s: the name of a remote list must end in .list or .toml, or be given with --name", u)
+	}
+	return name, nil
+}
+
+// remoteListDir returns the directory the remote list is kept in within the
+// cache directory, named after a hash of its URL.
+func remoteListDir(cacheDir, rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(cacheDir, remoteListsDir, hex.EncodeToString(sum[:8]))
+}
+
+// readRemoteListMeta reads when the remote list was last fetched, returning
+// the zero value if it never has been.
+func readRemoteListMeta(dir string) remoteListMeta {
+	var meta remoteListMeta
+	if b, err := os.ReadFile(filepath.Join(dir, "meta.json")); err == nil {
+		json.Unmarshal(b, &meta)
+	}
+	return meta
+}
+
+// fetchSubscription fetches the remote list into the cache, unless it was
+// fetched within --lists-ttl and force is not set. The server is asked
+// whether the list has changed since it was last fetched, and the list is
+// only replaced if every line of the new one is valid, and if the
+// subscription has a key, the new one is signed by it. A git repository of
+// lists is fetched as syncGitSubscription fetches it.
+func fetchSubscription(ctx context.Context, cacheDir string, sub Subscription, force bool) error {
+	if sub.Git {
+		return syncGitSubscription(ctx, cacheDir, sub, force)
+	}
+	dir := remoteListDir(cacheDir, sub.URL)
+	meta := readRemoteListMeta(dir)
+	_, err := os.Stat(filepath.Join(dir, sub.Name))
+	exists := err == nil
+	if exists && !force && time.Since(meta.Fetched) < *flagListsTTL {
+		return nil
+	}
+	if *flagOffline {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sub.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "va")
+	if exists {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteList+1))
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		meta.Fetched = time.Now()
+		return writeRemoteListMeta(dir, meta)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s: %s", sub.URL, resp.Status)
+	case len(b) > maxRemoteList:
+		return fmt.Errorf("%s: larger than %d bytes", sub.URL, maxRemoteList)
+	}
+	if err := checkList(sub.Name, b); err != nil {
+		return fmt.Errorf("%s: %w", sub.URL, err)
+	}
+	var sig []byte
+	if sub.Key != "" {
+		if sig, err = fetchListSig(ctx, sub, b); err != nil {
+			return fmt.Errorf("%s: %w", sub.URL, err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if sig != nil {
+		if err := writeFileAtomic(filepath.Join(dir, sub.Name+".sig"), sig); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(dir, sub.Name), b); err != nil {
+		return err
+	}
+	meta = remoteListMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+	}
+	return writeRemoteListMeta(dir, meta)
+}
+
+// fetchListSig fetches the signature of the remote list, and checks it is
+// a signature of the list by the subscription's key, returning it if so.
+func fetchListSig(ctx context.Context, sub Subscription, list []byte) ([]byte, error) {
+	key, err := parseSSHKey(sub.Key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sub.URL+".sig", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "va")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	sig, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteList))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("signature: %s", resp.Status)
+	}
+	if err := verifySSHSig(key, list, sig); err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	return sig, nil
+}
+
+// checkCachedSig checks the remote list kept in dir is still signed by the
+// subscription's key, if it has one, so that a list changed since it was
+// fetched, such as by anything else able to write to the cache, is not used.
+func checkCachedSig(dir string, sub Subscription) error {
+	if sub.Key == "" {
+		return nil
+	}
+	key, err := parseSSHKey(sub.Key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sub.URL, err)
+	}
+	list, err := os.ReadFile(filepath.Join(dir, sub.Name))
+	if err != nil {
+		return err
+	}
+	sig, err := os.ReadFile(filepath.Join(dir, sub.Name+".sig"))
+	if err != nil {
+		return fmt.Errorf("%s: signature: %w", sub.URL, err)
+	}
+	if err := verifySSHSig(key, list, sig); err != nil {
+		return fmt.Errorf("%s: signature: %w", sub.URL, err)
+	}
+	return nil
+}
+
+// checkSigned checks the subscription may be used, which if --signed-lists
+// is set means it must be signed.
+func checkSigned(sub Subscription) error {
+	if *flagSignedLists && sub.Key == "" {
+		return fmt.Errorf("%s is not signed, and --signed-lists is set", sub.URL)
+	}
+	return nil
+}
+
+// writeRemoteListMeta records when the remote list in the directory was
+// fetched.
+func writeRemoteListMeta(dir string, meta remoteListMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, "meta.json"), append(b, '\n'))
+}
+
+// checkList checks every line of the list file is valid.
+func checkList(name string, b []byte) error {
+	prefix, _ := listPrefix(name)
+	_, err := readListFrom(nil, bytes.NewReader(b), name, prefix, nil)
+	return err
+}
+
+// appendSubscriptions appends a source for each remote list subscribed to,
+// as it was last fetched, if it ever was. Lists are never fetched here, so
+// that running a tool never waits on a server; those due to be fetched
+// again are fetched by refreshSubscriptions, or "va lists sync".
+func appendSubscriptions(sources []LinkSource) []LinkSource {
+	subs, err := readSubscriptions()
+	if err != nil {
+		logWarnf("lists: %v", err)
+		return sources
+	}
+	if len(subs) == 0 {
+		return sources
+	}
+	cacheDir, _, err := CacheDir()
+	if err != nil {
+		logWarnf("lists: %v", err)
+		return sources
+	}
+	for _, sub := range subs {
+		if err := checkSigned(sub); err != nil {
+			logWarnf("lists: %v", err)
+			continue
+		}
+		dir, file := remoteListDir(cacheDir, sub.URL), sub.Name
+		if sub.Git {
+			dir, file = gitListsDir(cacheDir, sub), "."
+		}
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			continue
+		}
+		if err := checkCachedSig(dir, sub); err != nil {
+			logWarnf("lists: %v", err)
+			continue
+		}
+		sources = append(sources, LinkSource{Name: sub.URL, FS: os.DirFS(dir)})
+	}
+	return sources
+}
+
+// refreshSubscriptions fetches each remote list which was last fetched more
+// than --lists-ttl ago, for the runs of va after this one to use. It is run
+// in the background while a tool runs, and by the daemon.
+func refreshSubscriptions(ctx context.Context, cacheDir string) {
+	subs, err := readSubscriptions()
+	if err != nil {
+		logWarnf("lists: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, remoteListTimeout)
+	defer cancel()
+	for _, sub := range subs {
+		if checkSigned(sub) != nil {
+			continue // Warned of as the lists were loaded.
+		}
+		if err := fetchSubscription(ctx, cacheDir, sub, false); err != nil {
+			logWarnf("lists: %v", err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendSubscriptionsChecksSig(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		key       string
+		list, sig string // What is in the cache; no signature if empty.
+		want      bool
+	}{
+		{name: "signed", key: testSSHKey, list: testSignedList, sig: testListSig, want: true},
+		{name: "changed in the cache", key: testSSHKey, list: "hello example.com/evil@latest\n", sig: testListSig},
+		{name: "signature missing", key: testSSHKey, list: testSignedList},
+		{name: "signed by another key", key: testOtherSSHKey, list: testSignedList, sig: testListSig},
+		{name: "no key", list: "hello example.com/evil@latest\n", want: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+			cacheDir := t.TempDir()
+			t.Setenv("VA_CACHE_DIR", cacheDir)
+
+			sub := Subscription{URL: "https://lists.example/team.list", Name: "team.list", Key: tt.key}
+			if err := writeSubscriptions([]Subscription{sub}); err != nil {
+				t.Fatal(err)
+			}
+			dir := remoteListDir(cacheDir, sub.URL)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, sub.Name), []byte(tt.list), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.sig != "" {
+				if err := os.WriteFile(filepath.Join(dir, sub.Name+".sig"), []byte(tt.sig), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sources := appendSubscriptions(nil)
+			if got := len(sources) == 1 && sources[0].Name == sub.URL; got != tt.want {
+				t.Errorf("list used = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshSubscriptions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	cacheDir := t.TempDir()
+	t.Setenv("VA_CACHE_DIR", cacheDir)
+
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write([]byte("hello example.com/hello@v1.1.0\n"))
+	}))
+	defer srv.Close()
+
+	sub := Subscription{URL: srv.URL + "/team.list", Name: "team.list"}
+	if err := writeSubscriptions([]Subscription{sub}); err != nil {
+		t.Fatal(err)
+	}
+	dir := remoteListDir(cacheDir, sub.URL)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, sub.Name), []byte("hello example.com/hello@v1.0.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stale := remoteListMeta{Fetched: time.Now().Add(-2 * *flagListsTTL)}
+	if err := writeRemoteListMeta(dir, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	// The list is due to be fetched again, but loading it uses it as it is.
+	links, err := loadLinks(appendSubscriptions(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 0 || links["team/hello"].Pkg != "example.com/hello@v1.0.0" {
+		t.Errorf("after loading, fetched %d times, team/hello = %q", fetches, links["team/hello"].Pkg)
+	}
+
+	refreshSubscriptions(context.Background(), cacheDir)
+	if links, err = loadLinks(appendSubscriptions(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 1 || links["team/hello"].Pkg != "example.com/hello@v1.1.0" {
+		t.Errorf("after refreshing, fetched %d times, team/hello = %q", fetches, links["team/hello"].Pkg)
+	}
+
+	// Until it is due again, it is not fetched again.
+	refreshSubscriptions(context.Background(), cacheDir)
+	if fetches != 1 {
+		t.Errorf("refreshed again, fetched %d times", fetches)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// newS3Cache returns a remote cache in the S3 bucket at a URL of the form
+// "s3://bucket/prefix". The region is taken from the "region" parameter,
+// $AWS_REGION, or $AWS_DEFAULT_REGION, and credentials from
+// $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY, and $AWS_SESSION_TOKEN. An
+// "endpoint" parameter selects an S3-compatible service other than AWS,
+// which is addressed with path-style URLs.
+func newS3Cache(u *url.URL) (RemoteCache, error) {
+	bucket, prefix := u.Host, strings.Trim(u.Path, "/")
+	region := firstNonEmpty(u.Query().Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+	creds := awsCredentials{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKey == "" || creds.secretKey == "" {
+		return nil, errors.New("remote cache: s3: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	base := "https://" + bucket + ".s3." + region + ".amazonaws.com"
+	if endpoint := u.Query().Get("endpoint"); endpoint != "" {
+		base = strings.TrimSuffix(endpoint, "/") + "/" + bucket
+	}
+	return &objectCache{
+		url: func(hash string) string {
+			return base + "/" + path.Join(prefix, "bin", hash)
+		},
+		sign: func(req *http.Request) error {
+			creds.sign(req, region, time.Now())
+			return nil
+		},
+		digest: "X-Amz-Meta-Sha256",
+	}, nil
+}
+
+// awsCredentials sign requests to AWS.
+type awsCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// sign signs a request to S3 using AWS Signature Version 4. The payload is
+// left unsigned, so that tools can be streamed without hashing them first.
+func (c awsCredentials) sign(req *http.Request, region string, now time.Time) {
+	const payload = "UNSIGNED-PAYLOAD"
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// newGCSCache returns a remote cache in the Google Cloud Storage bucket at a
+// URL of the form "gs://bucket/prefix". Requests are authenticated with the
+// OAuth access token in $GOOGLE_OAUTH_ACCESS_TOKEN or, failing that, one
+// obtained from "gcloud auth print-access-token".
+func newGCSCache(u *url.URL) (RemoteCache, error) {
+	bucket, prefix := u.Host, strings.Trim(u.Path, "/")
+	var once sync.Once
+	var token string
+	var tokenErr error
+	return &objectCache{
+		url: func(hash string) string {
+			return "https://storage.googleapis.com/" + bucket + "/" + path.Join(prefix, "bin", hash)
+		},
+		sign: func(req *http.Request) error {
+			once.Do(func() {
+				token, tokenErr = gcsToken(req.Context())
+			})
+			if tokenErr != nil {
+				return tokenErr
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		},
+		digest: "X-Goog-Meta-Sha256",
+	}, nil
+}
+
+// gcsToken returns an OAuth access token for Google Cloud Storage.
+func gcsToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	cmd := exec.CommandContext(ctx, "gcloud", "auth", "print-access-token")
+	logCommand(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("gs: no GOOGLE_OAUTH_ACCESS_TOKEN, and gcloud failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// newAzureCache returns a remote cache in the Azure Blob Storage container at
+// a URL of the form "azblob://account/container/prefix". Requests are
+// authorised by the shared access signature in $AZURE_STORAGE_SAS_TOKEN.
+func newAzureCache(u *url.URL) (RemoteCache, error) {
+	account := u.Host
+	container, prefix, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if container == "" {
+		return nil, errors.New("remote cache: azblob: missing container")
+	}
+	sas := strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?")
+	if sas == "" {
+		return nil, errors.New("remote cache: azblob: AZURE_STORAGE_SAS_TOKEN must be set")
+	}
+	return &objectCache{
+		url: func(hash string) string {
+			return "https://" + account + ".blob.core.windows.net/" + container + "/" + path.Join(prefix, "bin", hash) + "?" + sas
+		},
+		sign: func(req *http.Request) error {
+			req.Header.Set("X-Ms-Version", "2020-10-02")
+			req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+			return nil
+		},
+		digest: "X-Ms-Meta-Sha256",
+	}, nil
+}
+
+// firstNonEmpty returns the first of the strings which is not empty.
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+// resolveFile is the file within the cache directory recording what version
+// queries, such as "latest", resolved to and when.
+const resolveFile = "resolve.json"
+
+// defaultResolveTTL is how long a resolved version query is trusted for,
+// unless $VA_RESOLVE_TTL says otherwise.
+const defaultResolveTTL = time.Hour
+
+// resolution is a version query that has been resolved.
+type resolution struct {
+	Version  string    // Version the query resolved to.
+	Resolved time.Time // When the query was resolved.
+}
+
+// isQuery reports whether the version is a query, such as "latest" or a
+// branch name, rather than a specific version.
+func isQuery(version string) bool {
+	return module.CanonicalVersion(version) != version
+}
+
+// resolveTTL returns how long resolved version queries are trusted for.
+func resolveTTL() time.Duration {
+	if ttl, err := parseAge(os.Getenv("VA_RESOLVE_TTL")); err == nil {
+		return ttl
+	}
+	return defaultResolveTTL
+}
+
+// lookupResolution returns the module path and version with the version
+// query replaced by what it previously resolved to, as long as that was
+// within the TTL. Otherwise, the module path and version is returned as it
+// was given.
+func lookupResolution(cacheDir, mod string, ttl time.Duration) string {
+	pkgPath, version, ok := strings.Cut(mod, "@")
+	if cacheDir == "" || !ok || !isQuery(version) {
+		return mod
+	}
+	resolutions, err := readResolutions(cacheDir)
+	if err != nil {
+		return mod
+	}
+	res, ok := resolutions[mod]
+	if !ok || time.Since(res.Resolved) > ttl {
+		return mod
+	}
+	return pkgPath + "@" + res.Version
+}
+
+// recordResolution records the version that the module path and version
+// query resolved to.
+func recordResolution(cacheDir, mod, version string) error {
+	if _, query, ok := strings.Cut(mod, "@"); cacheDir == "" || !ok || !isQuery(query) {
+		return nil
+	}
+	resolutions, err := readResolutions(cacheDir)
+	if err != nil {
+		// Start again, rather than forever failing to record anything.
+		resolutions = make(map[string]resolution)
+	}
+	resolutions[mod] = resolution{
+		Version:  version,
+		Resolved: time.Now(),
+	}
+	b, err := json.MarshalIndent(resolutions, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(cacheDir, resolveFile), b)
+}
+
+// readResolutions reads the record of resolved version queries, keyed by
+// the module path and version query.
+func readResolutions(cacheDir string) (map[string]resolution, error) {
+	resolutions := make(map[string]resolution)
+	b, err := os.ReadFile(filepath.Join(cacheDir, resolveFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return resolutions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &resolutions); err != nil {
+		return nil, err
+	}
+	return resolutions, nil
+}
+
+// writeFileAtomic writes the file via a temporary file, so that readers never
+// see it partially written.
+func writeFileAtomic(name string, b []byte) error {
+	return writeFileAtomicPerm(name, b, 0o644)
+}
+
+// writeFileAtomicPerm writes the file as writeFileAtomic does, with the
+// permissions given, for files which should not be readable by everyone.
+func writeFileAtomicPerm(name string, b []byte, perm fs.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// locateTool expands the version query of the tool to a version and finds
+// the module it is in, without downloading the module. If the module has
+// been downloaded, Dir is where it is, and downloaded is set; otherwise Dir
+// is where it would be.
+func locateTool(ctx context.Context, cacheDir, mod string) (_ Module, downloaded bool, _ error) {
+	modCache, err := GoModCache(ctx)
+	if err != nil {
+		return Module{}, false, err
+	}
+	resolved := mod
+	if !*flagRefresh {
+		resolved = lookupResolution(cacheDir, mod, *flagResolveTTL)
+	}
+	pkgPath, version, _ := strings.Cut(resolved, "@")
+	if _, query, _ := strings.Cut(mod, "@"); isQuery(query) {
+		if resolved != mod {
+			explainf(ctx, "resolve: %s was resolved to %s within the last %s, so that is used", query, version, *flagResolveTTL)
+		} else {
+			explainf(ctx, "resolve: %s has not been resolved within the last %s, so is resolved again", query, *flagResolveTTL)
+		}
+	}
+	if !isQuery(version) {
+		if m, ok := findDownloaded(modCache, pkgPath, version); ok {
+			explainf(ctx, "module: the deepest prefix of %s in the module cache at %s is %s", pkgPath, version, m.Path)
+			return m, true, nil
+		}
+	}
+	if offline {
+		return Module{}, false, fmt.Errorf("%s: %w", resolved, errOffline)
+	}
+	found, tail, err := findModule(ctx, pkgPath, version)
+	if err != nil {
+		return Module{}, false, err
+	}
+	if err := recordResolution(cacheDir, resolved, found.Version); err != nil {
+		logWarnf("cache: %v", err)
+	}
+	if m, ok := findDownloaded(modCache, pkgPath, found.Version); ok {
+		return m, true, nil
+	}
+	encPath, err := module.EscapePath(found.Path)
+	if err != nil {
+		return Module{}, false, err
+	}
+	encVersion, err := module.EscapeVersion(found.Version)
+	if err != nil {
+		return Module{}, false, err
+	}
+	return Module{
+		Path:    found.Path,
+		Version: found.Version,
+		Dir:     filepath.Join(modCache, filepath.FromSlash(encPath)+"@"+encVersion),
+		Tail:    tail,
+	}, false, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeResolutions writes the record of resolved version queries.
+func writeResolutions(t *testing.T, cacheDir string, resolutions map[string]resolution) {
+	t.Helper()
+	b, err := json.Marshal(resolutions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cacheDir, resolveFile), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolution(t *testing.T) {
+	cacheDir := t.TempDir()
+	const mod = "example.com/hello@latest"
+	if got := lookupResolution(cacheDir, mod, time.Hour); got != mod {
+		t.Errorf("lookupResolution before any were recorded = %s, want %s", got, mod)
+	}
+	if err := recordResolution(cacheDir, mod, "v1.2.3"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lookupResolution(cacheDir, mod, time.Hour), "example.com/hello@v1.2.3"; got != want {
+		t.Errorf("lookupResolution within the TTL = %s, want %s", got, want)
+	}
+	if got := lookupResolution(cacheDir, mod, 0); got != mod {
+		t.Errorf("lookupResolution with no TTL = %s, want %s", got, mod)
+	}
+
+	// Specific versions are not queries, so are never recorded.
+	if err := recordResolution(cacheDir, "example.com/hello@v1.0.0", "v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	resolutions, err := readResolutions(cacheDir)
+	if err != nil || len(resolutions) != 1 {
+		t.Errorf("readResolutions = %v, %v, want only %s", resolutions, err, mod)
+	}
+	if got := lookupResolution("", mod, time.Hour); got != mod {
+		t.Errorf("lookupResolution without a cache = %s, want %s", got, mod)
+	}
+}
+
+func TestResolutionTTL(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeResolutions(t, cacheDir, map[string]resolution{
+		"example.com/recent@latest": {Version: "v1.0.0", Resolved: time.Now().Add(-30 * time.Minute)},
+		"example.com/stale@latest":  {Version: "v1.0.0", Resolved: time.Now().Add(-2 * time.Hour)},
+	})
+	for _, tt := range []struct {
+		mod  string
+		ttl  time.Duration
+		want string
+	}{
+		{"example.com/recent@latest", time.Hour, "example.com/recent@v1.0.0"},
+		{"example.com/recent@latest", 10 * time.Minute, "example.com/recent@latest"},
+		{"example.com/stale@latest", time.Hour, "example.com/stale@latest"},
+		{"example.com/stale@latest", 3 * time.Hour, "example.com/stale@v1.0.0"},
+	} {
+		if got := lookupResolution(cacheDir, tt.mod, tt.ttl); got != tt.want {
+			t.Errorf("lookupResolution(%s, %v) = %s, want %s", tt.mod, tt.ttl, got, tt.want)
+		}
+	}
+
+	t.Setenv("VA_RESOLVE_TTL", "10m")
+	if got := resolveTTL(); got != 10*time.Minute {
+		t.Errorf("resolveTTL with $VA_RESOLVE_TTL=10m = %v, want 10m", got)
+	}
+	t.Setenv("VA_RESOLVE_TTL", "soon")
+	if got := resolveTTL(); got != defaultResolveTTL {
+		t.Errorf("resolveTTL with $VA_RESOLVE_TTL=soon = %v, want %v", got, defaultResolveTTL)
+	}
+}
+
+func TestLocateToolRefresh(t *testing.T) {
+	useTestProxy(t,
+		testModule{Path: "example.com/hello", Version: "v1.0.0"},
+		testModule{Path: "example.com/hello", Version: "v1.1.0"},
+	)
+	cacheDir := t.TempDir()
+	const mod = "example.com/hello@latest"
+	writeResolutions(t, cacheDir, map[string]resolution{
+		mod: {Version: "v1.0.0", Resolved: time.Now()},
+	})
+	ctx := context.Background()
+
+	m, _, err := locateTool(ctx, cacheDir, mod)
+	if err != nil || m.Version != "v1.0.0" {
+		t.Errorf("locateTool within the TTL = %s, %v, want v1.0.0", m.Version, err)
+	}
+
+	*flagRefresh = true
+	t.Cleanup(func() { *flagRefresh = false })
+	m, _, err = locateTool(ctx, cacheDir, mod)
+	if err != nil || m.Version != "v1.1.0" {
+		t.Errorf("locateTool with --refresh = %s, %v, want v1.1.0", m.Version, err)
+	}
+	*flagRefresh = false
+	if got, want := lookupResolution(cacheDir, mod, time.Hour), "example.com/hello@v1.1.0"; got != want {
+		t.Errorf("after --refresh, lookupResolution = %s, want %s", got, want)
+	}
+}
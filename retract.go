@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"golang.org/x/mod/semver"
+)
+
+// listModule is the subset of the output of "go list -m -json" that va uses.
+type listModule struct {
+	Path      string
+	Version   string
+	Versions  []string
+	Retracted []string
+	Error     *struct {
+		Err string
+	}
+}
+
+// goListModule runs "go list -m -json" with the given flags on the module
+// query, e.g. "example.com/a/b@v1.2.3", retrying transient failures.
+func goListModule(ctx context.Context, query string, flags ...string) (listModule, error) {
+	var mod listModule
+	err := retry(ctx, retryPolicy, func() (err error) {
+		mod, err = goListModuleOnce(ctx, query, flags...)
+		return err
+	})
+	return mod, err
+}
+
+// goListModuleOnce runs "go list -m -json" once.
+func goListModuleOnce(ctx context.Context, query string, flags ...string) (listModule, error) {
+	args := append([]string{"list", "-m", "-json"}, flags...)
+	args = append(args, query)
+	cmd := goCommand(ctx, args...)
+	logCommand(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			msg := string(bytes.TrimSpace(exitErr.Stderr))
+			return listModule{}, transientGoError(fmt.Errorf("go list: %s", msg), msg)
+		}
+		return listModule{}, fmt.Errorf("go list: %w", err)
+	}
+	var mod listModule
+	if err := json.Unmarshal(out, &mod); err != nil {
+		return listModule{}, fmt.Errorf("json: %w", err)
+	}
+	if mod.Error != nil {
+		return listModule{}, transientGoError(fmt.Errorf("go list: %s", mod.Error.Err), mod.Error.Err)
+	}
+	return mod, nil
+}
+
+// Retraction returns the rationale for the retraction of the version of the
+// module, which is empty if the version has not been retracted.
+func Retraction(ctx context.Context, path, version string) ([]string, error) {
+	mod, err := goListModule(ctx, path+"@"+version, "-retracted")
+	if err != nil {
+		return nil, err
+	}
+	return mod.Retracted, nil
+}
+
+// LatestUnretracted returns the newest released version of the module which
+// has not been retracted.
+func LatestUnretracted(ctx context.Context, path string) (string, error) {
+	// Without -retracted, the versions listed exclude retracted ones.
+	mod, err := goListModule(ctx, path, "-versions")
+	if err != nil {
+		return "", err
+	}
+	semver.Sort(mod.Versions)
+	if len(mod.Versions) == 0 {
+		return "", fmt.Errorf("no unretracted versions of %s", path)
+	}
+	return mod.Versions[len(mod.Versions)-1], nil
+}
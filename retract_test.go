@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// retractedModules are modules some of whose versions have been retracted:
+// example.com/r, whose v1.1.0 was retracted by v1.2.0, and example.com/s,
+// whose newest version retracted itself.
+var retractedModules = []testModule{
+	{Path: "example.com/r", Version: "v1.0.0"},
+	{Path: "example.com/r", Version: "v1.1.0"},
+	{Path: "example.com/r", Version: "v1.2.0", GoMod: "module example.com/r\n\nretract v1.1.0 // broken\n"},
+	{Path: "example.com/s", Version: "v1.0.0", Files: map[string]string{"main.go": "package main\n\nfunc main() {}\n"}},
+	{Path: "example.com/s", Version: "v1.1.0", GoMod: "module example.com/s\n\nretract v1.1.0 // bad release\n"},
+}
+
+func TestRetraction(t *testing.T) {
+	useTestProxy(t, retractedModules...)
+	ctx := context.Background()
+	for _, tt := range []struct {
+		path, version string
+		want          []string
+	}{
+		{"example.com/r", "v1.0.0", nil},
+		{"example.com/r", "v1.1.0", []string{"broken"}},
+		{"example.com/r", "v1.2.0", nil},
+		{"example.com/s", "v1.1.0", []string{"bad release"}},
+	} {
+		got, err := Retraction(ctx, tt.path, tt.version)
+		if err != nil {
+			t.Errorf("Retraction(%s@%s): %v", tt.path, tt.version, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Retraction(%s@%s) = %q, want %q", tt.path, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestLatestUnretracted(t *testing.T) {
+	useTestProxy(t, retractedModules...)
+	ctx := context.Background()
+	for path, want := range map[string]string{
+		"example.com/r": "v1.2.0",
+		"example.com/s": "v1.0.0",
+	} {
+		if got, err := LatestUnretracted(ctx, path); err != nil || got != want {
+			t.Errorf("LatestUnretracted(%s) = %s, %v, want %s", path, got, err, want)
+		}
+	}
+}
+
+func TestCheckRetracted(t *testing.T) {
+	useTestProxy(t, retractedModules...)
+	ctx := context.Background()
+	for _, tt := range []struct {
+		m     Module
+		avoid bool
+		want  string
+	}{
+		{Module{Path: "example.com/r", Version: "v1.0.0"}, true, "v1.0.0"},
+		{Module{Path: "example.com/s", Version: "v1.1.0"}, false, "v1.1.0"},
+		{Module{Path: "example.com/s", Version: "v1.1.0"}, true, "v1.0.0"},
+	} {
+		got, err := checkRetracted(ctx, tt.m, tt.avoid)
+		if err != nil || got.Path != tt.m.Path || got.Version != tt.want {
+			t.Errorf("checkRetracted(%s@%s, %v) = %s@%s, %v, want %s@%s", tt.m.Path, tt.m.Version, tt.avoid, got.Path, got.Version, err, tt.m.Path, tt.want)
+		}
+	}
+}
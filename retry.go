@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy says how often, and how quickly, operations which fail for
+// transient reasons, such as a module proxy returning 503, are retried.
+type RetryPolicy struct {
+	Retries int           // Retries after the first attempt.
+	Base    time.Duration // Delay before the first retry.
+	Max     time.Duration // Longest delay between retries.
+}
+
+// retryPolicy is the policy for everything which talks to the network. The
+// number of retries can be set with $VA_RETRIES or --retries.
+var retryPolicy = RetryPolicy{
+	Retries: envInt("VA_RETRIES", 3),
+	Base:    500 * time.Millisecond,
+	Max:     10 * time.Second,
+}
+
+// transientError is an error which is worth retrying.
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string { return e.err.Error() }
+func (e transientError) Unwrap() error { return e.err }
+
+// transient marks the error as being worth retrying.
+func transient(err error) error {
+	return transientError{err}
+}
+
+// retry calls fn until it succeeds, returns an error which is not transient,
+// or the retries run out, waiting longer after each failure. The error from
+// the last attempt is returned.
+func retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.Retries || !isTransient(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(policy.backoff(attempt)):
+		}
+	}
+}
+
+// backoff returns how long to wait before the retry following the attempt,
+// doubling each time, with jitter so that many clients failing at once do
+// not all retry at once.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Max
+	if attempt < 30 && p.Base<<attempt < p.Max {
+		d = p.Base << attempt
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// isTransient reports whether the error is likely to go away if the
+// operation is tried again.
+func isTransient(err error) bool {
+	var te transientError
+	if errors.As(err, &te) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// Connections which were refused or reset are probably down to a
+	// server restarting, or a load balancer shuffling things around.
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "read")
+}
+
+// transientStatus reports whether an HTTP status code means the request may
+// well succeed if it is tried again.
+func transientStatus(code int) bool {
+	return code == 429 || code >= 500 && code != 501
+}
+
+// transientOutput are signs in the output of the go command that it failed
+// for a reason that may well go away if it is run again.
+var transientOutput = []string{
+	"429 Too Many Requests",
+	"500 Internal Server Error",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+	"connection reset by peer",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"unexpected EOF",
+}
+
+// transientGoError marks the error from the go command as transient if its
+// output shows that it was.
+func transientGoError(err error, output string) error {
+	for _, s := range transientOutput {
+		if strings.Contains(output, s) {
+			return transient(err)
+		}
+	}
+	return err
+}
+
+// envInt returns the integer in the environment variable, or def if it is
+// not set or is not a non-negative integer.
+func envInt(name string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
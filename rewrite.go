@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// A rewrite rule is a link whose short name ends in "/*", and whose package
+// does too, such as:
+//
+//	x/* golang.org/x/*
+//	gh/* github.com/*@latest
+//
+// Rather than standing for a single tool, it shortens every package under a
+// common path, so "x/tools/cmd/stringer" is golang.org/x/tools/cmd/stringer.
+// The version is the one given, if there is one, or else the rule's, if it
+// has one, or else --default-version.
+
+// isRewrite reports whether the short name is that of a rewrite rule.
+func isRewrite(short string) bool {
+	return strings.HasSuffix(short, "/*")
+}
+
+// validateRewrite validates a rewrite rule: the short name must be a prefix
+// of short names followed by "/*", and the package a prefix of package paths
+// followed by "/*", with or without a version.
+func validateRewrite(short, pkg string) bool {
+	for _, elem := range strings.Split(strings.TrimSuffix(short, "/*"), "/") {
+		if !validateShort(elem) {
+			return false
+		}
+	}
+	pkgPath, version, hasVersion := strings.Cut(pkg, "@")
+	if hasVersion && version == "" || !strings.HasSuffix(pkgPath, "/*") {
+		return false
+	}
+	return module.CheckImportPath(strings.TrimSuffix(pkgPath, "/*")) == nil
+}
+
+// expandRewrite returns the package path the name is short for, and the
+// version of the rule which shortens it, if any rule does. Where several
+// do, the one with the longest prefix is used.
+func expandRewrite(links map[string]Link, name string) (pkgPath, version string, rule Link, ok bool) {
+	best := ""
+	for short, link := range links {
+		prefix := strings.TrimSuffix(short, "*")
+		if !isRewrite(short) || !strings.HasPrefix(name, prefix) || len(name) == len(prefix) || len(prefix) <= len(best) {
+			continue
+		}
+		best, rule = prefix, link
+	}
+	if best == "" {
+		return "", "", Link{}, false
+	}
+	rulePath, version, _ := strings.Cut(rule.Pkg, "@")
+	return strings.TrimSuffix(rulePath, "*") + name[len(best):], version, rule, true
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"time"
+)
+
+// Run runs the tool with the given arguments, passing through the standard
+// input and outputs, and returns its exit code. An error is only returned if
+// the tool could not be run, or was stopped because the context ended. If
+// the context has a deadline, the tool is run in a process group of its own
+// (on Unix), so that whatever it starts is stopped along with it.
+//
+// While the tool runs, the signals which would stop va are caught, so that va
+// outlives the tool and can clean up after it, and are passed on to the tool
+// instead. An interrupt is only passed on to a tool in a process group of its
+// own, as otherwise it shares va's, which the terminal interrupts as a whole.
+//
+// If a wrapper command is given, such as "strace -f", the tool is run under
+// it. The exit code is then that of the wrapper, which for most wrappers is
+// the exit code of the tool.
+//
+// If mem is given, the tool is run from that file rather than from tool,
+// which only names the tool to itself. The file is passed to the tool (and
+// any wrapper) as file descriptor 3, which is run through /proc, so this only
+// works on Linux.
+//
+// The tool is run in the directory given by --chdir, if there is one, with
+// the environment variables of env as well as those inherited.
+func Run(ctx context.Context, wrap []string, tool string, args, env []string, mem *os.File) (exitCode int, err error) {
+	ctx, end := startSpan(ctx, "run", "va.tool", tool)
+	defer func() { end(err) }()
+
+	var cmd *exec.Cmd
+	if mem != nil {
+		cmd = toolCommand(wrap, memTool, args)
+		cmd.ExtraFiles = []*os.File{mem}
+		if len(wrap) == 0 {
+			cmd.Args[0] = filepath.Base(tool)
+		}
+	} else {
+		cmd = toolCommand(wrap, tool, args)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Dir = *flagChdir
+	if tp := traceparent(ctx); tp != "" {
+		// Let the tool carry on the trace, should it know how.
+		env = append(env[:len(env):len(env)], "TRACEPARENT="+tp)
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if _, ok := ctx.Deadline(); ok {
+		newProcessGroup(cmd)
+	}
+	logCommand(cmd)
+	emitEvent(progressEvent{Event: "exec", Path: cmd.Path, Args: cmd.Args[1:]})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, stopSignals...)
+	defer signal.Stop(sigs)
+	start := time.Now()
+	if err = cmd.Start(); err == nil {
+		done := make(chan struct{})
+		go stopOnDone(ctx, cmd, sigs, done)
+		err = cmd.Wait()
+		close(done)
+		restoreForeground(cmd)
+	}
+	exitCode = exitStatus(cmd.ProcessState)
+	exited := progressEvent{Event: "exit", ExitCode: &exitCode, Duration: time.Since(start)}
+	if _, ok := err.(*exec.ExitError); !ok {
+		exited.Error = errorText(err)
+	}
+	emitEvent(exited)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return exitCode, fmt.Errorf("stopped after timeout: %w", ctx.Err())
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		// The tool ran, it just did not succeed, which is for the caller
+		// to interpret from the exit code.
+		return exitCode, nil
+	}
+	return exitCode, err
+}
+
+// stopGrace is how long a tool is given to stop once asked to, before it is
+// killed.
+const stopGrace = 5 * time.Second
+
+// stopOnDone stops the command once the context is done, unless it exits
+// first, which closes done. The command, and anything it started in its
+// process group, is asked to stop with SIGTERM, then killed with SIGKILL if
+// it has not stopped within stopGrace. Until then, each signal received from
+// sigs is passed on to the command and its process group, other than an
+// interrupt of a command sharing va's process group, which has had it too.
+func stopOnDone(ctx context.Context, cmd *exec.Cmd, sigs <-chan os.Signal, done <-chan struct{}) {
+	for stopping := false; !stopping; {
+		select {
+		case <-done:
+			return
+		case sig := <-sigs:
+			if sig == os.Interrupt && !ownGroup(cmd) {
+				logDebugf("run: %s was interrupted along with va", cmd.Path)
+				continue
+			}
+			logDebugf("run: passing %v on to %s", sig, cmd.Path)
+			if err := signalProcess(cmd, sig); err != nil {
+				logDebugf("run: signalling %s: %v", cmd.Path, err)
+			}
+		case <-ctx.Done():
+			stopping = true
+		}
+	}
+	if err := stopProcess(cmd, false); err != nil {
+		logDebugf("run: stopping %s: %v", cmd.Path, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(stopGrace):
+		if err := stopProcess(cmd, true); err != nil {
+			logDebugf("run: killing %s: %v", cmd.Path, err)
+		}
+	}
+}
+
+// memTool is the path of a tool run from memory, which is always passed as
+// the first of the extra files.
+const memTool = "/proc/self/fd/3"
+
+// toolCommand constructs the command which runs the tool, under the wrapper
+// command if one is given.
+func toolCommand(wrap []string, tool string, args []string) *exec.Cmd {
+	if len(wrap) == 0 {
+		return exec.Command(tool, args...)
+	}
+	wrapArgs := make([]string, 0, len(wrap)+len(args))
+	wrapArgs = append(wrapArgs, wrap[1:]...)
+	wrapArgs = append(wrapArgs, tool)
+	wrapArgs = append(wrapArgs, args...)
+	return exec.Command(wrap[0], wrapArgs...)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// shell returns the path of sh, skipping the test where there is none.
+func shell(t *testing.T) string {
+	t.Helper()
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run tools with")
+	}
+	return sh
+}
+
+func TestToolTimeoutDefault(t *testing.T) {
+	for _, tt := range []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", 0},
+		{"90s", 90 * time.Second},
+		{"bad", 0},
+	} {
+		t.Setenv("VA_TOOL_TIMEOUT", tt.env)
+		if got := toolTimeout(); got != tt.want {
+			t.Errorf("toolTimeout() with $VA_TOOL_TIMEOUT=%q = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestRunUnbounded(t *testing.T) {
+	sh := shell(t)
+	ctx, cancel := withTimeout(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("withTimeout(0) has a deadline, want none")
+	}
+	start := time.Now()
+	code, err := Run(ctx, nil, sh, []string{"-c", "sleep 0.3; exit 3"}, nil, nil)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if code != 3 {
+		t.Errorf("exit code = %d, want 3", code)
+	}
+	if took := time.Since(start); took < 300*time.Millisecond {
+		t.Errorf("Run returned after %v, before the tool could have finished", took)
+	}
+}
+
+func TestRunToolTimeout(t *testing.T) {
+	sh := shell(t)
+	ctx, cancel := withTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := Run(ctx, nil, sh, []string{"-c", "exec sleep 30"}, nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run: %v, want %v", err, context.DeadlineExceeded)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("Run returned after %v, want the tool killed once the timeout elapsed", took)
+	}
+}
+
+func TestToolCommand(t *testing.T) {
+	for _, tt := range []struct {
+		wrap []string
+		args []string
+		want []string
+	}{
+		{nil, nil, []string{"tool"}},
+		{nil, []string{"-v", "a b"}, []string{"tool", "-v", "a b"}},
+		{[]string{"strace"}, []string{"-v"}, []string{"strace", "tool", "-v"}},
+		{[]string{"strace", "-f", "-o", "out"}, []string{"-v"}, []string{"strace", "-f", "-o", "out", "tool", "-v"}},
+	} {
+		cmd := toolCommand(tt.wrap, "tool", tt.args)
+		if !reflect.DeepEqual(cmd.Args, tt.want) {
+			t.Errorf("toolCommand(%q, tool, %q) runs %q, want %q", tt.wrap, tt.args, cmd.Args, tt.want)
+		}
+	}
+}
+
+func TestRunWrapper(t *testing.T) {
+	sh := shell(t)
+	// The wrapper is run with the tool and its arguments after its own.
+	code, err := Run(context.Background(), []string{sh, "-c", `test "$0 $1 $2" = "tool a b"`}, "tool", []string{"a", "b"}, nil, nil)
+	if err != nil || code != 0 {
+		t.Errorf("Run under a wrapper = %d, %v, want the wrapper given the tool and its arguments", code, err)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// pkgGoDevSearch is the search page of pkg.go.dev, which has no API, so its
+// results are scraped from the page.
+const pkgGoDevSearch = "https://pkg.go.dev/search"
+
+// fuzzyScore scores how well the pattern matches s, case insensitively. The
+// characters of the pattern must all appear in s in order, and matches
+// score more when they are consecutive or start a word, and most when s is
+// the pattern, or contains it. It returns false if the pattern does not
+// match at all.
+func fuzzyScore(pattern, s string) (int, bool) {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	if pattern == "" {
+		return 0, true
+	}
+	runes := []rune(s)
+	score, last, i := 0, -2, 0
+	for _, p := range pattern {
+		for i < len(runes) && runes[i] != p {
+			i++
+		}
+		if i == len(runes) {
+			return 0, false
+		}
+		score++
+		if i == last+1 {
+			score += 5
+		}
+		if i == 0 || strings.ContainsRune("/-_. ", runes[i-1]) {
+			score += 3
+		}
+		last = i
+		i++
+	}
+	switch {
+	case s == pattern:
+		score += 100
+	case strings.Contains(s, pattern):
+		score += 20
+	}
+	return score, true
+}
+
+// searchResult is a tool found by searching.
+type searchResult struct {
+	Name  string // Short name of the link, or the package path.
+	Pkg   string // Package path and version, e.g. "example.com/a/cmd/b@latest".
+	Desc  string
+	Arg   string // What to give va to run the tool.
+	score int
+}
+
+// searchLinks returns the links which fuzzily match the query, best first.
+// The short name and the last element of the package path are matched
+// fuzzily, and the description only if it contains the query.
+func searchLinks(links map[string]Link, query string) []searchResult {
+	var results []searchResult
+	for _, link := range links {
+		best, ok := fuzzyScore(query, link.Short)
+		pkgPath, _, _ := strings.Cut(link.Pkg, "@")
+		if score, match := fuzzyScore(query, path.Base(pkgPath)); match && (!ok || score > best) {
+			best, ok = score, true
+		}
+		if !ok && strings.Contains(strings.ToLower(link.Desc), strings.ToLower(query)) {
+			best, ok = 1, true
+		}
+		if ok {
+			results = append(results, searchResult{Name: link.Short, Pkg: link.Pkg, Desc: link.Desc, Arg: link.Short, score: best})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+var (
+	// reSnippet finds the anchor of each search result on pkg.go.dev.
+	reSnippet = regexp.MustCompile(`<a [^>]*data-test-id="snippet-title"[^>]*>`)
+	// reHref finds the link within an anchor.
+	reHref = regexp.MustCompile(`href="/([^"?#]+)"`)
+	// reSynopsis finds the synopsis of a search result.
+	reSynopsis = regexp.MustCompile(`(?s)data-test-id="snippet-synopsis"[^>]*>(.*?)</`)
+)
+
+// searchPkgGoDev searches pkg.go.dev for packages matching the query,
+// returning at most limit of them, best first.
+func searchPkgGoDev(ctx context.Context, query string, limit int) ([]searchResult, error) {
+	q := url.Values{"q": {query}, "m": {"package"}, "limit": {strconv.Itoa(limit)}}
+	var page []byte
+	err := retry(ctx, retryPolicy, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, pkgGoDevSearch+"?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", "va")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err := fmt.Errorf("pkg.go.dev: %s", resp.Status)
+			if transientStatus(resp.StatusCode) {
+				return transient(err)
+			}
+			return err
+		}
+		page, err = io.ReadAll(resp.Body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseSearchPage(page, limit), nil
+}
+
+// parseSearchPage returns at most limit of the results on the pkg.go.dev
+// search page.
+func parseSearchPage(page []byte, limit int) []searchResult {
+	var results []searchResult
+	anchors := reSnippet.FindAllIndex(page, -1)
+	for i, anchor := range anchors {
+		href := reHref.FindSubmatch(page[anchor[0]:anchor[1]])
+		if href == nil {
+			continue
+		}
+		end := len(page)
+		if i+1 < len(anchors) {
+			end = anchors[i+1][0]
+		}
+		var desc string
+		if synopsis := reSynopsis.FindSubmatch(page[anchor[1]:end]); synopsis != nil {
+			desc = strings.Join(strings.Fields(html.UnescapeString(string(synopsis[1]))), " ")
+		}
+		pkgPath, err := url.PathUnescape(string(href[1]))
+		if err != nil {
+			continue
+		}
+		results = append(results, searchResult{Name: pkgPath, Pkg: pkgPath + "@latest", Desc: desc, Arg: pkgPath + "@latest"})
+		if len(results) == limit {
+			break
+		}
+	}
+	return results
+}
+
+// isTerminal reports whether the file is a terminal, or at least a character
+// device, which is near enough for deciding whether to prompt.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// truncate shortens s to at most n characters, marking where it was cut.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimRightFunc(string(runes[:n-1]), unicode.IsSpace) + "…"
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"debug/buildinfo"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// selfModule is the module va itself is built from.
+const selfModule = "github.com/dotwaffle/va"
+
+// selfVersion returns the version of va which is running, or "" if it was
+// built from source rather than installed at a version, in which case there
+// is no telling whether it is older or newer than any release.
+func selfVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || sourceBuild(info.Main) {
+		return ""
+	}
+	return info.Main.Version
+}
+
+// sourceBuild reports whether the main module was built from source, rather
+// than downloaded at a version. Builds within a checkout are "(devel)", or,
+// since Go 1.24, are stamped with a version from version control, which is
+// marked "+dirty" if there were changes, and is a pseudo-version unless a
+// tag was checked out. Only a downloaded module has a checksum, which tells
+// a pseudo-version fetched from the proxy from one made up from a checkout.
+func sourceBuild(main debug.Module) bool {
+	switch {
+	case main.Version == "" || main.Version == "(devel)":
+		return true
+	case strings.HasSuffix(main.Version, "+dirty"):
+		return true
+	case module.IsPseudoVersion(main.Version) && main.Sum == "":
+		return true
+	}
+	return false
+}
+
+// latestSelf returns the newest version of va which has not been retracted.
+func latestSelf(ctx context.Context) (string, error) {
+	mod, err := goListModule(ctx, selfModule+"@latest")
+	if err != nil {
+		return "", err
+	}
+	return mod.Version, nil
+}
+
+// needsUpdate reports whether va at the current version should be updated
+// to the latest, which is so for a build from source only if forced.
+func needsUpdate(current, latest string, force bool) bool {
+	if current == "" {
+		return force
+	}
+	return force || semver.Compare(latest, current) > 0
+}
+
+// buildSelf builds va at the version into the directory, returning the
+// path of the binary. It is built with "go install", rather than as tools
+// are, so that the binary records the version it was built at; the go
+// command checks the module against the checksum database as it downloads
+// it.
+func buildSelf(ctx context.Context, dir, version string) (string, error) {
+	cmd := goCommand(ctx, "install", selfModule+"@"+version)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, "GOBIN="+dir)
+	logCommand(cmd)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Stderr.Write(out)
+		return "", fmt.Errorf("go install: %w", err)
+	}
+	return filepath.Join(dir, toolName(selfModule)), nil
+}
+
+// verifySelf checks the binary is va at the version, built for this
+// platform, before it is allowed to replace the one running.
+func verifySelf(bin, version string) error {
+	info, err := buildinfo.ReadFile(bin)
+	if err != nil {
+		return err
+	}
+	if info.Main.Path != selfModule || info.Main.Version != version {
+		return fmt.Errorf("%s is %s@%s, not %s@%s", bin, info.Main.Path, info.Main.Version, selfModule, version)
+	}
+	for _, s := range info.Settings {
+		if (s.Key == "GOOS" && s.Value != runtime.GOOS) || (s.Key == "GOARCH" && s.Value != runtime.GOARCH) {
+			return fmt.Errorf("%s is built for %s=%s", bin, s.Key, s.Value)
+		}
+	}
+	return nil
+}
+
+// SelfUpdate replaces the binary of va which is running with va at the
+// version, returning the path it replaced.
+func SelfUpdate(ctx context.Context, version string) (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "va-self-update-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	bin, err := buildSelf(ctx, dir, version)
+	if err != nil {
+		return "", err
+	}
+	if err := verifySelf(bin, version); err != nil {
+		return "", fmt.Errorf("verify: %w", err)
+	}
+	if runtime.GOOS == "windows" {
+		// A binary which is running cannot be replaced on Windows, but it
+		// can be moved out of the way.
+		old := self + ".old"
+		os.Remove(old)
+		if err := os.Rename(self, old); err != nil {
+			return "", err
+		}
+		if err := copyExecutable(bin, self); err != nil {
+			if rerr := os.Rename(old, self); rerr != nil {
+				logErrorf("self-update: restoring %s: %v", self, rerr)
+			}
+			return "", err
+		}
+		return self, nil
+	}
+	return self, copyExecutable(bin, self)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestSourceBuild(t *testing.T) {
+	for _, tt := range []struct {
+		version, sum string
+		want         bool
+	}{
+		{"(devel)", "", true},
+		{"", "", true},
+		{"v1.2.3", "h1:abc=", false},
+		// Built within a checkout of a tag, since Go 1.24.
+		{"v1.2.3", "", false},
+		{"v1.2.3+dirty", "", true},
+		{"v1.2.4-0.20240101000000-abcdefabcdef", "", true},
+		{"v1.2.4-0.20240101000000-abcdefabcdef+dirty", "", true},
+		{"v0.0.0-20240101000000-abcdefabcdef", "", true},
+		// Installed at a commit, so fetched through the proxy.
+		{"v0.0.0-20240101000000-abcdefabcdef", "h1:abc=", false},
+	} {
+		if got := sourceBuild(debug.Module{Path: selfModule, Version: tt.version, Sum: tt.sum}); got != tt.want {
+			t.Errorf("sourceBuild(%q, sum %q) = %v, want %v", tt.version, tt.sum, got, tt.want)
+		}
+	}
+}
+
+func TestNeedsUpdate(t *testing.T) {
+	for _, tt := range []struct {
+		current, latest string
+		force           bool
+		want            bool
+	}{
+		{"v1.0.0", "v1.1.0", false, true},
+		{"v1.1.0", "v1.1.0", false, false},
+		{"v1.1.0", "v1.1.0", true, true},
+		{"v1.10.0", "v1.9.0", false, false},
+		{"v1.1.0-rc.1", "v1.1.0", false, true},
+		{"v0.0.0-20240101000000-abcdefabcdef", "v0.1.0", false, true},
+		// Built from source, so there is no telling.
+		{"", "v1.1.0", false, false},
+		{"", "v1.1.0", true, true},
+	} {
+		if got := needsUpdate(tt.current, tt.latest, tt.force); got != tt.want {
+			t.Errorf("needsUpdate(%q, %q, %v) = %v, want %v", tt.current, tt.latest, tt.force, got, tt.want)
+		}
+	}
+}
+
+// buildMain builds a main package of the module, for the GOARCH, returning
+// the binary.
+func buildMain(t *testing.T, modPath, goarch string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module " + modPath + "\n\ngo 1.18\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bin := filepath.Join(dir, "bin")
+	cmd := exec.Command("go", "build", "-buildvcs=false", "-o", bin, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS="+runtime.GOOS, "GOARCH="+goarch, "CGO_ENABLED=0", "GOFLAGS=", "GOWORK=off", "GOTOOLCHAIN=local")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return bin
+}
+
+func TestVerifySelf(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	self := buildMain(t, selfModule, runtime.GOARCH)
+	if err := verifySelf(self, "(devel)"); err != nil {
+		t.Errorf("verifySelf of va: %v", err)
+	}
+	if err := verifySelf(self, "v1.0.0"); err == nil || !strings.Contains(err.Error(), "not "+selfModule+"@v1.0.0") {
+		t.Errorf("verifySelf of va at another version: %v, want it refused", err)
+	}
+	other := buildMain(t, "example.com/notva", runtime.GOARCH)
+	if err := verifySelf(other, "(devel)"); err == nil || !strings.Contains(err.Error(), "is example.com/notva@(devel)") {
+		t.Errorf("verifySelf of another module: %v, want it refused", err)
+	}
+	goarch := "amd64"
+	if runtime.GOARCH == goarch {
+		goarch = "arm64"
+	}
+	foreign := buildMain(t, selfModule, goarch)
+	if err := verifySelf(foreign, "(devel)"); err == nil || !strings.Contains(err.Error(), "GOARCH="+goarch) {
+		t.Errorf("verifySelf of va built for %s: %v, want it refused", goarch, err)
+	}
+	notBinary := writeTool(t, "#!/bin/sh\n")
+	if err := verifySelf(notBinary, "(devel)"); err == nil {
+		t.Error("verifySelf of a script succeeded, want it refused")
+	}
+}
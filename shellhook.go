@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// notFoundHooks are the scripts which have each shell ask va to run a
+// command which is not found, if a link would run it, by way of "va
+// __not-found". The flags given to va hook replace {{flags}}.
+var notFoundHooks = map[string]string{
+	"bash": `# va hook for bash, e.g. in ~/.bashrc: source <(va hook bash)
+command_not_found_handle() {
+	va __not-found{{flags}} -- "$@"
+}
+`,
+	"zsh": `# va hook for zsh, e.g. in ~/.zshrc: source <(va hook zsh)
+command_not_found_handler() {
+	va __not-found{{flags}} -- "$@"
+}
+`,
+	"fish": `# va hook for fish, e.g.: va hook fish > ~/.config/fish/conf.d/va.fish
+function fish_command_not_found
+	va __not-found{{flags}} -- $argv
+end
+`,
+}
+
+// cmdHook prints the hook for the shell.
+func cmdHook(links map[string]Link, args []string) error {
+	shells := make([]string, 0, len(notFoundHooks))
+	for shell := range notFoundHooks {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	fs := newFlagSet("hook", "hook [flags] <"+strings.Join(shells, "|")+">",
+		"Prints a hook which has the shell offer to run a command which is not found through va,\n"+
+			"if there is a link which would run it.")
+	auto := fs.Bool("auto", false, "run the link without asking")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one shell must be given")
+	}
+	script, ok := notFoundHooks[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown shell: %s", fs.Arg(0))
+	}
+	flags := ""
+	if *auto {
+		flags = " --auto"
+	}
+	_, err := io.WriteString(os.Stdout, strings.ReplaceAll(script, "{{flags}}", flags))
+	return err
+}
+
+// cmdNotFound runs the link which would run the command the shell could not
+// find, asking first unless --auto is given. If there is no such link, or
+// running it is declined, it fails as the shell would have, with 127. It is
+// run by the shell hooks, and is not meant to be run by hand.
+func cmdNotFound(links map[string]Link, args []string) error {
+	fs := newFlagSet("__not-found", "__not-found [flags] -- <command> [args...]", "")
+	auto := fs.Bool("auto", false, "run the link without asking")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return exitError(127)
+	}
+	name := fs.Arg(0)
+	short := linkNamed(links, name)
+	if short == "" {
+		fmt.Fprintf(os.Stderr, "%s: command not found\n", name)
+		return exitError(127)
+	}
+	if !*auto {
+		if !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+			fmt.Fprintf(os.Stderr, "%s: command not found, but \"va %s\" would run %s\n", name, short, links[short].Pkg)
+			return exitError(127)
+		}
+		fmt.Fprintf(os.Stderr, "%s: command not found, but va can run %s. Run it? [Y/n]: ", name, links[short].Pkg)
+		answer, err := readLine(bufio.NewReader(os.Stdin))
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if answer = strings.ToLower(answer); answer != "" && answer != "y" && answer != "yes" {
+			return exitError(127)
+		}
+	}
+	return runSingle(links, append([]string{short}, fs.Args()[1:]...))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// shimMarker is written into every shim, so that va only ever overwrites or
+// removes files it wrote itself.
+const shimMarker = "written by va shim"
+
+// shimDir returns where shims are written by default, ~/.local/bin, which is
+// on the PATH of most systems.
+func shimDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "bin"), nil
+}
+
+// shimPath returns the path of the shim for the link in the directory,
+// which is named after the last element of its short name, as va finds the
+// link it is run as by that alone.
+func shimPath(dir, short string, symlink bool) string {
+	name := path.Base(short)
+	if runtime.GOOS == "windows" && !symlink {
+		name += ".cmd"
+	}
+	return filepath.Join(dir, name)
+}
+
+// shimScript returns the script which runs the link through va, passing on
+// all of its arguments.
+func shimScript(short string) string {
+	if runtime.GOOS == "windows" {
+		return "@rem " + shimMarker + "\r\n@va run " + short + " -- %*\r\n"
+	}
+	return "#!/bin/sh\n# " + shimMarker + "\nexec va run " + shellQuote(short) + " -- \"$@\"\n"
+}
+
+// isShim reports whether the file was written by va shim, either as a script
+// or as a symlink to va.
+func isShim(name string) bool {
+	if target, err := os.Readlink(name); err == nil {
+		return strings.TrimSuffix(filepath.Base(target), ".exe") == "va"
+	}
+	b, err := os.ReadFile(name)
+	return err == nil && bytes.Contains(b, []byte(shimMarker))
+}
+
+// WriteShim writes a shim for the link into the directory, returning its
+// path. If symlink is set, the shim is a symlink to va, which runs the link
+// when run as its name. Files which are not shims are only overwritten if
+// force is set.
+func WriteShim(dir, short string, force, symlink bool) (string, error) {
+	name := shimPath(dir, short, symlink)
+	if _, err := os.Lstat(name); err == nil && !force && !isShim(name) {
+		return "", fmt.Errorf("%s exists, and is not a shim", name)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	if symlink {
+		self, err := os.Executable()
+		if err != nil {
+			return "", err
+		}
+		if self, err = filepath.EvalSymlinks(self); err != nil {
+			return "", err
+		}
+		tmp := name + ".tmp-shim"
+		os.Remove(tmp)
+		if err := os.Symlink(self, tmp); err != nil {
+			return "", err
+		}
+		return name, os.Rename(tmp, name)
+	}
+	if err := writeFileAtomic(name, []byte(shimScript(short))); err != nil {
+		return "", err
+	}
+	return name, os.Chmod(name, 0o755)
+}
+
+// RemoveShim removes the shim for the link from the directory, whether a
+// script or a symlink, refusing to remove anything which is not a shim.
+func RemoveShim(dir, short string) (string, error) {
+	name := shimPath(dir, short, false)
+	if _, err := os.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+		name = shimPath(dir, short, true)
+	}
+	if _, err := os.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%s: no such shim", name)
+	}
+	if !isShim(name) {
+		return "", fmt.Errorf("%s is not a shim", name)
+	}
+	return name, os.Remove(name)
+}
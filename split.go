@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// nextField returns the first field in s, along with the remainder of s
+// following that field. Fields are separated by spaces, and may be quoted
+// with single or double quotes to include spaces. Outside of single quotes,
+// a backslash escapes the character following it. Quotes and escapes are
+// removed from the returned field.
+func nextField(s string) (field, rest string, err error) {
+	s = strings.TrimLeft(s, " ")
+	var b strings.Builder
+	var quote rune
+	escaped := false
+	for i, r := range s {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			b.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ' ':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return "", "", errors.New("unterminated quote")
+	}
+	if escaped {
+		return "", "", errors.New("trailing backslash")
+	}
+	return b.String(), "", nil
+}
+
+// splitFields splits s into fields, as described by nextField.
+func splitFields(s string) ([]string, error) {
+	var fields []string
+	for strings.TrimLeft(s, " ") != "" {
+		field, rest, err := nextField(s)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+		s = rest
+	}
+	return fields, nil
+}
+
+// shellQuote quotes s, if needed, so that a POSIX shell treats it as a single
+// word with no special characters.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !strings.ContainsRune(shellSafe, r)
+	}) == -1 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellSafe are the characters which never need quoting in a POSIX shell.
+const shellSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789%+,-./:=@_"
+
+// joinFields joins the fields with spaces, quoting any which need it, such
+// that splitFields would split them up again.
+func joinFields(fields []string) string {
+	quoted := make([]string, len(fields))
+	for i, field := range fields {
+		if field != "" && !strings.ContainsAny(field, " \t\n'\"\\") {
+			quoted[i] = field
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(field, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
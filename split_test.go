@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFields(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		want    []string
+		wantErr string
+	}{
+		{s: "", want: nil},
+		{s: "   ", want: nil},
+		{s: "run ./...", want: []string{"run", "./..."}},
+		{s: "  a   b  ", want: []string{"a", "b"}},
+		{s: "a\tb", want: []string{"a\tb"}},
+		{s: `-f "a b" 'c d'`, want: []string{"-f", "a b", "c d"}},
+		{s: `a"b c"d`, want: []string{"ab cd"}},
+		{s: `'' ""`, want: []string{"", ""}},
+		{s: `a\ b \"c\" d\\e`, want: []string{"a b", `"c"`, `d\e`}},
+		{s: `'a\b' "a\"b"`, want: []string{`a\b`, `a"b`}},
+		{s: `"it's" 'say "hi"'`, want: []string{"it's", `say "hi"`}},
+		{s: `a "b`, wantErr: "unterminated quote"},
+		{s: `a 'b`, wantErr: "unterminated quote"},
+		{s: `a b\`, wantErr: "trailing backslash"},
+	} {
+		got, err := splitFields(tt.s)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("splitFields(%q) error = %v, want %q", tt.s, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitFields(%q): %v", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitFields(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, tt := range []struct {
+		s, want string
+	}{
+		{"build", "build"},
+		{"-o", "-o"},
+		{"CGO_ENABLED=0", "CGO_ENABLED=0"},
+		{"", "''"},
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{`-extldflags "-static"`, `'-extldflags "-static"'`},
+	} {
+		if got := shellQuote(tt.s); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestJoinFields(t *testing.T) {
+	for _, fields := range [][]string{
+		{"run", "./..."},
+		{"a b", "", "it's", `say "hi"`, `a\b`, "a\tb"},
+	} {
+		s := joinFields(fields)
+		if got, err := splitFields(s); err != nil || !reflect.DeepEqual(got, fields) {
+			t.Errorf("splitFields(joinFields(%q)) = %q, %v, want them back", fields, got, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sshSigNamespace is the namespace remote lists are signed in, which stops
+// a signature made for anything else from being passed off as one of a list:
+//
+//	ssh-keygen -Y sign -f ~/.ssh/id_ed25519 -n va team.list
+const sshSigNamespace = "va"
+
+// sshSigMagic begins both an SSH signature and the data it signs.
+const sshSigMagic = "SSHSIG"
+
+// parseSSHKey parses a public key in the form of a line of authorized_keys,
+// "ssh-ed25519 AAAA... comment", returning it in the SSH wire format. Only
+// Ed25519 keys are supported.
+func parseSSHKey(line string) ([]byte, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, errors.New("bad public key: must be as in authorized_keys, \"ssh-ed25519 AAAA...\"")
+	}
+	if fields[0] != "ssh-ed25519" {
+		return nil, fmt.Errorf("unsupported public key type: %s (only ssh-ed25519 is supported)", fields[0])
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("bad public key: %w", err)
+	}
+	if _, err := ed25519Key(blob); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// sshFingerprint returns the fingerprint of the key, in the SSH wire format,
+// as "ssh-keygen -l" shows it.
+func sshFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// ed25519Key returns the Ed25519 key from its SSH wire format.
+func ed25519Key(blob []byte) (ed25519.PublicKey, error) {
+	r := sshReader{b: blob}
+	keyType, key := r.string(), r.string()
+	if r.err != nil || string(keyType) != "ssh-ed25519" || len(key) != ed25519.PublicKeySize || len(r.b) != 0 {
+		return nil, errors.New("bad public key: not an Ed25519 key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifySSHSig verifies the armored SSH signature, as made by "ssh-keygen -Y
+// sign", is of the message, in va's namespace, by the key (in the SSH wire
+// format).
+func verifySSHSig(key, message, armored []byte) error {
+	blob, err := unarmorSSHSig(armored)
+	if err != nil {
+		return err
+	}
+	r := sshReader{b: blob}
+	magic := r.bytes(len(sshSigMagic))
+	version := r.uint32()
+	sigKey, namespace, reserved, hashAlg, sig := r.string(), r.string(), r.string(), r.string(), r.string()
+	if r.err != nil || string(magic) != sshSigMagic || len(r.b) != 0 {
+		return errors.New("bad signature")
+	}
+	if version != 1 {
+		return fmt.Errorf("unsupported signature version: %d", version)
+	}
+	if string(namespace) != sshSigNamespace {
+		return fmt.Errorf("signature is for %q, not %q (sign with -n %s)", namespace, sshSigNamespace, sshSigNamespace)
+	}
+	if !bytes.Equal(sigKey, key) {
+		return errors.New("signature is not by the key")
+	}
+	var digest []byte
+	switch string(hashAlg) {
+	case "sha512":
+		sum := sha512.Sum512(message)
+		digest = sum[:]
+	case "sha256":
+		sum := sha256.Sum256(message)
+		digest = sum[:]
+	default:
+		return fmt.Errorf("unsupported signature hash: %s", hashAlg)
+	}
+
+	sr := sshReader{b: sig}
+	sigType, sigBytes := sr.string(), sr.string()
+	if sr.err != nil || string(sigType) != "ssh-ed25519" {
+		return errors.New("bad signature")
+	}
+	pub, err := ed25519Key(key)
+	if err != nil {
+		return err
+	}
+	var signed []byte
+	signed = append(signed, sshSigMagic...)
+	signed = appendSSHString(signed, namespace)
+	signed = appendSSHString(signed, reserved)
+	signed = appendSSHString(signed, hashAlg)
+	signed = appendSSHString(signed, digest)
+	if !ed25519.Verify(pub, signed, sigBytes) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// unarmorSSHSig returns the signature within its armor.
+func unarmorSSHSig(armored []byte) ([]byte, error) {
+	const begin, end = "-----BEGIN SSH SIGNATURE-----", "-----END SSH SIGNATURE-----"
+	s := strings.TrimSpace(string(armored))
+	if !strings.HasPrefix(s, begin) || !strings.HasSuffix(s, end) {
+		return nil, errors.New("bad signature: not an SSH signature")
+	}
+	s = strings.Join(strings.Fields(s[len(begin):len(s)-len(end)]), "")
+	blob, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("bad signature: %w", err)
+	}
+	return blob, nil
+}
+
+// appendSSHString appends the string in the SSH wire format: its length,
+// then its bytes.
+func appendSSHString(b, s []byte) []byte {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(s)))
+	return append(append(b, n[:]...), s...)
+}
+
+// sshReader reads values in the SSH wire format, remembering the first
+// error, so that a run of reads need only be checked once.
+type sshReader struct {
+	b   []byte
+	err error
+}
+
+// bytes reads n bytes.
+func (r *sshReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || len(r.b) < n {
+		r.err = errors.New("short read")
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+// uint32 reads a big-endian 32-bit integer.
+func (r *sshReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// string reads a length-prefixed string.
+func (r *sshReader) string() []byte {
+	return r.bytes(int(r.uint32()))
+}
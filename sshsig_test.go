@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// The signatures are of testSignedList by testSSHKey, made by:
+//
+//	ssh-keygen -Y sign -f key -n va team.list
+const (
+	testSSHKey      = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIG2ZcrsWg9y/lF29OW+ff8dSNOpZVEhnKr4k52aUM5fQ va-test"
+	testOtherSSHKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHyAkbqLWDDy4KF2eNP6F3A8YSc7mlYKR3tJcJYLiGPR other"
+	testSignedList  = "hello example.com/hello@latest\n"
+	testListSig     = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgbZlyuxaD3L+UXb05b59/x1I06l
+lUSGcqviTnZpQzl9AAAAACdmEAAAAAAAAABnNoYTUxMgAAAFMAAAALc3NoLWVkMjU1MTkA
+AABA2StmHI0fN30hpdJMkIlaXJeNzXA+gyRX3wOU3SO5PHYpMYarHPZGY/eFVNl1XRpQU3
+IIpBqmwv1xb+V/SCWcAw==
+-----END SSH SIGNATURE-----
+`
+)
+
+// Signed with -O hashalg=sha256.
+const testListSigSHA256 = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgbZlyuxaD3L+UXb05b59/x1I06l
+lUSGcqviTnZpQzl9AAAAACdmEAAAAAAAAABnNoYTI1NgAAAFMAAAALc3NoLWVkMjU1MTkA
+AABAZq3dLkgIFYgXMSAEevS869b8eebMcxVu6o8YUNhlE1g91DEQuT93pGs/aDqxSmsqmp
+jJcm5g+Rma0RyYG+gzCw==
+-----END SSH SIGNATURE-----
+`
+
+// Signed with -n file, as files are by default.
+const testListSigFile = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgbZlyuxaD3L+UXb05b59/x1I06l
+lUSGcqviTnZpQzl9AAAAAEZmlsZQAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAEAE1DjBkqJSyMuK1z3J5JidJasUubMuMwJYnkjIs9Yq8LB0z3cE+k37/is4+VA7yZ
+LTFFN/6iQ+0oCNrmx/T9YH
+-----END SSH SIGNATURE-----
+`
+
+// armorSSHSig armors the signature, as ssh-keygen does.
+func armorSSHSig(blob []byte) string {
+	return "-----BEGIN SSH SIGNATURE-----\n" + base64.StdEncoding.EncodeToString(blob) + "\n-----END SSH SIGNATURE-----\n"
+}
+
+// resignedSSHSig returns the signature with its hash algorithm replaced.
+func resignedSSHSig(t *testing.T, armored, hashAlg string) string {
+	t.Helper()
+	blob, err := unarmorSSHSig([]byte(armored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := sshReader{b: blob}
+	out := append([]byte(nil), r.bytes(len(sshSigMagic)+4)...)
+	for _, field := range []string{"key", "namespace", "reserved", "hash"} {
+		s := r.string()
+		if field == "hash" {
+			s = []byte(hashAlg)
+		}
+		out = appendSSHString(out, s)
+	}
+	out = append(out, r.b...)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	return armorSSHSig(out)
+}
+
+func TestVerifySSHSig(t *testing.T) {
+	key, err := parseSSHKey(testSSHKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := parseSSHKey(testOtherSSHKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := unarmorSSHSig([]byte(testListSig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name    string
+		key     []byte
+		message string
+		sig     string
+		wantErr string
+	}{
+		{name: "signed", key: key, message: testSignedList, sig: testListSig},
+		{name: "sha256", key: key, message: testSignedList, sig: testListSigSHA256},
+		{name: "wrong namespace", key: key, message: testSignedList, sig: testListSigFile, wantErr: `signature is for "file", not "va" (sign with -n va)`},
+		{name: "wrong key", key: other, message: testSignedList, sig: testListSig, wantErr: "signature is not by the key"},
+		{name: "tampered message", key: key, message: "hello example.com/evil@latest\n", sig: testListSig, wantErr: "signature does not match"},
+		{name: "unsupported hash", key: key, message: testSignedList, sig: resignedSSHSig(t, testListSig, "sha1"), wantErr: "unsupported signature hash: sha1"},
+		{name: "hash changed", key: key, message: testSignedList, sig: resignedSSHSig(t, testListSig, "sha256"), wantErr: "signature does not match"},
+		{name: "truncated", key: key, message: testSignedList, sig: armorSSHSig(blob[:len(blob)-8]), wantErr: "bad signature"},
+		{name: "trailing data", key: key, message: testSignedList, sig: armorSSHSig(append(blob[:len(blob):len(blob)], 0)), wantErr: "bad signature"},
+		{name: "not armored", key: key, message: testSignedList, sig: base64.StdEncoding.EncodeToString(blob), wantErr: "bad signature: not an SSH signature"},
+		{name: "empty", key: key, message: testSignedList, sig: "", wantErr: "bad signature: not an SSH signature"},
+	} {
+		err := verifySSHSig(tt.key, []byte(tt.message), []byte(tt.sig))
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: verifySSHSig: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+			t.Errorf("%s: verifySSHSig = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseSSHKey(t *testing.T) {
+	for _, tt := range []struct {
+		line    string
+		wantErr string
+	}{
+		{line: testSSHKey},
+		{line: strings.TrimSuffix(testSSHKey, " va-test")},
+		{line: "ssh-ed25519", wantErr: "bad public key"},
+		{line: "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ", wantErr: "unsupported public key type: ssh-rsa"},
+		{line: "ssh-ed25519 !!!", wantErr: "bad public key"},
+		// A key of another type, claiming to be Ed25519.
+		{line: "ssh-ed25519 AAAAB3NzaC1yc2EAAAADAQABAAABAQ==", wantErr: "bad public key: not an Ed25519 key"},
+	} {
+		_, err := parseSSHKey(tt.line)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("parseSSHKey(%q): %v", tt.line, err)
+		case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+			t.Errorf("parseSSHKey(%q) = %v, want %q", tt.line, err, tt.wantErr)
+		}
+	}
+
+	key, err := parseSSHKey(testSSHKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As "ssh-keygen -l -f key.pub" shows it.
+	if got, want := sshFingerprint(key), "SHA256:p/WNASm+PtoYM/+Jo2DB6cmw9CKh8UfPjDeATkSMkPA"; got != want {
+		t.Errorf("sshFingerprint = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// objectsDir is the directory within the cache holding the binaries of the
+// tools, each named by the SHA-256 of its contents. The binaries in binDir
+// are hard links to these, so that identical binaries, such as the same
+// tool reached through different links, only take up space once.
+const objectsDir = "objects"
+
+// hashFile returns the SHA-256 of the contents of the file, in hex.
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// storeObject adds the binary to the store of objects, and returns the
+// SHA-256 of its contents. If an identical binary is already stored, the
+// binary is replaced with a hard link to that instead. Where hard links are
+// not supported, the binary is left as it is.
+func storeObject(cacheDir, name string) (string, error) {
+	sum, err := hashFile(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Join(cacheDir, objectsDir), 0o755); err != nil {
+		return "", err
+	}
+	// Either the binary is now stored, or hard links are not supported,
+	// unless an identical binary was stored already. A stored binary
+	// which has since been corrupted is replaced, rather than spreading
+	// the corruption to this tool.
+	obj := filepath.Join(cacheDir, objectsDir, sum)
+	err = os.Link(name, obj)
+	if errors.Is(err, fs.ErrExist) {
+		if objSum, hashErr := hashFile(obj); hashErr == nil && objSum != sum {
+			os.Remove(obj)
+			err = os.Link(name, obj)
+		}
+	}
+	if err == nil || !errors.Is(err, fs.ErrExist) {
+		return sum, nil
+	}
+
+	// Link to the stored binary via a temporary name, so that the binary
+	// is never missing, even for a moment.
+	link := name + ".link"
+	if err := os.Link(obj, link); err != nil {
+		return sum, nil
+	}
+	if err := os.Rename(link, name); err != nil {
+		os.Remove(link)
+		return "", err
+	}
+	return sum, nil
+}
+
+// gcObjects removes the objects no longer used by any of the tools in the
+// cache. Objects newer than gcTempAge are left alone, as they may belong to
+// a build which has not yet moved its entry into place.
+func gcObjects(cacheDir string, entries []cacheEntry) error {
+	used := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		used[entry.Meta.SHA256] = true
+	}
+	objects, err := os.ReadDir(filepath.Join(cacheDir, objectsDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if used[obj.Name()] {
+			continue
+		}
+		if info, err := obj.Info(); err != nil || time.Since(info.ModTime()) < gcTempAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(cacheDir, objectsDir, obj.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errNoChecksum is returned when verifying a tool built before checksums
+// were recorded.
+var errNoChecksum = errors.New("no checksum recorded")
+
+// verifyEntry checks that the binary of the tool in the cache directory
+// entryDir still has the SHA-256 recorded when it was built.
+func verifyEntry(entryDir string) error {
+	b, err := os.ReadFile(filepath.Join(entryDir, binMetaFile))
+	if err != nil {
+		return err
+	}
+	var meta ToolMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return err
+	}
+	if meta.SHA256 == "" {
+		return errNoChecksum
+	}
+	sum, err := hashFile(filepath.Join(entryDir, meta.Key.Binary()))
+	if err != nil {
+		return err
+	}
+	if sum != meta.SHA256 {
+		return fmt.Errorf("binary has SHA-256 %s, but %s was recorded when it was built: it has been modified or corrupted", sum, meta.SHA256)
+	}
+	return nil
+}
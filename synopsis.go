@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// synopsisFile is the file within the cache directory holding the synopses
+// of packages that have previously been looked up, keyed by Link.Pkg.
+const synopsisFile = "synopsis.json"
+
+// withSynopses returns the links with any missing descriptions filled in from
+// the synopsis of their package documentation. Looking up a synopsis means
+// downloading the module, so they are cached. Links whose synopsis cannot be
+// found, such as when offline, are left as they were.
+func withSynopses(ctx context.Context, links map[string]Link) map[string]Link {
+	synopses := make(map[string]string)
+	cacheFile := ""
+	if dir, err := OpenCache(); err != nil {
+		logWarnf("cache: %v", err)
+	} else {
+		cacheFile = filepath.Join(dir, synopsisFile)
+		if cached, err := readSynopses(cacheFile); err != nil {
+			logWarnf("synopsis cache: %v", err)
+		} else {
+			synopses = cached
+		}
+	}
+
+	updated := false
+	for _, link := range links {
+		if _, ok := synopses[link.Pkg]; ok || link.Desc != "" || isRewrite(link.Short) {
+			continue
+		}
+		m, err := Download(ctx, link.Pkg)
+		if err != nil {
+			logWarnf("synopsis: %s: %v", link.Short, err)
+			continue
+		}
+		synopsis, err := packageSynopsis(m.ToolDir())
+		if err != nil {
+			logWarnf("synopsis: %s: %v", link.Short, err)
+			continue
+		}
+		synopses[link.Pkg] = synopsis
+		updated = true
+	}
+
+	if updated && cacheFile != "" {
+		if err := writeSynopses(cacheFile, synopses); err != nil {
+			logWarnf("synopsis cache: %v", err)
+		}
+	}
+	return mergeSynopses(links, synopses)
+}
+
+// mergeSynopses returns a copy of the links, where those without a
+// description are described by the synopsis of their package, if known. A
+// description given in a list always takes precedence over a synopsis.
+func mergeSynopses(links map[string]Link, synopses map[string]string) map[string]Link {
+	merged := make(map[string]Link, len(links))
+	for short, link := range links {
+		if link.Desc == "" {
+			link.Desc = synopses[link.Pkg]
+		}
+		merged[short] = link
+	}
+	return merged
+}
+
+// packageSynopsis returns the synopsis of the documentation of the main
+// package in dir, which is the first sentence of it.
+func packageSynopsis(dir string) (string, error) {
+	notTest := func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, notTest, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	pkg, ok := pkgs["main"]
+	if !ok {
+		return "", fmt.Errorf("no main package in %s", dir)
+	}
+	for _, f := range pkg.Files {
+		if f.Doc != nil {
+			return doc.Synopsis(f.Doc.Text()), nil
+		}
+	}
+	return "", nil
+}
+
+// readSynopses reads the cache of synopses, which is empty if there is no
+// cache yet.
+func readSynopses(name string) (map[string]string, error) {
+	synopses := make(map[string]string)
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return synopses, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &synopses); err != nil {
+		return nil, err
+	}
+	return synopses, nil
+}
+
+// writeSynopses writes the cache of synopses.
+func writeSynopses(name string, synopses map[string]string) error {
+	b, err := json.MarshalIndent(synopses, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0o644)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeSynopses(t *testing.T) {
+	links := map[string]Link{
+		"hello": {Short: "hello", Pkg: "example.com/hello@latest"},
+		"given": {Short: "given", Pkg: "example.com/given@latest", Desc: "Described by the list"},
+		"none":  {Short: "none", Pkg: "example.com/none@latest"},
+	}
+	synopses := map[string]string{
+		"example.com/hello@latest": "Says hello.",
+		"example.com/given@latest": "Described by its package.",
+	}
+	got := mergeSynopses(links, synopses)
+	want := map[string]Link{
+		"hello": {Short: "hello", Pkg: "example.com/hello@latest", Desc: "Says hello."},
+		"given": {Short: "given", Pkg: "example.com/given@latest", Desc: "Described by the list"},
+		"none":  {Short: "none", Pkg: "example.com/none@latest"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeSynopses = %+v, want %+v", got, want)
+	}
+	if links["hello"].Desc != "" {
+		t.Errorf("mergeSynopses changed the links it was given")
+	}
+}
+
+func TestWithSynopses(t *testing.T) {
+	useTestProxy(t,
+		testModule{Path: "example.com/hello", Version: "v1.0.0", Files: map[string]string{
+			"main.go": "// Hello says hello to the world. It says nothing else.\npackage main\n",
+		}},
+		testModule{Path: "example.com/given", Version: "v1.0.0", Files: map[string]string{
+			"main.go": "// Given is described by its package.\npackage main\n",
+		}},
+		testModule{Path: "example.com/lib", Version: "v1.0.0", Files: map[string]string{
+			"lib.go": "// Package lib is not a command.\npackage lib\n",
+		}},
+	)
+	t.Setenv("VA_CACHE_DIR", t.TempDir())
+	ctx := context.Background()
+
+	links := map[string]Link{
+		"hello":   {Short: "hello", Pkg: "example.com/hello@latest"},
+		"given":   {Short: "given", Pkg: "example.com/given@latest", Desc: "Described by the list"},
+		"lib":     {Short: "lib", Pkg: "example.com/lib@latest"},
+		"missing": {Short: "missing", Pkg: "example.com/missing@latest"},
+	}
+	got := withSynopses(ctx, links)
+	want := map[string]Link{
+		"hello":   {Short: "hello", Pkg: "example.com/hello@latest", Desc: "Hello says hello to the world."},
+		"given":   {Short: "given", Pkg: "example.com/given@latest", Desc: "Described by the list"},
+		"lib":     {Short: "lib", Pkg: "example.com/lib@latest"},
+		"missing": {Short: "missing", Pkg: "example.com/missing@latest"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withSynopses = %+v, want %+v", got, want)
+	}
+
+	// Only the synopses which were looked up are remembered, so a
+	// description given in the list is never looked up at all.
+	dir, err := OpenCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := readSynopses(filepath.Join(dir, synopsisFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"example.com/hello@latest": "Hello says hello to the world."}; !reflect.DeepEqual(cached, want) {
+		t.Errorf("cached synopses = %v, want %v", cached, want)
+	}
+
+	// Offline, those remembered are still used, and those which would need
+	// to be fetched are left undescribed.
+	offline = true
+	t.Cleanup(func() { offline = false })
+	links["other"] = Link{Short: "other", Pkg: "example.com/given@v1.0.0"}
+	got = withSynopses(ctx, links)
+	want["other"] = Link{Short: "other", Pkg: "example.com/given@v1.0.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withSynopses offline = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// errNoRawMode is returned where the terminal cannot be put into raw mode.
+var errNoRawMode = errors.New("raw terminal mode is not supported on this platform")
+
+// makeRaw would put the terminal into raw mode, which is not supported here.
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, errNoRawMode
+}
+
+// terminalHeight would return the number of rows the terminal has, which
+// cannot be found here.
+func terminalHeight(f *os.File) (int, error) {
+	return 0, errNoRawMode
+}
+
+// terminalWidth would return the number of columns the terminal has, which
+// cannot be found here.
+func terminalWidth(f *os.File) (int, error) {
+	return 0, errNoRawMode
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses the subset of TOML which va's files use: tables, arrays
+// of tables, and keys (bare, quoted, or dotted) whose values are strings,
+// integers, floats, booleans, arrays (which may span lines), or inline
+// tables. Multi-line strings, and dates and times, are not supported.
+//
+// Tables are returned as map[string]interface{}, arrays as []interface{},
+// integers as int64, and floats as float64.
+func parseTOML(data string) (map[string]interface{}, error) {
+	root, _, err := parseTOMLHeaders(data)
+	return root, err
+}
+
+// parseTOMLHeaders parses the file as parseTOML does, also returning the
+// line of the first header of each table, keyed by its dotted name, so that
+// problems with a table can be reported where it is.
+func parseTOMLHeaders(data string) (root map[string]interface{}, headers map[string]int, _ error) {
+	p := &tomlParser{s: data, line: 1, headers: make(map[string]int), defined: make(map[string]bool)}
+	root = make(map[string]interface{})
+	if err := p.parse(root); err != nil {
+		return nil, nil, &tomlError{Line: p.line, Err: err}
+	}
+	return root, p.headers, nil
+}
+
+// tomlError is an error in a TOML file, on the line it was found on.
+type tomlError struct {
+	Line int
+	Err  error
+}
+
+func (e *tomlError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *tomlError) Unwrap() error {
+	return e.Err
+}
+
+// tomlParser is the state of parseTOML, as it works through the file.
+type tomlParser struct {
+	s       string
+	pos     int
+	line    int
+	headers map[string]int
+
+	// defined records the tables which have been given headers, keyed by
+	// tomlPath, as a table may only be given one. Those within an element
+	// of an array of tables are forgotten once the next element starts.
+	defined map[string]bool
+}
+
+// tomlPath joins the keys of a table into a single key, which unlike their
+// dotted name, cannot be confused with a key which itself has a dot in it.
+func tomlPath(keys []string) string {
+	return strings.Join(keys, "\x00")
+}
+
+// parse parses the whole file into the root table.
+func (p *tomlParser) parse(root map[string]interface{}) error {
+	table := root
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.s) {
+			return nil
+		}
+		var err error
+		if p.s[p.pos] == '[' {
+			table, err = p.parseHeader(root)
+		} else {
+			err = p.parseKeyValue(table)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseHeader parses a table header, "[a.b]", or the header of an element of
+// an array of tables, "[[a.b]]", returning the table that follows it.
+func (p *tomlParser) parseHeader(root map[string]interface{}) (map[string]interface{}, error) {
+	array := strings.HasPrefix(p.s[p.pos:], "[[")
+	if array {
+		p.pos += 2
+	} else {
+		p.pos++
+	}
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.s[p.pos:], closing) {
+		return nil, fmt.Errorf("expected %q after table name", closing)
+	}
+	p.pos += len(closing)
+	if name := strings.Join(keys, "."); p.headers[name] == 0 {
+		p.headers[name] = p.line
+	}
+
+	parent, err := tomlTable(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	table := make(map[string]interface{})
+	switch existing := parent[last].(type) {
+	case nil:
+		if array {
+			parent[last] = []interface{}{table}
+		} else {
+			parent[last] = table
+		}
+	case []interface{}:
+		if !array {
+			return nil, fmt.Errorf("%s is an array of tables, not a table", strings.Join(keys, "."))
+		}
+		parent[last] = append(existing, table)
+	case map[string]interface{}:
+		if array {
+			return nil, fmt.Errorf("%s is a table, not an array of tables", strings.Join(keys, "."))
+		}
+		if p.defined[tomlPath(keys)] {
+			return nil, fmt.Errorf("table %s is already defined", strings.Join(keys, "."))
+		}
+		// A table which was only made by a dotted key or header further
+		// in may be given its own header later.
+		table = existing
+	default:
+		return nil, fmt.Errorf("%s is already defined", strings.Join(keys, "."))
+	}
+
+	path := tomlPath(keys)
+	if array {
+		// The tables within the new element are yet to be defined.
+		for defined := range p.defined {
+			if strings.HasPrefix(defined, path+"\x00") {
+				delete(p.defined, defined)
+			}
+		}
+	} else {
+		p.defined[path] = true
+	}
+	return table, nil
+}
+
+// tomlTable returns the table at the keys within the root, making any
+// which do not yet exist. The last element of an array of tables stands for
+// the array.
+func tomlTable(root map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	table := root
+	for i, key := range keys {
+		switch v := table[key].(type) {
+		case nil:
+			next := make(map[string]interface{})
+			table[key], table = next, next
+		case map[string]interface{}:
+			table = v
+		case []interface{}:
+			last, ok := v[len(v)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not a table", strings.Join(keys[:i+1], "."))
+			}
+			table = last
+		default:
+			return nil, fmt.Errorf("%s is not a table", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return table, nil
+}
+
+// parseKeyValue parses "key = value" into the table.
+func (p *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipSpace(false)
+	if p.pos >= len(p.s) || p.s[p.pos] != '=' {
+		return fmt.Errorf("expected \"=\" after %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace(false)
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	parent, err := tomlTable(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := parent[last]; ok {
+		return fmt.Errorf("%s is already defined", strings.Join(keys, "."))
+	}
+	parent[last] = value
+	return nil
+}
+
+// parseKey parses a key, which may be dotted, returning each part of it.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		if p.pos >= len(p.s) {
+			return nil, errors.New("expected a key")
+		}
+		var key string
+		switch c := p.s[p.pos]; {
+		case c == '"' || c == '\'':
+			var err error
+			if key, err = p.parseString(); err != nil {
+				return nil, err
+			}
+		default:
+			start := p.pos
+			for p.pos < len(p.s) && isBareKeyChar(p.s[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("unexpected %q in key", c)
+			}
+			key = p.s[start:p.pos]
+		}
+		keys = append(keys, key)
+		p.skipSpace(false)
+		if p.pos >= len(p.s) || p.s[p.pos] != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+// isBareKeyChar reports whether the character may be in a key which is not
+// quoted.
+func isBareKeyChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// parseValue parses a value.
+func (p *tomlParser) parseValue() (interface{}, error) {
+	if p.pos >= len(p.s) {
+		return nil, errors.New("expected a value")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '"' || c == '\'':
+		return p.parseString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	}
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" \t\r\n,]}#", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	word := p.s[start:p.pos]
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, errors.New("expected a value")
+	}
+	digits := strings.ReplaceAll(word, "_", "")
+	// Decimal numbers may not have leading zeros, which would otherwise
+	// make strconv take "010" to be octal.
+	if unsigned := strings.TrimLeft(digits, "+-"); len(unsigned) > 1 && unsigned[0] == '0' && unsigned[1] >= '0' && unsigned[1] <= '9' {
+		return nil, fmt.Errorf("leading zeros are not allowed: %s", word)
+	}
+	if n, err := strconv.ParseInt(digits, 0, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(digits, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unsupported value: %s", word)
+}
+
+// parseString parses a basic string, in double quotes, or a literal one, in
+// single quotes, which has no escapes.
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.s[p.pos]
+	if strings.HasPrefix(p.s[p.pos:], strings.Repeat(string(quote), 3)) {
+		return "", errors.New("multi-line strings are not supported")
+	}
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\n':
+			return "", errors.New("unterminated string")
+		case c == '\\' && quote == '"':
+			r, err := p.parseEscape()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", errors.New("unterminated string")
+}
+
+// parseEscape parses an escape sequence in a basic string, such as "\n" or
+// "\u00e9".
+func (p *tomlParser) parseEscape() (rune, error) {
+	if p.pos+1 >= len(p.s) {
+		return 0, errors.New("unterminated string")
+	}
+	c := p.s[p.pos+1]
+	p.pos += 2
+	switch c {
+	case 'b':
+		return '\b', nil
+	case 't':
+		return '\t', nil
+	case 'n':
+		return '\n', nil
+	case 'f':
+		return '\f', nil
+	case 'r':
+		return '\r', nil
+	case '"', '\\':
+		return rune(c), nil
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return 0, errors.New("unterminated string")
+		}
+		code, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return 0, fmt.Errorf("bad escape: \\%c%s", c, p.s[p.pos:p.pos+n])
+		}
+		p.pos += n
+		return rune(code), nil
+	}
+	return 0, fmt.Errorf("bad escape: \\%c", c)
+}
+
+// parseArray parses an array, whose values may be spread over several lines.
+func (p *tomlParser) parseArray() ([]interface{}, error) {
+	p.pos++
+	values := []interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.s) {
+			return nil, errors.New("unterminated array")
+		}
+		if p.s[p.pos] == ']' {
+			p.pos++
+			return values, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		p.skipSpace(true)
+		if p.pos < len(p.s) && p.s[p.pos] == ',' {
+			p.pos++
+		} else if p.pos < len(p.s) && p.s[p.pos] != ']' {
+			return nil, errors.New("expected \",\" or \"]\" in array")
+		}
+	}
+}
+
+// parseInlineTable parses a table given on one line, such as "{ a = 1 }".
+func (p *tomlParser) parseInlineTable() (map[string]interface{}, error) {
+	p.pos++
+	table := make(map[string]interface{})
+	for {
+		p.skipSpace(false)
+		if p.pos < len(p.s) && p.s[p.pos] == '}' && len(table) == 0 {
+			p.pos++
+			return table, nil
+		}
+		if err := p.parseKeyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		if p.pos >= len(p.s) {
+			return nil, errors.New("unterminated inline table")
+		}
+		switch p.s[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, errors.New("expected \",\" or \"}\" in inline table")
+		}
+	}
+}
+
+// skipSpace skips spaces and tabs, and if newlines is set, comments and
+// newlines too.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case ' ', '\t', '\r':
+		case '\n':
+			if !newlines {
+				return
+			}
+			p.line++
+		case '#':
+			if !newlines {
+				return
+			}
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		default:
+			return
+		}
+		p.pos++
+	}
+}
+
+// endOfLine checks nothing but a comment follows on the line.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace(false)
+	if p.pos < len(p.s) && p.s[p.pos] == '#' {
+		for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+			p.pos++
+		}
+	}
+	if p.pos < len(p.s) && p.s[p.pos] != '\n' {
+		return fmt.Errorf("unexpected %q at the end of the line", p.s[p.pos])
+	}
+	return nil
+}
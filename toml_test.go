@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	type table = map[string]interface{}
+	type array = []interface{}
+	for _, tt := range []struct {
+		name    string
+		data    string
+		want    table
+		wantErr string
+	}{
+		{name: "empty", data: "", want: table{}},
+		{
+			name: "values",
+			data: "# A comment.\ns = \"a\" # Another.\nl = 'C:\\va'\ni = -1_000\nx = 0x1F\no = 0o17\nb = 0b101\nzero = 0\nf = 1.5e3\nt = true\nn = false\n",
+			want: table{"s": "a", "l": `C:\va`, "i": int64(-1000), "x": int64(31), "o": int64(15), "b": int64(5), "zero": int64(0), "f": 1500.0, "t": true, "n": false},
+		},
+		{
+			name: "escapes",
+			data: `s = "tab\there\nquote\" back\\ \u00e9 \U0001F600"`,
+			want: table{"s": "tab\there\nquote\" back\\ é 😀"},
+		},
+		{
+			name: "dotted keys",
+			data: "a.b = 1\na.c = 2\n\"x.y\".z = 3\n",
+			want: table{"a": table{"b": int64(1), "c": int64(2)}, "x.y": table{"z": int64(3)}},
+		},
+		{
+			name: "tables",
+			data: "[a]\nk = 1\n[a.b]\nk = 2\n[c . \"d e\"]\nk = 3\n",
+			want: table{"a": table{"k": int64(1), "b": table{"k": int64(2)}}, "c": table{"d e": table{"k": int64(3)}}},
+		},
+		{
+			name: "table after its subtable",
+			data: "[a.b]\nk = 2\n[a]\nk = 1\n",
+			want: table{"a": table{"k": int64(1), "b": table{"k": int64(2)}}},
+		},
+		{
+			name: "arrays of tables",
+			data: "[[tool]]\nname = \"a\"\n[tool.env]\nX = \"1\"\n[[tool]]\nname = \"b\"\n[tool.env]\nX = \"2\"\n",
+			want: table{"tool": array{
+				table{"name": "a", "env": table{"X": "1"}},
+				table{"name": "b", "env": table{"X": "2"}},
+			}},
+		},
+		{
+			name: "arrays",
+			data: "a = [1, \"two\", [3]]\nb = [\n  \"x\", # A comment.\n  \"y\",\n]\nc = []\n",
+			want: table{"a": array{int64(1), "two", array{int64(3)}}, "b": array{"x", "y"}, "c": array{}},
+		},
+		{
+			name: "inline tables",
+			data: "t = {a = 1, b.c = \"d\"}\ne = {}\n",
+			want: table{"t": table{"a": int64(1), "b": table{"c": "d"}}, "e": table{}},
+		},
+		{name: "duplicate key", data: "a = 1\nb = 2\na = 3\n", wantErr: "line 3: a is already defined"},
+		{name: "duplicate dotted key", data: "a.b = 1\na.b = 2\n", wantErr: "line 2: a.b is already defined"},
+		{name: "duplicate key in inline table", data: "t = {a = 1, a = 2}\n", wantErr: "line 1: a is already defined"},
+		{name: "duplicate table", data: "[a]\nk = 1\n\n[a]\nj = 2\n", wantErr: "line 4: table a is already defined"},
+		{name: "duplicate subtable", data: "[a]\n[a.b]\n[a.b]\n", wantErr: "line 3: table a.b is already defined"},
+		{name: "duplicate table in array element", data: "[[t]]\n[t.env]\n[t.env]\n", wantErr: "line 3: table t.env is already defined"},
+		{name: "table as array", data: "[a]\n[[a]]\n", wantErr: "line 2: a is a table, not an array of tables"},
+		{name: "array as table", data: "[[a]]\n[a]\n", wantErr: "line 2: a is an array of tables, not a table"},
+		{name: "table over value", data: "a = 1\n[a]\n", wantErr: "line 2: a is already defined"},
+		{name: "key under value", data: "a = 1\na.b = 2\n", wantErr: "line 2: a is not a table"},
+		{name: "leading zero", data: "a = 1\nb = 010\n", wantErr: "line 2: leading zeros are not allowed: 010"},
+		{name: "negative leading zero", data: "a = -007\n", wantErr: "line 1: leading zeros are not allowed: -007"},
+		{name: "leading zero float", data: "a = 01.5\n", wantErr: "line 1: leading zeros are not allowed: 01.5"},
+		{name: "bad escape", data: "\n\ns = \"\\q\"\n", wantErr: `line 3: bad escape: \q`},
+		{name: "bad unicode escape", data: `s = "\u00zz"`, wantErr: `line 1: bad escape: \u00zz`},
+		{name: "unterminated string", data: "s = \"abc\n", wantErr: "line 1: unterminated string"},
+		{name: "multi-line string", data: "s = \"\"\"\nabc\n\"\"\"\n", wantErr: "line 1: multi-line strings are not supported"},
+		{name: "unterminated array", data: "a = [\n1,\n2,\n", wantErr: "line 4: unterminated array"},
+		{name: "missing comma", data: "a = [\n1\n2]\n", wantErr: `line 3: expected "," or "]" in array`},
+		{name: "unterminated table header", data: "[a\n", wantErr: `line 1: expected "]" after table name`},
+		{name: "missing equals", data: "a 1\n", wantErr: `line 1: expected "=" after a`},
+		{name: "missing value", data: "a =\n", wantErr: "line 1: expected a value"},
+		{name: "unsupported value", data: "d = 1979-05-27\n", wantErr: "line 1: unsupported value: 1979-05-27"},
+		{name: "trailing text", data: "a = 1 2\n", wantErr: `line 1: unexpected '2' at the end of the line`},
+	} {
+		got, err := parseTOML(tt.data)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: parseTOML error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parseTOML: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseTOML = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTOMLHeaders(t *testing.T) {
+	_, headers, err := parseTOMLHeaders("a = 1\n\n[[tool]]\n[tool.env]\n\n[[tool]]\n[tool.env]\n[x.\"y.z\"]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"tool": 3, "tool.env": 4, "x.y.z": 8}
+	if !reflect.DeepEqual(headers, want) {
+		t.Errorf("parseTOMLHeaders headers = %v, want %v", headers, want)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSpans is how many spans are kept for exporting, so that a long running
+// va, such as the daemon, does not keep them all forever.
+const maxSpans = 4096
+
+// traceExportTimeout is how long exporting the spans may take, so that an
+// unreachable collector does not hold up va exiting.
+const traceExportTimeout = 5 * time.Second
+
+// tracer records spans covering each phase of running a tool, which are
+// exported to an OpenTelemetry collector over OTLP/HTTP as va exits. It is
+// configured with the standard OTEL_EXPORTER_OTLP_* environment variables,
+// and is nil unless an endpoint is set.
+var tracer = newTracer()
+
+// Tracer collects spans for exporting.
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+
+	mu    sync.Mutex
+	spans []*span
+}
+
+// span is a completed, or in progress, span of a trace.
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    []string // Alternating keys and values.
+	err      error
+}
+
+// spanKey is the context key for the current span.
+type spanKey struct{}
+
+// newTracer returns a tracer configured from the environment, or nil if
+// tracing is not enabled.
+func newTracer() *Tracer {
+	if disabled, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); disabled {
+		return nil
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	t := &Tracer{
+		endpoint: endpoint,
+		headers:  make(map[string]string),
+		service:  firstNonEmpty(os.Getenv("OTEL_SERVICE_NAME"), "va"),
+	}
+	for _, h := range []string{os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), os.Getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS")} {
+		for _, kv := range strings.Split(h, ",") {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				t.headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+	}
+	return t
+}
+
+// startSpan starts a span, as a child of the span in the context if there
+// is one, or of the span in $TRACEPARENT if not, so that va can take part in
+// a trace begun by whatever ran it. The attributes alternate between keys
+// and values. The returned function ends the span, recording the error if
+// there was one.
+func startSpan(ctx context.Context, name string, attrs ...string) (context.Context, func(error)) {
+	if tracer == nil {
+		return ctx, func(error) {}
+	}
+	s := &span{name: name, start: time.Now(), attrs: attrs}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else if traceID, parentID, ok := parseTraceparent(os.Getenv("TRACEPARENT")); ok {
+		s.traceID, s.parentID = traceID, parentID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+
+	return context.WithValue(ctx, spanKey{}, s), func(err error) {
+		s.end, s.err = time.Now(), err
+		tracer.mu.Lock()
+		defer tracer.mu.Unlock()
+		if len(tracer.spans) < maxSpans {
+			tracer.spans = append(tracer.spans, s)
+		}
+	}
+}
+
+// traceparent returns the W3C traceparent of the span in the context, for
+// passing on to the tool, or "" if there is none.
+func traceparent(ctx context.Context) string {
+	s, ok := ctx.Value(spanKey{}).(*span)
+	if !ok {
+		return ""
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-01"
+}
+
+// parseTraceparent parses a W3C traceparent, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func parseTraceparent(s string) (traceID [16]byte, spanID [8]byte, ok bool) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, spanID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, spanID, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+		return traceID, spanID, false
+	}
+	return traceID, spanID, true
+}
+
+// flushTracing exports the spans recorded so far, if tracing is enabled.
+func flushTracing() {
+	if tracer == nil {
+		return
+	}
+	if err := tracer.export(); err != nil {
+		logWarnf("trace: %v", err)
+	}
+}
+
+// export sends the spans recorded so far to the collector, using the JSON
+// encoding of OTLP.
+func (t *Tracer) export() error {
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	type value struct {
+		StringValue string `json:"stringValue"`
+	}
+	type attribute struct {
+		Key   string `json:"key"`
+		Value value  `json:"value"`
+	}
+	attributes := func(kvs []string) []attribute {
+		var attrs []attribute
+		for i := 0; i+1 < len(kvs); i += 2 {
+			attrs = append(attrs, attribute{Key: kvs[i], Value: value{kvs[i+1]}})
+		}
+		return attrs
+	}
+	type status struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	type otlpSpan struct {
+		TraceID      string      `json:"traceId"`
+		SpanID       string      `json:"spanId"`
+		ParentSpanID string      `json:"parentSpanId,omitempty"`
+		Name         string      `json:"name"`
+		Kind         int         `json:"kind"`
+		Start        string      `json:"startTimeUnixNano"`
+		End          string      `json:"endTimeUnixNano"`
+		Attributes   []attribute `json:"attributes,omitempty"`
+		Status       status      `json:"status"`
+	}
+	var out []otlpSpan
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID:    hex.EncodeToString(s.traceID[:]),
+			SpanID:     hex.EncodeToString(s.spanID[:]),
+			Name:       s.name,
+			Kind:       1, // Internal.
+			Start:      strconv.FormatInt(s.start.UnixNano(), 10),
+			End:        strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes: attributes(s.attrs),
+		}
+		if s.parentID != ([8]byte{}) {
+			o.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != nil {
+			o.Status = status{Code: 2, Message: s.err.Error()}
+		}
+		out = append(out, o)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": attributes([]string{"service.name", t.service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "github.com/dotwaffle/va"},
+				"spans": out,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", t.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// rootCtx is the context holding the span covering the whole of this run of
+// va, which everything else should be derived from.
+var rootCtx = context.Background()
+
+// endRootSpan ends the span covering the whole of this run of va.
+var endRootSpan = func(error) {}
+
+// startRootSpan starts the span covering the whole of this run of va.
+func startRootSpan(args []string) {
+	rootCtx, endRootSpan = startSpan(context.Background(), "va", "va.args", strings.Join(args, " "))
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// trustFile is the file within va's state directory recording which tools
+// have been trusted to run, and which have not. It is not kept in the cache,
+// so that purging the cache does not forget the tools which were refused.
+const trustFile = "trust.json"
+
+var flagYes = flag.Bool("yes", envBool("VA_YES", false), "trust tools which have never been run before, without asking (or set $VA_YES)")
+
+// TrustDecision records whether a tool was trusted to run, when it was first
+// going to be.
+type TrustDecision struct {
+	Trusted bool
+	Version string // Version the tool was asked for at.
+	Origin  string // Where the tool was asked for, such as the link's list.
+	Time    time.Time
+}
+
+// trustPath returns the path of the trust store.
+func trustPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, trustFile), nil
+}
+
+// readTrust reads the trust store, which maps package paths of tools to the
+// decisions made about them. Until there is a trust store, every tool in the
+// history of runs is trusted, as it was run before trust was asked for.
+func readTrust(cacheDir string) (map[string]TrustDecision, error) {
+	name, err := trustPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return trustFromHistory(cacheDir), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	store := make(map[string]TrustDecision)
+	if err := json.Unmarshal(b, &store); err != nil {
+		return nil, fmt.Errorf("%s: %w", trustFile, err)
+	}
+	return store, nil
+}
+
+// updateTrust changes the trust store with the function, holding the lock
+// on it throughout so that concurrent changes are not lost.
+func updateTrust(cacheDir string, update func(store map[string]TrustDecision) error) error {
+	name, err := trustPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return err
+	}
+	lockFile, err := lock(context.Background(), name+".lock", nil)
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	store, err := readTrust(cacheDir)
+	if err != nil {
+		return err
+	}
+	if err := update(store); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(store, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, append(b, '\n'))
+}
+
+// checkTrust checks the tool is trusted to run, asking whether it is if it
+// has never been run before, and remembering the answer. All tools are
+// trusted if --yes is given. Otherwise, the question is asked at the
+// terminal va was run from, even if stdin is not it, as it is not for "va
+// exec --stdin"; without one, a tool which has never been run before is
+// refused.
+func checkTrust(cacheDir string, link Link, mod string) error {
+	pkgPath, version, _ := strings.Cut(mod, "@")
+	origin := "the command line"
+	if link.Short != "" {
+		origin = "link " + link.Short + " in " + link.Origin()
+	}
+	store, err := readTrust(cacheDir)
+	if err != nil {
+		return fmt.Errorf("trust: %w", err)
+	}
+	if d, ok := store[pkgPath]; ok {
+		if !d.Trusted {
+			return fmt.Errorf("%s was not trusted to run on %s (see \"va trust\")", pkgPath, d.Time.Format("2006-01-02"))
+		}
+		return nil
+	}
+
+	trusted := *flagYes
+	if !trusted {
+		in := os.Stdin
+		if !isTerminal(in) {
+			if tty, err := openTerminal(); err == nil {
+				defer tty.Close()
+				in = tty
+			}
+		}
+		if !isTerminal(in) || !isTerminal(os.Stderr) {
+			return fmt.Errorf("%s has never been run before, so must be trusted at a terminal first, or run with --yes", pkgPath)
+		}
+		fmt.Fprintf(os.Stderr, "%s has never been run before.\n  version: %s\n  from:    %s\nDownload and run it? [y/N]: ", pkgPath, version, origin)
+		answer, err := readLine(bufio.NewReader(in))
+		if err != nil && err != io.EOF {
+			return err
+		}
+		answer = strings.ToLower(answer)
+		trusted = answer == "y" || answer == "yes"
+	}
+	err = updateTrust(cacheDir, func(store map[string]TrustDecision) error {
+		store[pkgPath] = TrustDecision{Trusted: trusted, Version: version, Origin: origin, Time: time.Now()}
+		return nil
+	})
+	if err != nil {
+		logWarnf("trust: %v", err)
+	}
+	if !trusted {
+		return fmt.Errorf("%s is not trusted to run", pkgPath)
+	}
+	return nil
+}
+
+// openTerminal opens the terminal va was run from, if it was, to ask at
+// whatever stdin is.
+func openTerminal() (*os.File, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return os.Open("CONIN$")
+	case "plan9":
+		return os.Open("/dev/cons")
+	}
+	return os.Open("/dev/tty")
+}
+
+// trustFromHistory trusts every tool which was run successfully enough to
+// be recorded in the history of runs.
+func trustFromHistory(cacheDir string) map[string]TrustDecision {
+	store := make(map[string]TrustDecision)
+	if cacheDir == "" {
+		return store
+	}
+	runs, _ := readHistory(cacheDir)
+	for _, run := range runs {
+		if run.ExitCode < 0 {
+			continue
+		}
+		pkgPath, version, _ := strings.Cut(run.Tool, "@")
+		store[pkgPath] = TrustDecision{Trusted: true, Version: version, Origin: "history", Time: run.Start}
+	}
+	return store
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListVerification is the outcome of building the tool of a link, for va
+// verify-lists.
+type ListVerification struct {
+	Short    string
+	Pkg      string
+	Version  string `json:",omitempty"` // The version the package resolved to.
+	Location string // Where the link is defined.
+	Error    string `json:",omitempty"`
+	Took     time.Duration
+
+	// Skipped says why the link was not built, if it was not, such as it
+	// being for other systems.
+	Skipped string `json:",omitempty"`
+}
+
+// VerifyLinks resolves, downloads, and builds the tool of each link, as many
+// at once as jobs allows, returning the outcome for each, in order. Tools
+// which are already cached for the toolchain have been built already, so are
+// not built again. Links for other systems are skipped, as their tools may
+// not build on this one.
+func VerifyLinks(cacheDir string, links []Link, jobs int) []ListVerification {
+	results := make([]ListVerification, len(links))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, link := range links {
+		if !link.supported() {
+			results[i] = ListVerification{Short: link.Short, Pkg: link.Pkg, Location: link.Location(), Skipped: platformNote(link)}
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, link Link) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			logVerbosef("verify-lists: building %s (%s)", link.Short, link.Pkg)
+			start := time.Now()
+			ctx, cancel := withTimeout(rootCtx, *flagTimeout)
+			m, err := Prefetch(ctx, cacheDir, link.Pkg, linkBuildOptions(link))
+			cancel()
+			results[i] = ListVerification{
+				Short:    link.Short,
+				Pkg:      link.Pkg,
+				Version:  m.Version,
+				Location: link.Location(),
+				Took:     time.Since(start),
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, link)
+	}
+	wg.Wait()
+	return results
+}
+
+// verifiableLinks returns the links to verify, in order of their short
+// names: those from the sources named, or from every source if none are,
+// leaving out rewrite rules, which are not of any one tool, and aliases
+// which could not be resolved.
+func verifiableLinks(lint *ListLint, sources map[string]bool) []Link {
+	var links []Link
+	for _, link := range sortedLinks(lint.Links, nil) {
+		if len(sources) > 0 && !sources[link.Source] || link.Pkg == "" || isRewrite(link.Short) {
+			continue
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// changedLinks returns those of the links whose definitions have changed
+// since the git ref, in the repository each list file is in: for a list file
+// in TOML, any line of a link's table, or for the first format, its line. A
+// list file git does not track is new, so every link in it has changed.
+func changedLinks(ctx context.Context, lint *ListLint, links []Link, ref string) ([]Link, error) {
+	// A link's table runs until the next one's header.
+	ends := make(map[string]int)
+	for _, link := range links {
+		ends[link.Short] = link.Line
+	}
+	byFile := make(map[string][]Link)
+	for _, link := range lint.Links {
+		if filepath.Ext(link.File) == ".toml" {
+			key := link.Source + ":" + link.File
+			byFile[key] = append(byFile[key], link)
+		}
+	}
+	for _, fileLinks := range byFile {
+		sort.Slice(fileLinks, func(i, j int) bool { return fileLinks[i].Line < fileLinks[j].Line })
+		for i, link := range fileLinks {
+			ends[link.Short] = math.MaxInt
+			if i+1 < len(fileLinks) {
+				ends[link.Short] = fileLinks[i+1].Line - 1
+			}
+		}
+	}
+
+	changed := make(map[string][]lineRange)
+	var found []Link
+	for _, link := range links {
+		path := link.Path
+		if path == "" {
+			return nil, fmt.Errorf("%s: %s: changes can only be found in list files on disk", link.Short, link.Origin())
+		}
+		ranges, ok := changed[path]
+		if !ok {
+			var err error
+			if ranges, err = gitChangedLines(ctx, path, ref); err != nil {
+				return nil, err
+			}
+			changed[path] = ranges
+		}
+		for _, r := range ranges {
+			if r.first <= ends[link.Short] && link.Line <= r.last {
+				found = append(found, link)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// lineRange is a range of lines of a file, from first to last, inclusive.
+type lineRange struct {
+	first, last int
+}
+
+// reHunk matches the header of a hunk of a unified diff, capturing where the
+// lines it changes are in the new file.
+var reHunk = regexp.MustCompile(`^@@ -[0-9]+(?:,[0-9]+)? \+([0-9]+)(?:,([0-9]+))? @@`)
+
+// gitChangedLines returns the ranges of lines of the file which have changed
+// since the git ref, in its working tree. Lines which were removed count as
+// a change to the line before them. A file git does not track has changed
+// throughout.
+func gitChangedLines(ctx context.Context, path, ref string) ([]lineRange, error) {
+	dir, base := filepath.Dir(path), filepath.Base(path)
+	var stderr bytes.Buffer
+	cmd := gitCommand(ctx, dir, "ls-files", "--error-unmatch", "--", base)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// git exits with 1 for a file it does not track, but with
+		// another code for one outside a repository.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return []lineRange{{1, math.MaxInt}}, nil
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git: %s", msg)
+		}
+		return nil, fmt.Errorf("git: %w", err)
+	}
+	stderr.Reset()
+	cmd = gitCommand(ctx, dir, "diff", "--unified=0", "--no-color", "--no-ext-diff", ref, "--", base)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git diff %s: %s", ref, msg)
+		}
+		return nil, fmt.Errorf("git diff %s: %w", ref, err)
+	}
+	var ranges []lineRange
+	for _, line := range strings.Split(string(out), "\n") {
+		m := reHunk.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		first, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		if count == 0 {
+			count = 1
+		}
+		ranges = append(ranges, lineRange{first, first + count - 1})
+	}
+	return ranges, nil
+}
+
+// gitCommand returns the git command with the arguments, run in dir.
+func gitCommand(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	logCommand(cmd)
+	return cmd
+}
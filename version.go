@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"runtime"
+	"runtime/debug"
+	"sort"
+)
+
+// VersionInfo describes the build of va which is running, and the lists of
+// links embedded in it, so that a bug report can say exactly which va, and
+// which links, it is about.
+type VersionInfo struct {
+	Version   string // Version of va, or "(devel)" if built from source.
+	GoVersion string
+	Platform  string // GOOS/GOARCH va was built for.
+	Revision  string `json:",omitempty"` // Commit va was built from, if known.
+	Time      string `json:",omitempty"` // Time of the commit, if known.
+	Modified  bool   `json:",omitempty"` // Whether there were changes not yet committed.
+	Lists     ListsInfo
+}
+
+// ListsInfo describes the lists of links embedded in va.
+type ListsInfo struct {
+	Hash  string // SHA-256 of the names and contents of the list files.
+	Files int
+	Links int
+}
+
+// versionInfo returns the version information of va.
+func versionInfo() (VersionInfo, error) {
+	info := VersionInfo{
+		Version:   "(devel)",
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Version != "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Revision = s.Value
+			case "vcs.time":
+				info.Time = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	lists, err := hashLists(listfs)
+	if err != nil {
+		return info, err
+	}
+	info.Lists = lists
+	return info, nil
+}
+
+// hashLists hashes the list files in the filesystem, in order of their
+// names, so that the same lists always give the same hash.
+func hashLists(f fs.FS) (ListsInfo, error) {
+	var names []string
+	err := fs.WalkDir(f, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, ok := listPrefix(name); ok && !d.IsDir() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return ListsInfo{}, err
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		b, err := fs.ReadFile(f, name)
+		if err != nil {
+			return ListsInfo{}, err
+		}
+		// The name and length come first, so that content cannot move
+		// from one file to the next without changing the hash.
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(b))
+		h.Write(b)
+	}
+	links, err := fsToLinks(f)
+	if err != nil {
+		return ListsInfo{}, err
+	}
+	return ListsInfo{
+		Hash:  hex.EncodeToString(h.Sum(nil)),
+		Files: len(names),
+		Links: len(links),
+	}, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// ToolVersion is a version of the module containing a tool.
+type ToolVersion struct {
+	Version    string
+	Pinned     bool // The version the tool was asked for resolves to this.
+	Downloaded bool // The module is in the module cache at this version.
+	Built      bool // The tool has been built at this version.
+}
+
+// ToolVersions lists the versions of the module containing the tool, which
+// is given as a package path and the version to mark as pinned, which may be
+// a query such as "latest". Pre-releases are only listed if pre is set, and
+// pseudo-versions only if pseudo is set, except for the pinned version,
+// which is always listed. When offline, only versions found in the module
+// cache are listed.
+func ToolVersions(ctx context.Context, cacheDir, mod string, pre, pseudo bool) (string, []ToolVersion, error) {
+	pkgPath, _, _ := strings.Cut(mod, "@")
+	modCache, err := GoModCache(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	m, _, err := locateTool(ctx, cacheDir, mod)
+	if err != nil {
+		return "", nil, err
+	}
+	modPath, pinned := m.Path, m.Version
+
+	versions := make(map[string]*ToolVersion)
+	add := func(v string) *ToolVersion {
+		if versions[v] == nil {
+			versions[v] = &ToolVersion{Version: v}
+		}
+		return versions[v]
+	}
+	add(pinned).Pinned = true
+	if !offline {
+		remote, err := moduleVersions(ctx, modPath)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, v := range remote {
+			add(v)
+		}
+	}
+	downloaded, err := downloadedVersions(modCache, modPath)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, v := range downloaded {
+		add(v).Downloaded = true
+	}
+	if cacheDir != "" {
+		entries, err := cacheEntries(cacheDir)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, entry := range entries {
+			if entry.ToolPath() == pkgPath && entry.Meta.Key.Path == modPath {
+				add(entry.Meta.Key.Version).Built = true
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(versions))
+	for v, tv := range versions {
+		switch {
+		case tv.Pinned:
+		case module.IsPseudoVersion(v) && !pseudo:
+			continue
+		case semver.Prerelease(v) != "" && !module.IsPseudoVersion(v) && !pre:
+			continue
+		}
+		sorted = append(sorted, v)
+	}
+	semver.Sort(sorted)
+	list := make([]ToolVersion, len(sorted))
+	for i, v := range sorted {
+		list[i] = *versions[v]
+	}
+	return modPath, list, nil
+}
+
+// moduleVersions lists the tagged versions of the module, including any which
+// have been retracted, asking the module proxy if it can answer, or the go
+// command if not.
+func moduleVersions(ctx context.Context, modPath string) ([]string, error) {
+	if proxy, err := NewProxyClient(ctx); err == nil {
+		versions, err := proxy.Versions(ctx, modPath)
+		if !errors.Is(err, errNoProxy) {
+			return versions, err
+		}
+	}
+	mod, err := goListModule(ctx, modPath, "-versions", "-retracted")
+	return mod.Versions, err
+}
+
+// downloadedVersions lists the versions of the module in the module cache.
+func downloadedVersions(modCache, modPath string) ([]string, error) {
+	encPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(filepath.Join(modCache, "cache", "download", filepath.FromSlash(encPath), "@v"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, f := range files {
+		encVersion := strings.TrimSuffix(f.Name(), ".ziphash")
+		if encVersion == f.Name() {
+			continue
+		}
+		if v, err := module.UnescapeVersion(encVersion); err == nil && semver.IsValid(v) {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}